@@ -0,0 +1,139 @@
+// Command spider runs spider for local development.
+//
+//	spider dev -f flows/
+//
+// dev runs an embedded NATS server, in-memory or SQLite storage, the
+// workflow engine and the workflow API in one process, so nothing else
+// needs to be running. Flows given with -f are imported and activated at
+// start, and the echo action is handled in process.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spiderdev"
+)
+
+// echoActionID is handled by spider dev itself, sending back its input
+// with the success meta output.
+const echoActionID = "echo"
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"dev", "dev [-f FILE|DIR...] [--sqlite PATH]", "Run the workflow engine, API and NATS in one process", runDev},
+}
+
+func main() {
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+
+		if cmd.name != os.Args[1] {
+			continue
+		}
+
+		err := cmd.run(ctx, os.Args[2:])
+
+		switch {
+		case err == nil:
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(2)
+		default:
+			fmt.Fprintln(os.Stderr, "spider:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "spider: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: spider COMMAND [ARGS]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", cmd.usage, cmd.summary)
+	}
+}
+
+func runDev(ctx context.Context, args []string) error {
+	var files filesFlag
+
+	fs := flag.NewFlagSet("spider dev", flag.ContinueOnError)
+	fs.Var(&files, "f", "flow document, or directory of them, to import and activate at start; repeatable")
+	addr := fs.String("addr", "127.0.0.1:8080", "address of the workflow API")
+	sqlitePath := fs.String("sqlite", "", "SQLite database keeping flows and runs; in memory when empty")
+	natsPort := fs.Int("nats-port", 4222, "port of the embedded NATS server; 0 picks a free one")
+	tenantID := fs.String("tenant", "dev", "tenant of the imported flows")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	server := spiderdev.NewServer(spiderdev.ServerOpt{
+		Addr:       *addr,
+		SQLitePath: *sqlitePath,
+		NATSPort:   *natsPort,
+	})
+
+	server.Handle(echoActionID, func(c spider.InputMessageContext, m spider.InputMessage) error {
+		slog.Info("[echo] received input", slog.String("key", m.Key), slog.String("values", m.Values))
+
+		return c.SendOutput("success", m.Values)
+	})
+
+	err = server.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = server.ImportFlowFiles(ctx, *tenantID, files...)
+	if err == nil {
+		<-ctx.Done()
+	}
+
+	return errors.Join(err, server.Close(context.Background()))
+}
+
+// filesFlag collects the values of a flag given more than once.
+type filesFlag []string
+
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filesFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+// client calls the workflow REST API on behalf of a tenant.
+type client struct {
+	server   string
+	tenantID string
+	http     *http.Client
+}
+
+// apiError is an error response of the workflow API.
+type apiError struct {
+	Status  int
+	Message string               `json:"error"`
+	Fields  []usecase.FieldError `json:"fields"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s (%d):", e.Message, e.Status)
+
+	for _, field := range e.Fields {
+		fmt.Fprintf(&b, "\n  %s: %s", field.Field, field.Message)
+	}
+
+	return b.String()
+}
+
+func isNotFound(err error) bool {
+	var aerr *apiError
+	return errors.As(err, &aerr) && aerr.Status == http.StatusNotFound
+}
+
+// tenantPath returns the path of a resource of the tenant, escaping each
+// segment.
+func (c *client) tenantPath(segments ...string) string {
+	escaped := []string{"tenants", url.PathEscape(c.tenantID)}
+
+	for _, segment := range segments {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+
+	return "/" + strings.Join(escaped, "/")
+}
+
+// do sends body as JSON, unless it is nil, and decodes the JSON response
+// into out, unless out is nil.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body any, out any) error {
+	var reader io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(b)
+	}
+
+	u := strings.TrimSuffix(c.server, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		aerr := &apiError{Status: res.StatusCode}
+
+		err := json.Unmarshal(data, aerr)
+		if err != nil || aerr.Message == "" {
+			aerr.Message = strings.TrimSpace(string(data))
+		}
+
+		if aerr.Message == "" {
+			aerr.Message = http.StatusText(res.StatusCode)
+		}
+
+		return aerr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
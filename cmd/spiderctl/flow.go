@@ -0,0 +1,695 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/r3labs/diff/v3"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+type applyResult struct {
+	ID      string `json:"id"`
+	Result  string `json:"result"`
+	Version uint64 `json:"version,omitempty"`
+}
+
+func runApply(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("apply", env)
+
+	var files filesFlag
+	fs.Var(&files, "f", "flow document, directory of documents, or - for stdin (repeatable)")
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	docs, err := readDocuments(files)
+	if err != nil {
+		return err
+	}
+
+	var results []applyResult
+
+	for _, doc := range docs {
+		result := applyResult{
+			ID:     doc.ID,
+			Result: "configured",
+		}
+
+		remote, err := exportFlow(ctx, c, doc.ID)
+
+		switch {
+		case isNotFound(err):
+			result.Result = "created"
+		case err != nil:
+			return err
+		default:
+			changes, err := diffDocuments(remote, doc)
+			if err != nil {
+				return err
+			}
+
+			if len(changes) == 0 {
+				result.Result = "unchanged"
+				results = append(results, result)
+
+				if p.format == outputTable {
+					fmt.Fprintf(p.w, "flow/%s unchanged\n", doc.ID)
+				}
+
+				continue
+			}
+		}
+
+		var flow spider.Flow
+
+		err = c.do(ctx, http.MethodPost, c.tenantPath("flows", "import"), nil, doc, &flow)
+		if err != nil {
+			return fmt.Errorf("flow/%s: %w", doc.ID, err)
+		}
+
+		result.Version = flow.Version
+		results = append(results, result)
+
+		if p.format == outputTable {
+			fmt.Fprintf(p.w, "flow/%s %s (version %d)\n", doc.ID, result.Result, flow.Version)
+		}
+	}
+
+	if p.format == outputJSON {
+		return p.json(results)
+	}
+
+	return nil
+}
+
+func runGet(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("get", env)
+	page := fs.Int("page", 1, "page number")
+	pageSize := fs.Int("page-size", 20, "flows per page, up to 100")
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	args, err = requireResource(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"page":      {strconv.Itoa(*page)},
+		"page_size": {strconv.Itoa(*pageSize)},
+	}
+
+	var list spider.FlowListResponse
+
+	err = c.do(ctx, http.MethodGet, c.tenantPath("flows"), query, nil, &list)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(list)
+	}
+
+	var rows [][]string
+
+	for _, flow := range list.Flows {
+		rows = append(rows, []string{
+			flow.ID,
+			flow.Name,
+			orDash(string(flow.TriggerType)),
+			string(flow.Status),
+			strconv.FormatUint(flow.Version, 10),
+		})
+	}
+
+	return p.table([]string{"ID", "NAME", "TRIGGER", "STATUS", "VERSION"}, rows)
+}
+
+// flowDescription is the JSON output of describe.
+type flowDescription struct {
+	*usecase.FlowDocument
+	Status          spider.FlowStatus `json:"status"`
+	Version         uint64            `json:"version"`
+	DisabledActions []string          `json:"disabled_actions,omitempty"`
+}
+
+func runDescribe(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("describe", env)
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	args, err = requireResource(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	var detail usecase.FlowDetailResponse
+
+	err = c.do(ctx, http.MethodGet, c.tenantPath("flows", args[0]), nil, nil, &detail)
+	if err != nil {
+		return err
+	}
+
+	doc, err := exportFlow(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+
+	description := flowDescription{
+		FlowDocument: doc,
+		Status:       detail.Status,
+		Version:      detail.Version,
+	}
+
+	for _, action := range detail.Actions {
+		if action.Disabled {
+			description.DisabledActions = append(description.DisabledActions, action.Key)
+		}
+	}
+
+	if p.format == outputJSON {
+		return p.json(description)
+	}
+
+	var meta []string
+
+	for _, key := range slices.Sorted(maps.Keys(doc.Meta)) {
+		meta = append(meta, key+"="+doc.Meta[key])
+	}
+
+	err = p.fields([][2]string{
+		{"ID", doc.ID},
+		{"Name", doc.Name},
+		{"Trigger type", orDash(string(doc.TriggerType))},
+		{"Status", string(detail.Status)},
+		{"Version", strconv.FormatUint(detail.Version, 10)},
+		{"Deadline", durationOrDash(doc.Deadline)},
+		{"Retention", durationOrDash(doc.Retention)},
+		{"Meta", orDash(strings.Join(meta, ", "))},
+	})
+	if err != nil {
+		return err
+	}
+
+	var actions [][]string
+
+	for _, action := range doc.Actions {
+		join := "-"
+		if action.Join != nil {
+			join = string(action.Join.Mode)
+		}
+
+		retry := "-"
+		if action.Retry != nil {
+			retry = strconv.Itoa(action.Retry.MaxAttempts)
+		}
+
+		actions = append(actions, []string{
+			action.Key,
+			action.ActionID,
+			strconv.FormatBool(slices.Contains(description.DisabledActions, action.Key)),
+			join,
+			retry,
+			durationOrDash(action.Timeout),
+		})
+	}
+
+	fmt.Fprintln(p.w, "\nActions:")
+
+	err = p.table([]string{"KEY", "ACTION ID", "DISABLED", "JOIN", "MAX ATTEMPTS", "TIMEOUT"}, actions)
+	if err != nil {
+		return err
+	}
+
+	var peers [][]string
+
+	for _, peer := range doc.Peers {
+		peers = append(peers, []string{peer.ParentKey, peer.MetaOutput, peer.ChildKey})
+	}
+
+	fmt.Fprintln(p.w, "\nPeers:")
+
+	return p.table([]string{"PARENT", "META OUTPUT", "CHILD"}, peers)
+}
+
+type diffResult struct {
+	ID      string         `json:"id"`
+	New     bool           `json:"new,omitempty"`
+	Changes diff.Changelog `json:"changes"`
+
+	doc *usecase.FlowDocument
+}
+
+func runDiff(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("diff", env)
+
+	var files filesFlag
+	fs.Var(&files, "f", "flow document, directory of documents, or - for stdin (repeatable)")
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	docs, err := readDocuments(files)
+	if err != nil {
+		return err
+	}
+
+	var (
+		results []diffResult
+		differs bool
+	)
+
+	for _, doc := range docs {
+		result := diffResult{
+			ID:  doc.ID,
+			doc: doc,
+		}
+
+		remote, err := exportFlow(ctx, c, doc.ID)
+
+		switch {
+		case isNotFound(err):
+			result.New = true
+		case err != nil:
+			return err
+		}
+
+		result.Changes, err = diffDocuments(remote, doc)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, result)
+
+		if result.New || len(result.Changes) > 0 {
+			differs = true
+		}
+
+		if p.format == outputTable {
+			err := printChanges(p.w, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.format == outputJSON {
+		err := p.json(results)
+		if err != nil {
+			return err
+		}
+	}
+
+	if differs {
+		return errDiffFound
+	}
+
+	return nil
+}
+
+func runDelete(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("delete", env)
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	args, err = requireResource(args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	err = c.do(ctx, http.MethodDelete, c.tenantPath("flows", args[0]), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(applyResult{ID: args[0], Result: "deleted"})
+	}
+
+	fmt.Fprintf(p.w, "flow/%s deleted\n", args[0])
+
+	return nil
+}
+
+func runDisableAction(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("disable-action", env)
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID", "ACTION_KEY")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	err = c.do(ctx, http.MethodPost, c.tenantPath("workflows", args[0], "actions", args[1], "disable"), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(map[string]string{
+			"id":     args[0],
+			"key":    args[1],
+			"result": "disabled",
+		})
+	}
+
+	fmt.Fprintf(p.w, "flow/%s action/%s disabled\n", args[0], args[1])
+
+	return nil
+}
+
+func exportFlow(ctx context.Context, c *client, flowID string) (*usecase.FlowDocument, error) {
+	var doc usecase.FlowDocument
+
+	err := c.do(ctx, http.MethodGet, c.tenantPath("flows", flowID, "export"), nil, nil, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// readDocuments reads the flow documents of files, and of the .yaml, .yml
+// and .json files of directories.
+func readDocuments(paths []string) ([]*usecase.FlowDocument, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no documents, set -f")
+	}
+
+	var docs []*usecase.FlowDocument
+
+	for _, path := range paths {
+		files := []string{path}
+
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+
+			files = nil
+
+			for _, entry := range entries {
+				switch filepath.Ext(entry.Name()) {
+				case ".yaml", ".yml", ".json":
+					if !entry.IsDir() {
+						files = append(files, filepath.Join(path, entry.Name()))
+					}
+				}
+			}
+		}
+
+		for _, file := range files {
+			var data []byte
+
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc, err := usecase.ParseFlowDocument(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			if doc.ID == "" {
+				return nil, fmt.Errorf("%s: id is required", file)
+			}
+
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// diffDocuments returns the changes from the remote document to the local
+// one, with actions compared by key and peers as a set. A nil remote
+// document stands for a flow the server does not have yet.
+func diffDocuments(remote, local *usecase.FlowDocument) (diff.Changelog, error) {
+	from := map[string]any{}
+
+	if remote != nil {
+		var err error
+
+		from, err = comparableDocument(remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	to, err := comparableDocument(local)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diff.Diff(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(changes, func(a, b diff.Change) int {
+		return strings.Compare(strings.Join(a.Path, "."), strings.Join(b.Path, "."))
+	})
+
+	return changes, nil
+}
+
+func comparableDocument(doc *usecase.FlowDocument) (map[string]any, error) {
+	settings := *doc
+	settings.Actions = nil
+	settings.Peers = nil
+
+	v, err := jsonValue(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := map[string]any{}
+
+	for _, action := range doc.Actions {
+		av, err := jsonValue(action)
+		if err != nil {
+			return nil, err
+		}
+
+		delete(av, "key")
+		actions[action.Key] = av
+	}
+
+	peers := map[string]any{}
+
+	for _, peer := range doc.Peers {
+		peers[fmt.Sprintf("%s --%s--> %s", peer.ParentKey, peer.MetaOutput, peer.ChildKey)] = true
+	}
+
+	v["actions"] = actions
+	v["peers"] = peers
+
+	return v, nil
+}
+
+// jsonValue returns v as the JSON object it encodes to, leaving out the
+// fields tagged omitempty that are empty.
+func jsonValue(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var value map[string]any
+
+	err = json.Unmarshal(b, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func printChanges(w io.Writer, result diffResult) error {
+	switch {
+	case result.New:
+		fmt.Fprintf(w, "flow/%s (new)\n", result.ID)
+
+		data, err := usecase.MarshalFlowDocumentYAML(result.doc)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			fmt.Fprintf(w, "  + %s\n", line)
+		}
+
+		return nil
+	case len(result.Changes) == 0:
+		fmt.Fprintf(w, "flow/%s unchanged\n", result.ID)
+		return nil
+	default:
+		fmt.Fprintf(w, "flow/%s\n", result.ID)
+	}
+
+	for _, change := range result.Changes {
+		path := strings.Join(change.Path, ".")
+
+		// a peer is its own description
+		if len(change.Path) > 0 && change.Path[0] == "peers" {
+			switch change.Type {
+			case diff.CREATE:
+				fmt.Fprintf(w, "  + %s\n", path)
+			case diff.DELETE:
+				fmt.Fprintf(w, "  - %s\n", path)
+			}
+
+			continue
+		}
+
+		switch change.Type {
+		case diff.CREATE:
+			fmt.Fprintf(w, "  + %s: %s\n", path, formatValue(change.To))
+		case diff.DELETE:
+			fmt.Fprintf(w, "  - %s: %s\n", path, formatValue(change.From))
+		case diff.UPDATE:
+			fmt.Fprintf(w, "  ~ %s: %s -> %s\n", path, formatValue(change.From), formatValue(change.To))
+		}
+	}
+
+	return nil
+}
+
+func formatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
+
+func durationOrDash(d spider.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+
+	return d.Duration().String()
+}
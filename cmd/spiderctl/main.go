@@ -0,0 +1,216 @@
+// Command spiderctl manages the flows of a tenant through the workflow REST
+// API.
+//
+//	spiderctl apply -f flow.yaml
+//	spiderctl get flows
+//	spiderctl describe flow <flow-id>
+//	spiderctl diff -f flow.yaml
+//	spiderctl delete flow <flow-id>
+//	spiderctl disable-action <flow-id> <action-key>
+//	spiderctl trigger <flow-id> -d '{"value": 1}' --wait
+//	spiderctl runs <flow-id>
+//	spiderctl logs <flow-id> <session-id>
+//	spiderctl cancel <flow-id> <session-id>
+//
+// The server and tenant come from --server and --tenant, or from
+// SPIDER_SERVER and SPIDER_TENANT_ID.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type Env struct {
+	Server   string `env:"SPIDER_SERVER, default=http://localhost:8080"`
+	TenantID string `env:"SPIDER_TENANT_ID"`
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, env Env, args []string) error
+}
+
+var commands = []command{
+	{"apply", "apply -f FILE|DIR...", "Create or update flows from YAML or JSON documents", runApply},
+	{"get", "get flows", "List the flows of the tenant", runGet},
+	{"describe", "describe flow FLOW_ID", "Show a flow with its actions and peers", runDescribe},
+	{"diff", "diff -f FILE|DIR...", "Show how documents differ from the flows on the server", runDiff},
+	{"delete", "delete flow FLOW_ID", "Delete a flow", runDelete},
+	{"disable-action", "disable-action FLOW_ID ACTION_KEY", "Disable an action of a flow", runDisableAction},
+	{"trigger", "trigger FLOW_ID [-d JSON | --data-file FILE] [--wait]", "Start a run of a flow", runTrigger},
+	{"runs", "runs FLOW_ID", "List the runs of a flow", runRuns},
+	{"logs", "logs FLOW_ID SESSION_ID", "Show the steps of a run", runLogs},
+	{"cancel", "cancel FLOW_ID SESSION_ID", "Cancel a run", runCancel},
+}
+
+// errDiffFound makes diff exit with status 1 when documents differ from
+// the server, without printing an error.
+var errDiffFound = errors.New("differences found")
+
+func main() {
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "spiderctl:", err)
+		os.Exit(2)
+	}
+
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+
+		if cmd.name != os.Args[1] {
+			continue
+		}
+
+		err := cmd.run(ctx, env, os.Args[2:])
+
+		switch {
+		case err == nil:
+		case errors.Is(err, errDiffFound):
+			os.Exit(1)
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(2)
+		default:
+			fmt.Fprintln(os.Stderr, "spiderctl:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "spiderctl: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: spiderctl COMMAND [ARGS] [--server URL] [--tenant ID] [-o table|json]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-54s %s\n", cmd.usage, cmd.summary)
+	}
+}
+
+// options are the flags every command takes.
+type options struct {
+	server   string
+	tenantID string
+	output   string
+	timeout  time.Duration
+}
+
+// newFlagSet returns the flag set of a command with the shared flags,
+// defaulting to the environment.
+func newFlagSet(name string, env Env) (*flag.FlagSet, *options) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("spiderctl "+name, flag.ContinueOnError)
+	fs.StringVar(&opts.server, "server", env.Server, "workflow API URL")
+	fs.StringVar(&opts.tenantID, "tenant", env.TenantID, "tenant ID")
+	fs.StringVar(&opts.output, "o", outputTable, "output format: table or json")
+	fs.DurationVar(&opts.timeout, "request-timeout", 30*time.Second, "timeout of each API request")
+
+	return fs, opts
+}
+
+// parseArgs parses flags wherever they appear among the arguments, and
+// returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (o *options) client() (*client, error) {
+	if o.tenantID == "" {
+		return nil, errors.New("tenant is required, set --tenant or SPIDER_TENANT_ID")
+	}
+
+	return &client{
+		server:   o.server,
+		tenantID: o.tenantID,
+		http: &http.Client{
+			Timeout: o.timeout,
+		},
+	}, nil
+}
+
+func (o *options) printer() (*printer, error) {
+	if o.output != outputTable && o.output != outputJSON {
+		return nil, fmt.Errorf("unknown output %q, want table or json", o.output)
+	}
+
+	return &printer{
+		format: o.output,
+		w:      os.Stdout,
+	}, nil
+}
+
+// requireArgs checks the positional arguments of a command against the
+// names it expects.
+func requireArgs(args []string, names ...string) error {
+	if len(args) != len(names) {
+		return fmt.Errorf("want arguments %s, got %q", strings.Join(names, " "), args)
+	}
+
+	return nil
+}
+
+// requireResource checks that the first argument names the flow resource,
+// as in "get flows" or "delete flow".
+func requireResource(args []string) ([]string, error) {
+	if len(args) == 0 || (args[0] != "flow" && args[0] != "flows") {
+		return nil, errors.New("only the flow resource is supported, as in \"flow\" or \"flows\"")
+	}
+
+	return args[1:], nil
+}
+
+// filesFlag collects the values of a flag given more than once.
+type filesFlag []string
+
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filesFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
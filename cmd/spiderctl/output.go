@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer writes the results of a command as a table or as JSON.
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+func (p *printer) json(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// fields writes name and value pairs, one per line, with the values lined
+// up.
+func (p *printer) fields(pairs [][2]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 1, ' ', 0)
+
+	for _, pair := range pairs {
+		fmt.Fprintf(tw, "%s:\t%s\n", pair[0], pair[1])
+	}
+
+	return tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+func formatElapsed(start time.Time, end *time.Time) string {
+	if end == nil {
+		return "-"
+	}
+
+	return end.Sub(start).Round(time.Millisecond).String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
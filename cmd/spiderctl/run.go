@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/apis"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+func runTrigger(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("trigger", env)
+	data := fs.String("d", "", "trigger payload as a JSON object")
+	dataFile := fs.String("data-file", "", "file holding the trigger payload as a JSON object")
+	key := fs.String("key", "", "entry action to start from, when the flow has several")
+	metaOutput := fs.String("meta-output", "", "meta output of the entry action, when it is followed on several")
+	wait := fs.Bool("wait", false, "wait for the run to finish and print its final context")
+	waitTimeout := fs.Duration("wait-timeout", time.Minute, "longest wait for the run to finish")
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	raw := []byte(*data)
+
+	if *dataFile != "" {
+		raw, err = os.ReadFile(*dataFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	payload := map[string]interface{}{}
+
+	if len(raw) > 0 {
+		err = json.Unmarshal(raw, &payload)
+		if err != nil {
+			return fmt.Errorf("payload: %w", err)
+		}
+	}
+
+	var query url.Values
+
+	if *wait {
+		query = url.Values{
+			"wait":    {"true"},
+			"timeout": {waitTimeout.String()},
+		}
+
+		// the run decides how long the request lasts
+		c.http.Timeout = 0
+	}
+
+	var result usecase.TriggerRunResponse
+
+	err = c.do(ctx, http.MethodPost, c.tenantPath("flows", args[0], "runs"), query, apis.TriggerRunPayload{
+		Key:        *key,
+		MetaOutput: *metaOutput,
+		Payload:    payload,
+	}, &result)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(result)
+	}
+
+	if !*wait {
+		fmt.Fprintln(p.w, result.SessionID)
+		return nil
+	}
+
+	err = p.fields([][2]string{
+		{"Session ID", result.SessionID},
+		{"Status", orDash(string(result.Status))},
+		{"Error", orDash(result.Error)},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.w, "\nContext:")
+
+	return p.json(result.Context)
+}
+
+func runRuns(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("runs", env)
+	status := fs.String("status", "", "only runs with this status")
+	page := fs.Int("page", 1, "page number")
+	pageSize := fs.Int("page-size", 20, "runs per page, up to 100")
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"page":      {strconv.Itoa(*page)},
+		"page_size": {strconv.Itoa(*pageSize)},
+	}
+
+	if *status != "" {
+		query.Set("status", *status)
+	}
+
+	var list spider.RunListResponse
+
+	err = c.do(ctx, http.MethodGet, c.tenantPath("flows", args[0], "runs"), query, nil, &list)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(list)
+	}
+
+	var rows [][]string
+
+	for _, run := range list.Runs {
+		rows = append(rows, []string{
+			run.SessionID,
+			string(run.Status),
+			strconv.FormatUint(run.FlowVersion, 10),
+			formatTime(&run.StartedAt),
+			formatElapsed(run.StartedAt, run.EndedAt),
+			orDash(run.Error),
+		})
+	}
+
+	return p.table([]string{"SESSION ID", "STATUS", "VERSION", "STARTED", "DURATION", "ERROR"}, rows)
+}
+
+func runLogs(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("logs", env)
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID", "SESSION_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	var run spider.Run
+
+	err = c.do(ctx, http.MethodGet, c.tenantPath("flows", args[0], "runs", args[1]), nil, nil, &run)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(run)
+	}
+
+	err = p.fields([][2]string{
+		{"Session ID", run.SessionID},
+		{"Status", string(run.Status)},
+		{"Trigger", run.TriggerKey + " (" + orDash(run.TriggerMetaOutput) + ")"},
+		{"Started", formatTime(&run.StartedAt)},
+		{"Ended", formatTime(run.EndedAt)},
+		{"Error", orDash(run.Error)},
+	})
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+
+	for _, step := range run.Steps {
+		rows = append(rows, []string{
+			step.Key,
+			step.ActionID,
+			string(step.Status),
+			strconv.Itoa(step.Attempt),
+			orDash(step.MetaOutput),
+			formatTime(&step.StartedAt),
+			formatElapsed(step.StartedAt, step.EndedAt),
+			orDash(step.Error),
+		})
+	}
+
+	fmt.Fprintln(p.w, "\nSteps:")
+
+	return p.table([]string{"KEY", "ACTION ID", "STATUS", "ATTEMPT", "META OUTPUT", "STARTED", "DURATION", "ERROR"}, rows)
+}
+
+func runCancel(ctx context.Context, env Env, args []string) error {
+	fs, opts := newFlagSet("cancel", env)
+
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = requireArgs(args, "FLOW_ID", "SESSION_ID")
+	if err != nil {
+		return err
+	}
+
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	p, err := opts.printer()
+	if err != nil {
+		return err
+	}
+
+	var run spider.Run
+
+	err = c.do(ctx, http.MethodPost, c.tenantPath("flows", args[0], "runs", args[1], "cancel"), nil, nil, &run)
+	if err != nil {
+		return err
+	}
+
+	if p.format == outputJSON {
+		return p.json(run)
+	}
+
+	fmt.Fprintf(p.w, "flow/%s run/%s %s\n", args[0], run.SessionID, run.Status)
+
+	return nil
+}
@@ -24,16 +24,45 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/tenants/{tenant_id}/flows": {
+        "/admin/session-contexts/usage": {
             "get": {
-                "description": "Get a paginated list of flows for a tenant",
+                "description": "Get the number and size of the stored session contexts of every tenant",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "flows"
+                    "admin"
                 ],
-                "summary": "List flows",
+                "summary": "Session context usage",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.SessionContextUsageResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/dead-letters": {
+            "get": {
+                "description": "Get a paginated list of messages of a tenant that were given up on, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "dead-letters"
+                ],
+                "summary": "List dead letters",
                 "parameters": [
                     {
                         "type": "string",
@@ -61,7 +90,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.FlowListResponse"
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.DeadLetterListResponse"
                         }
                     },
                     "400": {
@@ -83,19 +112,18 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Create a new workflow flow for a tenant",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/tenants/{tenant_id}/dead-letters/{id}": {
+            "get": {
+                "description": "Get a dead-lettered message with its failure reason and original payload",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "flows"
+                    "dead-letters"
                 ],
-                "summary": "Create a new flow",
+                "summary": "Get dead letter details",
                 "parameters": [
                     {
                         "type": "string",
@@ -105,20 +133,18 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Flow creation payload",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/pkg_spider_apis.CreateFlowPayload"
-                        }
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowResponse"
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.DeadLetter"
                         }
                     },
                     "400": {
@@ -130,6 +156,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -140,21 +175,13 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/tenants/{tenant_id}/flows/{flow_id}": {
-            "put": {
-                "description": "Update an existing flow's properties",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+            },
+            "delete": {
+                "description": "Remove a dead-lettered message without replaying it",
                 "tags": [
-                    "flows"
+                    "dead-letters"
                 ],
-                "summary": "Update a flow",
+                "summary": "Discard a dead letter",
                 "parameters": [
                     {
                         "type": "string",
@@ -165,27 +192,15 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Flow ID",
-                        "name": "flow_id",
+                        "description": "Dead letter ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Flow update payload",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/pkg_spider_apis.UpdateFlowPayload"
-                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Flow"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Bad Request",
@@ -196,6 +211,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -206,13 +230,15 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete an existing flow",
+            }
+        },
+        "/tenants/{tenant_id}/dead-letters/{id}/replay": {
+            "post": {
+                "description": "Publish a dead-lettered message back to its original subject and remove it from the dead-letter stream",
                 "tags": [
-                    "flows"
+                    "dead-letters"
                 ],
-                "summary": "Delete a flow",
+                "summary": "Replay a dead letter",
                 "parameters": [
                     {
                         "type": "string",
@@ -223,8 +249,8 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Flow ID",
-                        "name": "flow_id",
+                        "description": "Dead letter ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -242,6 +268,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -254,16 +289,16 @@ const docTemplate = `{
                 }
             }
         },
-        "/tenants/{tenant_id}/flows/{id}": {
+        "/tenants/{tenant_id}/flows": {
             "get": {
-                "description": "Get detailed information about a specific flow",
+                "description": "Get a paginated list of flows for a tenant",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "flows"
                 ],
-                "summary": "Get flow details",
+                "summary": "List flows",
                 "parameters": [
                     {
                         "type": "string",
@@ -273,18 +308,25 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Flow ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size",
+                        "name": "page_size",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowDetailResponse"
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.FlowListResponse"
                         }
                     },
                     "400": {
@@ -296,8 +338,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -306,11 +348,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}": {
-            "put": {
-                "description": "Update configuration of a workflow action",
+            },
+            "post": {
+                "description": "Create a new workflow flow for a tenant. The graph is validated first, and every problem found is listed in the fields of a 400 response",
                 "consumes": [
                     "application/json"
                 ],
@@ -318,9 +358,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "actions"
+                    "flows"
                 ],
-                "summary": "Update a workflow action",
+                "summary": "Create a new flow",
                 "parameters": [
                     {
                         "type": "string",
@@ -330,26 +370,12 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Workflow ID",
-                        "name": "workflow_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Action Key",
-                        "name": "key",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Action update payload",
+                        "description": "Flow creation payload",
                         "name": "payload",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/pkg_spider_apis.UpdateActionPayload"
+                            "$ref": "#/definitions/pkg_spider_apis.CreateFlowPayload"
                         }
                     }
                 ],
@@ -357,25 +383,13 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.WorkflowAction"
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
                         }
                     },
                     "500": {
@@ -390,13 +404,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}/disable": {
+        "/tenants/{tenant_id}/flows/import": {
             "post": {
-                "description": "Disable a specific workflow action",
+                "description": "Create the flow of a YAML or JSON document, or replace the settings and graph of the flow with its ID. Importing a document the flow already matches changes nothing",
+                "consumes": [
+                    "application/json",
+                    "application/yaml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "actions"
+                    "flows"
                 ],
-                "summary": "Disable a workflow action",
+                "summary": "Import a flow",
                 "parameters": [
                     {
                         "type": "string",
@@ -406,26 +427,30 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Workflow ID",
-                        "name": "workflow_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Action Key",
-                        "name": "key",
-                        "in": "path",
-                        "required": true
+                        "description": "Flow document",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowDocument"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Flow"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -444,66 +469,1613 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "github_com_targc_spider-go_pkg_spider.Flow": {
-            "type": "object",
-            "properties": {
-                "id": {
-                    "type": "string"
-                },
-                "meta": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
-                },
-                "name": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string"
-                },
-                "tenant_id": {
-                    "type": "string"
-                },
-                "trigger_type": {
-                    "type": "string"
-                },
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}": {
+            "put": {
+                "description": "Update an existing flow's properties. Only active flows run their triggers: paused flows hold them as held runs, which are released when the flow is activated again and rejected when it is archived. A flow is only activated once its graph is valid",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Update a flow",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Flow update payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.UpdateFlowPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Flow"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete an existing flow",
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Delete a flow",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}/graph": {
+            "put": {
+                "description": "Replace the settings, actions and peers of an existing flow at once. The flow keeps its status, and runs already started keep the graph they started on",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Replace a flow graph",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Flow graph payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.CreateFlowPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}/runs": {
+            "get": {
+                "description": "Get a paginated list of runs (sessions) of a flow, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runs"
+                ],
+                "summary": "List flow runs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "running",
+                            "succeeded",
+                            "failed",
+                            "cancelled",
+                            "timed_out",
+                            "held",
+                            "rejected"
+                        ],
+                        "type": "string",
+                        "description": "Run status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only runs started at or after this time (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only runs started before this time (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RunListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Start a run of a flow from its entry action with a payload, as a trigger worker would. The key and meta_output are only needed when the flow has several entry actions, or its entry action is followed on several meta outputs. With wait=true the request lasts until the run ends, or until the timeout, and returns its final context",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runs"
+                ],
+                "summary": "Start a run",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Wait for the run to end",
+                        "name": "wait",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "1m",
+                        "description": "Longest wait, as a duration",
+                        "name": "timeout",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Trigger payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.TriggerRunPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.TriggerRunResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.TriggerRunResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}/runs/{session_id}": {
+            "get": {
+                "description": "Get a run (session) of a flow with its full step timeline",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runs"
+                ],
+                "summary": "Get run details",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "session_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Run"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}/runs/{session_id}/cancel": {
+            "post": {
+                "description": "Cancel a running or held run. Its running steps are cancelled, nothing follows them, and the workers still processing their inputs are told to stop",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runs"
+                ],
+                "summary": "Cancel a run",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "session_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Run"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{flow_id}/simulate": {
+            "post": {
+                "description": "Walk the graph of a flow from its entry action with a payload, as a run would, taking the output of each action from outputs instead of its workers. Nothing is sent to the workers and no run is recorded. Returns the input computed for each action reached and the path taken. A path stops at an action without a stubbed output. The key and meta_output default as when starting a run",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Simulate a flow",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "flow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Trigger payload and stubbed outputs",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.SimulateFlowPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Simulation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{id}": {
+            "get": {
+                "description": "Get detailed information about a specific flow",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Get flow details",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowDetailResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/flows/{id}/export": {
+            "get": {
+                "description": "Describe a flow and its graph as a document that can be kept in git and imported again",
+                "produces": [
+                    "application/json",
+                    "application/yaml"
+                ],
+                "tags": [
+                    "flows"
+                ],
+                "summary": "Export a flow",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Flow ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "yaml"
+                        ],
+                        "type": "string",
+                        "default": "json",
+                        "description": "Document format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FlowDocument"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/actions": {
+            "post": {
+                "description": "Add an action to an existing flow. Add a peer to make it follow another action",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Add a workflow action",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Action payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.WorkflowAction"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.WorkflowAction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}": {
+            "put": {
+                "description": "Update configuration of a workflow action. Its mappers are checked as when adding it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Update a workflow action",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action Key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Action update payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.UpdateActionPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.WorkflowAction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete an action together with the peers leading to and from it. The action of an active flow is only deleted if the graph left is valid",
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Delete a workflow action",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action Key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}/disable": {
+            "post": {
+                "description": "Disable a specific workflow action",
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Disable a workflow action",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action Key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}/enable": {
+            "post": {
+                "description": "Enable a disabled workflow action again",
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Enable a workflow action",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action Key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/peers": {
+            "post": {
+                "description": "Make an action follow another one when it ends with the given meta output",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Add a peer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Peer payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.Peer"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tenants/{tenant_id}/workflows/{workflow_id}/peers/{parent_key}/{meta_output}/{child_key}": {
+            "delete": {
+                "description": "Stop an action from following another one on the given meta output. The peer of an active flow is only removed if the graph left is valid",
+                "tags": [
+                    "actions"
+                ],
+                "summary": "Remove a peer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenant_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "workflow_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Parent Action Key",
+                        "name": "parent_key",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Meta Output",
+                        "name": "meta_output",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Child Action Key",
+                        "name": "child_key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/pkg_spider_apis.ValidationErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "github_com_targc_spider-go_pkg_spider.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "data": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "tenant_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.DeadLetterListResponse": {
+            "type": "object",
+            "properties": {
+                "dead_letters": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.DeadLetter"
+                    }
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.Duration": {
+            "type": "integer",
+            "format": "int64",
+            "enum": [
+                -9223372036854775808,
+                9223372036854775807,
+                1,
+                1000,
+                1000000,
+                1000000000,
+                60000000000,
+                3600000000000,
+                60000000000,
+                1000000000,
+                30000000000,
+                30000000000
+            ],
+            "x-enum-varnames": [
+                "flowRetentionCacheTTL",
+                "schedulerInterval",
+                "retryLease",
+                "defaultNATSAckWait"
+            ]
+        },
+        "github_com_targc_spider-go_pkg_spider.Flow": {
+            "type": "object",
+            "properties": {
+                "deadline": {
+                    "description": "Overall time limit of a run",
+                    "type": "string",
+                    "example": "1h"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "meta": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "retention": {
+                    "description": "Longest time a session context is kept, never while its task runs or waits for a retry, until its task is done when 0",
+                    "type": "string",
+                    "example": "72h"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "trigger_type": {
+                    "type": "string"
+                },
                 "version": {
                     "type": "integer"
                 }
             }
         },
-        "github_com_targc_spider-go_pkg_spider.FlowListResponse": {
+        "github_com_targc_spider-go_pkg_spider.FlowListResponse": {
+            "type": "object",
+            "properties": {
+                "flows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.WorkflowInfo"
+                    }
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.JoinPolicy": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "description": "N for JoinModeAny",
+                    "type": "integer",
+                    "example": 2
+                },
+                "mode": {
+                    "type": "string",
+                    "example": "all"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.Mapper": {
+            "type": "object",
+            "properties": {
+                "mode": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.RetryPolicy": {
+            "type": "object",
+            "properties": {
+                "initial_delay": {
+                    "type": "string",
+                    "example": "1s"
+                },
+                "max_attempts": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "max_delay": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "multiplier": {
+                    "type": "number",
+                    "example": 2
+                },
+                "retryable_errors": {
+                    "description": "Empty retries every class except permanent",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "transient"
+                    ]
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.Run": {
+            "type": "object",
+            "properties": {
+                "deadline_at": {
+                    "type": "string"
+                },
+                "ended_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "flow_version": {
+                    "type": "integer"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "steps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RunStep"
+                    }
+                },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "trigger_key": {
+                    "type": "string"
+                },
+                "trigger_meta_output": {
+                    "type": "string"
+                },
+                "trigger_payload": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "workflow_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.RunListResponse": {
+            "type": "object",
+            "properties": {
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "runs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Run"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.RunStep": {
+            "type": "object",
+            "properties": {
+                "action_id": {
+                    "type": "string"
+                },
+                "attempt": {
+                    "type": "integer"
+                },
+                "deadline_at": {
+                    "type": "string"
+                },
+                "ended_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "flow_version": {
+                    "type": "integer"
+                },
+                "input": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "key": {
+                    "type": "string"
+                },
+                "meta_output": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "task_id": {
+                    "type": "string"
+                },
+                "tenant_id": {
+                    "type": "string"
+                },
+                "workflow_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.SessionContextUsage": {
             "type": "object",
             "properties": {
-                "flows": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.WorkflowInfo"
-                    }
+                "bytes": {
+                    "description": "Size of the JSON encoded values",
+                    "type": "integer"
                 },
-                "page": {
+                "contexts": {
                     "type": "integer"
                 },
-                "page_size": {
+                "join_bytes": {
+                    "description": "Size of the JSON encoded arrivals",
                     "type": "integer"
                 },
-                "total": {
+                "joins": {
                     "type": "integer"
+                },
+                "tenant_id": {
+                    "type": "string"
                 }
             }
         },
-        "github_com_targc_spider-go_pkg_spider.Mapper": {
+        "github_com_targc_spider-go_pkg_spider.SimulatedOutput": {
             "type": "object",
             "properties": {
-                "mode": {
+                "error": {
                     "type": "string"
                 },
-                "value": {
+                "meta_output": {
+                    "type": "string",
+                    "example": "success"
+                },
+                "values": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.SimulatedStep": {
+            "type": "object",
+            "properties": {
+                "action_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "input": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "key": {
+                    "type": "string"
+                },
+                "meta_output": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "parent_key": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider.Simulation": {
+            "type": "object",
+            "properties": {
+                "context": {
+                    "description": "Context holds the output of the trigger and of every step that\nsucceeded, by key.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "object",
+                        "additionalProperties": true
+                    }
+                },
+                "error": {
                     "type": "string"
+                },
+                "path": {
+                    "description": "Path lists the keys of the trigger and of the steps, in the order\nthey were reached.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                },
+                "steps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.SimulatedStep"
+                    }
                 }
             }
         },
@@ -525,6 +2097,9 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "join": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.JoinPolicy"
+                },
                 "key": {
                     "type": "string"
                 },
@@ -540,9 +2115,16 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "retry": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RetryPolicy"
+                },
                 "tenant_id": {
                     "type": "string"
                 },
+                "timeout": {
+                    "type": "string",
+                    "example": "30s"
+                },
                 "workflow_id": {
                     "type": "string"
                 }
@@ -577,6 +2159,19 @@ const docTemplate = `{
                 }
             }
         },
+        "github_com_targc_spider-go_pkg_spider_usecase.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string",
+                    "example": "peers[0].child_key"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "unknown action key \"a9\""
+                }
+            }
+        },
         "github_com_targc_spider-go_pkg_spider_usecase.FlowDetailResponse": {
             "type": "object",
             "properties": {
@@ -592,8 +2187,61 @@ const docTemplate = `{
                 "flow_name": {
                     "type": "string"
                 },
+                "status": {
+                    "type": "string"
+                },
                 "tenant_id": {
                     "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider_usecase.FlowDocument": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.WorkflowActionInput"
+                    }
+                },
+                "api_version": {
+                    "type": "string",
+                    "example": "spider/v1"
+                },
+                "deadline": {
+                    "type": "string",
+                    "example": "1h"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "order-created"
+                },
+                "meta": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "My Workflow"
+                },
+                "peers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.PeerInput"
+                    }
+                },
+                "retention": {
+                    "type": "string",
+                    "example": "72h"
+                },
+                "trigger_type": {
+                    "type": "string",
+                    "example": "event"
                 }
             }
         },
@@ -608,6 +2256,82 @@ const docTemplate = `{
                 }
             }
         },
+        "github_com_targc_spider-go_pkg_spider_usecase.PeerInput": {
+            "type": "object",
+            "properties": {
+                "child_key": {
+                    "type": "string"
+                },
+                "meta_output": {
+                    "type": "string"
+                },
+                "parent_key": {
+                    "type": "string"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider_usecase.TriggerRunResponse": {
+            "type": "object",
+            "properties": {
+                "context": {
+                    "description": "Context holds the output of the trigger and of every action that\nsucceeded, by key, as the mappers of the run saw them.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "object",
+                        "additionalProperties": true
+                    }
+                },
+                "error": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string",
+                    "example": "0190c2a4-7b9e-7c1a-9f4e-2d3b5a6c7d8e"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                }
+            }
+        },
+        "github_com_targc_spider-go_pkg_spider_usecase.WorkflowActionInput": {
+            "type": "object",
+            "properties": {
+                "action_id": {
+                    "type": "string"
+                },
+                "config": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "join": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.JoinPolicy"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "mapper": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Mapper"
+                    }
+                },
+                "meta": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "retry": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RetryPolicy"
+                },
+                "timeout": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.Duration"
+                }
+            }
+        },
         "pkg_spider_apis.CreateFlowPayload": {
             "type": "object",
             "properties": {
@@ -617,6 +2341,10 @@ const docTemplate = `{
                         "$ref": "#/definitions/pkg_spider_apis.WorkflowAction"
                     }
                 },
+                "deadline": {
+                    "type": "string",
+                    "example": "1h"
+                },
                 "meta": {
                     "type": "object",
                     "additionalProperties": {
@@ -633,6 +2361,10 @@ const docTemplate = `{
                         "$ref": "#/definitions/pkg_spider_apis.Peer"
                     }
                 },
+                "retention": {
+                    "type": "string",
+                    "example": "72h"
+                },
                 "trigger_type": {
                     "type": "string",
                     "example": "event"
@@ -653,6 +2385,57 @@ const docTemplate = `{
                 }
             }
         },
+        "pkg_spider_apis.SessionContextUsageResponse": {
+            "type": "object",
+            "properties": {
+                "tenants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.SessionContextUsage"
+                    }
+                }
+            }
+        },
+        "pkg_spider_apis.SimulateFlowPayload": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string",
+                    "example": "start"
+                },
+                "meta_output": {
+                    "type": "string",
+                    "example": "triggered"
+                },
+                "outputs": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.SimulatedOutput"
+                    }
+                },
+                "payload": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "pkg_spider_apis.TriggerRunPayload": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string",
+                    "example": "start"
+                },
+                "meta_output": {
+                    "type": "string",
+                    "example": "triggered"
+                },
+                "payload": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
         "pkg_spider_apis.UpdateActionPayload": {
             "type": "object",
             "properties": {
@@ -662,6 +2445,9 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "join": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.JoinPolicy"
+                },
                 "mapper": {
                     "type": "object",
                     "additionalProperties": {
@@ -673,12 +2459,23 @@ const docTemplate = `{
                     "additionalProperties": {
                         "type": "string"
                     }
+                },
+                "retry": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RetryPolicy"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30s"
                 }
             }
         },
         "pkg_spider_apis.UpdateFlowPayload": {
             "type": "object",
             "properties": {
+                "deadline": {
+                    "type": "string",
+                    "example": "1h"
+                },
                 "meta": {
                     "type": "object",
                     "additionalProperties": {
@@ -689,8 +2486,18 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Updated Workflow"
                 },
+                "retention": {
+                    "type": "string",
+                    "example": "72h"
+                },
                 "status": {
                     "type": "string",
+                    "enum": [
+                        "draft",
+                        "active",
+                        "paused",
+                        "archived"
+                    ],
                     "example": "active"
                 },
                 "trigger_type": {
@@ -699,6 +2506,21 @@ const docTemplate = `{
                 }
             }
         },
+        "pkg_spider_apis.ValidationErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "invalid flow"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider_usecase.FieldError"
+                    }
+                }
+            }
+        },
         "pkg_spider_apis.WorkflowAction": {
             "type": "object",
             "properties": {
@@ -712,6 +2534,9 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "join": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.JoinPolicy"
+                },
                 "key": {
                     "type": "string",
                     "example": "a1"
@@ -727,6 +2552,13 @@ const docTemplate = `{
                     "additionalProperties": {
                         "type": "string"
                     }
+                },
+                "retry": {
+                    "$ref": "#/definitions/github_com_targc_spider-go_pkg_spider.RetryPolicy"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30s"
                 }
             }
         }
@@ -41,8 +41,14 @@ func main() {
 	}
 
 	storage := worflow.Storage()
+	messenger := worflow.Messenger()
+
+	uc, err := usecase.InitUsecase(ctx, storage, messenger)
+
+	if err != nil {
+		panic(err)
+	}
 
-	uc := usecase.NewUsecase(storage)
 	handler := apis.NewHandler(uc)
 
 	app := fiber.New()
@@ -54,16 +60,7 @@ func main() {
 	// swagger
 	app.All("/swagger/*", fiberSwagger.WrapHandler)
 
-	// flows
-	app.Get("/tenants/:tenant_id/flows", handler.ListFlows)
-	app.Get("/tenants/:tenant_id/flows/:id", handler.GetFlow)
-	app.Post("/tenants/:tenant_id/flows", handler.CreateFlow)
-	app.Put("/tenants/:tenant_id/flows/:flow_id", handler.UpdateFlow)
-	app.Delete("/tenants/:tenant_id/flows/:flow_id", handler.DeleteFlow)
-
-	// actions
-	app.Post("/tenants/:tenant_id/workflows/:workflow_id/actions/:key/disable", handler.DisableAction)
-	app.Put("/tenants/:tenant_id/workflows/:workflow_id/actions/:key", handler.UpdateAction)
+	handler.Register(app)
 
 	go worflow.Run(ctx)
 
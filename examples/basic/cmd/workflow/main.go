@@ -25,6 +25,30 @@ func main() {
 	}
 	workflowID := "wa"
 
+	_, err = storage.CreateFlow(ctx, &spider.CreateFlowRequest{
+		ID:          workflowID,
+		TenantID:    tenantID,
+		Name:        "basic",
+		TriggerType: spider.FlowTriggerTypeEvent,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	// flows are created as drafts, which ignore their triggers
+	_, err = storage.UpdateFlow(ctx, &spider.UpdateFlowRequest{
+		TenantID:    tenantID,
+		FlowID:      workflowID,
+		Name:        "basic",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Status:      spider.FlowStatusActive,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
 	_, err = storage.AddAction(ctx, &spider.AddActionRequest{
 		TenantID:   tenantID,
 		WorkflowID: workflowID,
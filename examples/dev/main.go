@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spiderdev"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+const tenantID = "dev"
+
+//go:embed flows/hello.yaml
+var helloFlow []byte
+
+func main() {
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	server := spiderdev.NewServer(spiderdev.ServerOpt{})
+
+	server.Handle("greet-action", func(c spider.InputMessageContext, m spider.InputMessage) error {
+
+		var input struct {
+			Name string `json:"name"`
+		}
+
+		err := json.Unmarshal([]byte(m.Values), &input)
+
+		if err != nil {
+			return err
+		}
+
+		output, err := json.Marshal(map[string]interface{}{
+			"greeting": fmt.Sprintf("Hello, %s!", input.Name),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return c.SendOutput("success", string(output))
+	})
+
+	server.Handle("echo", func(c spider.InputMessageContext, m spider.InputMessage) error {
+
+		slog.Info("[echo] received input", slog.String("session_id", m.SessionID), slog.String("values", m.Values))
+
+		return c.SendOutput("success", m.Values)
+	})
+
+	err := server.Start(ctx)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer server.Close(context.Background())
+
+	doc, err := usecase.ParseFlowDocument(helloFlow)
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = server.ImportFlow(ctx, tenantID, doc)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = server.SendTriggerMessage(ctx, spider.TriggerMessage{
+		TenantID:   tenantID,
+		WorkflowID: doc.ID,
+		Key:        "start",
+		ActionID:   "dev-trigger",
+		MetaOutput: "triggered",
+		Values:     `{"name": "spider"}`,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	slog.Info("run triggered, list it with: spiderctl runs hello --tenant dev")
+
+	<-ctx.Done()
+}
@@ -1,5 +1,11 @@
 package spider
 
+import (
+	"math"
+	"slices"
+	"time"
+)
+
 type WorkflowAction struct {
 	ID         string            `json:"id"`
 	Key        string            `json:"key"`
@@ -10,4 +16,95 @@ type WorkflowAction struct {
 	Map        map[string]Mapper `json:"map"`
 	Meta       map[string]string `json:"meta,omitempty"`
 	Disabled   bool              `json:"disabled"`
+	Join       *JoinPolicy       `json:"join,omitempty"`
+	Retry      *RetryPolicy      `json:"retry,omitempty"`
+	Timeout    Duration          `json:"timeout,omitempty" swaggertype:"string" example:"30s"`
+}
+
+type WorkflowActionDep struct {
+	Key        string `json:"key"`
+	MetaOutput string `json:"meta_output"`
+	DepKey     string `json:"dep_key"`
+}
+
+type JoinMode string
+
+var (
+	JoinModeAll   JoinMode = "all"
+	JoinModeFirst JoinMode = "first"
+	JoinModeAny   JoinMode = "any"
+)
+
+// JoinPolicy makes an action with several parents wait for the arrivals of
+// its parents within a session and run once with their merged context,
+// instead of once per parent.
+type JoinPolicy struct {
+	Mode  JoinMode `json:"mode" example:"all"`
+	Count int      `json:"count,omitempty" example:"2"` // N for JoinModeAny
+}
+
+// Threshold returns how many distinct parents must arrive before the action
+// is dispatched.
+func (p *JoinPolicy) Threshold(parents int) int {
+
+	n := parents
+
+	switch p.Mode {
+	case JoinModeFirst:
+		n = 1
+	case JoinModeAny:
+		n = p.Count
+	}
+
+	if n > parents {
+		n = parents
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	return n
+}
+
+// RetryPolicy re-dispatches a failed step with an exponential backoff.
+type RetryPolicy struct {
+	MaxAttempts     int      `json:"max_attempts" example:"3"`
+	InitialDelay    Duration `json:"initial_delay" swaggertype:"string" example:"1s"`
+	Multiplier      float64  `json:"multiplier,omitempty" example:"2"`
+	MaxDelay        Duration `json:"max_delay,omitempty" swaggertype:"string" example:"1m"`
+	RetryableErrors []string `json:"retryable_errors,omitempty" example:"transient"` // Empty retries every class except permanent
+}
+
+// ShouldRetry reports whether a step that failed on the given attempt with
+// an error of the given class gets another attempt.
+func (p *RetryPolicy) ShouldRetry(attempt int, class string) bool {
+
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if len(p.RetryableErrors) == 0 {
+		return class != ErrorClassPermanent
+	}
+
+	return slices.Contains(p.RetryableErrors, class)
+}
+
+// Delay returns how long to wait before the attempt following the given one.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+
+	multiplier := p.Multiplier
+
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	return time.Duration(delay)
 }
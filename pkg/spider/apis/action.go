@@ -1,12 +1,190 @@
 package apis
 
 import (
+	"errors"
 	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
 )
 
+// AddAction godoc
+// @Summary Add a workflow action
+// @Description Add an action to an existing flow. Add a peer to make it follow another action
+// @Tags actions
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param workflow_id path string true "Workflow ID"
+// @Param payload body WorkflowAction true "Action payload"
+// @Success 200 {object} spider.WorkflowAction
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/workflows/{workflow_id}/actions [post]
+func (h *Handler) AddAction(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	workflowID := c.Params("workflow_id")
+	if workflowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "workflow_id is required",
+		})
+	}
+
+	var payload WorkflowAction
+
+	err := c.BodyParser(&payload)
+	if err != nil {
+		return err
+	}
+
+	req := &spider.AddActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: workflowID,
+		Key:        payload.Key,
+		ActionID:   payload.ActionID,
+		Config:     payload.Config,
+		Map:        payload.Mapper,
+		Meta:       payload.Meta,
+		Join:       payload.Join,
+		Retry:      payload.Retry,
+		Timeout:    payload.Timeout,
+	}
+
+	action, err := h.usecase.AddAction(c.Context(), req)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid action",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
+	if errors.Is(err, spider.ErrAlreadyExists) {
+		return c.Status(409).JSON(map[string]string{
+			"error": "Action key already exists",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to add action",
+		})
+	}
+
+	return c.JSON(action)
+}
+
+// DeleteAction godoc
+// @Summary Delete a workflow action
+// @Description Delete an action together with the peers leading to and from it. The action of an active flow is only deleted if the graph left is valid
+// @Tags actions
+// @Param tenant_id path string true "Tenant ID"
+// @Param workflow_id path string true "Workflow ID"
+// @Param key path string true "Action Key"
+// @Success 204
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/workflows/{workflow_id}/actions/{key} [delete]
+func (h *Handler) DeleteAction(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	workflowID := c.Params("workflow_id")
+	if workflowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "workflow_id is required",
+		})
+	}
+
+	key := c.Params("key")
+	if key == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "key is required",
+		})
+	}
+
+	err := h.usecase.DeleteAction(c.Context(), tenantID, workflowID, key)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Action not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to delete action",
+		})
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+// EnableAction godoc
+// @Summary Enable a workflow action
+// @Description Enable a disabled workflow action again
+// @Tags actions
+// @Param tenant_id path string true "Tenant ID"
+// @Param workflow_id path string true "Workflow ID"
+// @Param key path string true "Action Key"
+// @Success 200
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/workflows/{workflow_id}/actions/{key}/enable [post]
+func (h *Handler) EnableAction(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	workflowID := c.Params("workflow_id")
+	if workflowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "workflow_id is required",
+		})
+	}
+
+	key := c.Params("key")
+	if key == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "key is required",
+		})
+	}
+
+	err := h.usecase.EnableAction(c.Context(), tenantID, workflowID, key)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("[process] enabled")
+
+	return nil
+}
+
 // DisableAction godoc
 // @Summary Disable a workflow action
 // @Description Disable a specific workflow action
@@ -52,7 +230,7 @@ func (h *Handler) DisableAction(c *fiber.Ctx) error {
 
 // UpdateAction godoc
 // @Summary Update a workflow action
-// @Description Update configuration of a workflow action
+// @Description Update configuration of a workflow action. Its mappers are checked as when adding it
 // @Tags actions
 // @Accept json
 // @Produce json
@@ -61,7 +239,7 @@ func (h *Handler) DisableAction(c *fiber.Ctx) error {
 // @Param key path string true "Action Key"
 // @Param payload body UpdateActionPayload true "Action update payload"
 // @Success 200 {object} spider.WorkflowAction
-// @Failure 400 {object} map[string]string
+// @Failure 400 {object} ValidationErrorResponse
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /tenants/{tenant_id}/workflows/{workflow_id}/actions/{key} [put]
@@ -88,9 +266,12 @@ func (h *Handler) UpdateAction(c *fiber.Ctx) error {
 	}
 
 	var payload struct {
-		Config map[string]string        `json:"config"`
-		Mapper map[string]spider.Mapper `json:"mapper"`
-		Meta   map[string]string        `json:"meta,omitempty"`
+		Config  map[string]string        `json:"config"`
+		Mapper  map[string]spider.Mapper `json:"mapper"`
+		Meta    map[string]string        `json:"meta,omitempty"`
+		Join    *spider.JoinPolicy       `json:"join,omitempty"`
+		Retry   *spider.RetryPolicy      `json:"retry,omitempty"`
+		Timeout spider.Duration          `json:"timeout,omitempty"`
 	}
 
 	err := c.BodyParser(&payload)
@@ -105,20 +286,161 @@ func (h *Handler) UpdateAction(c *fiber.Ctx) error {
 		Config:     payload.Config,
 		Map:        payload.Mapper,
 		Meta:       payload.Meta,
+		Join:       payload.Join,
+		Retry:      payload.Retry,
+		Timeout:    payload.Timeout,
 	}
 
 	action, err := h.usecase.UpdateAction(c.Context(), req)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid action",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Action not found",
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(map[string]string{
 			"error": "Failed to update action",
 		})
 	}
 
-	if action == nil {
+	return c.JSON(action)
+}
+
+// AddPeer godoc
+// @Summary Add a peer
+// @Description Make an action follow another one when it ends with the given meta output
+// @Tags actions
+// @Accept json
+// @Param tenant_id path string true "Tenant ID"
+// @Param workflow_id path string true "Workflow ID"
+// @Param payload body Peer true "Peer payload"
+// @Success 204
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/workflows/{workflow_id}/peers [post]
+func (h *Handler) AddPeer(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	workflowID := c.Params("workflow_id")
+	if workflowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "workflow_id is required",
+		})
+	}
+
+	var payload Peer
+
+	err := c.BodyParser(&payload)
+	if err != nil {
+		return err
+	}
+
+	peer := usecase.PeerInput{
+		ParentKey:  payload.ParentKey,
+		MetaOutput: payload.MetaOutput,
+		ChildKey:   payload.ChildKey,
+	}
+
+	err = h.usecase.AddPeer(c.Context(), tenantID, workflowID, peer)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid peer",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
 		return c.Status(404).JSON(map[string]string{
-			"error": "Action not found",
+			"error": "Flow not found",
+		})
+	}
+	if errors.Is(err, spider.ErrAlreadyExists) {
+		return c.Status(409).JSON(map[string]string{
+			"error": "Peer already exists",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to add peer",
 		})
 	}
 
-	return c.JSON(action)
+	return c.Status(204).Send(nil)
+}
+
+// RemovePeer godoc
+// @Summary Remove a peer
+// @Description Stop an action from following another one on the given meta output. The peer of an active flow is only removed if the graph left is valid
+// @Tags actions
+// @Param tenant_id path string true "Tenant ID"
+// @Param workflow_id path string true "Workflow ID"
+// @Param parent_key path string true "Parent Action Key"
+// @Param meta_output path string true "Meta Output"
+// @Param child_key path string true "Child Action Key"
+// @Success 204
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/workflows/{workflow_id}/peers/{parent_key}/{meta_output}/{child_key} [delete]
+func (h *Handler) RemovePeer(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	workflowID := c.Params("workflow_id")
+	if workflowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "workflow_id is required",
+		})
+	}
+
+	peer := usecase.PeerInput{
+		ParentKey:  c.Params("parent_key"),
+		MetaOutput: c.Params("meta_output"),
+		ChildKey:   c.Params("child_key"),
+	}
+
+	if peer.ParentKey == "" || peer.MetaOutput == "" || peer.ChildKey == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "parent_key, meta_output and child_key are required",
+		})
+	}
+
+	err := h.usecase.RemovePeer(c.Context(), tenantID, workflowID, peer)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Peer not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to remove peer",
+		})
+	}
+
+	return c.Status(204).Send(nil)
 }
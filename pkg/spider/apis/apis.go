@@ -21,6 +21,9 @@ type WorkflowAction struct {
 	Config   map[string]string        `json:"config"`
 	Mapper   map[string]spider.Mapper `json:"mapper"`
 	Meta     map[string]string        `json:"meta,omitempty"`
+	Join     *spider.JoinPolicy       `json:"join,omitempty"`
+	Retry    *spider.RetryPolicy      `json:"retry,omitempty"`
+	Timeout  spider.Duration          `json:"timeout,omitempty" swaggertype:"string" example:"30s"`
 }
 
 type Peer struct {
@@ -34,6 +37,8 @@ type CreateFlowPayload struct {
 	Name        string                 `json:"name" example:"My Workflow"`
 	TriggerType spider.FlowTriggerType `json:"trigger_type" example:"event"`
 	Meta        map[string]string      `json:"meta,omitempty"`
+	Deadline    spider.Duration        `json:"deadline,omitempty" swaggertype:"string" example:"1h"`
+	Retention   spider.Duration        `json:"retention,omitempty" swaggertype:"string" example:"72h"`
 	Actions     []WorkflowAction       `json:"actions"`
 	Peers       []Peer                 `json:"peers"`
 }
@@ -43,12 +48,38 @@ type UpdateFlowPayload struct {
 	Name        string                 `json:"name" example:"Updated Workflow"`
 	TriggerType spider.FlowTriggerType `json:"trigger_type" example:"schedule"`
 	Meta        map[string]string      `json:"meta,omitempty"`
-	Status      spider.FlowStatus      `json:"status" example:"active"`
+	Status      spider.FlowStatus      `json:"status,omitempty" example:"active" enums:"draft,active,paused,archived"`
+	Deadline    spider.Duration        `json:"deadline,omitempty" swaggertype:"string" example:"1h"`
+	Retention   spider.Duration        `json:"retention,omitempty" swaggertype:"string" example:"72h"`
 }
 
 // UpdateActionPayload represents the request body for updating an action
 type UpdateActionPayload struct {
-	Config map[string]string        `json:"config"`
-	Mapper map[string]spider.Mapper `json:"mapper"`
-	Meta   map[string]string        `json:"meta,omitempty"`
+	Config  map[string]string        `json:"config"`
+	Mapper  map[string]spider.Mapper `json:"mapper"`
+	Meta    map[string]string        `json:"meta,omitempty"`
+	Join    *spider.JoinPolicy       `json:"join,omitempty"`
+	Retry   *spider.RetryPolicy      `json:"retry,omitempty"`
+	Timeout spider.Duration          `json:"timeout,omitempty" swaggertype:"string" example:"30s"`
+}
+
+// TriggerRunPayload represents the request body for starting a run
+type TriggerRunPayload struct {
+	Key        string                 `json:"key,omitempty" example:"start"`
+	MetaOutput string                 `json:"meta_output,omitempty" example:"triggered"`
+	Payload    map[string]interface{} `json:"payload"`
+}
+
+// SimulateFlowPayload represents the request body for simulating a flow
+type SimulateFlowPayload struct {
+	Key        string                            `json:"key,omitempty" example:"start"`
+	MetaOutput string                            `json:"meta_output,omitempty" example:"triggered"`
+	Payload    map[string]interface{}            `json:"payload"`
+	Outputs    map[string]spider.SimulatedOutput `json:"outputs"`
+}
+
+// ValidationErrorResponse lists the problems found in a flow graph
+type ValidationErrorResponse struct {
+	Error  string               `json:"error" example:"invalid flow"`
+	Fields []usecase.FieldError `json:"fields"`
 }
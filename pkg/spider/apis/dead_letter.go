@@ -0,0 +1,176 @@
+package apis
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// ListDeadLetters godoc
+// @Summary List dead letters
+// @Description Get a paginated list of messages of a tenant that were given up on, oldest first
+// @Tags dead-letters
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} spider.DeadLetterListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/dead-letters [get]
+func (h *Handler) ListDeadLetters(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize := c.QueryInt("page_size", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	result, err := h.usecase.ListDeadLetters(c.Context(), &spider.ListDeadLettersRequest{
+		TenantID: tenantID,
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to list dead letters",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// GetDeadLetter godoc
+// @Summary Get dead letter details
+// @Description Get a dead-lettered message with its failure reason and original payload
+// @Tags dead-letters
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param id path string true "Dead letter ID"
+// @Success 200 {object} spider.DeadLetter
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/dead-letters/{id} [get]
+func (h *Handler) GetDeadLetter(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "id is required",
+		})
+	}
+
+	deadLetter, err := h.usecase.GetDeadLetter(c.Context(), tenantID, id)
+	if errors.Is(err, spider.ErrDeadLetterNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Dead letter not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to get dead letter",
+		})
+	}
+
+	return c.JSON(deadLetter)
+}
+
+// ReplayDeadLetter godoc
+// @Summary Replay a dead letter
+// @Description Publish a dead-lettered message back to its original subject and remove it from the dead-letter stream
+// @Tags dead-letters
+// @Param tenant_id path string true "Tenant ID"
+// @Param id path string true "Dead letter ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/dead-letters/{id}/replay [post]
+func (h *Handler) ReplayDeadLetter(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "id is required",
+		})
+	}
+
+	err := h.usecase.ReplayDeadLetter(c.Context(), tenantID, id)
+	if errors.Is(err, spider.ErrDeadLetterNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Dead letter not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to replay dead letter",
+		})
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+// DiscardDeadLetter godoc
+// @Summary Discard a dead letter
+// @Description Remove a dead-lettered message without replaying it
+// @Tags dead-letters
+// @Param tenant_id path string true "Tenant ID"
+// @Param id path string true "Dead letter ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/dead-letters/{id} [delete]
+func (h *Handler) DiscardDeadLetter(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "id is required",
+		})
+	}
+
+	err := h.usecase.DiscardDeadLetter(c.Context(), tenantID, id)
+	if errors.Is(err, spider.ErrDeadLetterNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Dead letter not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to discard dead letter",
+		})
+	}
+
+	return c.Status(204).Send(nil)
+}
@@ -1,6 +1,8 @@
 package apis
 
 import (
+	"errors"
+
 	"github.com/targc/spider-go/pkg/spider"
 	"github.com/targc/spider-go/pkg/spider/usecase"
 	"github.com/gofiber/fiber/v2"
@@ -8,14 +10,14 @@ import (
 
 // CreateFlow godoc
 // @Summary Create a new flow
-// @Description Create a new workflow flow for a tenant
+// @Description Create a new workflow flow for a tenant. The graph is validated first, and every problem found is listed in the fields of a 400 response
 // @Tags flows
 // @Accept json
 // @Produce json
 // @Param tenant_id path string true "Tenant ID"
 // @Param payload body CreateFlowPayload true "Flow creation payload"
 // @Success 200 {object} usecase.FlowResponse
-// @Failure 400 {object} map[string]string
+// @Failure 400 {object} ValidationErrorResponse
 // @Failure 500 {object} map[string]string
 // @Router /tenants/{tenant_id}/flows [post]
 func (h *Handler) CreateFlow(c *fiber.Ctx) error {
@@ -26,13 +28,7 @@ func (h *Handler) CreateFlow(c *fiber.Ctx) error {
 		})
 	}
 
-	var payload struct {
-		Name        string                    `json:"name"`
-		TriggerType spider.FlowTriggerType   `json:"trigger_type"`
-		Meta        map[string]string         `json:"meta,omitempty"`
-		Actions     []WorkflowAction          `json:"actions"`
-		Peers       []Peer                    `json:"peers"`
-	}
+	var payload CreateFlowPayload
 
 	err := c.BodyParser(&payload)
 	if err != nil {
@@ -45,37 +41,16 @@ func (h *Handler) CreateFlow(c *fiber.Ctx) error {
 		})
 	}
 
-	// Convert to usecase types
-	actions := make([]usecase.WorkflowActionInput, len(payload.Actions))
-	for i, action := range payload.Actions {
-		actions[i] = usecase.WorkflowActionInput{
-			Key:      action.Key,
-			ActionID: action.ActionID,
-			Config:   action.Config,
-			Mapper:   action.Mapper,
-			Meta:     action.Meta,
-		}
-	}
-
-	peers := make([]usecase.PeerInput, len(payload.Peers))
-	for i, peer := range payload.Peers {
-		peers[i] = usecase.PeerInput{
-			ParentKey:  peer.ParentKey,
-			MetaOutput: peer.MetaOutput,
-			ChildKey:   peer.ChildKey,
-		}
-	}
-
-	req := &usecase.CreateFlowRequest{
-		TenantID:    tenantID,
-		Name:        payload.Name,
-		TriggerType: payload.TriggerType,
-		Meta:        payload.Meta,
-		Actions:     actions,
-		Peers:       peers,
-	}
+	req := buildCreateFlowRequest(tenantID, &payload)
 
 	result, err := h.usecase.CreateFlow(c.Context(), req)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(map[string]string{
 			"error": "Failed to create flow",
@@ -163,7 +138,7 @@ func (h *Handler) GetFlow(c *fiber.Ctx) error {
 
 // UpdateFlow godoc
 // @Summary Update a flow
-// @Description Update an existing flow's properties
+// @Description Update an existing flow's properties. Only active flows run their triggers: paused flows hold them as held runs, which are released when the flow is activated again and rejected when it is archived. A flow is only activated once its graph is valid
 // @Tags flows
 // @Accept json
 // @Produce json
@@ -171,7 +146,7 @@ func (h *Handler) GetFlow(c *fiber.Ctx) error {
 // @Param flow_id path string true "Flow ID"
 // @Param payload body UpdateFlowPayload true "Flow update payload"
 // @Success 200 {object} spider.Flow
-// @Failure 400 {object} map[string]string
+// @Failure 400 {object} ValidationErrorResponse
 // @Failure 500 {object} map[string]string
 // @Router /tenants/{tenant_id}/flows/{flow_id} [put]
 func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
@@ -194,6 +169,8 @@ func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
 		TriggerType spider.FlowTriggerType   `json:"trigger_type"`
 		Meta        map[string]string         `json:"meta,omitempty"`
 		Status      spider.FlowStatus         `json:"status"`
+		Deadline    spider.Duration           `json:"deadline,omitempty"`
+		Retention   spider.Duration           `json:"retention,omitempty"`
 	}
 
 	err := c.BodyParser(&payload)
@@ -207,6 +184,14 @@ func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
 		})
 	}
 
+	switch payload.Status {
+	case "", spider.FlowStatusDraft, spider.FlowStatusActive, spider.FlowStatusPaused, spider.FlowStatusArchived:
+	default:
+		return c.Status(400).JSON(map[string]string{
+			"error": "invalid status",
+		})
+	}
+
 	req := &usecase.UpdateFlowRequest{
 		TenantID:    tenantID,
 		FlowID:      flowID,
@@ -214,9 +199,18 @@ func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
 		TriggerType: payload.TriggerType,
 		Meta:        payload.Meta,
 		Status:      payload.Status,
+		Deadline:    payload.Deadline,
+		Retention:   payload.Retention,
 	}
 
 	flow, err := h.usecase.UpdateFlow(c.Context(), req)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(map[string]string{
 			"error": "Failed to update flow",
@@ -226,6 +220,70 @@ func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
 	return c.JSON(flow)
 }
 
+// ReplaceFlowGraph godoc
+// @Summary Replace a flow graph
+// @Description Replace the settings, actions and peers of an existing flow at once. The flow keeps its status, and runs already started keep the graph they started on
+// @Tags flows
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param payload body CreateFlowPayload true "Flow graph payload"
+// @Success 200 {object} usecase.FlowResponse
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/graph [put]
+func (h *Handler) ReplaceFlowGraph(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	var payload CreateFlowPayload
+
+	err := c.BodyParser(&payload)
+	if err != nil {
+		return err
+	}
+
+	if payload.Name == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "name is required",
+		})
+	}
+
+	result, err := h.usecase.ReplaceFlowGraph(c.Context(), flowID, buildCreateFlowRequest(tenantID, &payload))
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to replace flow graph",
+		})
+	}
+
+	return c.JSON(result)
+}
+
 // DeleteFlow godoc
 // @Summary Delete a flow
 // @Description Delete an existing flow
@@ -234,6 +292,7 @@ func (h *Handler) UpdateFlow(c *fiber.Ctx) error {
 // @Param flow_id path string true "Flow ID"
 // @Success 204
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /tenants/{tenant_id}/flows/{flow_id} [delete]
 func (h *Handler) DeleteFlow(c *fiber.Ctx) error {
@@ -252,6 +311,11 @@ func (h *Handler) DeleteFlow(c *fiber.Ctx) error {
 	}
 
 	err := h.usecase.DeleteFlow(c.Context(), tenantID, flowID)
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(map[string]string{
 			"error": "Failed to delete flow",
@@ -259,4 +323,40 @@ func (h *Handler) DeleteFlow(c *fiber.Ctx) error {
 	}
 
 	return c.Status(204).Send(nil)
+}
+
+func buildCreateFlowRequest(tenantID string, payload *CreateFlowPayload) *usecase.CreateFlowRequest {
+	actions := make([]usecase.WorkflowActionInput, len(payload.Actions))
+	for i, action := range payload.Actions {
+		actions[i] = usecase.WorkflowActionInput{
+			Key:      action.Key,
+			ActionID: action.ActionID,
+			Config:   action.Config,
+			Mapper:   action.Mapper,
+			Meta:     action.Meta,
+			Join:     action.Join,
+			Retry:    action.Retry,
+			Timeout:  action.Timeout,
+		}
+	}
+
+	peers := make([]usecase.PeerInput, len(payload.Peers))
+	for i, peer := range payload.Peers {
+		peers[i] = usecase.PeerInput{
+			ParentKey:  peer.ParentKey,
+			MetaOutput: peer.MetaOutput,
+			ChildKey:   peer.ChildKey,
+		}
+	}
+
+	return &usecase.CreateFlowRequest{
+		TenantID:    tenantID,
+		Name:        payload.Name,
+		TriggerType: payload.TriggerType,
+		Meta:        payload.Meta,
+		Deadline:    payload.Deadline,
+		Retention:   payload.Retention,
+		Actions:     actions,
+		Peers:       peers,
+	}
 }
\ No newline at end of file
@@ -0,0 +1,125 @@
+package apis
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+// ExportFlow godoc
+// @Summary Export a flow
+// @Description Describe a flow and its graph as a document that can be kept in git and imported again
+// @Tags flows
+// @Produce json
+// @Produce application/yaml
+// @Param tenant_id path string true "Tenant ID"
+// @Param id path string true "Flow ID"
+// @Param format query string false "Document format" Enums(json, yaml) default(json)
+// @Success 200 {object} usecase.FlowDocument
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{id}/export [get]
+func (h *Handler) ExportFlow(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow id is required",
+		})
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "yaml" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "format must be json or yaml",
+		})
+	}
+
+	doc, err := h.usecase.ExportFlow(c.Context(), tenantID, flowID)
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to export flow",
+		})
+	}
+
+	if format == "json" {
+		return c.JSON(doc)
+	}
+
+	data, err := usecase.MarshalFlowDocumentYAML(doc)
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to export flow",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/yaml")
+
+	return c.Send(data)
+}
+
+// ImportFlow godoc
+// @Summary Import a flow
+// @Description Create the flow of a YAML or JSON document, or replace the settings and graph of the flow with its ID. Importing a document the flow already matches changes nothing
+// @Tags flows
+// @Accept json
+// @Accept application/yaml
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param payload body usecase.FlowDocument true "Flow document"
+// @Success 200 {object} spider.Flow
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/import [post]
+func (h *Handler) ImportFlow(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	doc, err := usecase.ParseFlowDocument(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(map[string]string{
+			"error": "invalid flow document: " + err.Error(),
+		})
+	}
+
+	flow, err := h.usecase.ImportFlow(c.Context(), tenantID, doc)
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid flow",
+			Fields: verr.Fields,
+		})
+	}
+	// flow IDs are unique across tenants
+	if errors.Is(err, spider.ErrAlreadyExists) {
+		return c.Status(409).JSON(map[string]string{
+			"error": "Flow ID is taken by another tenant",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to import flow",
+		})
+	}
+
+	return c.JSON(flow)
+}
@@ -0,0 +1,44 @@
+package apis
+
+import "github.com/gofiber/fiber/v2"
+
+// Register adds the routes of the workflow API to router.
+func (h *Handler) Register(router fiber.Router) {
+
+	// flows
+	router.Get("/tenants/:tenant_id/flows", h.ListFlows)
+	router.Get("/tenants/:tenant_id/flows/:id", h.GetFlow)
+	router.Post("/tenants/:tenant_id/flows", h.CreateFlow)
+	router.Post("/tenants/:tenant_id/flows/import", h.ImportFlow)
+	router.Get("/tenants/:tenant_id/flows/:id/export", h.ExportFlow)
+	router.Put("/tenants/:tenant_id/flows/:flow_id", h.UpdateFlow)
+	router.Put("/tenants/:tenant_id/flows/:flow_id/graph", h.ReplaceFlowGraph)
+	router.Delete("/tenants/:tenant_id/flows/:flow_id", h.DeleteFlow)
+	router.Post("/tenants/:tenant_id/flows/:flow_id/simulate", h.SimulateFlow)
+
+	// runs
+	router.Get("/tenants/:tenant_id/flows/:flow_id/runs", h.ListRuns)
+	router.Post("/tenants/:tenant_id/flows/:flow_id/runs", h.TriggerRun)
+	router.Get("/tenants/:tenant_id/flows/:flow_id/runs/:session_id", h.GetRun)
+	router.Post("/tenants/:tenant_id/flows/:flow_id/runs/:session_id/cancel", h.CancelRun)
+
+	// dead letters
+	router.Get("/tenants/:tenant_id/dead-letters", h.ListDeadLetters)
+	router.Get("/tenants/:tenant_id/dead-letters/:id", h.GetDeadLetter)
+	router.Post("/tenants/:tenant_id/dead-letters/:id/replay", h.ReplayDeadLetter)
+	router.Delete("/tenants/:tenant_id/dead-letters/:id", h.DiscardDeadLetter)
+
+	// actions
+	router.Post("/tenants/:tenant_id/workflows/:workflow_id/actions", h.AddAction)
+	router.Post("/tenants/:tenant_id/workflows/:workflow_id/actions/:key/disable", h.DisableAction)
+	router.Post("/tenants/:tenant_id/workflows/:workflow_id/actions/:key/enable", h.EnableAction)
+	router.Put("/tenants/:tenant_id/workflows/:workflow_id/actions/:key", h.UpdateAction)
+	router.Delete("/tenants/:tenant_id/workflows/:workflow_id/actions/:key", h.DeleteAction)
+
+	// peers
+	router.Post("/tenants/:tenant_id/workflows/:workflow_id/peers", h.AddPeer)
+	router.Delete("/tenants/:tenant_id/workflows/:workflow_id/peers/:parent_key/:meta_output/:child_key", h.RemovePeer)
+
+	// admin
+	router.Get("/admin/session-contexts/usage", h.ListSessionContextUsage)
+}
@@ -0,0 +1,308 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+const defaultRunWaitTimeout = time.Minute
+
+// ListRuns godoc
+// @Summary List flow runs
+// @Description Get a paginated list of runs (sessions) of a flow, newest first
+// @Tags runs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param status query string false "Run status" Enums(running, succeeded, failed, cancelled, timed_out, held, rejected)
+// @Param from query string false "Only runs started at or after this time (RFC3339)"
+// @Param to query string false "Only runs started before this time (RFC3339)"
+// @Success 200 {object} spider.RunListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/runs [get]
+func (h *Handler) ListRuns(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize := c.QueryInt("page_size", 20)
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	status := spider.RunStatus(c.Query("status"))
+
+	switch status {
+	case "", spider.RunStatusRunning, spider.RunStatusSucceeded, spider.RunStatusFailed, spider.RunStatusCancelled, spider.RunStatusTimedOut, spider.RunStatusHeld, spider.RunStatusRejected:
+	default:
+		return c.Status(400).JSON(map[string]string{
+			"error": "invalid status",
+		})
+	}
+
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		return c.Status(400).JSON(map[string]string{
+			"error": "from must be an RFC3339 time",
+		})
+	}
+
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		return c.Status(400).JSON(map[string]string{
+			"error": "to must be an RFC3339 time",
+		})
+	}
+
+	result, err := h.usecase.ListRuns(c.Context(), &spider.ListRunsRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Status:     status,
+		From:       from,
+		To:         to,
+		Page:       page,
+		PageSize:   pageSize,
+	})
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to list runs",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// GetRun godoc
+// @Summary Get run details
+// @Description Get a run (session) of a flow with its full step timeline
+// @Tags runs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param session_id path string true "Session ID"
+// @Success 200 {object} spider.Run
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/runs/{session_id} [get]
+func (h *Handler) GetRun(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	sessionID := c.Params("session_id")
+	if sessionID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "session_id is required",
+		})
+	}
+
+	run, err := h.usecase.GetRun(c.Context(), tenantID, flowID, sessionID)
+	if err != nil {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Run not found",
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// CancelRun godoc
+// @Summary Cancel a run
+// @Description Cancel a running or held run. Its running steps are cancelled, nothing follows them, and the workers still processing their inputs are told to stop
+// @Tags runs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param session_id path string true "Session ID"
+// @Success 200 {object} spider.Run
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/runs/{session_id}/cancel [post]
+func (h *Handler) CancelRun(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	sessionID := c.Params("session_id")
+	if sessionID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "session_id is required",
+		})
+	}
+
+	run, err := h.usecase.CancelRun(c.Context(), tenantID, flowID, sessionID)
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Run not found",
+		})
+	}
+	if errors.Is(err, usecase.ErrRunEnded) {
+		return c.Status(409).JSON(map[string]string{
+			"error": "Run already ended",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to cancel run",
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// TriggerRun godoc
+// @Summary Start a run
+// @Description Start a run of a flow from its entry action with a payload, as a trigger worker would. The key and meta_output are only needed when the flow has several entry actions, or its entry action is followed on several meta outputs. With wait=true the request lasts until the run ends, or until the timeout, and returns its final context
+// @Tags runs
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param wait query bool false "Wait for the run to end"
+// @Param timeout query string false "Longest wait, as a duration" default(1m)
+// @Param payload body TriggerRunPayload true "Trigger payload"
+// @Success 200 {object} usecase.TriggerRunResponse
+// @Success 202 {object} usecase.TriggerRunResponse
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/runs [post]
+func (h *Handler) TriggerRun(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	timeout := defaultRunWaitTimeout
+
+	if value := c.Query("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(map[string]string{
+				"error": "timeout must be a positive duration",
+			})
+		}
+
+		timeout = d
+	}
+
+	var payload TriggerRunPayload
+
+	err := c.BodyParser(&payload)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.usecase.TriggerRun(c.Context(), &usecase.TriggerRunRequest{
+		TenantID:   tenantID,
+		FlowID:     flowID,
+		Key:        payload.Key,
+		MetaOutput: payload.MetaOutput,
+		Payload:    payload.Payload,
+	})
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid trigger",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to trigger run",
+		})
+	}
+
+	if !c.QueryBool("wait") {
+		return c.Status(202).JSON(result)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	run, err := h.usecase.WaitRun(ctx, tenantID, flowID, result.SessionID)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// the run has not started yet, it may still
+		return c.Status(202).JSON(result)
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to wait for run",
+		})
+	}
+
+	return c.JSON(run)
+}
+
+func parseTimeQuery(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,32 @@
+package apis
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// SessionContextUsageResponse is the session context storage of every tenant
+type SessionContextUsageResponse struct {
+	Tenants []spider.SessionContextUsage `json:"tenants"`
+}
+
+// ListSessionContextUsage godoc
+// @Summary Session context usage
+// @Description Get the number and size of the stored session contexts of every tenant
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SessionContextUsageResponse
+// @Failure 500 {object} map[string]string
+// @Router /admin/session-contexts/usage [get]
+func (h *Handler) ListSessionContextUsage(c *fiber.Ctx) error {
+	usages, err := h.usecase.ListSessionContextUsage(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to list session context usage",
+		})
+	}
+
+	return c.JSON(SessionContextUsageResponse{
+		Tenants: usages,
+	})
+}
@@ -0,0 +1,74 @@
+package apis
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+// SimulateFlow godoc
+// @Summary Simulate a flow
+// @Description Walk the graph of a flow from its entry action with a payload, as a run would, taking the output of each action from outputs instead of its workers. Nothing is sent to the workers and no run is recorded. Returns the input computed for each action reached and the path taken. A path stops at an action without a stubbed output. The key and meta_output default as when starting a run
+// @Tags flows
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param flow_id path string true "Flow ID"
+// @Param payload body SimulateFlowPayload true "Trigger payload and stubbed outputs"
+// @Success 200 {object} spider.Simulation
+// @Failure 400 {object} ValidationErrorResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tenants/{tenant_id}/flows/{flow_id}/simulate [post]
+func (h *Handler) SimulateFlow(c *fiber.Ctx) error {
+	tenantID := c.Params("tenant_id")
+	if tenantID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "tenant_id is required",
+		})
+	}
+
+	flowID := c.Params("flow_id")
+	if flowID == "" {
+		return c.Status(400).JSON(map[string]string{
+			"error": "flow_id is required",
+		})
+	}
+
+	var payload SimulateFlowPayload
+
+	err := c.BodyParser(&payload)
+	if err != nil {
+		return err
+	}
+
+	simulation, err := h.usecase.SimulateFlow(c.Context(), &usecase.SimulateFlowRequest{
+		TenantID:   tenantID,
+		FlowID:     flowID,
+		Key:        payload.Key,
+		MetaOutput: payload.MetaOutput,
+		Payload:    payload.Payload,
+		Outputs:    payload.Outputs,
+	})
+	var verr *usecase.ValidationError
+	if errors.As(err, &verr) {
+		return c.Status(400).JSON(ValidationErrorResponse{
+			Error:  "invalid simulation",
+			Fields: verr.Fields,
+		})
+	}
+	if errors.Is(err, spider.ErrNotFound) {
+		return c.Status(404).JSON(map[string]string{
+			"error": "Flow not found",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(map[string]string{
+			"error": "Failed to simulate flow",
+		})
+	}
+
+	return c.JSON(simulation)
+}
@@ -0,0 +1,60 @@
+package spider
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	DeadLetterReasonMalformed  = "malformed"
+	DeadLetterReasonPermanent  = "permanent_error"
+	DeadLetterReasonMaxDeliver = "max_deliver"
+)
+
+// deadLetterUnknownTenant files messages whose tenant cannot be read, such
+// as payloads that are not valid JSON.
+const deadLetterUnknownTenant = "_unknown"
+
+// DeadLetter is a message that was given up on, together with why it
+// failed. Data is the original payload, which is published back to Subject
+// when the dead letter is replayed.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	TenantID string    `json:"tenant_id"`
+	Subject  string    `json:"subject"`
+	Reason   string    `json:"reason"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Data     string    `json:"data"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type ListDeadLettersRequest struct {
+	TenantID string
+	Page     int
+	PageSize int
+}
+
+type DeadLetterListResponse struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+	Total       int64        `json:"total"`
+	Page        int          `json:"page"`
+	PageSize    int          `json:"page_size"`
+}
+
+// deadLetterReason tells why a message that failed with err on its
+// delivered-th delivery is given up on, or returns "" when it should be
+// redelivered.
+func deadLetterReason(err error, delivered uint64, maxDeliver int) string {
+
+	switch {
+	case errors.Is(err, ErrMalformedMessage):
+		return DeadLetterReasonMalformed
+	case ErrorClassOf(err) == ErrorClassPermanent:
+		return DeadLetterReasonPermanent
+	case maxDeliver > 0 && delivered >= uint64(maxDeliver):
+		return DeadLetterReasonMaxDeliver
+	}
+
+	return ""
+}
@@ -0,0 +1,76 @@
+package spider
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ErrorClassUnknown   = "unknown"
+	ErrorClassTransient = "transient"
+	ErrorClassPermanent = "permanent"
+)
+
+// ErrMalformedMessage marks a message that can never be processed, such as
+// a payload that is not valid JSON. Such messages are not redelivered.
+var ErrMalformedMessage = errors.New("malformed message")
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrRunCancelled is the cause of the context of a handler whose run was
+// cancelled while it was processing an input.
+var ErrRunCancelled = errors.New("run cancelled")
+
+// ErrNotFound and ErrAlreadyExists are returned by every storage adapter,
+// whatever error its backend reports for a missing record or a duplicate
+// key.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+var ErrFlowSnapshotNotFound = fmt.Errorf("flow snapshot %w", ErrNotFound)
+
+// ActionError attaches an error class to an error returned by a worker
+// handler, so retry policies can tell transient failures from permanent
+// ones.
+type ActionError struct {
+	Class string
+	Err   error
+}
+
+func (e *ActionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+func NewActionError(class string, err error) error {
+	return &ActionError{
+		Class: class,
+		Err:   err,
+	}
+}
+
+func TransientError(err error) error {
+	return NewActionError(ErrorClassTransient, err)
+}
+
+func PermanentError(err error) error {
+	return NewActionError(ErrorClassPermanent, err)
+}
+
+// ErrorClassOf returns the class of err, or ErrorClassUnknown when err does
+// not wrap an ActionError.
+func ErrorClassOf(err error) string {
+
+	var actionErr *ActionError
+
+	if errors.As(err, &actionErr) && actionErr.Class != "" {
+		return actionErr.Class
+	}
+
+	return ErrorClassUnknown
+}
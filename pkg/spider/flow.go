@@ -3,8 +3,10 @@ package spider
 type FlowStatus string
 
 var (
-	FlowStatusDraft  FlowStatus = "draft"
-	FlowStatusActive FlowStatus = "active"
+	FlowStatusDraft    FlowStatus = "draft" // Ignores triggers
+	FlowStatusActive   FlowStatus = "active"
+	FlowStatusPaused   FlowStatus = "paused"   // Holds triggers until the flow is active again
+	FlowStatusArchived FlowStatus = "archived" // Rejects triggers
 )
 
 type FlowTriggerType string
@@ -22,4 +24,6 @@ type Flow struct {
 	Meta        map[string]string `json:"meta,omitempty"`
 	Status      FlowStatus        `json:"status"`
 	Version     uint64            `json:"version"`
+	Deadline    Duration          `json:"deadline,omitempty" swaggertype:"string" example:"1h"`   // Overall time limit of a run
+	Retention   Duration          `json:"retention,omitempty" swaggertype:"string" example:"72h"` // Longest time a session context is kept, never while its task runs or waits for a retry, until its task is done when 0
 }
@@ -0,0 +1,50 @@
+package spider
+
+import "time"
+
+// FlowSnapshot is the graph of a flow, its actions and their deps, as it
+// was at one version. A session resolves its actions from the snapshot of
+// the version it started on, so edits never reach a session midway.
+type FlowSnapshot struct {
+	TenantID   string              `json:"tenant_id"`
+	WorkflowID string              `json:"workflow_id"`
+	Version    uint64              `json:"version"`
+	Actions    []WorkflowAction    `json:"actions"`
+	Deps       []WorkflowActionDep `json:"deps"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+func (s *FlowSnapshot) Action(key string) (*WorkflowAction, bool) {
+
+	for i := range s.Actions {
+		if s.Actions[i].Key == key {
+			return &s.Actions[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Dependencies returns the actions that follow key when it outputs
+// metaOutput.
+func (s *FlowSnapshot) Dependencies(key, metaOutput string) []WorkflowAction {
+
+	var deps []WorkflowAction
+
+	for _, dep := range s.Deps {
+
+		if dep.Key != key || dep.MetaOutput != metaOutput {
+			continue
+		}
+
+		action, ok := s.Action(dep.DepKey)
+
+		if !ok {
+			continue
+		}
+
+		deps = append(deps, *action)
+	}
+
+	return deps
+}
@@ -18,9 +18,11 @@ type InputMessage struct {
 	WorkflowID string
 	// TODO
 	// WorkflowActionID string
-	Key      string
-	ActionID string
-	Values   string
+	Key         string
+	ActionID    string
+	Values      string
+	Attempt     int
+	FlowVersion uint64
 }
 
 func (m *InputMessage) ToOutputMessage(metaOutput, values string) OutputMessage {
@@ -31,9 +33,30 @@ func (m *InputMessage) ToOutputMessage(metaOutput, values string) OutputMessage
 		WorkflowID: m.WorkflowID,
 		// TODO
 		// WorkflowActionID: m.WorkflowActionID,
-		Key:        m.Key,
-		MetaOutput: metaOutput,
-		Values:     values,
+		Key:         m.Key,
+		MetaOutput:  metaOutput,
+		Values:      values,
+		Attempt:     m.Attempt,
+		FlowVersion: m.FlowVersion,
+	}
+}
+
+// ToFailedOutputMessage reports a handler error back to the workflow, which
+// decides whether the step is retried.
+func (m *InputMessage) ToFailedOutputMessage(err error) OutputMessage {
+	return OutputMessage{
+		SessionID:  m.SessionID,
+		TaskID:     m.TaskID,
+		TenantID:   m.TenantID,
+		WorkflowID: m.WorkflowID,
+		// TODO
+		// WorkflowActionID: m.WorkflowActionID,
+		Key:         m.Key,
+		Values:      "{}",
+		Attempt:     m.Attempt,
+		FlowVersion: m.FlowVersion,
+		Error:       err.Error(),
+		ErrorClass:  ErrorClassOf(err),
 	}
 }
 
@@ -49,10 +72,14 @@ type OutputMessage struct {
 	WorkflowID string
 	// TODO
 	// WorkflowActionID string
-	Key        string
-	ActionID   string
-	MetaOutput string
-	Values     string
+	Key         string
+	ActionID    string
+	MetaOutput  string
+	Values      string
+	Attempt     int
+	FlowVersion uint64
+	Error       string
+	ErrorClass  string
 }
 
 type TriggerMessageContext struct {
@@ -69,4 +96,19 @@ type TriggerMessage struct {
 	ActionID   string
 	MetaOutput string
 	Values     string
+	// SessionID is set when a held run is released, so the workflow resumes
+	// that run instead of starting a new one.
+	SessionID string
+	// NewSessionID is the session ID of the run the trigger starts, chosen
+	// by the sender so it knows the run before the workflow receives it. A
+	// new one is generated when it is empty.
+	NewSessionID string
+}
+
+// CancelMessage tells the workers that a run was cancelled, so the handlers
+// still processing its inputs can stop.
+type CancelMessage struct {
+	TenantID   string
+	WorkflowID string
+	SessionID  string
 }
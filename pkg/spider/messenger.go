@@ -8,6 +8,12 @@ type WorkflowMessengerAdapter interface {
 	ListenTriggerMessages(ctx context.Context, h func(c TriggerMessageContext, message TriggerMessage) error) error
 	ListenOutputMessages(ctx context.Context, h func(c OutputMessageContext, message OutputMessage) error) error
 	SendInputMessage(ctx context.Context, message InputMessage) error
+	SendTriggerMessage(ctx context.Context, message TriggerMessage) error
+	SendCancelMessage(ctx context.Context, message CancelMessage) error
+	ListDeadLetters(ctx context.Context, req *ListDeadLettersRequest) (*DeadLetterListResponse, error)
+	GetDeadLetter(ctx context.Context, tenantID, id string) (*DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, tenantID, id string) error
+	DiscardDeadLetter(ctx context.Context, tenantID, id string) error
 	Close(ctx context.Context) error
 }
 
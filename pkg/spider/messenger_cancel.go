@@ -0,0 +1,96 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+type runKey struct {
+	workflowID string
+	sessionID  string
+}
+
+// runCancels keeps the contexts of the handlers processing an input, by
+// run, so a cancel message reaches the handlers of its run.
+type runCancels struct {
+	mu      sync.Mutex
+	seq     uint64
+	cancels map[runKey]map[uint64]context.CancelCauseFunc
+}
+
+func newRunCancels() *runCancels {
+	return &runCancels{
+		cancels: map[runKey]map[uint64]context.CancelCauseFunc{},
+	}
+}
+
+// track derives the context of a handler of an input of the run. release
+// must be called once the handler returned.
+func (r *runCancels) track(ctx context.Context, workflowID, sessionID string) (context.Context, func()) {
+
+	hctx, cancel := context.WithCancelCause(ctx)
+
+	key := runKey{workflowID, sessionID}
+
+	r.mu.Lock()
+
+	r.seq++
+	id := r.seq
+
+	if r.cancels[key] == nil {
+		r.cancels[key] = map[uint64]context.CancelCauseFunc{}
+	}
+
+	r.cancels[key][id] = cancel
+
+	r.mu.Unlock()
+
+	release := func() {
+		r.mu.Lock()
+
+		delete(r.cancels[key], id)
+
+		if len(r.cancels[key]) == 0 {
+			delete(r.cancels, key)
+		}
+
+		r.mu.Unlock()
+
+		cancel(nil)
+	}
+
+	return hctx, release
+}
+
+// cancel cancels the contexts of the handlers of the run of message with
+// ErrRunCancelled.
+func (r *runCancels) cancel(message CancelMessage) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancels := r.cancels[runKey{message.WorkflowID, message.SessionID}]
+
+	if len(cancels) == 0 {
+		return
+	}
+
+	slog.Info(
+		"cancelling handlers",
+		slog.String("workflow_id", message.WorkflowID),
+		slog.String("session_id", message.SessionID),
+		slog.Int("handlers", len(cancels)),
+	)
+
+	for _, cancel := range cancels {
+		cancel(ErrRunCancelled)
+	}
+}
+
+// runCancelled reports whether ctx, a context from track, was cancelled by
+// a cancel message.
+func runCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrRunCancelled)
+}
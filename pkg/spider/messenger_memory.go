@@ -0,0 +1,406 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	memoryTriggerSubject = "trigger"
+	memoryInputSubject   = "input"
+	memoryOutputSubject  = "output"
+)
+
+// MemoryBroker carries messages between in-process messenger adapters. It
+// keeps the delivery semantics of the NATS adapters: a message is delivered
+// at least once, redelivered with a backoff while its handler fails, and
+// dead-lettered once it can never be processed or used up its deliveries.
+//
+// Triggers and outputs are shared by every workflow adapter of the broker,
+// and inputs by every worker adapter of the same action, each message going
+// to one of them. Cancel messages reach every worker adapter.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	queues      map[string]*memoryQueue
+	cancels     *runCancels
+	deadLetters []DeadLetter
+	seq         uint64
+	maxDeliver  int
+	nakDelay    time.Duration
+}
+
+type MemoryBrokerOpt struct {
+	// MaxDeliver is the number of deliveries of a message before it is
+	// dead-lettered. Defaults to the NATS_MAX_DELIVER default.
+	MaxDeliver int
+	// NakDelay is the delay before a failed message is redelivered. Zero
+	// backs off like the NATS adapters.
+	NakDelay time.Duration
+}
+
+func NewMemoryBroker(opt MemoryBrokerOpt) *MemoryBroker {
+
+	maxDeliver := opt.MaxDeliver
+
+	if maxDeliver == 0 {
+		maxDeliver = defaultNATSMaxDeliver
+	}
+
+	return &MemoryBroker{
+		queues:     map[string]*memoryQueue{},
+		cancels:    newRunCancels(),
+		maxDeliver: maxDeliver,
+		nakDelay:   opt.NakDelay,
+	}
+}
+
+type memoryMessage struct {
+	subject     string
+	tenantID    string
+	value       any
+	publishedAt time.Time
+	delivered   uint64
+}
+
+type memoryQueue struct {
+	mu      sync.Mutex
+	pending []*memoryMessage
+	notify  chan struct{}
+}
+
+func (q *memoryQueue) push(msg *memoryMessage) {
+	q.mu.Lock()
+	q.pending = append(q.pending, msg)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *memoryQueue) pop() (*memoryMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil, false
+	}
+
+	msg := q.pending[0]
+	q.pending = q.pending[1:]
+
+	return msg, true
+}
+
+func memoryQueueName(subject, actionID string) string {
+
+	if subject == memoryInputSubject {
+		return fmt.Sprintf("%s.%s", subject, actionID)
+	}
+
+	return subject
+}
+
+// queue returns the queue of a consumer, creating it on first use so
+// messages published before anyone listens are kept until someone does.
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+
+	if !ok {
+		q = &memoryQueue{
+			notify: make(chan struct{}, 1),
+		}
+
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+func (b *MemoryBroker) publish(subject, actionID, tenantID string, value any) {
+
+	slog.Info(
+		"published",
+		slog.String("subject", subject),
+		slog.Any("message", value),
+	)
+
+	b.queue(memoryQueueName(subject, actionID)).push(&memoryMessage{
+		subject:     subject,
+		tenantID:    tenantID,
+		value:       value,
+		publishedAt: time.Now(),
+	})
+}
+
+// consume hands the messages of q to h, at most limit at once, until ctx is
+// done.
+func (b *MemoryBroker) consume(ctx context.Context, q *memoryQueue, limit int, h func(msg *memoryMessage) error) {
+
+	sem := make(chan struct{}, limit)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+
+		msg, ok := q.pop()
+
+		for !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+			}
+
+			msg, ok = q.pop()
+		}
+
+		msg.delivered++
+
+		go func() {
+			defer func() {
+				<-sem
+			}()
+
+			b.settle(ctx, q, msg, h(msg))
+		}()
+	}
+}
+
+func (b *MemoryBroker) settle(ctx context.Context, q *memoryQueue, msg *memoryMessage, err error) {
+
+	if err == nil {
+		return
+	}
+
+	reason := deadLetterReason(err, msg.delivered, b.maxDeliver)
+
+	if reason != "" {
+		slog.Error(
+			"message dead-lettered",
+			slog.String("reason", reason),
+			slog.String("error", err.Error()),
+			slog.Uint64("delivered", msg.delivered),
+		)
+
+		// like the NATS adapters, the message is kept until it reaches the
+		// dead-letter queue rather than delivered again
+		for attempt := uint64(1); ; attempt++ {
+
+			dlqErr := b.deadLetter(msg, reason, err)
+
+			if dlqErr == nil {
+				return
+			}
+
+			slog.Error("dead-letter failed", slog.String("error", dlqErr.Error()), slog.Uint64("attempt", attempt))
+
+			select {
+			case <-ctx.Done():
+				q.push(msg)
+				return
+			case <-time.After(b.retryDelay(attempt)):
+			}
+		}
+	}
+
+	delay := b.retryDelay(msg.delivered)
+
+	slog.Warn(
+		"message nacked",
+		slog.String("error", err.Error()),
+		slog.Uint64("delivered", msg.delivered),
+		slog.Duration("delay", delay),
+	)
+
+	time.AfterFunc(delay, func() {
+		q.push(msg)
+	})
+}
+
+func (b *MemoryBroker) retryDelay(attempt uint64) time.Duration {
+
+	if b.nakDelay > 0 {
+		return b.nakDelay
+	}
+
+	return nakDelay(attempt)
+}
+
+func (b *MemoryBroker) deadLetter(msg *memoryMessage, reason string, cause error) error {
+
+	data, err := marshalMemoryMessage(msg.value)
+
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+
+	b.deadLetters = append(b.deadLetters, DeadLetter{
+		ID:       strconv.FormatUint(b.seq, 10),
+		TenantID: msg.tenantID,
+		Subject:  msg.subject,
+		Reason:   reason,
+		Error:    cause.Error(),
+		Attempts: int(msg.delivered),
+		Data:     string(data),
+		FailedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (b *MemoryBroker) listDeadLetters(req *ListDeadLettersRequest) *DeadLetterListResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deadLetters := []DeadLetter{}
+
+	for _, deadLetter := range b.deadLetters {
+		if deadLetter.TenantID == req.TenantID {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+
+	total := int64(len(deadLetters))
+
+	skip := min((req.Page-1)*req.PageSize, len(deadLetters))
+	end := min(skip+req.PageSize, len(deadLetters))
+
+	return &DeadLetterListResponse{
+		DeadLetters: deadLetters[skip:end],
+		Total:       total,
+		Page:        req.Page,
+		PageSize:    req.PageSize,
+	}
+}
+
+func (b *MemoryBroker) getDeadLetter(tenantID, id string) (*DeadLetter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, deadLetter := range b.deadLetters {
+		if deadLetter.ID == id && deadLetter.TenantID == tenantID {
+			return &deadLetter, nil
+		}
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+func (b *MemoryBroker) removeDeadLetter(tenantID, id string) (*DeadLetter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := slices.IndexFunc(b.deadLetters, func(deadLetter DeadLetter) bool {
+		return deadLetter.ID == id && deadLetter.TenantID == tenantID
+	})
+
+	if i < 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+
+	deadLetter := b.deadLetters[i]
+
+	b.deadLetters = slices.Delete(b.deadLetters, i, i+1)
+
+	return &deadLetter, nil
+}
+
+// replayDeadLetter publishes the original message of a dead letter again
+// and removes the dead letter.
+func (b *MemoryBroker) replayDeadLetter(tenantID, id string) error {
+
+	deadLetter, err := b.getDeadLetter(tenantID, id)
+
+	if err != nil {
+		return err
+	}
+
+	value, actionID, err := unmarshalMemoryMessage(deadLetter.Subject, []byte(deadLetter.Data))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = b.removeDeadLetter(tenantID, id)
+
+	if err != nil {
+		return err
+	}
+
+	b.publish(deadLetter.Subject, actionID, tenantID, value)
+
+	return nil
+}
+
+// marshalMemoryMessage encodes a message like the NATS adapters do, so dead
+// letters look the same whichever broker carried them.
+func marshalMemoryMessage(value any) ([]byte, error) {
+
+	switch m := value.(type) {
+	case TriggerMessage:
+		return json.Marshal(NatsTriggerMessage{}.FromTriggerMessage(m))
+	case InputMessage:
+		return json.Marshal(NatsInputMessage{}.FromInputMessage(m))
+	case OutputMessage:
+		return json.Marshal(NatsOutputMessage{}.FromOutputMessage(m))
+	}
+
+	return nil, fmt.Errorf("unsupported message %T", value)
+}
+
+func unmarshalMemoryMessage(subject string, data []byte) (any, string, error) {
+
+	switch subject {
+	case memoryTriggerSubject:
+		var b NatsTriggerMessage
+
+		err := json.Unmarshal(data, &b)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return b.ToTriggerMessage(), "", nil
+	case memoryInputSubject:
+		var b NatsInputMessage
+
+		err := json.Unmarshal(data, &b)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return b.ToInputMessage(), b.ActionID, nil
+	case memoryOutputSubject:
+		var b NatsOutputMessage
+
+		err := json.Unmarshal(data, &b)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return b.ToOutputMessage(), "", nil
+	}
+
+	return nil, "", fmt.Errorf("unknown subject %s", subject)
+}
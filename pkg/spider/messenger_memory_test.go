@@ -0,0 +1,246 @@
+package spider_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+)
+
+const memoryTestTenantID = "tenant"
+
+// listenInputs runs a worker adapter of actionID over broker until the
+// test ends.
+func listenInputs(t *testing.T, broker *spider.MemoryBroker, actionID string, h func(c spider.InputMessageContext, m spider.InputMessage) error) *spider.MemoryWorkerMessengerAdapter {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	worker := spider.NewMemoryWorkerMessengerAdapter(broker, actionID)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = worker.ListenInputMessages(ctx, h)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return worker
+}
+
+func sendInput(t *testing.T, workflow *spider.MemoryWorkflowMessengerAdapter, actionID, taskID string) {
+	t.Helper()
+
+	err := workflow.SendInputMessage(context.Background(), spider.InputMessage{
+		SessionID:  "session",
+		TaskID:     taskID,
+		TenantID:   memoryTestTenantID,
+		WorkflowID: "flow",
+		Key:        "key",
+		ActionID:   actionID,
+		Values:     "{}",
+	})
+
+	if err != nil {
+		t.Fatalf("SendInputMessage: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !ok() {
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMemoryMessengerAdapters(t *testing.T) {
+	spidertest.RunMessengerConformance(t, func(t *testing.T) spidertest.MessengerAdapters {
+
+		broker := spider.NewMemoryBroker(spider.MemoryBrokerOpt{})
+
+		workflow := spider.NewMemoryWorkflowMessengerAdapter(broker)
+
+		t.Cleanup(func() {
+			_ = workflow.Close(context.Background())
+		})
+
+		return spidertest.MessengerAdapters{
+			Workflow: workflow,
+			Worker: func(actionID string) spider.WorkerMessengerAdapter {
+				return spider.NewMemoryWorkerMessengerAdapter(broker, actionID)
+			},
+			MaxDeliver: 5,
+		}
+	})
+}
+
+func TestMemoryBrokerRoundTrip(t *testing.T) {
+
+	broker := spider.NewMemoryBroker(spider.MemoryBrokerOpt{})
+
+	workflow := spider.NewMemoryWorkflowMessengerAdapter(broker)
+
+	var worker *spider.MemoryWorkerMessengerAdapter
+
+	worker = listenInputs(t, broker, "echo", func(c spider.InputMessageContext, m spider.InputMessage) error {
+		return worker.SendOutputMessage(c.Context, m.ToOutputMessage("success", m.Values))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outputs := make(chan spider.OutputMessage, 1)
+
+	go func() {
+		_ = workflow.ListenOutputMessages(ctx, func(c spider.OutputMessageContext, m spider.OutputMessage) error {
+			outputs <- m
+			return nil
+		})
+	}()
+
+	sendInput(t, workflow, "echo", "task")
+
+	select {
+	case m := <-outputs:
+		if m.TaskID != "task" || m.MetaOutput != "success" {
+			t.Fatalf("output of task %s on %s, want task on success", m.TaskID, m.MetaOutput)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output received")
+	}
+}
+
+func TestMemoryBrokerRedelivery(t *testing.T) {
+
+	broker := spider.NewMemoryBroker(spider.MemoryBrokerOpt{
+		NakDelay: time.Millisecond,
+	})
+
+	workflow := spider.NewMemoryWorkflowMessengerAdapter(broker)
+
+	var deliveries atomic.Int32
+
+	listenInputs(t, broker, "flaky", func(c spider.InputMessageContext, m spider.InputMessage) error {
+
+		if deliveries.Add(1) == 1 {
+			return errors.New("flaky")
+		}
+
+		return nil
+	})
+
+	sendInput(t, workflow, "flaky", "task")
+
+	waitFor(t, "the redelivery", func() bool {
+		return deliveries.Load() == 2
+	})
+
+	// a handled message is not delivered again
+	time.Sleep(20 * time.Millisecond)
+
+	if deliveries.Load() != 2 {
+		t.Fatalf("%d deliveries, want 2", deliveries.Load())
+	}
+}
+
+func TestMemoryBrokerDeadLetter(t *testing.T) {
+
+	ctx := context.Background()
+
+	broker := spider.NewMemoryBroker(spider.MemoryBrokerOpt{
+		MaxDeliver: 2,
+		NakDelay:   time.Millisecond,
+	})
+
+	workflow := spider.NewMemoryWorkflowMessengerAdapter(broker)
+
+	var deliveries atomic.Int32
+
+	listenInputs(t, broker, "failing", func(c spider.InputMessageContext, m spider.InputMessage) error {
+
+		deliveries.Add(1)
+
+		if m.TaskID == "permanent" {
+			return spider.PermanentError(errors.New("bad input"))
+		}
+
+		return errors.New("down")
+	})
+
+	sendInput(t, workflow, "failing", "transient")
+	sendInput(t, workflow, "failing", "permanent")
+
+	list := func() *spider.DeadLetterListResponse {
+		t.Helper()
+
+		deadLetters, err := workflow.ListDeadLetters(ctx, &spider.ListDeadLettersRequest{
+			TenantID: memoryTestTenantID,
+			Page:     1,
+			PageSize: 10,
+		})
+
+		if err != nil {
+			t.Fatalf("ListDeadLetters: %v", err)
+		}
+
+		return deadLetters
+	}
+
+	waitFor(t, "the dead letters", func() bool {
+		return list().Total == 2
+	})
+
+	// the permanent failure is dead-lettered at once, the other one once it
+	// used up its deliveries
+	if deliveries.Load() != 3 {
+		t.Fatalf("%d deliveries, want 3", deliveries.Load())
+	}
+
+	reasons := map[string]spider.DeadLetter{}
+
+	for _, deadLetter := range list().DeadLetters {
+		reasons[deadLetter.Reason] = deadLetter
+	}
+
+	if reasons[spider.DeadLetterReasonMaxDeliver].Attempts != 2 {
+		t.Errorf("max_deliver dead letter %#v, want 2 attempts", reasons[spider.DeadLetterReasonMaxDeliver])
+	}
+
+	if reasons[spider.DeadLetterReasonPermanent].Attempts != 1 {
+		t.Errorf("permanent dead letter %#v, want 1 attempt", reasons[spider.DeadLetterReasonPermanent])
+	}
+
+	err := workflow.ReplayDeadLetter(ctx, memoryTestTenantID, reasons[spider.DeadLetterReasonPermanent].ID)
+
+	if err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+
+	waitFor(t, "the replay", func() bool {
+		return deliveries.Load() == 4 && list().Total == 2
+	})
+
+	_, err = workflow.GetDeadLetter(ctx, memoryTestTenantID, reasons[spider.DeadLetterReasonPermanent].ID)
+
+	if !errors.Is(err, spider.ErrDeadLetterNotFound) {
+		t.Fatalf("GetDeadLetter of a replayed dead letter: %v, want %v", err, spider.ErrDeadLetterNotFound)
+	}
+}
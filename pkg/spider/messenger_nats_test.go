@@ -0,0 +1,175 @@
+package spider_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+	"github.com/targc/xnats-go"
+)
+
+const (
+	natsTestHost       = "127.0.0.1"
+	natsTestUser       = "spider"
+	natsTestPassword   = "spider"
+	natsTestMaxDeliver = 2
+)
+
+// natsTestPrefixes numbers the stream prefixes, so each subtest gets its own
+// streams and consumers on the shared server.
+var natsTestPrefixes atomic.Int64
+
+func natsTestPrefix() string {
+	return fmt.Sprintf("spider-test-%d", natsTestPrefixes.Add(1))
+}
+
+// startNATSServer runs an embedded NATS server with JetStream until the test
+// ends and returns its port.
+func startNATSServer(t *testing.T) int {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "spider-test",
+		Host:       natsTestHost,
+		Port:       server.RANDOM_PORT,
+		Username:   natsTestUser,
+		Password:   natsTestPassword,
+		JetStream:  true,
+		StoreDir:   t.TempDir(),
+		NoSigs:     true,
+		NoLog:      true,
+	})
+
+	if err != nil {
+		t.Fatalf("nats server: %v", err)
+	}
+
+	ns.Start()
+
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	addr, ok := ns.Addr().(*net.TCPAddr)
+
+	if !ok {
+		t.Fatalf("unexpected nats address %v", ns.Addr())
+	}
+
+	return addr.Port
+}
+
+// connectNATS opens a connection to the embedded server, for an adapter to
+// close along with itself.
+func connectNATS(t *testing.T, port int) *xnats.XNats {
+	t.Helper()
+
+	nc, err := xnats.Connect(xnats.ConnectOpt{
+		Host:     natsTestHost,
+		Port:     port,
+		User:     natsTestUser,
+		Password: natsTestPassword,
+	})
+
+	if err != nil {
+		t.Fatalf("nats connect: %v", err)
+	}
+
+	return nc
+}
+
+// breakNATSDeadLetters deletes the dead-letter stream of prefix, so
+// publishing a dead letter fails until restore creates it again.
+func breakNATSDeadLetters(t *testing.T, port int, prefix string) (restore func()) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	nc := connectNATS(t, port)
+
+	t.Cleanup(nc.Close)
+
+	stream := prefix + "-dlq"
+
+	err := nc.JS().DeleteStream(ctx, stream)
+
+	if err != nil {
+		t.Fatalf("delete %s: %v", stream, err)
+	}
+
+	return func() {
+
+		_, err := nc.JS().CreateStream(ctx, jetstream.StreamConfig{
+			Name:     stream,
+			Subjects: []string{stream + ".>"},
+			Storage:  jetstream.FileStorage,
+		})
+
+		if err != nil {
+			t.Errorf("create %s: %v", stream, err)
+		}
+	}
+}
+
+func TestNATSMessengerAdapters(t *testing.T) {
+
+	port := startNATSServer(t)
+
+	spidertest.RunMessengerConformance(t, func(t *testing.T) spidertest.MessengerAdapters {
+
+		ctx := context.Background()
+
+		prefix := natsTestPrefix()
+
+		workflow, err := spider.NewNATSWorkflowMessengerAdapter(ctx, connectNATS(t, port), spider.NewNATSWorkflowMessengerAdapterOpt{
+			StreamPrefix:      prefix,
+			ConsumerIDPrefix:  prefix,
+			BetaAutoSetupNATS: true,
+			MaxDeliver:        natsTestMaxDeliver,
+		})
+
+		if err != nil {
+			t.Fatalf("NewNATSWorkflowMessengerAdapter: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = workflow.Close(context.Background())
+		})
+
+		return spidertest.MessengerAdapters{
+			Workflow: workflow,
+			Worker: func(actionID string) spider.WorkerMessengerAdapter {
+
+				worker, err := spider.NewNATSWorkerMessengerAdapter(ctx, connectNATS(t, port), actionID, spider.NewNATSWorkerMessengerAdapterOpt{
+					StreamPrefix:      prefix,
+					ConsumerIDPrefix:  prefix,
+					BetaAutoSetupNATS: true,
+					MaxDeliver:        natsTestMaxDeliver,
+				})
+
+				if err != nil {
+					t.Fatalf("NewNATSWorkerMessengerAdapter: %v", err)
+				}
+
+				t.Cleanup(func() {
+					_ = worker.Close(context.Background())
+				})
+
+				return worker
+			},
+			MaxDeliver: natsTestMaxDeliver,
+			BreakDeadLetters: func(t *testing.T) func() {
+				return breakNATSDeadLetters(t, port, prefix)
+			},
+		}
+	})
+}
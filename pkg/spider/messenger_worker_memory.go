@@ -0,0 +1,98 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+type MemoryWorkerMessengerAdapter struct {
+	broker   *MemoryBroker
+	actionID string
+	mu       sync.Mutex
+	stop     context.CancelFunc
+}
+
+var _ WorkerMessengerAdapter = &MemoryWorkerMessengerAdapter{}
+
+func NewMemoryWorkerMessengerAdapter(broker *MemoryBroker, actionID string) *MemoryWorkerMessengerAdapter {
+	return &MemoryWorkerMessengerAdapter{
+		broker:   broker,
+		actionID: actionID,
+	}
+}
+
+func (m *MemoryWorkerMessengerAdapter) ListenInputMessages(ctx context.Context, h func(c InputMessageContext, message InputMessage) error) error {
+
+	m.mu.Lock()
+
+	if m.stop != nil {
+		m.mu.Unlock()
+		return errors.New("cannot re-initialize")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+
+	m.stop = cancel
+
+	m.mu.Unlock()
+
+	ictx := context.Background()
+
+	queue := m.broker.queue(memoryQueueName(memoryInputSubject, m.actionID))
+
+	m.broker.consume(cctx, queue, 10, func(msg *memoryMessage) error {
+
+		slog.Info(
+			"received input",
+			slog.Any("message", msg.value),
+		)
+
+		message := msg.value.(InputMessage)
+
+		hctx, release := m.broker.cancels.track(ictx, message.WorkflowID, message.SessionID)
+		defer release()
+
+		err := h(
+			InputMessageContext{
+				Context:   hctx,
+				Timestamp: msg.publishedAt,
+			},
+			message,
+		)
+
+		// nothing waits for the inputs of a cancelled run, so it is not
+		// redelivered
+		if runCancelled(hctx) {
+			return nil
+		}
+
+		return err
+	})
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (m *MemoryWorkerMessengerAdapter) SendTriggerMessage(ctx context.Context, message TriggerMessage) error {
+	m.broker.publish(memoryTriggerSubject, "", message.TenantID, message)
+	return nil
+}
+
+func (m *MemoryWorkerMessengerAdapter) SendOutputMessage(ctx context.Context, message OutputMessage) error {
+	m.broker.publish(memoryOutputSubject, "", message.TenantID, message)
+	return nil
+}
+
+func (m *MemoryWorkerMessengerAdapter) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		m.stop()
+	}
+
+	return nil
+}
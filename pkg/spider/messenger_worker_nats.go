@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/sethvargo/go-envconfig"
 	"github.com/targc/xnats-go"
@@ -16,24 +19,36 @@ type NATSWorkerMessengerAdapter struct {
 	p                *xnats.Producer
 	c                *xnats.Consumer
 	cctx             jetstream.ConsumeContext
+	cancelSub        *nats.Subscription
+	cancels          *runCancels
 	natsStreamPrefix string
 	actionID         string
+	ackWait          time.Duration
+	settler          *natsSettler
 }
 
 var _ WorkerMessengerAdapter = &NATSWorkerMessengerAdapter{}
 
 type InitNATSWorkerMessengerAdapterOpt struct {
 	BetaAutoSetupNATS bool
+	// AckWait overrides NATS_ACK_WAIT, the time a delivered message may stay
+	// unacknowledged before JetStream redelivers it.
+	AckWait time.Duration
+	// MaxDeliver overrides NATS_MAX_DELIVER, the number of deliveries of a
+	// message before it is dead-lettered.
+	MaxDeliver int
 }
 
 func InitNATSWorkerMessengerAdapter(ctx context.Context, actionID string, opt InitNATSWorkerMessengerAdapterOpt) (*NATSWorkerMessengerAdapter, error) {
 	type Env struct {
-		NATSHost             string `env:"NATS_HOST,required"`
-		NATSPort             int    `env:"NATS_PORT,required"`
-		NATSUser             string `env:"NATS_USER,required"`
-		NATSPassword         string `env:"NATS_PASSWORD,required"`
-		NATSStreamPrefix     string `env:"NATS_STREAM_PREFIX,required"`
-		NATSConsumerIDPrefix string `env:"NATS_CONSUMER_ID_PREFIX,required"`
+		NATSHost             string        `env:"NATS_HOST,required"`
+		NATSPort             int           `env:"NATS_PORT,required"`
+		NATSUser             string        `env:"NATS_USER,required"`
+		NATSPassword         string        `env:"NATS_PASSWORD,required"`
+		NATSStreamPrefix     string        `env:"NATS_STREAM_PREFIX,required"`
+		NATSConsumerIDPrefix string        `env:"NATS_CONSUMER_ID_PREFIX,required"`
+		NATSAckWait          time.Duration `env:"NATS_ACK_WAIT,default=30s"`
+		NATSMaxDeliver       int           `env:"NATS_MAX_DELIVER,default=5"`
 	}
 
 	var env Env
@@ -55,10 +70,47 @@ func InitNATSWorkerMessengerAdapter(ctx context.Context, actionID string, opt In
 		return nil, err
 	}
 
+	consumerOpt := buildNATSConsumerOpt(env.NATSAckWait, env.NATSMaxDeliver, opt.AckWait, opt.MaxDeliver)
+
+	adapter, err := NewNATSWorkerMessengerAdapter(ctx, nc, actionID, NewNATSWorkerMessengerAdapterOpt{
+		StreamPrefix:      env.NATSStreamPrefix,
+		ConsumerIDPrefix:  env.NATSConsumerIDPrefix,
+		BetaAutoSetupNATS: opt.BetaAutoSetupNATS,
+		AckWait:           consumerOpt.AckWait,
+		MaxDeliver:        consumerOpt.MaxDeliver,
+	})
+
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+type NewNATSWorkerMessengerAdapterOpt struct {
+	StreamPrefix      string
+	ConsumerIDPrefix  string
+	BetaAutoSetupNATS bool
+	// AckWait is the time a delivered message may stay unacknowledged
+	// before JetStream redelivers it. Defaults to 30s.
+	AckWait time.Duration
+	// MaxDeliver is the number of deliveries of a message before it is
+	// dead-lettered. Defaults to 5.
+	MaxDeliver int
+}
+
+// NewNATSWorkerMessengerAdapter uses an open NATS connection, which the
+// adapter closes along with itself. The input stream must exist, the
+// workflow adapter creates it.
+func NewNATSWorkerMessengerAdapter(ctx context.Context, nc *xnats.XNats, actionID string, opt NewNATSWorkerMessengerAdapterOpt) (*NATSWorkerMessengerAdapter, error) {
+
 	p := nc.Producer()
 
-	inputStream := buildInputSubject(env.NATSStreamPrefix)
-	consumerID := buildWorkerConsumerID(env.NATSConsumerIDPrefix, actionID)
+	consumerOpt := buildNATSConsumerOpt(0, 0, opt.AckWait, opt.MaxDeliver)
+
+	inputStream := buildInputSubject(opt.StreamPrefix)
+	consumerID := buildWorkerConsumerID(opt.ConsumerIDPrefix, actionID)
 
 	slog.Info(
 		"worker",
@@ -68,7 +120,7 @@ func InitNATSWorkerMessengerAdapter(ctx context.Context, actionID string, opt In
 	)
 
 	if opt.BetaAutoSetupNATS {
-		err = betaCreateConsumer(ctx, nc.JS(), inputStream, consumerID)
+		err := betaCreateConsumer(ctx, nc.JS(), inputStream, consumerID, consumerOpt)
 
 		if err != nil {
 			// return nil, err
@@ -85,8 +137,16 @@ func InitNATSWorkerMessengerAdapter(ctx context.Context, actionID string, opt In
 		nc:               nc,
 		p:                p,
 		c:                c,
-		natsStreamPrefix: env.NATSStreamPrefix,
+		cancels:          newRunCancels(),
+		natsStreamPrefix: opt.StreamPrefix,
 		actionID:         actionID,
+		ackWait:          consumerOpt.AckWait,
+		settler: &natsSettler{
+			p:                p,
+			natsStreamPrefix: opt.StreamPrefix,
+			maxDeliver:       consumerOpt.MaxDeliver,
+			ackWait:          consumerOpt.AckWait,
+		},
 	}
 
 	return &adapter, nil
@@ -100,72 +160,113 @@ func (m *NATSWorkerMessengerAdapter) ListenInputMessages(ctx context.Context, h
 
 	ictx := context.Background()
 
+	cancelSub, err := m.nc.JS().Conn().Subscribe(buildCancelSubject(m.natsStreamPrefix), m.handleCancelMessage)
+
+	if err != nil {
+		return err
+	}
+
+	m.cancelSub = cancelSub
+
 	sem := make(chan struct{}, 10)
 
 	cctx, err := m.c.Consume(func(msg jetstream.Msg) {
 		sem <- struct{}{}
 
-		msg.Ack()
-
-		go func() error {
+		go func() {
 			defer func() {
 				<-sem
 			}()
 
-			slog.Info(
-				"received input",
-				slog.String("b", string(msg.Data())),
-			)
+			stop := keepInProgress(msg, m.ackWait)
 
-			metadata, err := msg.Metadata()
+			err := m.handleInputMessage(ictx, msg, h)
 
-			if err != nil {
-				slog.Error(err.Error())
-				return err
-			}
+			stop()
 
-			var b NatsInputMessage
+			m.settler.settle(ictx, msg, err)
+		}()
+	})
 
-			err = json.Unmarshal(msg.Data(), &b)
+	if err != nil {
+		return err
+	}
 
-			if err != nil {
-				// TODO:
-				slog.Error(err.Error())
-				return err
-			}
+	m.cctx = cctx
 
-			if b.ActionID != m.actionID {
-				return nil
-			}
+	<-ctx.Done()
 
-			err = h(
-				InputMessageContext{
-					Context:   ictx,
-					Timestamp: metadata.Timestamp,
-				},
-				b.ToInputMessage(),
-			)
+	return nil
+}
 
-			if err != nil {
-				// TODO:
-				return err
-			}
+func (m *NATSWorkerMessengerAdapter) handleInputMessage(ctx context.Context, msg jetstream.Msg, h func(c InputMessageContext, message InputMessage) error) error {
 
-			return nil
-		}()
-	})
+	slog.Info(
+		"received input",
+		slog.String("b", string(msg.Data())),
+	)
+
+	metadata, err := msg.Metadata()
 
 	if err != nil {
 		return err
 	}
 
-	m.cctx = cctx
+	var b NatsInputMessage
 
-	<-ctx.Done()
+	err = json.Unmarshal(msg.Data(), &b)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+
+	if b.ActionID != m.actionID {
+		return nil
+	}
+
+	hctx, release := m.cancels.track(ctx, b.WorkflowID, b.SessionID)
+	defer release()
+
+	err = h(
+		InputMessageContext{
+			Context:   hctx,
+			Timestamp: metadata.Timestamp,
+		},
+		b.ToInputMessage(),
+	)
+
+	// nothing waits for the inputs of a cancelled run, so it is not
+	// redelivered
+	if runCancelled(hctx) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
+func (m *NATSWorkerMessengerAdapter) handleCancelMessage(msg *nats.Msg) {
+
+	slog.Info(
+		"received cancel",
+		slog.String("b", string(msg.Data)),
+	)
+
+	var b NatsCancelMessage
+
+	err := json.Unmarshal(msg.Data, &b)
+
+	if err != nil {
+		slog.Error("unmarshal cancel failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	m.cancels.cancel(b.ToCancelMessage())
+}
+
 func (m *NATSWorkerMessengerAdapter) SendTriggerMessage(ctx context.Context, message TriggerMessage) error {
 	subject := buildTriggerSubject(m.natsStreamPrefix)
 
@@ -215,7 +316,16 @@ func (m *NATSWorkerMessengerAdapter) SendOutputMessage(ctx context.Context, mess
 }
 
 func (m *NATSWorkerMessengerAdapter) Close(ctx context.Context) error {
-	m.cctx.Stop()
+
+	if m.cctx != nil {
+		m.cctx.Stop()
+	}
+
+	if m.cancelSub != nil {
+		_ = m.cancelSub.Unsubscribe()
+	}
+
 	m.nc.Close()
+
 	return nil
 }
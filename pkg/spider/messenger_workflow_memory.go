@@ -0,0 +1,148 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+type MemoryWorkflowMessengerAdapter struct {
+	broker             *MemoryBroker
+	mu                 sync.Mutex
+	triggerMessageStop context.CancelFunc
+	outputMessageStop  context.CancelFunc
+}
+
+var _ WorkflowMessengerAdapter = &MemoryWorkflowMessengerAdapter{}
+
+func NewMemoryWorkflowMessengerAdapter(broker *MemoryBroker) *MemoryWorkflowMessengerAdapter {
+	return &MemoryWorkflowMessengerAdapter{
+		broker: broker,
+	}
+}
+
+func (m *MemoryWorkflowMessengerAdapter) ListenTriggerMessages(ctx context.Context, h func(c TriggerMessageContext, message TriggerMessage) error) error {
+
+	cctx, err := m.start(ctx, &m.triggerMessageStop)
+
+	if err != nil {
+		return err
+	}
+
+	ictx := context.Background()
+
+	m.broker.consume(cctx, m.broker.queue(memoryTriggerSubject), 50, func(msg *memoryMessage) error {
+
+		slog.Info(
+			"received trigger",
+			slog.Any("message", msg.value),
+		)
+
+		return h(
+			TriggerMessageContext{
+				Context:   ictx,
+				Timestamp: msg.publishedAt,
+			},
+			msg.value.(TriggerMessage),
+		)
+	})
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) ListenOutputMessages(ctx context.Context, h func(c OutputMessageContext, message OutputMessage) error) error {
+
+	cctx, err := m.start(ctx, &m.outputMessageStop)
+
+	if err != nil {
+		return err
+	}
+
+	ictx := context.Background()
+
+	m.broker.consume(cctx, m.broker.queue(memoryOutputSubject), 50, func(msg *memoryMessage) error {
+
+		slog.Info(
+			"received output",
+			slog.Any("message", msg.value),
+		)
+
+		return h(
+			OutputMessageContext{
+				Context:   ictx,
+				Timestamp: msg.publishedAt,
+			},
+			msg.value.(OutputMessage),
+		)
+	})
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// start derives the context a listener consumes with, which Close cancels.
+func (m *MemoryWorkflowMessengerAdapter) start(ctx context.Context, stop *context.CancelFunc) (context.Context, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if *stop != nil {
+		return nil, errors.New("cannot re-initialize")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+
+	*stop = cancel
+
+	return cctx, nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) SendInputMessage(ctx context.Context, message InputMessage) error {
+	m.broker.publish(memoryInputSubject, message.ActionID, message.TenantID, message)
+	return nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) SendTriggerMessage(ctx context.Context, message TriggerMessage) error {
+	m.broker.publish(memoryTriggerSubject, "", message.TenantID, message)
+	return nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) SendCancelMessage(ctx context.Context, message CancelMessage) error {
+	m.broker.cancels.cancel(message)
+	return nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) ListDeadLetters(ctx context.Context, req *ListDeadLettersRequest) (*DeadLetterListResponse, error) {
+	return m.broker.listDeadLetters(req), nil
+}
+
+func (m *MemoryWorkflowMessengerAdapter) GetDeadLetter(ctx context.Context, tenantID, id string) (*DeadLetter, error) {
+	return m.broker.getDeadLetter(tenantID, id)
+}
+
+func (m *MemoryWorkflowMessengerAdapter) ReplayDeadLetter(ctx context.Context, tenantID, id string) error {
+	return m.broker.replayDeadLetter(tenantID, id)
+}
+
+func (m *MemoryWorkflowMessengerAdapter) DiscardDeadLetter(ctx context.Context, tenantID, id string) error {
+	_, err := m.broker.removeDeadLetter(tenantID, id)
+	return err
+}
+
+func (m *MemoryWorkflowMessengerAdapter) Close(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.triggerMessageStop != nil {
+		m.triggerMessageStop()
+	}
+
+	if m.outputMessageStop != nil {
+		m.outputMessageStop()
+	}
+
+	return nil
+}
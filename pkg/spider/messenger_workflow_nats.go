@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/sethvargo/go-envconfig"
@@ -20,22 +22,33 @@ type NATSWorkflowMessengerAdapter struct {
 	outputMessageCCtx      jetstream.ConsumeContext
 	triggerMessageCCtx     jetstream.ConsumeContext
 	natsStreamPrefix       string
+	ackWait                time.Duration
+	settler                *natsSettler
+	js                     jetstream.JetStream
 }
 
 var _ WorkflowMessengerAdapter = &NATSWorkflowMessengerAdapter{}
 
 type InitNATSWorkflowMessengerAdapterOpt struct {
 	BetaAutoSetupNATS bool
+	// AckWait overrides NATS_ACK_WAIT, the time a delivered message may stay
+	// unacknowledged before JetStream redelivers it.
+	AckWait time.Duration
+	// MaxDeliver overrides NATS_MAX_DELIVER, the number of deliveries of a
+	// message before it is dead-lettered.
+	MaxDeliver int
 }
 
 func InitNATSWorkflowMessengerAdapter(ctx context.Context, opt InitNATSWorkflowMessengerAdapterOpt) (*NATSWorkflowMessengerAdapter, error) {
 	type Env struct {
-		NATSHost             string `env:"NATS_HOST,required"`
-		NATSPort             int    `env:"NATS_PORT,required"`
-		NATSUser             string `env:"NATS_USER,required"`
-		NATSPassword         string `env:"NATS_PASSWORD,required"`
-		NATSStreamPrefix     string `env:"NATS_STREAM_PREFIX,required"`
-		NATSConsumerIDPrefix string `env:"NATS_CONSUMER_ID_PREFIX,required"`
+		NATSHost             string        `env:"NATS_HOST,required"`
+		NATSPort             int           `env:"NATS_PORT,required"`
+		NATSUser             string        `env:"NATS_USER,required"`
+		NATSPassword         string        `env:"NATS_PASSWORD,required"`
+		NATSStreamPrefix     string        `env:"NATS_STREAM_PREFIX,required"`
+		NATSConsumerIDPrefix string        `env:"NATS_CONSUMER_ID_PREFIX,required"`
+		NATSAckWait          time.Duration `env:"NATS_ACK_WAIT,default=30s"`
+		NATSMaxDeliver       int           `env:"NATS_MAX_DELIVER,default=5"`
 	}
 
 	var env Env
@@ -57,13 +70,49 @@ func InitNATSWorkflowMessengerAdapter(ctx context.Context, opt InitNATSWorkflowM
 		return nil, err
 	}
 
+	consumerOpt := buildNATSConsumerOpt(env.NATSAckWait, env.NATSMaxDeliver, opt.AckWait, opt.MaxDeliver)
+
+	adapter, err := NewNATSWorkflowMessengerAdapter(ctx, nc, NewNATSWorkflowMessengerAdapterOpt{
+		StreamPrefix:      env.NATSStreamPrefix,
+		ConsumerIDPrefix:  env.NATSConsumerIDPrefix,
+		BetaAutoSetupNATS: opt.BetaAutoSetupNATS,
+		AckWait:           consumerOpt.AckWait,
+		MaxDeliver:        consumerOpt.MaxDeliver,
+	})
+
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return adapter, nil
+}
+
+type NewNATSWorkflowMessengerAdapterOpt struct {
+	StreamPrefix      string
+	ConsumerIDPrefix  string
+	BetaAutoSetupNATS bool
+	// AckWait is the time a delivered message may stay unacknowledged
+	// before JetStream redelivers it. Defaults to 30s.
+	AckWait time.Duration
+	// MaxDeliver is the number of deliveries of a message before it is
+	// dead-lettered. Defaults to 5.
+	MaxDeliver int
+}
+
+// NewNATSWorkflowMessengerAdapter uses an open NATS connection, which the
+// adapter closes along with itself.
+func NewNATSWorkflowMessengerAdapter(ctx context.Context, nc *xnats.XNats, opt NewNATSWorkflowMessengerAdapterOpt) (*NATSWorkflowMessengerAdapter, error) {
+
 	p := nc.Producer()
 
-	triggerStream := buildTriggerSubject(env.NATSStreamPrefix)
-	inputStream := buildInputSubject(env.NATSStreamPrefix)
-	outputStream := buildOutputSubject(env.NATSStreamPrefix)
-	workflowActionTriggerConsumerID := buildWorkflowActionTriggerConsumerID(env.NATSConsumerIDPrefix)
-	workflowActionOutputConsumerID := buildWorkflowActionOutputConsumerID(env.NATSConsumerIDPrefix)
+	consumerOpt := buildNATSConsumerOpt(0, 0, opt.AckWait, opt.MaxDeliver)
+
+	triggerStream := buildTriggerSubject(opt.StreamPrefix)
+	inputStream := buildInputSubject(opt.StreamPrefix)
+	outputStream := buildOutputSubject(opt.StreamPrefix)
+	workflowActionTriggerConsumerID := buildWorkflowActionTriggerConsumerID(opt.ConsumerIDPrefix)
+	workflowActionOutputConsumerID := buildWorkflowActionOutputConsumerID(opt.ConsumerIDPrefix)
 
 	slog.Info(
 		"workflow",
@@ -73,7 +122,7 @@ func InitNATSWorkflowMessengerAdapter(ctx context.Context, opt InitNATSWorkflowM
 
 	if opt.BetaAutoSetupNATS {
 
-		err = betaCreateJetstream(ctx, nc.JS(), triggerStream)
+		err := betaCreateJetstream(ctx, nc.JS(), triggerStream)
 
 		if err != nil {
 			// return nil, err
@@ -91,13 +140,19 @@ func InitNATSWorkflowMessengerAdapter(ctx context.Context, opt InitNATSWorkflowM
 			// return nil, err
 		}
 
-		err = betaCreateConsumer(ctx, nc.JS(), triggerStream, workflowActionTriggerConsumerID)
+		err = betaCreateDeadLetterJetstream(ctx, nc.JS(), opt.StreamPrefix)
+
+		if err != nil {
+			// return nil, err
+		}
+
+		err = betaCreateConsumer(ctx, nc.JS(), triggerStream, workflowActionTriggerConsumerID, consumerOpt)
 
 		if err != nil {
 			// return nil, err
 		}
 
-		err = betaCreateConsumer(ctx, nc.JS(), outputStream, workflowActionOutputConsumerID)
+		err = betaCreateConsumer(ctx, nc.JS(), outputStream, workflowActionOutputConsumerID, consumerOpt)
 
 		if err != nil {
 			// return nil, err
@@ -121,7 +176,15 @@ func InitNATSWorkflowMessengerAdapter(ctx context.Context, opt InitNATSWorkflowM
 		p:                      p,
 		triggerMessageConsumer: triggerMessageConsumer,
 		outputMessageConsumer:  outputMessageConsumer,
-		natsStreamPrefix:       env.NATSStreamPrefix,
+		natsStreamPrefix:       opt.StreamPrefix,
+		ackWait:                consumerOpt.AckWait,
+		settler: &natsSettler{
+			p:                p,
+			natsStreamPrefix: opt.StreamPrefix,
+			maxDeliver:       consumerOpt.MaxDeliver,
+			ackWait:          consumerOpt.AckWait,
+		},
+		js: nc.JS(),
 	}
 
 	return &adapter, nil
@@ -141,41 +204,13 @@ func (m *NATSWorkflowMessengerAdapter) ListenTriggerMessages(ctx context.Context
 
 	cctx, err := m.triggerMessageConsumer.Consume(func(msg jetstream.Msg) {
 		eg.Go(func() error {
-			msg.Ack()
-
-			slog.Info(
-				"received output",
-				slog.String("b", string(msg.Data())),
-			)
-
-			metadata, err := msg.Metadata()
-
-			if err != nil {
-				// TODO:
-				return err
-			}
-
-			var b NatsTriggerMessage
-
-			err = json.Unmarshal(msg.Data(), &b)
+			stop := keepInProgress(msg, m.ackWait)
 
-			if err != nil {
-				// TODO:
-				return err
-			}
+			err := m.handleTriggerMessage(ictx, msg, h)
 
-			err = h(
-				TriggerMessageContext{
-					Context:   ictx,
-					Timestamp: metadata.Timestamp,
-				},
-				b.ToTriggerMessage(),
-			)
+			stop()
 
-			if err != nil {
-				// TODO:
-				return err
-			}
+			m.settler.settle(ictx, msg, err)
 
 			return nil
 		})
@@ -206,41 +241,13 @@ func (m *NATSWorkflowMessengerAdapter) ListenOutputMessages(ctx context.Context,
 
 	cctx, err := m.outputMessageConsumer.Consume(func(msg jetstream.Msg) {
 		eg.Go(func() error {
-			msg.Ack()
+			stop := keepInProgress(msg, m.ackWait)
 
-			slog.Info(
-				"received output",
-				slog.String("b", string(msg.Data())),
-			)
+			err := m.handleOutputMessage(ictx, msg, h)
 
-			metadata, err := msg.Metadata()
+			stop()
 
-			if err != nil {
-				// TODO:
-				return err
-			}
-
-			var b NatsOutputMessage
-
-			err = json.Unmarshal(msg.Data(), &b)
-
-			if err != nil {
-				// TODO:
-				return err
-			}
-
-			err = h(
-				OutputMessageContext{
-					Context:   ictx,
-					Timestamp: metadata.Timestamp,
-				},
-				b.ToOutputMessage(),
-			)
-
-			if err != nil {
-				// TODO:
-				return err
-			}
+			m.settler.settle(ictx, msg, err)
 
 			return nil
 		})
@@ -257,20 +264,82 @@ func (m *NATSWorkflowMessengerAdapter) ListenOutputMessages(ctx context.Context,
 	return nil
 }
 
+func (m *NATSWorkflowMessengerAdapter) handleTriggerMessage(ctx context.Context, msg jetstream.Msg, h func(c TriggerMessageContext, message TriggerMessage) error) error {
+
+	slog.Info(
+		"received trigger",
+		slog.String("b", string(msg.Data())),
+	)
+
+	metadata, err := msg.Metadata()
+
+	if err != nil {
+		return err
+	}
+
+	var b NatsTriggerMessage
+
+	err = json.Unmarshal(msg.Data(), &b)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+
+	err = h(
+		TriggerMessageContext{
+			Context:   ctx,
+			Timestamp: metadata.Timestamp,
+		},
+		b.ToTriggerMessage(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *NATSWorkflowMessengerAdapter) handleOutputMessage(ctx context.Context, msg jetstream.Msg, h func(c OutputMessageContext, message OutputMessage) error) error {
+
+	slog.Info(
+		"received output",
+		slog.String("b", string(msg.Data())),
+	)
+
+	metadata, err := msg.Metadata()
+
+	if err != nil {
+		return err
+	}
+
+	var b NatsOutputMessage
+
+	err = json.Unmarshal(msg.Data(), &b)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+
+	err = h(
+		OutputMessageContext{
+			Context:   ctx,
+			Timestamp: metadata.Timestamp,
+		},
+		b.ToOutputMessage(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (m *NATSWorkflowMessengerAdapter) SendInputMessage(ctx context.Context, message InputMessage) error {
 	subject := buildInputSubject(m.natsStreamPrefix)
 
-	b, err := json.Marshal(NatsInputMessage{
-		SessionID:  message.SessionID,
-		TaskID:     message.TaskID,
-		WorkflowID: message.WorkflowID,
-		TenantID:   message.TenantID,
-		// TODO
-		// WorkflowActionID: message.WorkflowActionID,
-		Key:      message.Key,
-		ActionID: message.ActionID,
-		Values:   message.Values,
-	})
+	b, err := json.Marshal(NatsInputMessage{}.FromInputMessage(message))
 
 	if err != nil {
 		return err
@@ -291,8 +360,73 @@ func (m *NATSWorkflowMessengerAdapter) SendInputMessage(ctx context.Context, mes
 	return nil
 }
 
+func (m *NATSWorkflowMessengerAdapter) SendTriggerMessage(ctx context.Context, message TriggerMessage) error {
+	subject := buildTriggerSubject(m.natsStreamPrefix)
+
+	b, err := json.Marshal(NatsTriggerMessage{}.FromTriggerMessage(message))
+
+	if err != nil {
+		return err
+	}
+
+	err = m.p.Produce(ctx, subject, b)
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info(
+		"sent trigger",
+		slog.String("subject", subject),
+		slog.String("b", string(b)),
+	)
+
+	return nil
+}
+
+// SendCancelMessage publishes message to the workers listening at the time,
+// without keeping it for later ones.
+func (m *NATSWorkflowMessengerAdapter) SendCancelMessage(ctx context.Context, message CancelMessage) error {
+	subject := buildCancelSubject(m.natsStreamPrefix)
+
+	b, err := json.Marshal(NatsCancelMessage{}.FromCancelMessage(message))
+
+	if err != nil {
+		return err
+	}
+
+	err = m.js.Conn().Publish(subject, b)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.js.Conn().Flush()
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info(
+		"sent cancel",
+		slog.String("subject", subject),
+		slog.String("b", string(b)),
+	)
+
+	return nil
+}
+
 func (m *NATSWorkflowMessengerAdapter) Close(ctx context.Context) error {
-	m.outputMessageCCtx.Stop()
+
+	if m.triggerMessageCCtx != nil {
+		m.triggerMessageCCtx.Stop()
+	}
+
+	if m.outputMessageCCtx != nil {
+		m.outputMessageCCtx.Stop()
+	}
+
 	m.nc.Close()
+
 	return nil
 }
@@ -0,0 +1,203 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func (m *NATSWorkflowMessengerAdapter) ListDeadLetters(ctx context.Context, req *ListDeadLettersRequest) (*DeadLetterListResponse, error) {
+
+	stream, err := m.js.Stream(ctx, buildDeadLetterStream(m.natsStreamPrefix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	subject := buildDeadLetterSubject(m.natsStreamPrefix, req.TenantID)
+
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(subject))
+
+	if err != nil {
+		return nil, err
+	}
+
+	total := int64(info.State.Subjects[subject])
+
+	skip := (req.Page - 1) * req.PageSize
+
+	deadLetters := []DeadLetter{}
+
+	if int64(skip) >= total {
+		return &DeadLetterListResponse{
+			DeadLetters: deadLetters,
+			Total:       total,
+			Page:        req.Page,
+			PageSize:    req.PageSize,
+		}, nil
+	}
+
+	cons, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{
+			subject,
+		},
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := cons.FetchNoWait(skip + req.PageSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := 0
+
+	for msg := range batch.Messages() {
+
+		i++
+
+		if i <= skip {
+			continue
+		}
+
+		metadata, err := msg.Metadata()
+
+		if err != nil {
+			return nil, err
+		}
+
+		var b NatsDeadLetter
+
+		err = json.Unmarshal(msg.Data(), &b)
+
+		if err != nil {
+			slog.Error("invalid dead letter", slog.String("error", err.Error()))
+			continue
+		}
+
+		deadLetters = append(deadLetters, b.ToDeadLetter(strconv.FormatUint(metadata.Sequence.Stream, 10)))
+	}
+
+	err = batch.Error()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterListResponse{
+		DeadLetters: deadLetters,
+		Total:       total,
+		Page:        req.Page,
+		PageSize:    req.PageSize,
+	}, nil
+}
+
+func (m *NATSWorkflowMessengerAdapter) GetDeadLetter(ctx context.Context, tenantID, id string) (*DeadLetter, error) {
+
+	_, _, deadLetter, err := m.getDeadLetter(ctx, tenantID, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deadLetter, nil
+}
+
+// ReplayDeadLetter publishes the original payload back to the subject it
+// failed on and removes it from the dead-letter stream.
+func (m *NATSWorkflowMessengerAdapter) ReplayDeadLetter(ctx context.Context, tenantID, id string) error {
+
+	stream, seq, deadLetter, err := m.getDeadLetter(ctx, tenantID, id)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.p.Produce(ctx, deadLetter.Subject, []byte(deadLetter.Data))
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info(
+		"replayed dead letter",
+		slog.String("id", id),
+		slog.String("subject", deadLetter.Subject),
+	)
+
+	err = stream.DeleteMsg(ctx, seq)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *NATSWorkflowMessengerAdapter) DiscardDeadLetter(ctx context.Context, tenantID, id string) error {
+
+	stream, seq, _, err := m.getDeadLetter(ctx, tenantID, id)
+
+	if err != nil {
+		return err
+	}
+
+	err = stream.DeleteMsg(ctx, seq)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *NATSWorkflowMessengerAdapter) getDeadLetter(ctx context.Context, tenantID, id string) (jetstream.Stream, uint64, *DeadLetter, error) {
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+
+	if err != nil {
+		return nil, 0, nil, ErrDeadLetterNotFound
+	}
+
+	stream, err := m.js.Stream(ctx, buildDeadLetterStream(m.natsStreamPrefix))
+
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	raw, err := stream.GetMsg(ctx, seq)
+
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, 0, nil, ErrDeadLetterNotFound
+	}
+
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// sequences are global to the stream, so make sure the message belongs
+	// to the tenant asking for it
+	if raw.Subject != buildDeadLetterSubject(m.natsStreamPrefix, tenantID) {
+		return nil, 0, nil, ErrDeadLetterNotFound
+	}
+
+	var b NatsDeadLetter
+
+	err = json.Unmarshal(raw.Data, &b)
+
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	deadLetter := b.ToDeadLetter(id)
+
+	return stream, seq, &deadLetter, nil
+}
@@ -0,0 +1,148 @@
+CREATE TABLE workflows (
+	id           TEXT PRIMARY KEY,
+	tenant_id    TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	trigger_type TEXT NOT NULL,
+	meta         JSONB NOT NULL,
+	status       TEXT NOT NULL,
+	version      BIGINT NOT NULL,
+	deadline     BIGINT NOT NULL DEFAULT 0,
+	retention    BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX workflows_tenant_id_idx ON workflows (tenant_id, id DESC);
+
+CREATE TABLE workflow_actions (
+	id           TEXT PRIMARY KEY,
+	tenant_id    TEXT NOT NULL,
+	workflow_id  TEXT NOT NULL,
+	key          TEXT NOT NULL,
+	action_id    TEXT NOT NULL,
+	config       JSONB NOT NULL,
+	map          JSONB NOT NULL,
+	meta         JSONB NOT NULL,
+	disabled     BOOLEAN NOT NULL DEFAULT FALSE,
+	join_policy  JSONB NOT NULL,
+	retry_policy JSONB NOT NULL,
+	timeout      BIGINT NOT NULL DEFAULT 0,
+	UNIQUE (tenant_id, workflow_id, key)
+);
+
+CREATE INDEX workflow_actions_action_id_idx ON workflow_actions (action_id);
+
+CREATE TABLE workflow_action_deps (
+	id          TEXT PRIMARY KEY,
+	workflow_id TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	meta_output TEXT NOT NULL,
+	dep_key     TEXT NOT NULL,
+	UNIQUE (workflow_id, key, meta_output, dep_key)
+);
+
+CREATE TABLE workflow_session_contexts (
+	workflow_id TEXT NOT NULL,
+	session_id  TEXT NOT NULL,
+	task_id     TEXT NOT NULL,
+	value       JSONB NOT NULL,
+	tenant_id   TEXT NOT NULL,
+	size        BIGINT NOT NULL DEFAULT 0,
+	created_at  TIMESTAMPTZ NOT NULL,
+	expires_at  TIMESTAMPTZ,
+	PRIMARY KEY (workflow_id, session_id, task_id)
+);
+
+CREATE INDEX workflow_session_contexts_expires_at_idx ON workflow_session_contexts (expires_at);
+CREATE INDEX workflow_session_contexts_tenant_id_idx ON workflow_session_contexts (tenant_id);
+
+CREATE TABLE workflow_runs (
+	session_id          TEXT PRIMARY KEY,
+	tenant_id           TEXT NOT NULL,
+	workflow_id         TEXT NOT NULL,
+	flow_version        BIGINT NOT NULL DEFAULT 0,
+	status              TEXT NOT NULL,
+	trigger_key         TEXT NOT NULL,
+	trigger_meta_output TEXT NOT NULL,
+	trigger_payload     JSONB NOT NULL,
+	error               TEXT NOT NULL DEFAULT '',
+	started_at          TIMESTAMPTZ NOT NULL,
+	ended_at            TIMESTAMPTZ,
+	deadline_at         TIMESTAMPTZ
+);
+
+CREATE INDEX workflow_runs_started_at_idx ON workflow_runs (tenant_id, workflow_id, started_at DESC);
+CREATE INDEX workflow_runs_deadline_at_idx ON workflow_runs (status, deadline_at);
+
+CREATE TABLE workflow_run_steps (
+	task_id      TEXT PRIMARY KEY,
+	session_id   TEXT NOT NULL,
+	tenant_id    TEXT NOT NULL,
+	workflow_id  TEXT NOT NULL,
+	key          TEXT NOT NULL,
+	action_id    TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	input        JSONB NOT NULL,
+	output       JSONB NOT NULL,
+	meta_output  TEXT NOT NULL DEFAULT '',
+	error        TEXT NOT NULL DEFAULT '',
+	attempt      INTEGER NOT NULL DEFAULT 0,
+	flow_version BIGINT NOT NULL DEFAULT 0,
+	started_at   TIMESTAMPTZ NOT NULL,
+	ended_at     TIMESTAMPTZ,
+	deadline_at  TIMESTAMPTZ
+);
+
+CREATE INDEX workflow_run_steps_session_id_idx ON workflow_run_steps (workflow_id, session_id, status);
+CREATE INDEX workflow_run_steps_deadline_at_idx ON workflow_run_steps (status, deadline_at);
+
+CREATE TABLE workflow_session_joins (
+	workflow_id   TEXT NOT NULL,
+	session_id    TEXT NOT NULL,
+	key           TEXT NOT NULL,
+	tenant_id     TEXT NOT NULL,
+	dispatched    BOOLEAN NOT NULL DEFAULT FALSE,
+	dispatched_by TEXT NOT NULL DEFAULT '',
+	expires_at    TIMESTAMPTZ,
+	PRIMARY KEY (workflow_id, session_id, key)
+);
+
+CREATE INDEX workflow_session_joins_expires_at_idx ON workflow_session_joins (expires_at);
+CREATE INDEX workflow_session_joins_tenant_id_idx ON workflow_session_joins (tenant_id);
+
+CREATE TABLE workflow_session_join_arrivals (
+	seq         BIGSERIAL PRIMARY KEY,
+	workflow_id TEXT NOT NULL,
+	session_id  TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	parent_key  TEXT NOT NULL,
+	value       JSONB NOT NULL,
+	size        BIGINT NOT NULL,
+	arrived_at  TIMESTAMPTZ NOT NULL,
+	UNIQUE (workflow_id, session_id, key, parent_key)
+);
+
+CREATE TABLE workflow_scheduled_retries (
+	id           TEXT PRIMARY KEY,
+	tenant_id    TEXT NOT NULL,
+	workflow_id  TEXT NOT NULL,
+	session_id   TEXT NOT NULL,
+	task_id      TEXT NOT NULL,
+	key          TEXT NOT NULL,
+	action_id    TEXT NOT NULL,
+	input_values TEXT NOT NULL,
+	attempt      INTEGER NOT NULL,
+	flow_version BIGINT NOT NULL DEFAULT 0,
+	timeout      BIGINT NOT NULL DEFAULT 0,
+	due_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX workflow_scheduled_retries_due_at_idx ON workflow_scheduled_retries (due_at);
+
+CREATE TABLE workflow_flow_snapshots (
+	tenant_id   TEXT NOT NULL,
+	workflow_id TEXT NOT NULL,
+	version     BIGINT NOT NULL,
+	actions     JSONB NOT NULL,
+	deps        JSONB NOT NULL,
+	created_at  TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant_id, workflow_id, version)
+);
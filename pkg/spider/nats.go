@@ -2,11 +2,18 @@ package spider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/targc/xnats-go"
+)
+
+const (
+	defaultNATSAckWait    = 30 * time.Second
+	defaultNATSMaxDeliver = 5
 )
 
 type NatsTriggerMessage struct {
@@ -14,10 +21,12 @@ type NatsTriggerMessage struct {
 	TenantID   string `json:"tenant_id"`
 	// TODO
 	// WorkflowActionID string `json:"workflow_action_id"`
-	MetaOutput string `json:"meta_output"`
-	Key        string `json:"key"`
-	ActionID   string `json:"action_id"`
-	Values     string `json:"values"`
+	MetaOutput   string `json:"meta_output"`
+	Key          string `json:"key"`
+	ActionID     string `json:"action_id"`
+	Values       string `json:"values"`
+	SessionID    string `json:"session_id,omitempty"`
+	NewSessionID string `json:"new_session_id,omitempty"`
 }
 
 func (n NatsTriggerMessage) FromTriggerMessage(message TriggerMessage) NatsTriggerMessage {
@@ -26,10 +35,12 @@ func (n NatsTriggerMessage) FromTriggerMessage(message TriggerMessage) NatsTrigg
 		TenantID:   message.TenantID,
 		// TODO:
 		// WorkflowActionID: message.WorkflowActionID,
-		MetaOutput: message.MetaOutput,
-		Key:        message.Key,
-		ActionID:   message.ActionID,
-		Values:     message.Values,
+		MetaOutput:   message.MetaOutput,
+		Key:          message.Key,
+		ActionID:     message.ActionID,
+		Values:       message.Values,
+		SessionID:    message.SessionID,
+		NewSessionID: message.NewSessionID,
 	}
 }
 
@@ -39,10 +50,35 @@ func (n *NatsTriggerMessage) ToTriggerMessage() TriggerMessage {
 		TenantID:   n.TenantID,
 		// TODO
 		// WorkflowActionID: b.WorkflowActionID,
-		MetaOutput: n.MetaOutput,
-		Key:        n.Key,
-		ActionID:   n.ActionID,
-		Values:     n.Values,
+		MetaOutput:   n.MetaOutput,
+		Key:          n.Key,
+		ActionID:     n.ActionID,
+		Values:       n.Values,
+		SessionID:    n.SessionID,
+		NewSessionID: n.NewSessionID,
+	}
+}
+
+type NatsDeadLetter struct {
+	TenantID string    `json:"tenant_id"`
+	Subject  string    `json:"subject"`
+	Reason   string    `json:"reason"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Data     string    `json:"data"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func (n *NatsDeadLetter) ToDeadLetter(id string) DeadLetter {
+	return DeadLetter{
+		ID:       id,
+		TenantID: n.TenantID,
+		Subject:  n.Subject,
+		Reason:   n.Reason,
+		Error:    n.Error,
+		Attempts: n.Attempts,
+		Data:     n.Data,
+		FailedAt: n.FailedAt,
 	}
 }
 
@@ -53,10 +89,14 @@ type NatsOutputMessage struct {
 	TenantID   string `json:"tenant_id"`
 	// TODO
 	// WorkflowActionID string `json:"workflow_action_id"`
-	MetaOutput string `json:"meta_output"`
-	Key        string `json:"key"`
-	ActionID   string `json:"action_id"`
-	Values     string `json:"values"`
+	MetaOutput  string `json:"meta_output"`
+	Key         string `json:"key"`
+	ActionID    string `json:"action_id"`
+	Values      string `json:"values"`
+	Attempt     int    `json:"attempt,omitempty"`
+	FlowVersion uint64 `json:"flow_version,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorClass  string `json:"error_class,omitempty"`
 }
 
 func (n NatsOutputMessage) FromOutputMessage(message OutputMessage) NatsOutputMessage {
@@ -67,10 +107,14 @@ func (n NatsOutputMessage) FromOutputMessage(message OutputMessage) NatsOutputMe
 		TenantID:   message.TenantID,
 		// TODO:
 		// WorkflowActionID: message.WorkflowActionID,
-		MetaOutput: message.MetaOutput,
-		Key:        message.Key,
-		ActionID:   message.ActionID,
-		Values:     message.Values,
+		MetaOutput:  message.MetaOutput,
+		Key:         message.Key,
+		ActionID:    message.ActionID,
+		Values:      message.Values,
+		Attempt:     message.Attempt,
+		FlowVersion: message.FlowVersion,
+		Error:       message.Error,
+		ErrorClass:  message.ErrorClass,
 	}
 }
 
@@ -82,10 +126,14 @@ func (n *NatsOutputMessage) ToOutputMessage() OutputMessage {
 		TenantID:   n.TenantID,
 		// TODO
 		// WorkflowActionID: b.WorkflowActionID,
-		MetaOutput: n.MetaOutput,
-		Key:        n.Key,
-		ActionID:   n.ActionID,
-		Values:     n.Values,
+		MetaOutput:  n.MetaOutput,
+		Key:         n.Key,
+		ActionID:    n.ActionID,
+		Values:      n.Values,
+		Attempt:     n.Attempt,
+		FlowVersion: n.FlowVersion,
+		Error:       n.Error,
+		ErrorClass:  n.ErrorClass,
 	}
 }
 
@@ -96,9 +144,27 @@ type NatsInputMessage struct {
 	TenantID   string `json:"tenant_id"`
 	// TODO
 	// WorkflowActionID string `json:"workflow_action_id"`
-	Key      string `json:"key"`
-	ActionID string `json:"action_id"`
-	Values   string `json:"values"`
+	Key         string `json:"key"`
+	ActionID    string `json:"action_id"`
+	Values      string `json:"values"`
+	Attempt     int    `json:"attempt,omitempty"`
+	FlowVersion uint64 `json:"flow_version,omitempty"`
+}
+
+func (n NatsInputMessage) FromInputMessage(message InputMessage) NatsInputMessage {
+	return NatsInputMessage{
+		SessionID:  message.SessionID,
+		TaskID:     message.TaskID,
+		WorkflowID: message.WorkflowID,
+		TenantID:   message.TenantID,
+		// TODO
+		// WorkflowActionID: message.WorkflowActionID,
+		Key:         message.Key,
+		ActionID:    message.ActionID,
+		Values:      message.Values,
+		Attempt:     message.Attempt,
+		FlowVersion: message.FlowVersion,
+	}
 }
 
 func (n *NatsInputMessage) ToInputMessage() InputMessage {
@@ -109,9 +175,33 @@ func (n *NatsInputMessage) ToInputMessage() InputMessage {
 		TenantID:   n.TenantID,
 		// TODO
 		// WorkflowActionID: n.WorkflowActionID,
-		Key:      n.Key,
-		ActionID: n.ActionID,
-		Values:   n.Values,
+		Key:         n.Key,
+		ActionID:    n.ActionID,
+		Values:      n.Values,
+		Attempt:     n.Attempt,
+		FlowVersion: n.FlowVersion,
+	}
+}
+
+type NatsCancelMessage struct {
+	TenantID   string `json:"tenant_id"`
+	WorkflowID string `json:"workflow_id"`
+	SessionID  string `json:"session_id"`
+}
+
+func (n NatsCancelMessage) FromCancelMessage(message CancelMessage) NatsCancelMessage {
+	return NatsCancelMessage{
+		TenantID:   message.TenantID,
+		WorkflowID: message.WorkflowID,
+		SessionID:  message.SessionID,
+	}
+}
+
+func (n *NatsCancelMessage) ToCancelMessage() CancelMessage {
+	return CancelMessage{
+		TenantID:   n.TenantID,
+		WorkflowID: n.WorkflowID,
+		SessionID:  n.SessionID,
 	}
 }
 
@@ -127,6 +217,20 @@ func buildOutputSubject(prefix string) string {
 	return fmt.Sprintf("%s-output", prefix)
 }
 
+// buildCancelSubject is a core NATS subject rather than a stream, a cancel
+// only matters to the handlers running when it is sent.
+func buildCancelSubject(prefix string) string {
+	return fmt.Sprintf("%s-cancel", prefix)
+}
+
+func buildDeadLetterStream(prefix string) string {
+	return fmt.Sprintf("%s-dlq", prefix)
+}
+
+func buildDeadLetterSubject(prefix, tenantID string) string {
+	return fmt.Sprintf("%s-dlq.%s", prefix, tenantID)
+}
+
 func buildWorkflowActionTriggerConsumerID(prefix string) string {
 	return fmt.Sprintf("%s-workflow-action-trigger", prefix)
 }
@@ -188,8 +292,73 @@ func betaCreateJetstream(ctx context.Context, js jetstream.JetStream, stream str
 	return nil
 }
 
-func betaCreateConsumer(ctx context.Context, js jetstream.JetStream, stream, consumerID string) error {
-	_, err := js.CreateConsumer(ctx, stream, jetstream.ConsumerConfig{
+// betaCreateDeadLetterJetstream creates the dead-letter stream. Unlike the
+// work streams it is file backed and keeps messages for a week, so failed
+// messages can be inspected and replayed long after they failed.
+func betaCreateDeadLetterJetstream(ctx context.Context, js jetstream.JetStream, prefix string) error {
+
+	stream := buildDeadLetterStream(prefix)
+
+	_, err := js.CreateStream(ctx, jetstream.StreamConfig{
+		Name: stream,
+		Subjects: []string{
+			buildDeadLetterSubject(prefix, ">"),
+		},
+		Retention:  jetstream.LimitsPolicy,
+		Discard:    jetstream.DiscardOld,
+		MaxAge:     time.Hour * 24 * 7,
+		Storage:    jetstream.FileStorage,
+		Replicas:   1,
+		Duplicates: time.Minute * 2,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("nats jetstream created", slog.String("stream", stream))
+
+	return nil
+}
+
+type natsConsumerOpt struct {
+	AckWait    time.Duration
+	MaxDeliver int
+}
+
+// buildNATSConsumerOpt resolves the consumer delivery settings, preferring
+// explicit adapter options over the environment and falling back to defaults.
+func buildNATSConsumerOpt(envAckWait time.Duration, envMaxDeliver int, ackWait time.Duration, maxDeliver int) natsConsumerOpt {
+
+	opt := natsConsumerOpt{
+		AckWait:    defaultNATSAckWait,
+		MaxDeliver: defaultNATSMaxDeliver,
+	}
+
+	if envAckWait > 0 {
+		opt.AckWait = envAckWait
+	}
+
+	if envMaxDeliver != 0 {
+		opt.MaxDeliver = envMaxDeliver
+	}
+
+	if ackWait > 0 {
+		opt.AckWait = ackWait
+	}
+
+	if maxDeliver != 0 {
+		opt.MaxDeliver = maxDeliver
+	}
+
+	return opt
+}
+
+// betaCreateConsumer leaves the deliveries unlimited, natsSettler counts
+// them against opt.MaxDeliver instead. JetStream would drop a message whose
+// dead-lettering failed on its last delivery.
+func betaCreateConsumer(ctx context.Context, js jetstream.JetStream, stream, consumerID string, opt natsConsumerOpt) error {
+	_, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
 		Name:               consumerID,
 		Durable:            "",
 		Description:        "",
@@ -197,8 +366,8 @@ func betaCreateConsumer(ctx context.Context, js jetstream.JetStream, stream, con
 		OptStartSeq:        0,
 		OptStartTime:       nil,
 		AckPolicy:          jetstream.AckExplicitPolicy,
-		AckWait:            0,
-		MaxDeliver:         0,
+		AckWait:            opt.AckWait,
+		MaxDeliver:         -1,
 		BackOff:            []time.Duration{},
 		FilterSubject:      "",
 		ReplayPolicy:       0,
@@ -231,3 +400,197 @@ func betaCreateConsumer(ctx context.Context, js jetstream.JetStream, stream, con
 
 	return nil
 }
+
+// natsSettler settles messages once their handler returned. Successful
+// messages are acked and other failures are nacked with a backoff so
+// JetStream redelivers them. Messages that can never be processed, or that
+// used up their deliveries, are moved to the dead-letter stream.
+type natsSettler struct {
+	p                *xnats.Producer
+	natsStreamPrefix string
+	maxDeliver       int
+	ackWait          time.Duration
+}
+
+func (s *natsSettler) settle(ctx context.Context, msg jetstream.Msg, err error) {
+
+	if err == nil {
+		ackErr := msg.Ack()
+
+		if ackErr != nil {
+			slog.Error("ack failed", slog.String("error", ackErr.Error()))
+		}
+
+		return
+	}
+
+	var delivered uint64 = 1
+
+	metadata, metaErr := msg.Metadata()
+
+	if metaErr == nil {
+		delivered = metadata.NumDelivered
+	}
+
+	reason := deadLetterReason(err, delivered, s.maxDeliver)
+
+	if reason != "" {
+		slog.Error(
+			"message dead-lettered",
+			slog.String("reason", reason),
+			slog.String("error", err.Error()),
+			slog.Uint64("delivered", delivered),
+		)
+
+		dlqErr := s.deadLetterInPlace(ctx, msg, reason, err, delivered)
+
+		if dlqErr != nil {
+			slog.Error("dead-letter failed", slog.String("error", dlqErr.Error()))
+
+			nakErr := msg.NakWithDelay(nakDelay(delivered))
+
+			if nakErr != nil {
+				slog.Error("nak failed", slog.String("error", nakErr.Error()))
+			}
+
+			return
+		}
+
+		termErr := msg.Term()
+
+		if termErr != nil {
+			slog.Error("term failed", slog.String("error", termErr.Error()))
+		}
+
+		return
+	}
+
+	delay := nakDelay(delivered)
+
+	slog.Warn(
+		"message nacked",
+		slog.String("error", err.Error()),
+		slog.Uint64("delivered", delivered),
+		slog.Duration("delay", delay),
+	)
+
+	nakErr := msg.NakWithDelay(delay)
+
+	if nakErr != nil {
+		slog.Error("nak failed", slog.String("error", nakErr.Error()))
+	}
+}
+
+// deadLetterInPlace publishes msg to the dead-letter stream, retrying with
+// a backoff while keeping msg in progress. A nacked message would not be
+// redelivered once it used up its deliveries, so msg is only nacked when
+// ctx is done.
+func (s *natsSettler) deadLetterInPlace(ctx context.Context, msg jetstream.Msg, reason string, cause error, delivered uint64) error {
+
+	interval := s.ackWait / 2
+
+	if interval <= 0 {
+		interval = defaultNATSAckWait / 2
+	}
+
+	for attempt := uint64(1); ; attempt++ {
+
+		err := s.deadLetter(ctx, msg, reason, cause, delivered)
+
+		if err == nil {
+			return nil
+		}
+
+		slog.Error("dead-letter failed", slog.String("error", err.Error()), slog.Uint64("attempt", attempt))
+
+		inProgressErr := msg.InProgress()
+
+		if inProgressErr != nil {
+			slog.Error("in progress failed", slog.String("error", inProgressErr.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(min(nakDelay(attempt), interval)):
+		}
+	}
+}
+
+func (s *natsSettler) deadLetter(ctx context.Context, msg jetstream.Msg, reason string, cause error, delivered uint64) error {
+
+	// best effort, malformed payloads have no tenant to file them under
+	var tenant struct {
+		TenantID string `json:"tenant_id"`
+	}
+
+	_ = json.Unmarshal(msg.Data(), &tenant)
+
+	if tenant.TenantID == "" {
+		tenant.TenantID = deadLetterUnknownTenant
+	}
+
+	b, err := json.Marshal(NatsDeadLetter{
+		TenantID: tenant.TenantID,
+		Subject:  msg.Subject(),
+		Reason:   reason,
+		Error:    cause.Error(),
+		Attempts: int(delivered),
+		Data:     string(msg.Data()),
+		FailedAt: time.Now(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = s.p.Produce(ctx, buildDeadLetterSubject(s.natsStreamPrefix, tenant.TenantID), b)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func nakDelay(delivered uint64) time.Duration {
+
+	delay := time.Second
+
+	for i := uint64(1); i < delivered && delay < time.Minute; i++ {
+		delay *= 2
+	}
+
+	return min(delay, time.Minute)
+}
+
+// keepInProgress extends the ack deadline of msg while its handler is still
+// running, so long handlers are not redelivered to another worker.
+func keepInProgress(msg jetstream.Msg, ackWait time.Duration) (stop func()) {
+
+	done := make(chan struct{})
+
+	interval := ackWait / 2
+
+	if interval <= 0 {
+		interval = defaultNATSAckWait / 2
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = msg.InProgress()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
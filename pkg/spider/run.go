@@ -0,0 +1,72 @@
+package spider
+
+import "time"
+
+type RunStatus string
+
+var (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+	RunStatusTimedOut  RunStatus = "timed_out"
+	RunStatusHeld      RunStatus = "held"     // Triggered while the flow was paused
+	RunStatusRejected  RunStatus = "rejected" // Triggered while the flow was not active nor paused
+)
+
+type RunStepStatus string
+
+var (
+	RunStepStatusRunning   RunStepStatus = "running"
+	RunStepStatusRetrying  RunStepStatus = "retrying"
+	RunStepStatusSucceeded RunStepStatus = "succeeded"
+	RunStepStatusFailed    RunStepStatus = "failed"
+	RunStepStatusTimedOut  RunStepStatus = "timed_out"
+	RunStepStatusCancelled RunStepStatus = "cancelled"
+)
+
+// Run is the persistent record of one workflow session, from the trigger
+// until the last step finishes.
+type Run struct {
+	SessionID         string                 `json:"session_id"`
+	TenantID          string                 `json:"tenant_id"`
+	WorkflowID        string                 `json:"workflow_id"`
+	FlowVersion       uint64                 `json:"flow_version,omitempty"`
+	Status            RunStatus              `json:"status"`
+	TriggerKey        string                 `json:"trigger_key"`
+	TriggerMetaOutput string                 `json:"trigger_meta_output"`
+	TriggerPayload    map[string]interface{} `json:"trigger_payload"`
+	Error             string                 `json:"error,omitempty"`
+	StartedAt         time.Time              `json:"started_at"`
+	EndedAt           *time.Time             `json:"ended_at,omitempty"`
+	DeadlineAt        *time.Time             `json:"deadline_at,omitempty"`
+	Steps             []RunStep              `json:"steps,omitempty"`
+}
+
+// RunStep records the execution of a single task (one dispatched action)
+// within a run.
+type RunStep struct {
+	TaskID      string                 `json:"task_id"`
+	SessionID   string                 `json:"session_id"`
+	TenantID    string                 `json:"tenant_id"`
+	WorkflowID  string                 `json:"workflow_id"`
+	Key         string                 `json:"key"`
+	ActionID    string                 `json:"action_id"`
+	Status      RunStepStatus          `json:"status"`
+	Input       map[string]interface{} `json:"input"`
+	Output      map[string]interface{} `json:"output,omitempty"`
+	MetaOutput  string                 `json:"meta_output,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Attempt     int                    `json:"attempt"`
+	FlowVersion uint64                 `json:"flow_version,omitempty"`
+	StartedAt   time.Time              `json:"started_at"`
+	EndedAt     *time.Time             `json:"ended_at,omitempty"`
+	DeadlineAt  *time.Time             `json:"deadline_at,omitempty"`
+}
+
+// activeRunStepStatuses are the statuses of steps that still hold the run
+// open.
+var activeRunStepStatuses = []RunStepStatus{
+	RunStepStatusRunning,
+	RunStepStatusRetrying,
+}
@@ -0,0 +1,266 @@
+package spider
+
+import (
+	"fmt"
+	"maps"
+)
+
+// maxSimulatedSteps stops a simulation that would never end.
+const maxSimulatedSteps = 1000
+
+type SimulatedStepStatus string
+
+var (
+	SimulatedStepStatusSucceeded SimulatedStepStatus = "succeeded"
+	SimulatedStepStatusFailed    SimulatedStepStatus = "failed"
+	SimulatedStepStatusDisabled  SimulatedStepStatus = "disabled"  // The action ran, but the path stops after it
+	SimulatedStepStatusNoOutput  SimulatedStepStatus = "no_output" // No output was stubbed, the path stops here
+)
+
+// SimulatedOutput stands in for what the worker of an action would send
+// back. An error fails the action as a failing handler would, without
+// retries.
+type SimulatedOutput struct {
+	MetaOutput string                 `json:"meta_output" example:"success"`
+	Values     map[string]interface{} `json:"values"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type SimulateRequest struct {
+	TriggerKey        string
+	TriggerMetaOutput string
+	Payload           map[string]interface{}
+	// Outputs are the stubbed outputs by action key.
+	Outputs map[string]SimulatedOutput
+}
+
+// SimulatedStep is an action the simulation reached, with the input its
+// mappers computed.
+type SimulatedStep struct {
+	Key        string                 `json:"key"`
+	ActionID   string                 `json:"action_id"`
+	ParentKey  string                 `json:"parent_key"`
+	Status     SimulatedStepStatus    `json:"status"`
+	Input      map[string]interface{} `json:"input"`
+	Output     map[string]interface{} `json:"output,omitempty"`
+	MetaOutput string                 `json:"meta_output,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Simulation is the outcome of walking a flow graph with stubbed outputs.
+type Simulation struct {
+	Status RunStatus `json:"status" example:"succeeded"`
+	Error  string    `json:"error,omitempty"`
+	// Path lists the keys of the trigger and of the steps, in the order
+	// they were reached.
+	Path  []string        `json:"path"`
+	Steps []SimulatedStep `json:"steps"`
+	// Context holds the output of the trigger and of every step that
+	// succeeded, by key.
+	Context map[string]map[string]interface{} `json:"context"`
+}
+
+// simulatedTask is an action the simulation is about to dispatch.
+type simulatedTask struct {
+	parentKey  string
+	action     WorkflowAction
+	contextVal map[string]map[string]interface{}
+}
+
+// simulatedArrival is a branch that reached a joining action.
+type simulatedArrival struct {
+	parentKey  string
+	contextVal map[string]map[string]interface{}
+}
+
+// Simulate walks the graph of snapshot from a trigger as Workflow would,
+// computing the input of each action with the same mappers and following
+// the same dependencies and joins, but taking the outputs of the actions
+// from req instead of sending anything to their workers. Branches are
+// walked one step at a time, in the order their actions were reached.
+func Simulate(snapshot *FlowSnapshot, req *SimulateRequest) (*Simulation, error) {
+
+	trigger, ok := snapshot.Action(req.TriggerKey)
+
+	if !ok {
+		return nil, fmt.Errorf("action %s not found in flow %s", req.TriggerKey, snapshot.WorkflowID)
+	}
+
+	payload := req.Payload
+
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	triggerOutput := map[string]interface{}{
+		"output": payload,
+	}
+
+	contextVal := map[string]map[string]interface{}{
+		trigger.Key: triggerOutput,
+		"$trigger":  triggerOutput,
+	}
+
+	simulation := &Simulation{
+		Status:  RunStatusSucceeded,
+		Path:    []string{trigger.Key},
+		Context: maps.Clone(contextVal),
+	}
+
+	// joins collect the branches that arrived at a joining action, in
+	// arrival order, until it is dispatched
+	joins := map[string][]simulatedArrival{}
+	joined := map[string]bool{}
+
+	var queue []simulatedTask
+
+	enqueue := func(parentKey string, contextVal map[string]map[string]interface{}, deps []WorkflowAction) {
+
+		for _, dep := range deps {
+
+			taskContextVal := contextVal
+
+			if dep.Join != nil {
+
+				if joined[dep.Key] {
+					continue
+				}
+
+				joins[dep.Key] = append(joins[dep.Key], simulatedArrival{
+					parentKey:  parentKey,
+					contextVal: contextVal,
+				})
+
+				if countArrivedParents(joins[dep.Key]) < dep.Join.Threshold(countParents(snapshot.Deps, dep.Key)) {
+					continue
+				}
+
+				joined[dep.Key] = true
+
+				taskContextVal = map[string]map[string]interface{}{}
+
+				for _, arrival := range joins[dep.Key] {
+					maps.Copy(taskContextVal, arrival.contextVal)
+				}
+			}
+
+			queue = append(queue, simulatedTask{
+				parentKey:  parentKey,
+				action:     dep,
+				contextVal: taskContextVal,
+			})
+		}
+	}
+
+	enqueue(trigger.Key, contextVal, snapshot.Dependencies(trigger.Key, req.TriggerMetaOutput))
+
+	for len(queue) > 0 {
+
+		if len(simulation.Steps) >= maxSimulatedSteps {
+			return nil, fmt.Errorf("simulation of flow %s exceeded %d steps", snapshot.WorkflowID, maxSimulatedSteps)
+		}
+
+		task := queue[0]
+		queue = queue[1:]
+
+		step := SimulatedStep{
+			Key:       task.action.Key,
+			ActionID:  task.action.ActionID,
+			ParentKey: task.parentKey,
+		}
+
+		simulation.Path = append(simulation.Path, step.Key)
+
+		input, err := ex(task.contextVal, task.action.Map)
+
+		if err != nil {
+			step.Status = SimulatedStepStatusFailed
+			step.Error = err.Error()
+			simulation.fail(step)
+			continue
+		}
+
+		step.Input = input
+
+		output, ok := req.Outputs[step.Key]
+
+		switch {
+		case !ok:
+			step.Status = SimulatedStepStatusNoOutput
+		case output.Error != "":
+			step.Status = SimulatedStepStatusFailed
+			step.Error = output.Error
+			simulation.fail(step)
+			continue
+		case task.action.Disabled:
+			step.Status = SimulatedStepStatusDisabled
+			step.Output = output.Values
+			step.MetaOutput = output.MetaOutput
+		default:
+			step.Status = SimulatedStepStatusSucceeded
+			step.Output = output.Values
+			step.MetaOutput = output.MetaOutput
+		}
+
+		simulation.Steps = append(simulation.Steps, step)
+
+		if step.Status != SimulatedStepStatusSucceeded {
+			continue
+		}
+
+		values := output.Values
+
+		if values == nil {
+			values = map[string]interface{}{}
+		}
+
+		nextContextVal := maps.Clone(task.contextVal)
+		nextContextVal[step.Key] = map[string]interface{}{
+			"output": values,
+		}
+
+		simulation.Context[step.Key] = nextContextVal[step.Key]
+
+		enqueue(step.Key, nextContextVal, snapshot.Dependencies(step.Key, step.MetaOutput))
+	}
+
+	return simulation, nil
+}
+
+// fail records a failed step. As in a run, the first failure fails the
+// whole simulation, while the other branches carry on.
+func (s *Simulation) fail(step SimulatedStep) {
+
+	s.Steps = append(s.Steps, step)
+
+	if s.Status == RunStatusFailed {
+		return
+	}
+
+	s.Status = RunStatusFailed
+	s.Error = fmt.Sprintf("%s: %s", step.Key, step.Error)
+}
+
+func countParents(deps []WorkflowActionDep, key string) int {
+
+	parents := map[string]struct{}{}
+
+	for _, dep := range deps {
+		if dep.DepKey == key {
+			parents[dep.Key] = struct{}{}
+		}
+	}
+
+	return len(parents)
+}
+
+func countArrivedParents(arrivals []simulatedArrival) int {
+
+	parents := map[string]struct{}{}
+
+	for _, arrival := range arrivals {
+		parents[arrival.parentKey] = struct{}{}
+	}
+
+	return len(parents)
+}
@@ -0,0 +1,124 @@
+package spiderdev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+var flowDocumentExts = []string{".yaml", ".yml", ".json"}
+
+// ImportFlow creates or replaces the flow of doc for tenantID and activates
+// it, so its triggers start runs right away.
+func (s *Server) ImportFlow(ctx context.Context, tenantID string, doc *usecase.FlowDocument) (*spider.Flow, error) {
+
+	if s.usecase == nil {
+		return nil, errors.New("not started")
+	}
+
+	flow, err := s.usecase.ImportFlow(ctx, tenantID, doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if flow.Status == spider.FlowStatusActive {
+		return flow, nil
+	}
+
+	return s.usecase.UpdateFlow(ctx, &usecase.UpdateFlowRequest{
+		TenantID:    tenantID,
+		FlowID:      flow.ID,
+		Name:        flow.Name,
+		TriggerType: flow.TriggerType,
+		Meta:        flow.Meta,
+		Status:      spider.FlowStatusActive,
+		Deadline:    flow.Deadline,
+		Retention:   flow.Retention,
+	})
+}
+
+// ImportFlowFiles imports the flow documents at paths, files or
+// directories of .yaml, .yml and .json files, as ImportFlow does.
+func (s *Server) ImportFlowFiles(ctx context.Context, tenantID string, paths ...string) error {
+
+	files, err := flowDocumentFiles(paths)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		doc, err := usecase.ParseFlowDocument(data)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		flow, err := s.ImportFlow(ctx, tenantID, doc)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		slog.Info(
+			"flow imported",
+			slog.String("file", file),
+			slog.String("tenant_id", tenantID),
+			slog.String("flow_id", flow.ID),
+			slog.Uint64("version", flow.Version),
+		)
+	}
+
+	return nil
+}
+
+func flowDocumentFiles(paths []string) ([]string, error) {
+
+	var files []string
+
+	for _, path := range paths {
+
+		info, err := os.Stat(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+
+			if entry.IsDir() || !slices.Contains(flowDocumentExts, filepath.Ext(entry.Name())) {
+				continue
+			}
+
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,392 @@
+// Package spiderdev runs spider in a single process for local development:
+// an embedded NATS server with JetStream, in-memory or SQLite storage, the
+// workflow engine, the workflow API and the workers registered with
+// Server.Handle. Nothing needs to be running beforehand.
+package spiderdev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/apis"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+	"github.com/targc/xnats-go"
+)
+
+const (
+	defaultAddr = "127.0.0.1:8080"
+
+	natsHost             = "127.0.0.1"
+	natsUser             = "spider"
+	natsPassword         = "spider"
+	natsStreamPrefix     = "spider-dev"
+	natsConsumerIDPrefix = "spider-dev"
+	natsReadyTimeout     = 10 * time.Second
+)
+
+type ServerOpt struct {
+	// Addr is the address the workflow API listens on. Defaults to
+	// 127.0.0.1:8080.
+	Addr string
+	// SQLitePath keeps flows and runs in the SQLite database at this path.
+	// They are kept in memory when empty, and lost on close.
+	SQLitePath string
+	// NATSPort is the port of the embedded NATS server, for workers running
+	// in other processes. A free port is picked when zero.
+	NATSPort int
+}
+
+// Server is the whole of spider in one process. Register the workers with
+// Handle, then Start it.
+type Server struct {
+	opt      ServerOpt
+	handlers map[string]func(c spider.InputMessageContext, m spider.InputMessage) error
+
+	storeDir      string
+	ns            *server.Server
+	conns         []*xnats.XNats
+	storage       spider.WorkflowStorageAdapter
+	workerStorage spider.WorkerStorageAdapter
+	workflow      *spider.Workflow
+	workers       []*spider.Worker
+	usecase       *usecase.Usecase
+	app           *fiber.App
+	addr          string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewServer(opt ServerOpt) *Server {
+
+	if opt.Addr == "" {
+		opt.Addr = defaultAddr
+	}
+
+	return &Server{
+		opt:      opt,
+		handlers: map[string]func(c spider.InputMessageContext, m spider.InputMessage) error{},
+	}
+}
+
+// Handle runs h in process for the inputs of actionID, as a worker of that
+// action would. It must be called before Start.
+func (s *Server) Handle(actionID string, h func(c spider.InputMessageContext, m spider.InputMessage) error) {
+	s.handlers[actionID] = h
+}
+
+// Start starts NATS, the storage, the workflow engine, the API and the
+// workers, and returns once they all run. Close stops them.
+func (s *Server) Start(ctx context.Context) error {
+
+	if s.cancel != nil {
+		return errors.New("already started")
+	}
+
+	err := s.start(ctx)
+
+	if err != nil {
+		_ = s.Close(ctx)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) start(ctx context.Context) error {
+
+	err := s.startNATS()
+
+	if err != nil {
+		return err
+	}
+
+	err = s.openStorage(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.opt.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	s.addr = ln.Addr().String()
+
+	nc, err := s.connect()
+
+	if err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	messenger, err := spider.NewNATSWorkflowMessengerAdapter(ctx, nc, spider.NewNATSWorkflowMessengerAdapterOpt{
+		StreamPrefix:      natsStreamPrefix,
+		ConsumerIDPrefix:  natsConsumerIDPrefix,
+		BetaAutoSetupNATS: true,
+	})
+
+	if err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	workflow := spider.InitWorkflow(messenger, s.storage)
+
+	actionIDs := slices.Sorted(maps.Keys(s.handlers))
+
+	for _, actionID := range actionIDs {
+
+		nc, err := s.connect()
+
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+
+		workerMessenger, err := spider.NewNATSWorkerMessengerAdapter(ctx, nc, actionID, spider.NewNATSWorkerMessengerAdapterOpt{
+			StreamPrefix:      natsStreamPrefix,
+			ConsumerIDPrefix:  natsConsumerIDPrefix,
+			BetaAutoSetupNATS: true,
+		})
+
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+
+		s.workers = append(s.workers, spider.InitWorker(workerMessenger, s.workerStorage, actionID))
+	}
+
+	s.workflow = workflow
+	s.usecase = usecase.NewUsecase(s.storage, messenger)
+
+	s.app = fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+
+	s.app.Get("/healthz", func(c *fiber.Ctx) error {
+		return nil
+	})
+
+	apis.NewHandler(s.usecase).Register(s.app)
+
+	rctx, cancel := context.WithCancel(ctx)
+
+	s.cancel = cancel
+
+	s.goRun("workflow", func() error {
+		return s.workflow.Run(rctx)
+	})
+
+	for i, worker := range s.workers {
+		h := s.handlers[actionIDs[i]]
+
+		s.goRun("worker", func() error {
+			return worker.Run(rctx, h)
+		})
+	}
+
+	s.goRun("api", func() error {
+		return s.app.Listener(ln)
+	})
+
+	slog.Info(
+		"spider dev started",
+		slog.String("api", "http://"+s.addr),
+		slog.String("nats", s.ns.ClientURL()),
+		slog.String("nats_user", natsUser),
+		slog.String("nats_password", natsPassword),
+		slog.String("nats_stream_prefix", natsStreamPrefix),
+		slog.Any("action_ids", actionIDs),
+	)
+
+	return nil
+}
+
+// startNATS starts an embedded NATS server keeping JetStream in a
+// temporary directory.
+func (s *Server) startNATS() error {
+
+	storeDir, err := os.MkdirTemp("", "spider-dev-")
+
+	if err != nil {
+		return err
+	}
+
+	s.storeDir = storeDir
+
+	port := s.opt.NATSPort
+
+	if port == 0 {
+		port = server.RANDOM_PORT
+	}
+
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "spider-dev",
+		Host:       natsHost,
+		Port:       port,
+		Username:   natsUser,
+		Password:   natsPassword,
+		JetStream:  true,
+		StoreDir:   storeDir,
+		NoSigs:     true,
+		NoLog:      true,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	ns.Start()
+
+	s.ns = ns
+
+	if !ns.ReadyForConnections(natsReadyTimeout) {
+		return errors.New("nats server not ready")
+	}
+
+	return nil
+}
+
+func (s *Server) openStorage(ctx context.Context) error {
+
+	if s.opt.SQLitePath == "" {
+		storage := spider.NewMemoryWorkflowStorageAdapter()
+
+		s.storage = storage
+		s.workerStorage = spider.NewMemoryWorkerStorageAdapter(storage)
+
+		return nil
+	}
+
+	db, err := spider.OpenSQLite(ctx, s.opt.SQLitePath)
+
+	if err != nil {
+		return err
+	}
+
+	err = spider.MigrateSQLite(ctx, db)
+
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	// both adapters share db, which the workflow one closes
+	s.storage = spider.NewSQLiteWorkflowStorageAdapter(db)
+	s.workerStorage = spider.NewSQLiteWorkerStorageAdapter(db)
+
+	return nil
+}
+
+// connect opens a connection to the embedded NATS server. Each messenger
+// adapter gets its own, as it closes it along with itself.
+func (s *Server) connect() (*xnats.XNats, error) {
+
+	addr, ok := s.ns.Addr().(*net.TCPAddr)
+
+	if !ok {
+		return nil, fmt.Errorf("unexpected nats address %v", s.ns.Addr())
+	}
+
+	nc, err := xnats.Connect(xnats.ConnectOpt{
+		Host:     natsHost,
+		Port:     addr.Port,
+		User:     natsUser,
+		Password: natsPassword,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.conns = append(s.conns, nc)
+
+	return nc, nil
+}
+
+func (s *Server) goRun(name string, run func() error) {
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		err := run()
+
+		if err != nil {
+			slog.Error(name+" failed", slog.Any("error", err.Error()))
+		}
+	}()
+}
+
+// Addr returns the address the workflow API listens on, once started.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Usecase returns the usecase behind the workflow API, once started.
+func (s *Server) Usecase() *usecase.Usecase {
+	return s.usecase
+}
+
+// SendTriggerMessage starts a run as a trigger worker would.
+func (s *Server) SendTriggerMessage(ctx context.Context, m spider.TriggerMessage) error {
+
+	if s.workflow == nil {
+		return errors.New("not started")
+	}
+
+	return s.workflow.Messenger().SendTriggerMessage(ctx, m)
+}
+
+// Close stops what Start started, and removes the JetStream directory.
+func (s *Server) Close(ctx context.Context) error {
+
+	var errs []error
+
+	if s.cancel != nil {
+		s.cancel()
+
+		errs = append(errs, s.app.ShutdownWithContext(ctx))
+
+		s.wg.Wait()
+
+		for _, worker := range s.workers {
+			errs = append(errs, worker.Close(ctx))
+		}
+
+		errs = append(errs, s.workflow.Close(ctx))
+	} else if s.storage != nil {
+		errs = append(errs, s.storage.Close(ctx))
+	}
+
+	for _, nc := range s.conns {
+		nc.Close()
+	}
+
+	if s.ns != nil {
+		s.ns.Shutdown()
+		s.ns.WaitForShutdown()
+	}
+
+	if s.storeDir != "" {
+		errs = append(errs, os.RemoveAll(s.storeDir))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,588 @@
+package spidertest
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// MessengerAdapters are connected messengers: what a worker sends reaches
+// the workflow and the other way around.
+type MessengerAdapters struct {
+	Workflow spider.WorkflowMessengerAdapter
+	// Worker returns a worker messenger of the given action.
+	Worker func(actionID string) spider.WorkerMessengerAdapter
+	// MaxDeliver is the number of deliveries of a message before the
+	// messengers dead-letter it.
+	MaxDeliver int
+	// BreakDeadLetters makes dead-lettering fail until the returned
+	// function is called. It is nil for messengers that cannot fail to
+	// dead-letter, skipping the tests that need it.
+	BreakDeadLetters func(t *testing.T) (restore func())
+}
+
+// MessengerFactory returns messengers with no pending messages nor dead
+// letters. It is called once per subtest and closes what it opens, for
+// instance with t.Cleanup.
+type MessengerFactory func(t *testing.T) MessengerAdapters
+
+// RunMessengerConformance exercises spider.WorkflowMessengerAdapter and
+// spider.WorkerMessengerAdapter against the behavior of the NATS adapters.
+func RunMessengerConformance(t *testing.T, newMessengers MessengerFactory) {
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, m MessengerAdapters)
+	}{
+		{"WorkerTrigger", testWorkerTrigger},
+		{"WorkflowTrigger", testWorkflowTrigger},
+		{"InputRouting", testInputRouting},
+		{"Output", testOutput},
+		{"Redelivery", testRedelivery},
+		{"DeadLetters", testDeadLetters},
+		{"DeadLetterRetry", testDeadLetterRetry},
+		{"ListenTwice", testListenTwice},
+		{"Cancel", testCancel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newMessengers(t))
+		})
+	}
+}
+
+// listen runs a listener until the test ends.
+func listen(t *testing.T, l func(ctx context.Context) error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := l(ctx)
+
+		if err != nil {
+			t.Errorf("listen: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func listenTriggers(t *testing.T, m spider.WorkflowMessengerAdapter, h func(message spider.TriggerMessage) error) {
+	t.Helper()
+
+	listen(t, func(ctx context.Context) error {
+		return m.ListenTriggerMessages(ctx, func(c spider.TriggerMessageContext, message spider.TriggerMessage) error {
+			return h(message)
+		})
+	})
+}
+
+func listenInputs(t *testing.T, m spider.WorkerMessengerAdapter, h func(message spider.InputMessage) error) {
+	t.Helper()
+
+	listen(t, func(ctx context.Context) error {
+		return m.ListenInputMessages(ctx, func(c spider.InputMessageContext, message spider.InputMessage) error {
+			return h(message)
+		})
+	})
+}
+
+func testWorkerTrigger(t *testing.T, m MessengerAdapters) {
+
+	received := make(chan spider.TriggerMessage, 1)
+
+	listenTriggers(t, m.Workflow, func(message spider.TriggerMessage) error {
+		received <- message
+		return nil
+	})
+
+	sent := spider.TriggerMessage{
+		TenantID:   newID(t),
+		WorkflowID: newID(t),
+		Key:        "a1",
+		ActionID:   "worker-a",
+		MetaOutput: "triggered",
+		Values:     `{"value":"hi"}`,
+	}
+
+	err := m.Worker("worker-a").SendTriggerMessage(context.Background(), sent)
+
+	requireNoError(t, err, "SendTriggerMessage")
+	requireEqual(t, receive(t, received, "trigger"), sent, "trigger")
+}
+
+func testWorkflowTrigger(t *testing.T, m MessengerAdapters) {
+
+	received := make(chan spider.TriggerMessage, 1)
+
+	listenTriggers(t, m.Workflow, func(message spider.TriggerMessage) error {
+		received <- message
+		return nil
+	})
+
+	sent := spider.TriggerMessage{
+		TenantID:   newID(t),
+		WorkflowID: newID(t),
+		Key:        "a1",
+		ActionID:   "worker-a",
+		MetaOutput: "triggered",
+		Values:     `{"value":"hi"}`,
+		SessionID:  newID(t),
+	}
+
+	err := m.Workflow.SendTriggerMessage(context.Background(), sent)
+
+	requireNoError(t, err, "SendTriggerMessage")
+	requireEqual(t, receive(t, received, "trigger"), sent, "trigger with a session ID")
+}
+
+func testInputRouting(t *testing.T, m MessengerAdapters) {
+
+	receivedA := make(chan spider.InputMessage, 10)
+	receivedB := make(chan spider.InputMessage, 10)
+
+	listenInputs(t, m.Worker("worker-a"), func(message spider.InputMessage) error {
+		receivedA <- message
+		return nil
+	})
+
+	listenInputs(t, m.Worker("worker-b"), func(message spider.InputMessage) error {
+		receivedB <- message
+		return nil
+	})
+
+	tenantID := newID(t)
+	workflowID := newID(t)
+	sessionID := newID(t)
+
+	sentB := spider.InputMessage{
+		SessionID:   sessionID,
+		TaskID:      newID(t),
+		TenantID:    tenantID,
+		WorkflowID:  workflowID,
+		Key:         "b1",
+		ActionID:    "worker-b",
+		Values:      `{"value":"b"}`,
+		Attempt:     2,
+		FlowVersion: 7,
+	}
+
+	sentA := spider.InputMessage{
+		SessionID:   sessionID,
+		TaskID:      newID(t),
+		TenantID:    tenantID,
+		WorkflowID:  workflowID,
+		Key:         "a1",
+		ActionID:    "worker-a",
+		Values:      `{"value":"a"}`,
+		Attempt:     1,
+		FlowVersion: 7,
+	}
+
+	err := m.Workflow.SendInputMessage(context.Background(), sentB)
+
+	requireNoError(t, err, "SendInputMessage")
+
+	err = m.Workflow.SendInputMessage(context.Background(), sentA)
+
+	requireNoError(t, err, "SendInputMessage")
+	requireEqual(t, receive(t, receivedB, "input of worker-b"), sentB, "input of worker-b")
+	requireEqual(t, receive(t, receivedA, "input of worker-a"), sentA, "input of worker-a")
+
+	// an input reaches the workers of its action only
+	select {
+	case message := <-receivedA:
+		t.Fatalf("worker-a received an input of another action: %+v", message)
+	case message := <-receivedB:
+		t.Fatalf("worker-b received an input of another action: %+v", message)
+	default:
+	}
+}
+
+func testOutput(t *testing.T, m MessengerAdapters) {
+
+	received := make(chan spider.OutputMessage, 1)
+
+	listen(t, func(ctx context.Context) error {
+		return m.Workflow.ListenOutputMessages(ctx, func(c spider.OutputMessageContext, message spider.OutputMessage) error {
+			received <- message
+			return nil
+		})
+	})
+
+	sent := spider.OutputMessage{
+		SessionID:   newID(t),
+		TaskID:      newID(t),
+		TenantID:    newID(t),
+		WorkflowID:  newID(t),
+		Key:         "a1",
+		ActionID:    "worker-a",
+		MetaOutput:  "failure",
+		Values:      "{}",
+		Attempt:     3,
+		FlowVersion: 2,
+		Error:       "boom",
+		ErrorClass:  spider.ErrorClassTransient,
+	}
+
+	err := m.Worker("worker-a").SendOutputMessage(context.Background(), sent)
+
+	requireNoError(t, err, "SendOutputMessage")
+	requireEqual(t, receive(t, received, "output"), sent, "output")
+}
+
+func testRedelivery(t *testing.T, m MessengerAdapters) {
+
+	received := make(chan spider.InputMessage, 10)
+
+	var deliveries atomic.Int32
+
+	listenInputs(t, m.Worker("worker-a"), func(message spider.InputMessage) error {
+
+		// a failed message is delivered again
+		if deliveries.Add(1) == 1 {
+			return errors.New("not yet")
+		}
+
+		received <- message
+
+		return nil
+	})
+
+	sent := spider.InputMessage{
+		SessionID:  newID(t),
+		TaskID:     newID(t),
+		TenantID:   newID(t),
+		WorkflowID: newID(t),
+		Key:        "a1",
+		ActionID:   "worker-a",
+		Values:     "{}",
+		Attempt:    1,
+	}
+
+	err := m.Workflow.SendInputMessage(context.Background(), sent)
+
+	requireNoError(t, err, "SendInputMessage")
+	requireEqual(t, receive(t, received, "redelivered input"), sent, "redelivered input")
+	requireEqual(t, deliveries.Load(), 2, "deliveries")
+}
+
+func testDeadLetters(t *testing.T, m MessengerAdapters) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+
+	received := make(chan spider.TriggerMessage, 10)
+
+	var accept atomic.Bool
+
+	listenTriggers(t, m.Workflow, func(message spider.TriggerMessage) error {
+
+		if !accept.Load() {
+			return spider.PermanentError(errors.New("rejected"))
+		}
+
+		received <- message
+
+		return nil
+	})
+
+	send := func(key string) spider.TriggerMessage {
+
+		message := spider.TriggerMessage{
+			TenantID:   tenantID,
+			WorkflowID: newID(t),
+			Key:        key,
+			ActionID:   "worker-a",
+			MetaOutput: "triggered",
+			Values:     `{"value":"hi"}`,
+		}
+
+		err := m.Workflow.SendTriggerMessage(ctx, message)
+
+		requireNoError(t, err, "SendTriggerMessage")
+
+		return message
+	}
+
+	listDeadLetters := func(page, pageSize int) *spider.DeadLetterListResponse {
+
+		result, err := m.Workflow.ListDeadLetters(ctx, &spider.ListDeadLettersRequest{
+			TenantID: tenantID,
+			Page:     page,
+			PageSize: pageSize,
+		})
+
+		requireNoError(t, err, "ListDeadLetters")
+
+		return result
+	}
+
+	replayed := send("a1")
+
+	eventually(t, func() bool {
+		return listDeadLetters(1, 10).Total == 1
+	}, "a permanently failed message is dead-lettered")
+
+	discarded := send("a2")
+
+	eventually(t, func() bool {
+		return listDeadLetters(1, 10).Total == 2
+	}, "a second permanently failed message is dead-lettered")
+
+	page := listDeadLetters(1, 1)
+
+	requireEqual(t, len(page.DeadLetters), 1, "size of the first page")
+	requireEqual(t, page.Page, 1, "page")
+	requireEqual(t, page.PageSize, 1, "page size")
+
+	// dead letters are listed oldest first
+	first := page.DeadLetters[0]
+
+	page = listDeadLetters(2, 1)
+
+	requireEqual(t, len(page.DeadLetters), 1, "size of the second page")
+
+	second := page.DeadLetters[0]
+
+	page = listDeadLetters(3, 1)
+
+	requireEqual(t, len(page.DeadLetters), 0, "size of a page past the end")
+	requireEqual(t, page.Total, 2, "total past the end")
+
+	other, err := m.Workflow.ListDeadLetters(ctx, &spider.ListDeadLettersRequest{
+		TenantID: newID(t),
+		Page:     1,
+		PageSize: 10,
+	})
+
+	requireNoError(t, err, "ListDeadLetters")
+	requireEqual(t, other.Total, 0, "dead letters of another tenant")
+
+	deadLetter, err := m.Workflow.GetDeadLetter(ctx, tenantID, first.ID)
+
+	requireNoError(t, err, "GetDeadLetter")
+	requireEqual(t, deadLetter.ID, first.ID, "ID")
+	requireEqual(t, deadLetter.TenantID, tenantID, "tenant ID")
+	requireEqual(t, deadLetter.Reason, spider.DeadLetterReasonPermanent, "reason")
+	requireEqual(t, deadLetter.Error, "rejected", "error")
+
+	if deadLetter.Data == "" || deadLetter.Subject == "" || deadLetter.FailedAt.IsZero() {
+		t.Fatalf("GetDeadLetter: incomplete dead letter %+v", deadLetter)
+	}
+
+	_, err = m.Workflow.GetDeadLetter(ctx, newID(t), first.ID)
+
+	requireErrorIs(t, err, spider.ErrDeadLetterNotFound, "GetDeadLetter of another tenant")
+
+	accept.Store(true)
+
+	err = m.Workflow.ReplayDeadLetter(ctx, tenantID, first.ID)
+
+	requireNoError(t, err, "ReplayDeadLetter")
+	requireEqual(t, receive(t, received, "replayed trigger"), replayed, "replayed trigger")
+
+	err = m.Workflow.DiscardDeadLetter(ctx, tenantID, second.ID)
+
+	requireNoError(t, err, "DiscardDeadLetter")
+	requireEqual(t, listDeadLetters(1, 10).Total, 0, "dead letters after replaying and discarding them")
+
+	select {
+	case message := <-received:
+		t.Fatalf("discarded trigger was delivered: %+v, want only %+v", message, discarded)
+	default:
+	}
+
+	_, err = m.Workflow.GetDeadLetter(ctx, tenantID, first.ID)
+
+	requireErrorIs(t, err, spider.ErrDeadLetterNotFound, "GetDeadLetter of a replayed dead letter")
+
+	err = m.Workflow.ReplayDeadLetter(ctx, tenantID, first.ID)
+
+	requireErrorIs(t, err, spider.ErrDeadLetterNotFound, "ReplayDeadLetter of a replayed dead letter")
+
+	err = m.Workflow.DiscardDeadLetter(ctx, tenantID, second.ID)
+
+	requireErrorIs(t, err, spider.ErrDeadLetterNotFound, "DiscardDeadLetter of a discarded dead letter")
+}
+
+func testDeadLetterRetry(t *testing.T, m MessengerAdapters) {
+
+	if m.BreakDeadLetters == nil {
+		t.Skip("the messengers cannot fail to dead-letter")
+	}
+
+	ctx := context.Background()
+	tenantID := newID(t)
+
+	var deliveries atomic.Int32
+
+	last := make(chan struct{}, 1)
+
+	restore := m.BreakDeadLetters(t)
+
+	listenTriggers(t, m.Workflow, func(message spider.TriggerMessage) error {
+
+		if int(deliveries.Add(1)) == m.MaxDeliver {
+			last <- struct{}{}
+		}
+
+		return errors.New("down")
+	})
+
+	err := m.Workflow.SendTriggerMessage(ctx, spider.TriggerMessage{
+		TenantID:   tenantID,
+		WorkflowID: newID(t),
+		Key:        "a1",
+		ActionID:   "worker-a",
+		MetaOutput: "triggered",
+		Values:     `{"value":"hi"}`,
+	})
+
+	requireNoError(t, err, "SendTriggerMessage")
+
+	receive(t, last, "last delivery")
+
+	// the message used up its deliveries while dead-lettering fails
+	time.Sleep(500 * time.Millisecond)
+
+	restore()
+
+	var deadLetters *spider.DeadLetterListResponse
+
+	eventually(t, func() bool {
+
+		deadLetters, err = m.Workflow.ListDeadLetters(ctx, &spider.ListDeadLettersRequest{
+			TenantID: tenantID,
+			Page:     1,
+			PageSize: 10,
+		})
+
+		requireNoError(t, err, "ListDeadLetters")
+
+		return deadLetters.Total == 1
+	}, "the message is dead-lettered once dead-lettering works again")
+
+	deadLetter := deadLetters.DeadLetters[0]
+
+	requireEqual(t, deadLetter.Reason, spider.DeadLetterReasonMaxDeliver, "reason")
+	requireEqual(t, deadLetter.Attempts, m.MaxDeliver, "attempts")
+	requireEqual(t, int(deliveries.Load()), m.MaxDeliver, "deliveries")
+}
+
+func testListenTwice(t *testing.T, m MessengerAdapters) {
+
+	received := make(chan spider.InputMessage, 1)
+
+	worker := m.Worker("worker-a")
+
+	listenInputs(t, worker, func(message spider.InputMessage) error {
+		received <- message
+		return nil
+	})
+
+	err := m.Workflow.SendInputMessage(context.Background(), spider.InputMessage{
+		SessionID:  newID(t),
+		TaskID:     newID(t),
+		TenantID:   newID(t),
+		WorkflowID: newID(t),
+		Key:        "a1",
+		ActionID:   "worker-a",
+		Values:     "{}",
+	})
+
+	requireNoError(t, err, "SendInputMessage")
+
+	receive(t, received, "input")
+
+	err = worker.ListenInputMessages(context.Background(), func(c spider.InputMessageContext, message spider.InputMessage) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Fatalf("ListenInputMessages: a second listener of the same messenger was accepted")
+	}
+}
+
+func testCancel(t *testing.T, m MessengerAdapters) {
+
+	started := make(chan spider.InputMessage, 10)
+	stopped := make(chan error, 10)
+	release := make(chan struct{})
+
+	t.Cleanup(func() {
+		close(release)
+	})
+
+	listen(t, func(ctx context.Context) error {
+		return m.Worker("worker-a").ListenInputMessages(ctx, func(c spider.InputMessageContext, message spider.InputMessage) error {
+
+			started <- message
+
+			select {
+			case <-c.Context.Done():
+				stopped <- context.Cause(c.Context)
+				return c.Context.Err()
+			case <-release:
+				return nil
+			}
+		})
+	})
+
+	tenantID := newID(t)
+	workflowID := newID(t)
+
+	send := func(sessionID string) {
+
+		err := m.Workflow.SendInputMessage(context.Background(), spider.InputMessage{
+			SessionID:  sessionID,
+			TaskID:     newID(t),
+			TenantID:   tenantID,
+			WorkflowID: workflowID,
+			Key:        "a1",
+			ActionID:   "worker-a",
+			Values:     "{}",
+			Attempt:    1,
+		})
+
+		requireNoError(t, err, "SendInputMessage")
+	}
+
+	cancelledID := newID(t)
+
+	send(cancelledID)
+	send(newID(t))
+
+	receive(t, started, "first input")
+	receive(t, started, "second input")
+
+	err := m.Workflow.SendCancelMessage(context.Background(), spider.CancelMessage{
+		TenantID:   tenantID,
+		WorkflowID: workflowID,
+		SessionID:  cancelledID,
+	})
+
+	requireNoError(t, err, "SendCancelMessage")
+
+	// only the handler of the cancelled run stops
+	requireErrorIs(t, receive(t, stopped, "stopped handler"), spider.ErrRunCancelled, "cause of the stopped handler")
+
+	select {
+	case cause := <-stopped:
+		t.Fatalf("the handler of another run stopped: %v", cause)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
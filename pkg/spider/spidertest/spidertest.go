@@ -0,0 +1,91 @@
+// Package spidertest checks that storage and messenger adapters behave like
+// the MongoDB and NATS ones, so the workflow engine can run on any of them.
+//
+// Run the suites from a test of the adapter package:
+//
+//	func TestStorage(t *testing.T) {
+//		spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+//			return newEmptyStorage(t)
+//		})
+//	}
+package spidertest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// waitTimeout bounds how long a suite waits for a message. NATS redelivers
+// a failed message after a backoff of a second or more.
+const waitTimeout = 15 * time.Second
+
+func newID(t *testing.T) string {
+	t.Helper()
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		t.Fatalf("uuid: %v", err)
+	}
+
+	return id.String()
+}
+
+func requireNoError(t *testing.T, err error, what string) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", what, err)
+	}
+}
+
+func requireErrorIs(t *testing.T, err, target error, what string) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+func requireEqual[T comparable](t *testing.T, got, want T, what string) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+// receive waits for a value on ch.
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(waitTimeout):
+		t.Fatalf("%s: nothing received after %s", what, waitTimeout)
+	}
+
+	var zero T
+
+	return zero
+}
+
+// eventually polls cond until it holds.
+func eventually(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+
+	for !cond() {
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not true after %s", what, waitTimeout)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,1932 @@
+package spidertest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// StorageFactory returns a storage adapter holding no data. It is called
+// once per subtest.
+type StorageFactory func(t *testing.T) spider.WorkflowStorageAdapter
+
+// RunStorageConformance exercises every method of
+// spider.WorkflowStorageAdapter against the behavior of the MongoDB
+// adapter.
+func RunStorageConformance(t *testing.T, newStorage StorageFactory) {
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s spider.WorkflowStorageAdapter)
+	}{
+		{"Flows", testFlows},
+		{"ListFlows", testListFlows},
+		{"Actions", testActions},
+		{"Deps", testDeps},
+		{"DeleteFlow", testDeleteFlow},
+		{"SaveFlowGraph", testSaveFlowGraph},
+		{"SessionContexts", testSessionContexts},
+		{"ConcurrentSessionContexts", testConcurrentSessionContexts},
+		{"ExpiredSessionContexts", testExpiredSessionContexts},
+		{"SessionContextUsage", testSessionContextUsage},
+		{"Runs", testRuns},
+		{"ListRuns", testListRuns},
+		{"RunSteps", testRunSteps},
+		{"ExpiredRuns", testExpiredRuns},
+		{"ExpiredRunSteps", testExpiredRunSteps},
+		{"Joins", testJoins},
+		{"ConcurrentJoins", testConcurrentJoins},
+		{"ExpiredJoins", testExpiredJoins},
+		{"Retries", testRetries},
+		{"ConcurrentRetries", testConcurrentRetries},
+		{"Snapshots", testSnapshots},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := newStorage(t)
+
+			t.Cleanup(func() {
+				_ = s.Close(context.Background())
+			})
+
+			tt.run(t, s)
+		})
+	}
+}
+
+// now returns the current time at the precision every storage keeps.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func createFlow(t *testing.T, s spider.WorkflowStorageAdapter, tenantID, flowID string) *spider.Flow {
+	t.Helper()
+
+	flow, err := s.CreateFlow(context.Background(), &spider.CreateFlowRequest{
+		ID:          flowID,
+		TenantID:    tenantID,
+		Name:        flowID,
+		TriggerType: spider.FlowTriggerTypeEvent,
+	})
+
+	requireNoError(t, err, "CreateFlow")
+
+	return flow
+}
+
+func addAction(t *testing.T, s spider.WorkflowStorageAdapter, tenantID, flowID, key string) *spider.WorkflowAction {
+	t.Helper()
+
+	action, err := s.AddAction(context.Background(), &spider.AddActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        key,
+		ActionID:   "action-" + key,
+		Config: map[string]string{
+			"key": key,
+		},
+	})
+
+	requireNoError(t, err, "AddAction")
+
+	return action
+}
+
+func flowVersion(t *testing.T, s spider.WorkflowStorageAdapter, tenantID, flowID string) uint64 {
+	t.Helper()
+
+	flow, err := s.GetFlow(context.Background(), tenantID, flowID)
+
+	requireNoError(t, err, "GetFlow")
+
+	return flow.Version
+}
+
+func testFlows(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+
+	flow, err := s.CreateFlow(ctx, &spider.CreateFlowRequest{
+		ID:          flowID,
+		TenantID:    tenantID,
+		Name:        "flow",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Meta: map[string]string{
+			"owner": "team",
+		},
+		Deadline:  spider.Duration(time.Minute),
+		Retention: spider.Duration(time.Hour),
+	})
+
+	requireNoError(t, err, "CreateFlow")
+	requireEqual(t, flow.Version, 1, "version of a new flow")
+	requireEqual(t, flow.Status, spider.FlowStatusDraft, "status of a new flow")
+
+	_, err = s.CreateFlow(ctx, &spider.CreateFlowRequest{
+		ID:          flowID,
+		TenantID:    tenantID,
+		Name:        "again",
+		TriggerType: spider.FlowTriggerTypeEvent,
+	})
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "CreateFlow with a taken ID")
+
+	got, err := s.GetFlow(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetFlow")
+	requireEqual(t, got.Name, "flow", "name")
+	requireEqual(t, got.Meta["owner"], "team", "meta")
+	requireEqual(t, got.Deadline, spider.Duration(time.Minute), "deadline")
+	requireEqual(t, got.Retention, spider.Duration(time.Hour), "retention")
+
+	_, err = s.GetFlow(ctx, newID(t), flowID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetFlow of another tenant")
+
+	_, err = s.GetFlow(ctx, tenantID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetFlow of a missing flow")
+
+	updated, err := s.UpdateFlow(ctx, &spider.UpdateFlowRequest{
+		TenantID:    tenantID,
+		FlowID:      flowID,
+		Name:        "renamed",
+		TriggerType: spider.FlowTriggerTypeSchedule,
+		Status:      spider.FlowStatusActive,
+	})
+
+	requireNoError(t, err, "UpdateFlow")
+	requireEqual(t, updated.Name, "renamed", "updated name")
+	requireEqual(t, updated.TriggerType, spider.FlowTriggerTypeSchedule, "updated trigger type")
+	requireEqual(t, updated.Status, spider.FlowStatusActive, "updated status")
+	requireEqual(t, updated.Deadline, 0, "cleared deadline")
+	requireEqual(t, updated.Retention, 0, "cleared retention")
+	requireEqual(t, updated.Version, 1, "version after a flow update")
+
+	_, err = s.UpdateFlow(ctx, &spider.UpdateFlowRequest{
+		TenantID: tenantID,
+		FlowID:   newID(t),
+		Name:     "missing",
+	})
+
+	requireErrorIs(t, err, spider.ErrNotFound, "UpdateFlow of a missing flow")
+}
+
+func testListFlows(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+
+	var ids []string
+
+	for i := range 5 {
+		ids = append(ids, fmt.Sprintf("flow-%d-%s", i, newID(t)))
+		createFlow(t, s, tenantID, ids[i])
+	}
+
+	createFlow(t, s, newID(t), newID(t))
+
+	page1, err := s.ListFlows(ctx, tenantID, 1, 2)
+
+	requireNoError(t, err, "ListFlows")
+	requireEqual(t, page1.Total, 5, "total")
+	requireEqual(t, len(page1.Flows), 2, "size of the first page")
+	requireEqual(t, page1.Page, 1, "page")
+	requireEqual(t, page1.PageSize, 2, "page size")
+
+	// flows are listed by descending ID
+	requireEqual(t, page1.Flows[0].ID, ids[4], "first flow")
+	requireEqual(t, page1.Flows[1].ID, ids[3], "second flow")
+
+	page3, err := s.ListFlows(ctx, tenantID, 3, 2)
+
+	requireNoError(t, err, "ListFlows")
+	requireEqual(t, len(page3.Flows), 1, "size of the last page")
+	requireEqual(t, page3.Flows[0].ID, ids[0], "last flow")
+
+	page4, err := s.ListFlows(ctx, tenantID, 4, 2)
+
+	requireNoError(t, err, "ListFlows")
+	requireEqual(t, len(page4.Flows), 0, "size of a page past the end")
+	requireEqual(t, page4.Total, 5, "total past the end")
+
+	empty, err := s.ListFlows(ctx, newID(t), 1, 10)
+
+	requireNoError(t, err, "ListFlows")
+	requireEqual(t, empty.Total, 0, "total of a tenant without flows")
+}
+
+func testActions(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+
+	createFlow(t, s, tenantID, flowID)
+
+	action, err := s.AddAction(ctx, &spider.AddActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        "a1",
+		ActionID:   "worker-a",
+		Config: map[string]string{
+			"url": "https://example.com",
+		},
+		Map: map[string]spider.Mapper{
+			"value": {Mode: spider.MapperModeExpression, Value: "$trigger.output.value"},
+		},
+		Join: &spider.JoinPolicy{Mode: spider.JoinModeAll},
+		Retry: &spider.RetryPolicy{
+			MaxAttempts:  3,
+			InitialDelay: spider.Duration(time.Second),
+		},
+		Timeout: spider.Duration(time.Minute),
+	})
+
+	requireNoError(t, err, "AddAction")
+	requireEqual(t, action.Disabled, false, "disabled of a new action")
+
+	if action.ID == "" {
+		t.Fatalf("AddAction: empty ID")
+	}
+
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), 2, "version after AddAction")
+
+	_, err = s.AddAction(ctx, &spider.AddActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        "a1",
+		ActionID:   "worker-b",
+	})
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "AddAction with a taken key")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), 2, "version after a rejected AddAction")
+
+	got, err := s.QueryWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, got.ID, action.ID, "ID")
+	requireEqual(t, got.ActionID, "worker-a", "action ID")
+	requireEqual(t, got.Config["url"], "https://example.com", "config")
+	requireEqual(t, got.Map["value"], action.Map["value"], "map")
+	requireEqual(t, got.Timeout, spider.Duration(time.Minute), "timeout")
+
+	if got.Join == nil || got.Join.Mode != spider.JoinModeAll {
+		t.Fatalf("QueryWorkflowAction: join policy %+v", got.Join)
+	}
+
+	if got.Retry == nil || got.Retry.MaxAttempts != 3 || got.Retry.InitialDelay != spider.Duration(time.Second) {
+		t.Fatalf("QueryWorkflowAction: retry policy %+v", got.Retry)
+	}
+
+	_, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "missing")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "QueryWorkflowAction of a missing action")
+
+	_, err = s.QueryWorkflowAction(ctx, newID(t), flowID, "a1")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "QueryWorkflowAction of another tenant")
+
+	updated, err := s.UpdateAction(ctx, &spider.UpdateActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        "a1",
+		Config: map[string]string{
+			"url": "https://example.org",
+		},
+	})
+
+	requireNoError(t, err, "UpdateAction")
+	requireEqual(t, updated.ID, action.ID, "ID after UpdateAction")
+	requireEqual(t, updated.ActionID, "worker-a", "action ID after UpdateAction")
+	requireEqual(t, updated.Config["url"], "https://example.org", "config after UpdateAction")
+	requireEqual(t, updated.Timeout, 0, "cleared timeout")
+
+	if updated.Retry != nil || updated.Join != nil {
+		t.Fatalf("UpdateAction: policies not cleared: %+v %+v", updated.Retry, updated.Join)
+	}
+
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), 3, "version after UpdateAction")
+
+	_, err = s.UpdateAction(ctx, &spider.UpdateActionRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        "missing",
+	})
+
+	requireErrorIs(t, err, spider.ErrNotFound, "UpdateAction of a missing action")
+
+	err = s.DisableWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "DisableWorkflowAction")
+
+	got, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, got.Disabled, true, "disabled after DisableWorkflowAction")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), 4, "version after DisableWorkflowAction")
+
+	err = s.EnableWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "EnableWorkflowAction")
+
+	got, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, got.Disabled, false, "disabled after EnableWorkflowAction")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), 5, "version after EnableWorkflowAction")
+
+	addAction(t, s, tenantID, flowID, "a2")
+
+	actions, err := s.GetWorkflowActions(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 2, "number of actions")
+
+	actions, err = s.GetWorkflowActions(ctx, tenantID, newID(t))
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 0, "number of actions of a missing flow")
+
+	// a returned action is a copy
+	got.Config["url"] = "changed"
+
+	got, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, got.Config["url"], "https://example.org", "config after changing a returned action")
+}
+
+func testDeps(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+
+	createFlow(t, s, tenantID, flowID)
+	addAction(t, s, tenantID, flowID, "a1")
+	addAction(t, s, tenantID, flowID, "a2")
+	addAction(t, s, tenantID, flowID, "a3")
+
+	version := flowVersion(t, s, tenantID, flowID)
+
+	err := s.AddDep(ctx, tenantID, flowID, "a1", "success", "a2")
+
+	requireNoError(t, err, "AddDep")
+
+	err = s.AddDep(ctx, tenantID, flowID, "a1", "success", "a3")
+
+	requireNoError(t, err, "AddDep")
+
+	err = s.AddDep(ctx, tenantID, flowID, "a1", "failure", "a3")
+
+	requireNoError(t, err, "AddDep")
+
+	// a dependency on an action that does not exist is skipped when queried
+	err = s.AddDep(ctx, tenantID, flowID, "a1", "success", "missing")
+
+	requireNoError(t, err, "AddDep on a missing action")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), version+4, "version after AddDep")
+
+	err = s.AddDep(ctx, tenantID, flowID, "a1", "success", "a2")
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "AddDep of an existing dependency")
+
+	deps, err := s.QueryWorkflowActionDependencies(ctx, tenantID, flowID, "a1", "success")
+
+	requireNoError(t, err, "QueryWorkflowActionDependencies")
+	requireEqual(t, len(deps), 2, "number of dependencies")
+	requireEqual(t, deps[0].Key, "a2", "first dependency")
+	requireEqual(t, deps[1].Key, "a3", "second dependency")
+
+	deps, err = s.QueryWorkflowActionDependencies(ctx, tenantID, flowID, "a2", "success")
+
+	requireNoError(t, err, "QueryWorkflowActionDependencies")
+	requireEqual(t, len(deps), 0, "number of dependencies of a leaf")
+
+	all, err := s.GetWorkflowActionDeps(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActionDeps")
+
+	want := []spider.WorkflowActionDep{
+		{Key: "a1", MetaOutput: "success", DepKey: "a2"},
+		{Key: "a1", MetaOutput: "success", DepKey: "a3"},
+		{Key: "a1", MetaOutput: "failure", DepKey: "a3"},
+		{Key: "a1", MetaOutput: "success", DepKey: "missing"},
+	}
+
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("GetWorkflowActionDeps: got %+v, want %+v in insertion order", all, want)
+	}
+
+	version = flowVersion(t, s, tenantID, flowID)
+
+	err = s.RemoveDep(ctx, tenantID, flowID, "a1", "failure", "a3")
+
+	requireNoError(t, err, "RemoveDep")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), version+1, "version after RemoveDep")
+
+	err = s.RemoveDep(ctx, tenantID, flowID, "a1", "failure", "a3")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "RemoveDep of a missing dependency")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), version+1, "version after a rejected RemoveDep")
+
+	err = s.AddDep(ctx, tenantID, flowID, "a3", "success", "a2")
+
+	requireNoError(t, err, "AddDep")
+
+	err = s.DeleteAction(ctx, tenantID, flowID, "a3")
+
+	requireNoError(t, err, "DeleteAction")
+	requireEqual(t, flowVersion(t, s, tenantID, flowID), version+3, "version after DeleteAction")
+
+	_, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "a3")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "QueryWorkflowAction of a deleted action")
+
+	err = s.DeleteAction(ctx, tenantID, flowID, "a3")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "DeleteAction of a missing action")
+
+	err = s.DeleteAction(ctx, newID(t), flowID, "a2")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "DeleteAction of another tenant")
+
+	all, err = s.GetWorkflowActionDeps(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActionDeps")
+
+	// the deps leading to and from a deleted action go with it
+	want = []spider.WorkflowActionDep{
+		{Key: "a1", MetaOutput: "success", DepKey: "a2"},
+		{Key: "a1", MetaOutput: "success", DepKey: "missing"},
+	}
+
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("GetWorkflowActionDeps after DeleteAction: got %+v, want %+v", all, want)
+	}
+}
+
+func testDeleteFlow(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	otherFlowID := newID(t)
+
+	createFlow(t, s, tenantID, flowID)
+	createFlow(t, s, tenantID, otherFlowID)
+	addAction(t, s, tenantID, flowID, "a1")
+	addAction(t, s, tenantID, flowID, "a2")
+	addAction(t, s, tenantID, otherFlowID, "a1")
+
+	err := s.AddDep(ctx, tenantID, flowID, "a1", "success", "a2")
+
+	requireNoError(t, err, "AddDep")
+
+	sessionID := newID(t)
+
+	err = s.CreateRun(ctx, &spider.Run{
+		SessionID:  sessionID,
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Status:     spider.RunStatusRunning,
+		StartedAt:  now(),
+	})
+
+	requireNoError(t, err, "CreateRun")
+
+	err = s.SaveFlowSnapshot(ctx, &spider.FlowSnapshot{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Version:    1,
+		CreatedAt:  now(),
+	})
+
+	requireNoError(t, err, "SaveFlowSnapshot")
+
+	taskID := newID(t)
+
+	for _, workflowID := range []string{flowID, otherFlowID} {
+
+		err = s.CreateSessionContext(ctx, &spider.SessionContext{
+			TenantID:   tenantID,
+			WorkflowID: workflowID,
+			SessionID:  sessionID,
+			TaskID:     taskID,
+			Value: map[string]map[string]interface{}{
+				"$trigger": {"output": map[string]interface{}{}},
+			},
+			CreatedAt: now(),
+		})
+
+		requireNoError(t, err, "CreateSessionContext")
+	}
+
+	err = s.DeleteFlow(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "DeleteFlow")
+
+	// another tenant must not reach the contexts of the flow
+	err = s.DeleteFlow(ctx, newID(t), otherFlowID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "DeleteFlow of another tenant's flow")
+
+	_, err = s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetSessionContext after DeleteFlow")
+
+	_, err = s.GetSessionContext(ctx, otherFlowID, sessionID, taskID)
+
+	requireNoError(t, err, "GetSessionContext of another flow after DeleteFlow")
+
+	_, err = s.GetFlow(ctx, tenantID, flowID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetFlow after DeleteFlow")
+
+	actions, err := s.GetWorkflowActions(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 0, "actions after DeleteFlow")
+
+	deps, err := s.GetWorkflowActionDeps(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActionDeps")
+	requireEqual(t, len(deps), 0, "dependencies after DeleteFlow")
+
+	_, err = s.GetRun(ctx, tenantID, flowID, sessionID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetRun after DeleteFlow")
+
+	_, err = s.GetFlowSnapshot(ctx, tenantID, flowID, 1)
+
+	requireErrorIs(t, err, spider.ErrFlowSnapshotNotFound, "GetFlowSnapshot after DeleteFlow")
+
+	actions, err = s.GetWorkflowActions(ctx, tenantID, otherFlowID)
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 1, "actions of another flow after DeleteFlow")
+
+	err = s.DeleteFlow(ctx, tenantID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "DeleteFlow of a missing flow")
+}
+
+func testSaveFlowGraph(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+
+	graph := spider.SaveFlowGraphRequest{
+		Flow: spider.CreateFlowRequest{
+			ID:          flowID,
+			TenantID:    tenantID,
+			Name:        "graph",
+			TriggerType: spider.FlowTriggerTypeEvent,
+			Deadline:    spider.Duration(time.Minute),
+		},
+		Actions: []spider.AddActionRequest{
+			{Key: "a1", ActionID: "action-a1"},
+			{Key: "a2", ActionID: "action-a2", Config: map[string]string{"key": "a2"}},
+		},
+		Deps: []spider.WorkflowActionDep{
+			{Key: "a1", MetaOutput: "success", DepKey: "a2"},
+		},
+	}
+
+	flow, err := s.SaveFlowGraph(ctx, &graph)
+
+	requireNoError(t, err, "SaveFlowGraph")
+	requireEqual(t, flow.Version, 1, "version of a new flow")
+	requireEqual(t, flow.Status, spider.FlowStatusDraft, "status of a new flow")
+	requireEqual(t, flow.Deadline, spider.Duration(time.Minute), "deadline")
+
+	actions, err := s.GetWorkflowActions(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 2, "actions of a saved graph")
+
+	a2, err := s.QueryWorkflowAction(ctx, tenantID, flowID, "a2")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, a2.Config["key"], "a2", "config of a saved action")
+
+	deps, err := s.QueryWorkflowActionDependencies(ctx, tenantID, flowID, "a1", "success")
+
+	requireNoError(t, err, "QueryWorkflowActionDependencies")
+	requireEqual(t, len(deps), 1, "dependencies of a saved graph")
+
+	_, err = s.UpdateFlow(ctx, &spider.UpdateFlowRequest{
+		TenantID:    tenantID,
+		FlowID:      flowID,
+		Name:        "graph",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Status:      spider.FlowStatusActive,
+	})
+
+	requireNoError(t, err, "UpdateFlow")
+
+	// a replaced graph keeps the status of the flow and the IDs of the
+	// actions it keeps
+	graph.Flow.Name = "replaced"
+	graph.Actions = []spider.AddActionRequest{
+		{Key: "a2", ActionID: "action-a2"},
+		{Key: "a3", ActionID: "action-a3"},
+	}
+	graph.Deps = []spider.WorkflowActionDep{
+		{Key: "a2", MetaOutput: "success", DepKey: "a3"},
+	}
+
+	flow, err = s.SaveFlowGraph(ctx, &graph)
+
+	requireNoError(t, err, "SaveFlowGraph of an existing flow")
+	requireEqual(t, flow.Version, 2, "version of a replaced flow")
+	requireEqual(t, flow.Status, spider.FlowStatusActive, "status of a replaced flow")
+	requireEqual(t, flow.Name, "replaced", "name of a replaced flow")
+
+	_, err = s.QueryWorkflowAction(ctx, tenantID, flowID, "a1")
+
+	requireErrorIs(t, err, spider.ErrNotFound, "QueryWorkflowAction of a removed action")
+
+	replaced, err := s.QueryWorkflowAction(ctx, tenantID, flowID, "a2")
+
+	requireNoError(t, err, "QueryWorkflowAction")
+	requireEqual(t, replaced.ID, a2.ID, "ID of a kept action")
+	requireEqual(t, len(replaced.Config), 0, "config of a replaced action")
+
+	all, err := s.GetWorkflowActionDeps(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActionDeps")
+
+	if !reflect.DeepEqual(all, graph.Deps) {
+		t.Fatalf("GetWorkflowActionDeps: got %+v, want %+v", all, graph.Deps)
+	}
+
+	// a graph that cannot be saved leaves the flow as it was
+	_, err = s.SaveFlowGraph(ctx, &spider.SaveFlowGraphRequest{
+		Flow: spider.CreateFlowRequest{
+			ID:          flowID,
+			TenantID:    tenantID,
+			Name:        "broken",
+			TriggerType: spider.FlowTriggerTypeEvent,
+		},
+		Actions: []spider.AddActionRequest{
+			{Key: "b1", ActionID: "action-b1"},
+			{Key: "b1", ActionID: "action-b1"},
+		},
+	})
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "SaveFlowGraph with a duplicate key")
+
+	got, err := s.GetFlow(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetFlow")
+	requireEqual(t, got.Name, "replaced", "name after a failed SaveFlowGraph")
+	requireEqual(t, got.Version, 2, "version after a failed SaveFlowGraph")
+
+	actions, err = s.GetWorkflowActions(ctx, tenantID, flowID)
+
+	requireNoError(t, err, "GetWorkflowActions")
+	requireEqual(t, len(actions), 2, "actions after a failed SaveFlowGraph")
+
+	_, err = s.SaveFlowGraph(ctx, &spider.SaveFlowGraphRequest{
+		Flow: spider.CreateFlowRequest{
+			ID:          flowID,
+			TenantID:    newID(t),
+			Name:        "stolen",
+			TriggerType: spider.FlowTriggerTypeEvent,
+		},
+	})
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "SaveFlowGraph of the flow of another tenant")
+}
+
+func testSessionContexts(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+	taskID := newID(t)
+
+	value := map[string]map[string]interface{}{
+		"$trigger": {
+			"output": map[string]interface{}{
+				"name":  "spider",
+				"count": float64(2),
+				"tags":  []interface{}{"a", "b"},
+			},
+		},
+	}
+
+	sessionContext := spider.SessionContext{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		SessionID:  sessionID,
+		TaskID:     taskID,
+		Value:      value,
+		CreatedAt:  now(),
+	}
+
+	err := s.CreateSessionContext(ctx, &sessionContext)
+
+	requireNoError(t, err, "CreateSessionContext")
+
+	err = s.CreateSessionContext(ctx, &sessionContext)
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "CreateSessionContext of an existing task")
+
+	got, err := s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+	requireNoError(t, err, "GetSessionContext")
+
+	if !reflect.DeepEqual(got, value) {
+		t.Fatalf("GetSessionContext: got %#v, want %#v", got, value)
+	}
+
+	_, err = s.GetSessionContext(ctx, flowID, sessionID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetSessionContext of a missing task")
+
+	// a returned context is a copy
+	got["$trigger"]["output"] = "changed"
+
+	got, err = s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+	requireNoError(t, err, "GetSessionContext")
+
+	if !reflect.DeepEqual(got, value) {
+		t.Fatalf("GetSessionContext after changing a returned context: got %#v", got)
+	}
+
+	err = s.DeleteSessionContext(ctx, flowID, sessionID, taskID)
+
+	requireNoError(t, err, "DeleteSessionContext")
+
+	_, err = s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetSessionContext of a deleted task")
+
+	err = s.DeleteSessionContext(ctx, flowID, sessionID, newID(t))
+
+	requireNoError(t, err, "DeleteSessionContext of a missing task")
+}
+
+func testConcurrentSessionContexts(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	flowID := newID(t)
+	sessionID := newID(t)
+	sharedTaskID := newID(t)
+
+	var taskIDs []string
+
+	for range 20 {
+		taskIDs = append(taskIDs, newID(t))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+
+	for i, taskID := range taskIDs {
+
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			err := s.CreateSessionContext(ctx, &spider.SessionContext{
+				WorkflowID: flowID,
+				SessionID:  sessionID,
+				TaskID:     taskID,
+				Value: map[string]map[string]interface{}{
+					"step": {"index": float64(i)},
+				},
+				CreatedAt: now(),
+			})
+
+			if err != nil {
+				t.Errorf("CreateSessionContext: %v", err)
+			}
+		}()
+
+		// every writer races for the same task, a single one must win
+		go func() {
+			defer wg.Done()
+
+			err := s.CreateSessionContext(ctx, &spider.SessionContext{
+				WorkflowID: flowID,
+				SessionID:  sessionID,
+				TaskID:     sharedTaskID,
+				Value: map[string]map[string]interface{}{
+					"step": {"index": float64(i)},
+				},
+				CreatedAt: now(),
+			})
+
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	requireEqual(t, created, 1, "concurrent writers of the same task that succeeded")
+
+	for i, taskID := range taskIDs {
+
+		got, err := s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+		requireNoError(t, err, "GetSessionContext")
+		requireEqual(t, got["step"]["index"], interface{}(float64(i)), "context of a concurrent writer")
+	}
+}
+
+func testExpiredSessionContexts(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+	createdAt := now()
+	expiredAt := createdAt.Add(-time.Minute)
+	expiresAt := createdAt.Add(time.Hour)
+
+	runningTaskID := newID(t)
+
+	contexts := map[string]*time.Time{
+		newID(t):      &expiredAt,
+		newID(t):      &expiresAt,
+		newID(t):      nil,
+		runningTaskID: &expiredAt,
+	}
+
+	// the context of a step still running is kept past its expiry
+	err := s.AddRunStep(ctx, &spider.RunStep{
+		TaskID:     runningTaskID,
+		SessionID:  sessionID,
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Key:        "running",
+		ActionID:   "worker",
+		Status:     spider.RunStepStatusRunning,
+		Attempt:    1,
+		StartedAt:  createdAt,
+	})
+
+	requireNoError(t, err, "AddRunStep")
+
+	for taskID, expiresAt := range contexts {
+
+		err := s.CreateSessionContext(ctx, &spider.SessionContext{
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			SessionID:  sessionID,
+			TaskID:     taskID,
+			Value: map[string]map[string]interface{}{
+				"$trigger": {"output": map[string]interface{}{}},
+			},
+			CreatedAt: createdAt,
+			ExpiresAt: expiresAt,
+		})
+
+		requireNoError(t, err, "CreateSessionContext")
+	}
+
+	deleted, err := s.DeleteExpiredSessionContexts(ctx, createdAt, 100)
+
+	requireNoError(t, err, "DeleteExpiredSessionContexts")
+
+	// a shared database may hold expired contexts of other tests
+	if deleted < 1 {
+		t.Fatalf("DeleteExpiredSessionContexts: deleted %d contexts, want at least 1", deleted)
+	}
+
+	for taskID, expiresAt := range contexts {
+
+		_, err := s.GetSessionContext(ctx, flowID, sessionID, taskID)
+
+		if expiresAt == &expiredAt && taskID != runningTaskID {
+			requireErrorIs(t, err, spider.ErrNotFound, "GetSessionContext of an expired task")
+			continue
+		}
+
+		requireNoError(t, err, "GetSessionContext of an unexpired task")
+	}
+}
+
+func testSessionContextUsage(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantA := newID(t)
+	tenantB := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+
+	usages, err := s.ListSessionContextUsage(ctx)
+
+	requireNoError(t, err, "ListSessionContextUsage")
+	requireEqual(t, len(usages), 0, "usages of an empty storage")
+
+	var taskIDs []string
+
+	for i, tenantID := range []string{tenantA, tenantA, tenantB} {
+
+		taskID := newID(t)
+
+		err := s.CreateSessionContext(ctx, &spider.SessionContext{
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			SessionID:  sessionID,
+			TaskID:     taskID,
+			Value: map[string]map[string]interface{}{
+				"step": {"index": float64(i)},
+			},
+			CreatedAt: now(),
+		})
+
+		requireNoError(t, err, "CreateSessionContext")
+
+		taskIDs = append(taskIDs, taskID)
+	}
+
+	usages, err = s.ListSessionContextUsage(ctx)
+
+	requireNoError(t, err, "ListSessionContextUsage")
+	requireEqual(t, len(usages), 2, "tenants using session contexts")
+
+	byTenant := map[string]spider.SessionContextUsage{}
+
+	for _, usage := range usages {
+		byTenant[usage.TenantID] = usage
+	}
+
+	requireEqual(t, byTenant[tenantA].Contexts, 2, "contexts of a tenant")
+	requireEqual(t, byTenant[tenantB].Contexts, 1, "contexts of another tenant")
+	requireEqual(t, byTenant[tenantA].Joins, 0, "joins of a tenant without any")
+
+	if byTenant[tenantB].Bytes <= 0 || byTenant[tenantA].Bytes <= byTenant[tenantB].Bytes {
+		t.Fatalf("ListSessionContextUsage: got %d and %d bytes", byTenant[tenantA].Bytes, byTenant[tenantB].Bytes)
+	}
+
+	err = s.DeleteSessionContext(ctx, flowID, sessionID, taskIDs[2])
+
+	requireNoError(t, err, "DeleteSessionContext")
+
+	usages, err = s.ListSessionContextUsage(ctx)
+
+	requireNoError(t, err, "ListSessionContextUsage")
+	requireEqual(t, len(usages), 1, "tenants using session contexts after DeleteSessionContext")
+	requireEqual(t, usages[0].TenantID, tenantA, "tenant using session contexts")
+}
+
+func testRuns(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+	startedAt := now()
+	deadlineAt := startedAt.Add(time.Hour)
+
+	run := spider.Run{
+		SessionID:         sessionID,
+		TenantID:          tenantID,
+		WorkflowID:        flowID,
+		FlowVersion:       3,
+		Status:            spider.RunStatusHeld,
+		TriggerKey:        "a1",
+		TriggerMetaOutput: "triggered",
+		TriggerPayload: map[string]interface{}{
+			"value": "hi",
+		},
+		StartedAt:  startedAt,
+		DeadlineAt: &deadlineAt,
+	}
+
+	err := s.CreateRun(ctx, &run)
+
+	requireNoError(t, err, "CreateRun")
+
+	err = s.CreateRun(ctx, &run)
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "CreateRun of an existing session")
+
+	got, err := s.GetRun(ctx, tenantID, flowID, sessionID)
+
+	requireNoError(t, err, "GetRun")
+	requireEqual(t, got.Status, spider.RunStatusHeld, "status")
+	requireEqual(t, got.FlowVersion, 3, "flow version")
+	requireEqual(t, got.TriggerKey, "a1", "trigger key")
+	requireEqual(t, got.TriggerPayload["value"], interface{}("hi"), "trigger payload")
+
+	if !got.StartedAt.Equal(startedAt) {
+		t.Fatalf("GetRun: started at %v, want %v", got.StartedAt, startedAt)
+	}
+
+	if got.DeadlineAt == nil || !got.DeadlineAt.Equal(deadlineAt) {
+		t.Fatalf("GetRun: deadline at %v, want %v", got.DeadlineAt, deadlineAt)
+	}
+
+	if got.EndedAt != nil {
+		t.Fatalf("GetRun: ended at %v, want nil", got.EndedAt)
+	}
+
+	_, err = s.GetRun(ctx, newID(t), flowID, sessionID)
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetRun of another tenant")
+
+	_, err = s.GetRun(ctx, tenantID, flowID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetRun of a missing session")
+
+	ok, err := s.UpdateRunStatus(ctx, flowID, sessionID, &spider.UpdateRunStatusRequest{
+		From: []spider.RunStatus{spider.RunStatusRunning},
+		To:   spider.RunStatusSucceeded,
+	})
+
+	requireNoError(t, err, "UpdateRunStatus")
+	requireEqual(t, ok, false, "UpdateRunStatus from a status the run is not in")
+
+	ok, err = s.UpdateRunStatus(ctx, flowID, sessionID, &spider.UpdateRunStatusRequest{
+		From:        []spider.RunStatus{spider.RunStatusHeld},
+		To:          spider.RunStatusRunning,
+		FlowVersion: 4,
+	})
+
+	requireNoError(t, err, "UpdateRunStatus")
+	requireEqual(t, ok, true, "UpdateRunStatus from the status of the run")
+
+	endedAt := now()
+
+	ok, err = s.UpdateRunStatus(ctx, flowID, sessionID, &spider.UpdateRunStatusRequest{
+		From:    []spider.RunStatus{spider.RunStatusRunning, spider.RunStatusHeld},
+		To:      spider.RunStatusFailed,
+		Error:   "boom",
+		EndedAt: &endedAt,
+	})
+
+	requireNoError(t, err, "UpdateRunStatus")
+	requireEqual(t, ok, true, "UpdateRunStatus to a final status")
+
+	got, err = s.GetRun(ctx, tenantID, flowID, sessionID)
+
+	requireNoError(t, err, "GetRun")
+	requireEqual(t, got.Status, spider.RunStatusFailed, "status after UpdateRunStatus")
+	requireEqual(t, got.Error, "boom", "error after UpdateRunStatus")
+
+	status, err := s.GetRunStatus(ctx, flowID, sessionID)
+
+	requireNoError(t, err, "GetRunStatus")
+	requireEqual(t, status, spider.RunStatusFailed, "GetRunStatus")
+
+	_, err = s.GetRunStatus(ctx, flowID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetRunStatus of a missing session")
+	requireEqual(t, got.FlowVersion, 4, "flow version after UpdateRunStatus")
+
+	if got.EndedAt == nil || !got.EndedAt.Equal(endedAt) {
+		t.Fatalf("GetRun: ended at %v, want %v", got.EndedAt, endedAt)
+	}
+
+	if got.DeadlineAt == nil || !got.DeadlineAt.Equal(deadlineAt) {
+		t.Fatalf("GetRun: deadline at %v, want it kept", got.DeadlineAt)
+	}
+
+	ok, err = s.UpdateRunStatus(ctx, flowID, newID(t), &spider.UpdateRunStatusRequest{
+		From: []spider.RunStatus{spider.RunStatusRunning},
+		To:   spider.RunStatusFailed,
+	})
+
+	requireNoError(t, err, "UpdateRunStatus of a missing session")
+	requireEqual(t, ok, false, "UpdateRunStatus of a missing session")
+}
+
+func testListRuns(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	base := now().Add(-time.Hour)
+
+	var sessionIDs []string
+
+	for i := range 5 {
+
+		status := spider.RunStatusSucceeded
+
+		if i%2 == 1 {
+			status = spider.RunStatusFailed
+		}
+
+		sessionIDs = append(sessionIDs, newID(t))
+
+		err := s.CreateRun(ctx, &spider.Run{
+			SessionID:  sessionIDs[i],
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			Status:     status,
+			StartedAt:  base.Add(time.Duration(i) * time.Minute),
+		})
+
+		requireNoError(t, err, "CreateRun")
+	}
+
+	err := s.CreateRun(ctx, &spider.Run{
+		SessionID:  newID(t),
+		TenantID:   tenantID,
+		WorkflowID: newID(t),
+		Status:     spider.RunStatusSucceeded,
+		StartedAt:  base,
+	})
+
+	requireNoError(t, err, "CreateRun")
+
+	page1, err := s.ListRuns(ctx, &spider.ListRunsRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Page:       1,
+		PageSize:   2,
+	})
+
+	requireNoError(t, err, "ListRuns")
+	requireEqual(t, page1.Total, 5, "total")
+	requireEqual(t, len(page1.Runs), 2, "size of the first page")
+
+	// runs are listed newest first
+	requireEqual(t, page1.Runs[0].SessionID, sessionIDs[4], "first run")
+	requireEqual(t, page1.Runs[1].SessionID, sessionIDs[3], "second run")
+
+	page4, err := s.ListRuns(ctx, &spider.ListRunsRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Page:       4,
+		PageSize:   2,
+	})
+
+	requireNoError(t, err, "ListRuns")
+	requireEqual(t, len(page4.Runs), 0, "size of a page past the end")
+
+	if page4.Runs == nil {
+		t.Fatalf("ListRuns: nil runs past the end, want an empty list")
+	}
+
+	failed, err := s.ListRuns(ctx, &spider.ListRunsRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Status:     spider.RunStatusFailed,
+		Page:       1,
+		PageSize:   10,
+	})
+
+	requireNoError(t, err, "ListRuns")
+	requireEqual(t, failed.Total, 2, "total of failed runs")
+
+	from := base.Add(time.Minute)
+	to := base.Add(3 * time.Minute)
+
+	window, err := s.ListRuns(ctx, &spider.ListRunsRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		From:       &from,
+		To:         &to,
+		Page:       1,
+		PageSize:   10,
+	})
+
+	requireNoError(t, err, "ListRuns")
+
+	// from is inclusive, to is exclusive
+	requireEqual(t, window.Total, 2, "total of runs in a time window")
+	requireEqual(t, window.Runs[0].SessionID, sessionIDs[2], "newest run in a time window")
+	requireEqual(t, window.Runs[1].SessionID, sessionIDs[1], "oldest run in a time window")
+}
+
+func testRunSteps(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+
+	err := s.CreateRun(ctx, &spider.Run{
+		SessionID:  sessionID,
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Status:     spider.RunStatusRunning,
+		StartedAt:  now(),
+	})
+
+	requireNoError(t, err, "CreateRun")
+
+	var taskIDs []string
+
+	for i := range 3 {
+
+		taskIDs = append(taskIDs, newID(t))
+
+		err := s.AddRunStep(ctx, &spider.RunStep{
+			TaskID:     taskIDs[i],
+			SessionID:  sessionID,
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			Key:        fmt.Sprintf("a%d", i),
+			ActionID:   "worker",
+			Status:     spider.RunStepStatusRunning,
+			Input: map[string]interface{}{
+				"value": "in",
+			},
+			Attempt:   1,
+			StartedAt: now(),
+		})
+
+		requireNoError(t, err, "AddRunStep")
+	}
+
+	err = s.AddRunStep(ctx, &spider.RunStep{
+		TaskID:     taskIDs[0],
+		SessionID:  sessionID,
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Status:     spider.RunStepStatusRunning,
+	})
+
+	requireErrorIs(t, err, spider.ErrAlreadyExists, "AddRunStep of an existing task")
+
+	count, err := s.CountActiveRunSteps(ctx, flowID, sessionID)
+
+	requireNoError(t, err, "CountActiveRunSteps")
+	requireEqual(t, count, 3, "active steps")
+
+	step, err := s.GetRunStep(ctx, flowID, sessionID, taskIDs[0])
+
+	requireNoError(t, err, "GetRunStep")
+	requireEqual(t, step.Key, "a0", "key")
+	requireEqual(t, step.Input["value"], interface{}("in"), "input")
+
+	_, err = s.GetRunStep(ctx, flowID, sessionID, newID(t))
+
+	requireErrorIs(t, err, spider.ErrNotFound, "GetRunStep of a missing task")
+
+	deadlineAt := now().Add(time.Minute)
+
+	ok, err := s.UpdateRunStepStatus(ctx, flowID, sessionID, taskIDs[1], &spider.UpdateRunStepStatusRequest{
+		From:  []spider.RunStepStatus{spider.RunStepStatusRunning},
+		To:    spider.RunStepStatusRetrying,
+		Error: "try again",
+	})
+
+	requireNoError(t, err, "UpdateRunStepStatus")
+	requireEqual(t, ok, true, "UpdateRunStepStatus from the status of the step")
+
+	ok, err = s.UpdateRunStepStatus(ctx, flowID, sessionID, taskIDs[1], &spider.UpdateRunStepStatusRequest{
+		From: []spider.RunStepStatus{spider.RunStepStatusRunning},
+		To:   spider.RunStepStatusRetrying,
+	})
+
+	requireNoError(t, err, "UpdateRunStepStatus")
+	requireEqual(t, ok, false, "UpdateRunStepStatus from a status the step is not in")
+
+	ok, err = s.UpdateRunStepStatus(ctx, flowID, sessionID, taskIDs[1], &spider.UpdateRunStepStatusRequest{
+		From:       []spider.RunStepStatus{spider.RunStepStatusRetrying},
+		To:         spider.RunStepStatusRunning,
+		Attempt:    2,
+		DeadlineAt: &deadlineAt,
+	})
+
+	requireNoError(t, err, "UpdateRunStepStatus")
+	requireEqual(t, ok, true, "UpdateRunStepStatus back to running")
+
+	step, err = s.GetRunStep(ctx, flowID, sessionID, taskIDs[1])
+
+	requireNoError(t, err, "GetRunStep")
+	requireEqual(t, step.Status, spider.RunStepStatusRunning, "status after UpdateRunStepStatus")
+	requireEqual(t, step.Attempt, 2, "attempt after UpdateRunStepStatus")
+	requireEqual(t, step.Error, "try again", "error kept by UpdateRunStepStatus")
+
+	if step.DeadlineAt == nil || !step.DeadlineAt.Equal(deadlineAt) {
+		t.Fatalf("GetRunStep: deadline at %v, want %v", step.DeadlineAt, deadlineAt)
+	}
+
+	endedAt := now()
+
+	finished, err := s.FinishRunStep(ctx, flowID, sessionID, taskIDs[0], &spider.FinishRunStepRequest{
+		Status:     spider.RunStepStatusSucceeded,
+		MetaOutput: "success",
+		Output: map[string]interface{}{
+			"value": "out",
+		},
+		EndedAt: endedAt,
+	})
+
+	requireNoError(t, err, "FinishRunStep")
+	requireEqual(t, finished, true, "FinishRunStep of an active step")
+
+	// a redelivered output must not finish the step twice
+	finished, err = s.FinishRunStep(ctx, flowID, sessionID, taskIDs[0], &spider.FinishRunStepRequest{
+		Status:  spider.RunStepStatusFailed,
+		EndedAt: endedAt,
+	})
+
+	requireNoError(t, err, "FinishRunStep")
+	requireEqual(t, finished, false, "FinishRunStep of a finished step")
+
+	finished, err = s.FinishRunStep(ctx, flowID, sessionID, newID(t), &spider.FinishRunStepRequest{
+		Status:  spider.RunStepStatusFailed,
+		EndedAt: endedAt,
+	})
+
+	requireNoError(t, err, "FinishRunStep of a missing task")
+	requireEqual(t, finished, false, "FinishRunStep of a missing task")
+
+	step, err = s.GetRunStep(ctx, flowID, sessionID, taskIDs[0])
+
+	requireNoError(t, err, "GetRunStep")
+	requireEqual(t, step.Status, spider.RunStepStatusSucceeded, "status after FinishRunStep")
+	requireEqual(t, step.MetaOutput, "success", "meta output after FinishRunStep")
+	requireEqual(t, step.Output["value"], interface{}("out"), "output after FinishRunStep")
+
+	if step.EndedAt == nil || !step.EndedAt.Equal(endedAt) {
+		t.Fatalf("GetRunStep: ended at %v, want %v", step.EndedAt, endedAt)
+	}
+
+	count, err = s.CountActiveRunSteps(ctx, flowID, sessionID)
+
+	requireNoError(t, err, "CountActiveRunSteps")
+	requireEqual(t, count, 2, "active steps after FinishRunStep")
+
+	run, err := s.GetRun(ctx, tenantID, flowID, sessionID)
+
+	requireNoError(t, err, "GetRun")
+	requireEqual(t, len(run.Steps), 3, "steps of the run")
+
+	for i, step := range run.Steps {
+		requireEqual(t, step.TaskID, taskIDs[i], "steps in task order")
+	}
+}
+
+func testExpiredRuns(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	current := now()
+
+	create := func(status spider.RunStatus, deadlineAt *time.Time) string {
+
+		sessionID := newID(t)
+
+		err := s.CreateRun(ctx, &spider.Run{
+			SessionID:  sessionID,
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			Status:     status,
+			StartedAt:  current.Add(-time.Hour),
+			DeadlineAt: deadlineAt,
+		})
+
+		requireNoError(t, err, "CreateRun")
+
+		return sessionID
+	}
+
+	late := current.Add(-time.Minute)
+	later := current.Add(-2 * time.Minute)
+	future := current.Add(time.Minute)
+
+	lateID := create(spider.RunStatusRunning, &late)
+	laterID := create(spider.RunStatusRunning, &later)
+	create(spider.RunStatusRunning, &future)
+	create(spider.RunStatusRunning, nil)
+	create(spider.RunStatusSucceeded, &later)
+	create(spider.RunStatusHeld, &later)
+
+	runs, err := s.ListExpiredRuns(ctx, current, 10)
+
+	requireNoError(t, err, "ListExpiredRuns")
+	requireEqual(t, len(runs), 2, "expired runs")
+
+	// the longest overdue run comes first
+	requireEqual(t, runs[0].SessionID, laterID, "first expired run")
+	requireEqual(t, runs[1].SessionID, lateID, "second expired run")
+
+	runs, err = s.ListExpiredRuns(ctx, current, 1)
+
+	requireNoError(t, err, "ListExpiredRuns")
+	requireEqual(t, len(runs), 1, "expired runs with a limit")
+}
+
+func testExpiredRunSteps(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+	current := now()
+
+	add := func(status spider.RunStepStatus, deadlineAt *time.Time) string {
+
+		taskID := newID(t)
+
+		err := s.AddRunStep(ctx, &spider.RunStep{
+			TaskID:     taskID,
+			SessionID:  sessionID,
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			Key:        taskID,
+			Status:     status,
+			Attempt:    1,
+			StartedAt:  current.Add(-time.Hour),
+			DeadlineAt: deadlineAt,
+		})
+
+		requireNoError(t, err, "AddRunStep")
+
+		return taskID
+	}
+
+	late := current.Add(-time.Minute)
+	later := current.Add(-2 * time.Minute)
+	future := current.Add(time.Minute)
+
+	lateID := add(spider.RunStepStatusRunning, &late)
+	laterID := add(spider.RunStepStatusRunning, &later)
+	add(spider.RunStepStatusRunning, &future)
+	add(spider.RunStepStatusRunning, nil)
+	add(spider.RunStepStatusRetrying, &later)
+	add(spider.RunStepStatusSucceeded, &later)
+
+	steps, err := s.ListExpiredRunSteps(ctx, current, 10)
+
+	requireNoError(t, err, "ListExpiredRunSteps")
+	requireEqual(t, len(steps), 2, "expired steps")
+	requireEqual(t, steps[0].TaskID, laterID, "first expired step")
+	requireEqual(t, steps[1].TaskID, lateID, "second expired step")
+
+	steps, err = s.ListExpiredRunSteps(ctx, current, 1)
+
+	requireNoError(t, err, "ListExpiredRunSteps")
+	requireEqual(t, len(steps), 1, "expired steps with a limit")
+}
+
+func testJoins(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+
+	value := func(parentKey string) map[string]map[string]interface{} {
+		return map[string]map[string]interface{}{
+			parentKey: {"output": "from " + parentKey},
+		}
+	}
+
+	arrive := func(parentKey string) (*spider.JoinState, error) {
+		return s.AddJoinArrival(ctx, &spider.AddJoinArrivalRequest{
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			SessionID:  sessionID,
+			Key:        "a3",
+			ParentKey:  parentKey,
+			Value:      value(parentKey),
+		})
+	}
+
+	state, err := arrive("a1")
+
+	requireNoError(t, err, "AddJoinArrival")
+	requireEqual(t, len(state.Arrivals), 1, "arrivals")
+	requireEqual(t, state.Dispatched, false, "dispatched")
+
+	// a redelivered arrival of the same parent is not counted twice
+	state, err = arrive("a1")
+
+	requireNoError(t, err, "AddJoinArrival")
+	requireEqual(t, len(state.Arrivals), 1, "arrivals after a repeated parent")
+
+	state, err = arrive("a2")
+
+	requireNoError(t, err, "AddJoinArrival")
+	requireEqual(t, len(state.Arrivals), 2, "arrivals after a second parent")
+	requireEqual(t, state.Arrivals[0].ParentKey, "a1", "first arrival")
+	requireEqual(t, state.Arrivals[1].ParentKey, "a2", "second arrival")
+
+	if !reflect.DeepEqual(state.Arrivals[1].Value, value("a2")) {
+		t.Fatalf("AddJoinArrival: value %#v, want %#v", state.Arrivals[1].Value, value("a2"))
+	}
+
+	claimed, err := s.ClaimJoin(ctx, flowID, sessionID, "a3", "a2")
+
+	requireNoError(t, err, "ClaimJoin")
+	requireEqual(t, claimed, true, "first ClaimJoin")
+
+	claimed, err = s.ClaimJoin(ctx, flowID, sessionID, "a3", "a1")
+
+	requireNoError(t, err, "ClaimJoin")
+	requireEqual(t, claimed, false, "ClaimJoin of another parent")
+
+	// the claiming parent claims again when its output is redelivered
+	claimed, err = s.ClaimJoin(ctx, flowID, sessionID, "a3", "a2")
+
+	requireNoError(t, err, "ClaimJoin")
+	requireEqual(t, claimed, true, "ClaimJoin repeated by the claiming parent")
+
+	claimed, err = s.ClaimJoin(ctx, flowID, sessionID, "missing", "a1")
+
+	requireNoError(t, err, "ClaimJoin of a missing join")
+	requireEqual(t, claimed, false, "ClaimJoin of a missing join")
+
+	state, err = arrive("a4")
+
+	requireNoError(t, err, "AddJoinArrival")
+	requireEqual(t, state.Dispatched, true, "dispatched after ClaimJoin")
+	requireEqual(t, state.DispatchedBy, "a2", "parent that claimed the join")
+}
+
+func testConcurrentJoins(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	sessionID := newID(t)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+
+	for i := range 10 {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			parentKey := fmt.Sprintf("p%d", i)
+
+			_, err := s.AddJoinArrival(ctx, &spider.AddJoinArrivalRequest{
+				TenantID:   tenantID,
+				WorkflowID: flowID,
+				SessionID:  sessionID,
+				Key:        "join",
+				ParentKey:  parentKey,
+				Value: map[string]map[string]interface{}{
+					parentKey: {"output": "ok"},
+				},
+			})
+
+			if err != nil {
+				t.Errorf("AddJoinArrival: %v", err)
+				return
+			}
+
+			ok, err := s.ClaimJoin(ctx, flowID, sessionID, "join", parentKey)
+
+			if err != nil {
+				t.Errorf("ClaimJoin: %v", err)
+				return
+			}
+
+			if ok {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	requireEqual(t, claimed, 1, "concurrent claims that succeeded")
+
+	state, err := s.AddJoinArrival(ctx, &spider.AddJoinArrivalRequest{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		SessionID:  sessionID,
+		Key:        "join",
+		ParentKey:  "p0",
+	})
+
+	requireNoError(t, err, "AddJoinArrival")
+	requireEqual(t, len(state.Arrivals), 10, "arrivals of concurrent parents")
+}
+
+func testExpiredJoins(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	runningID := newID(t)
+	endedID := newID(t)
+	createdAt := now()
+	expiredAt := createdAt.Add(-time.Minute)
+	expiresAt := createdAt.Add(time.Hour)
+
+	for sessionID, status := range map[string]spider.RunStatus{
+		runningID: spider.RunStatusRunning,
+		endedID:   spider.RunStatusSucceeded,
+	} {
+
+		err := s.CreateRun(ctx, &spider.Run{
+			SessionID:         sessionID,
+			TenantID:          tenantID,
+			WorkflowID:        flowID,
+			Status:            status,
+			TriggerKey:        "a1",
+			TriggerMetaOutput: "triggered",
+			StartedAt:         createdAt,
+		})
+
+		requireNoError(t, err, "CreateRun")
+	}
+
+	arrive := func(sessionID, key, parentKey string, expiresAt *time.Time) *spider.JoinState {
+
+		state, err := s.AddJoinArrival(ctx, &spider.AddJoinArrivalRequest{
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			SessionID:  sessionID,
+			Key:        key,
+			ParentKey:  parentKey,
+			Value: map[string]map[string]interface{}{
+				parentKey: {"output": "ok"},
+			},
+			ExpiresAt: expiresAt,
+		})
+
+		requireNoError(t, err, "AddJoinArrival")
+
+		return state
+	}
+
+	joins := func() int64 {
+
+		usages, err := s.ListSessionContextUsage(ctx)
+
+		requireNoError(t, err, "ListSessionContextUsage")
+		requireEqual(t, len(usages), 1, "tenants using joins")
+		requireEqual(t, usages[0].TenantID, tenantID, "tenant using joins")
+
+		if usages[0].Joins > 0 && usages[0].JoinBytes <= 0 {
+			t.Fatalf("ListSessionContextUsage: %d joins of %d bytes", usages[0].Joins, usages[0].JoinBytes)
+		}
+
+		return usages[0].Joins
+	}
+
+	// the join of a running run is kept past its expiry, the joins of an
+	// ended run and of a missing one are not
+	arrive(runningID, "join", "a1", &expiredAt)
+	arrive(endedID, "expired", "a1", &expiredAt)
+	arrive(endedID, "unexpired", "a1", &expiresAt)
+	arrive(endedID, "kept", "a1", nil)
+	arrive(newID(t), "orphan", "a1", &expiredAt)
+
+	requireEqual(t, joins(), 5, "joins")
+
+	deleted, err := s.DeleteExpiredJoins(ctx, createdAt, 100)
+
+	requireNoError(t, err, "DeleteExpiredJoins")
+	requireEqual(t, deleted, 2, "expired joins deleted")
+	requireEqual(t, joins(), 3, "joins")
+
+	err = s.DeleteSessionJoins(ctx, flowID, endedID)
+
+	requireNoError(t, err, "DeleteSessionJoins")
+	requireEqual(t, joins(), 1, "joins")
+
+	state := arrive(runningID, "join", "a2", &expiredAt)
+
+	requireEqual(t, len(state.Arrivals), 2, "arrivals of the join of the running run")
+}
+
+func testRetries(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+	current := now()
+
+	schedule := func(dueAt time.Time) *spider.ScheduledRetry {
+
+		retry := spider.ScheduledRetry{
+			TenantID:    tenantID,
+			WorkflowID:  flowID,
+			SessionID:   newID(t),
+			TaskID:      newID(t),
+			Key:         "a1",
+			ActionID:    "worker",
+			Values:      `{"value":"hi"}`,
+			Attempt:     2,
+			FlowVersion: 5,
+			Timeout:     spider.Duration(time.Minute),
+			DueAt:       dueAt,
+		}
+
+		err := s.ScheduleRetry(ctx, &retry)
+
+		requireNoError(t, err, "ScheduleRetry")
+
+		if retry.ID == "" {
+			t.Fatalf("ScheduleRetry: empty ID")
+		}
+
+		return &retry
+	}
+
+	late := schedule(current.Add(-time.Second))
+	later := schedule(current.Add(-time.Minute))
+	schedule(current.Add(time.Minute))
+
+	retries, err := s.ClaimDueRetries(ctx, current, time.Minute, 1)
+
+	requireNoError(t, err, "ClaimDueRetries")
+	requireEqual(t, len(retries), 1, "due retries with a limit")
+	requireEqual(t, retries[0].ID, later.ID, "longest due retry")
+	requireEqual(t, retries[0].TaskID, later.TaskID, "task ID")
+	requireEqual(t, retries[0].Values, later.Values, "values")
+	requireEqual(t, retries[0].Attempt, 2, "attempt")
+	requireEqual(t, retries[0].FlowVersion, 5, "flow version")
+	requireEqual(t, retries[0].Timeout, spider.Duration(time.Minute), "timeout")
+
+	if !retries[0].DueAt.Equal(later.DueAt) {
+		t.Fatalf("ClaimDueRetries: due at %v, want %v", retries[0].DueAt, later.DueAt)
+	}
+
+	retries, err = s.ClaimDueRetries(ctx, current, time.Minute, 10)
+
+	requireNoError(t, err, "ClaimDueRetries")
+	requireEqual(t, len(retries), 1, "due retries left")
+	requireEqual(t, retries[0].ID, late.ID, "remaining due retry")
+
+	retries, err = s.ClaimDueRetries(ctx, current, time.Minute, 10)
+
+	requireNoError(t, err, "ClaimDueRetries")
+	requireEqual(t, len(retries), 0, "due retries while leased")
+
+	err = s.DeleteRetry(ctx, late.ID)
+
+	requireNoError(t, err, "DeleteRetry")
+
+	// the lease of the retry that was not deleted expired
+	retries, err = s.ClaimDueRetries(ctx, current.Add(2*time.Minute), time.Minute, 10)
+
+	requireNoError(t, err, "ClaimDueRetries")
+	requireEqual(t, len(retries), 2, "retries due later and expired leases")
+
+	ids := map[string]bool{}
+
+	for _, retry := range retries {
+		ids[retry.ID] = true
+	}
+
+	requireEqual(t, ids[later.ID], true, "retry claimed again after its lease")
+	requireEqual(t, ids[late.ID], false, "deleted retry claimed")
+}
+
+func testConcurrentRetries(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	current := now()
+
+	for range 20 {
+
+		err := s.ScheduleRetry(ctx, &spider.ScheduledRetry{
+			TenantID:   newID(t),
+			WorkflowID: newID(t),
+			SessionID:  newID(t),
+			TaskID:     newID(t),
+			DueAt:      current.Add(-time.Second),
+		})
+
+		requireNoError(t, err, "ScheduleRetry")
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = map[string]int{}
+	)
+
+	for range 5 {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				retries, err := s.ClaimDueRetries(ctx, current, time.Hour, 3)
+
+				if err != nil {
+					t.Errorf("ClaimDueRetries: %v", err)
+					return
+				}
+
+				if len(retries) == 0 {
+					return
+				}
+
+				mu.Lock()
+
+				for _, retry := range retries {
+					claimed[retry.ID]++
+				}
+
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	requireEqual(t, len(claimed), 20, "retries claimed by concurrent schedulers")
+
+	for id, n := range claimed {
+		if n != 1 {
+			t.Fatalf("ClaimDueRetries: retry %s claimed %d times", id, n)
+		}
+	}
+}
+
+func testSnapshots(t *testing.T, s spider.WorkflowStorageAdapter) {
+
+	ctx := context.Background()
+	tenantID := newID(t)
+	flowID := newID(t)
+
+	snapshot := spider.FlowSnapshot{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Version:    2,
+		Actions: []spider.WorkflowAction{
+			{
+				ID:         newID(t),
+				Key:        "a1",
+				TenantID:   tenantID,
+				WorkflowID: flowID,
+				ActionID:   "worker",
+				Config: map[string]string{
+					"url": "https://example.com",
+				},
+				Timeout: spider.Duration(time.Minute),
+			},
+		},
+		Deps: []spider.WorkflowActionDep{
+			{Key: "a1", MetaOutput: "success", DepKey: "a2"},
+		},
+		CreatedAt: now(),
+	}
+
+	err := s.SaveFlowSnapshot(ctx, &snapshot)
+
+	requireNoError(t, err, "SaveFlowSnapshot")
+
+	// snapshots never change, a second save of the version is ignored
+	err = s.SaveFlowSnapshot(ctx, &spider.FlowSnapshot{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		Version:    2,
+		CreatedAt:  now(),
+	})
+
+	requireNoError(t, err, "SaveFlowSnapshot of a saved version")
+
+	got, err := s.GetFlowSnapshot(ctx, tenantID, flowID, 2)
+
+	requireNoError(t, err, "GetFlowSnapshot")
+	requireEqual(t, len(got.Actions), 1, "actions of the snapshot")
+	requireEqual(t, got.Actions[0].Config["url"], "https://example.com", "config of a snapshot action")
+	requireEqual(t, got.Actions[0].Timeout, spider.Duration(time.Minute), "timeout of a snapshot action")
+
+	if !reflect.DeepEqual(got.Deps, snapshot.Deps) {
+		t.Fatalf("GetFlowSnapshot: deps %+v, want %+v", got.Deps, snapshot.Deps)
+	}
+
+	if !got.CreatedAt.Equal(snapshot.CreatedAt) {
+		t.Fatalf("GetFlowSnapshot: created at %v, want %v", got.CreatedAt, snapshot.CreatedAt)
+	}
+
+	_, err = s.GetFlowSnapshot(ctx, tenantID, flowID, 3)
+
+	requireErrorIs(t, err, spider.ErrFlowSnapshotNotFound, "GetFlowSnapshot of a missing version")
+	requireErrorIs(t, err, spider.ErrNotFound, "GetFlowSnapshot of a missing version")
+}
@@ -1,6 +1,11 @@
 package spider
 
-import "context"
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
 
 type MapperMode string
 
@@ -40,6 +45,9 @@ type AddActionRequest struct {
 	Config     map[string]string `json:"config"`
 	Map        map[string]Mapper `json:"map"`
 	Meta       map[string]string `json:"meta,omitempty"`
+	Join       *JoinPolicy       `json:"join,omitempty"`
+	Retry      *RetryPolicy      `json:"retry,omitempty"`
+	Timeout    Duration          `json:"timeout,omitempty"`
 }
 
 type UpdateActionRequest struct {
@@ -49,6 +57,9 @@ type UpdateActionRequest struct {
 	Config     map[string]string `json:"config"`
 	Map        map[string]Mapper `json:"map"`
 	Meta       map[string]string `json:"meta,omitempty"`
+	Join       *JoinPolicy       `json:"join,omitempty"`
+	Retry      *RetryPolicy      `json:"retry,omitempty"`
+	Timeout    Duration          `json:"timeout,omitempty"`
 }
 
 type CreateFlowRequest struct {
@@ -57,6 +68,8 @@ type CreateFlowRequest struct {
 	Name        string            `json:"name"`
 	TriggerType FlowTriggerType   `json:"trigger_type"`
 	Meta        map[string]string `json:"meta,omitempty"`
+	Deadline    Duration          `json:"deadline,omitempty"`
+	Retention   Duration          `json:"retention,omitempty"`
 }
 
 type UpdateFlowRequest struct {
@@ -66,17 +79,141 @@ type UpdateFlowRequest struct {
 	TriggerType FlowTriggerType   `json:"trigger_type"`
 	Meta        map[string]string `json:"meta,omitempty"`
 	Status      FlowStatus        `json:"status"`
+	Deadline    Duration          `json:"deadline,omitempty"`
+	Retention   Duration          `json:"retention,omitempty"`
+}
+
+// SaveFlowGraphRequest is a flow with its whole graph. The tenant and flow
+// of the actions are taken from Flow.
+type SaveFlowGraphRequest struct {
+	Flow    CreateFlowRequest   `json:"flow"`
+	Actions []AddActionRequest  `json:"actions"`
+	Deps    []WorkflowActionDep `json:"deps"`
+}
+
+type FinishRunStepRequest struct {
+	Status     RunStepStatus          `json:"status"`
+	MetaOutput string                 `json:"meta_output"`
+	Output     map[string]interface{} `json:"output"`
+	Error      string                 `json:"error"`
+	EndedAt    time.Time              `json:"ended_at"`
+}
+
+type UpdateRunStatusRequest struct {
+	From        []RunStatus `json:"from"`
+	To          RunStatus   `json:"to"`
+	Error       string      `json:"error"`
+	EndedAt     *time.Time  `json:"ended_at"`
+	DeadlineAt  *time.Time  `json:"deadline_at"`
+	FlowVersion uint64      `json:"flow_version"`
+}
+
+type UpdateRunStepStatusRequest struct {
+	From       []RunStepStatus `json:"from"`
+	To         RunStepStatus   `json:"to"`
+	Attempt    int             `json:"attempt"`
+	Error      string          `json:"error"`
+	DeadlineAt *time.Time      `json:"deadline_at"`
+}
+
+// ScheduledRetry is a step attempt waiting for its backoff delay before it
+// is dispatched again.
+type ScheduledRetry struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id"`
+	WorkflowID  string    `json:"workflow_id"`
+	SessionID   string    `json:"session_id"`
+	TaskID      string    `json:"task_id"`
+	Key         string    `json:"key"`
+	ActionID    string    `json:"action_id"`
+	Values      string    `json:"values"`
+	Attempt     int       `json:"attempt"`
+	FlowVersion uint64    `json:"flow_version"`
+	Timeout     Duration  `json:"timeout"`
+	DueAt       time.Time `json:"due_at"`
+}
+
+type ListRunsRequest struct {
+	TenantID   string     `json:"tenant_id"`
+	WorkflowID string     `json:"workflow_id"`
+	Status     RunStatus  `json:"status,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	Page       int        `json:"page"`
+	PageSize   int        `json:"page_size"`
+}
+
+type RunListResponse struct {
+	Runs     []Run `json:"runs"`
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+}
+
+// SessionContext is the context a task reads its inputs from: the outputs
+// of the actions that ran before it in the session.
+type SessionContext struct {
+	TenantID   string                            `json:"tenant_id"`
+	WorkflowID string                            `json:"workflow_id"`
+	SessionID  string                            `json:"session_id"`
+	TaskID     string                            `json:"task_id"`
+	Value      map[string]map[string]interface{} `json:"value"`
+	CreatedAt  time.Time                         `json:"created_at"`
+	ExpiresAt  *time.Time                        `json:"expires_at,omitempty"` // Kept until the task is done when nil
+}
+
+// SessionContextUsage is the storage the session contexts and the joins of
+// a tenant take.
+type SessionContextUsage struct {
+	TenantID  string `json:"tenant_id"`
+	Contexts  int64  `json:"contexts"`
+	Bytes     int64  `json:"bytes"` // Size of the JSON encoded values
+	Joins     int64  `json:"joins"`
+	JoinBytes int64  `json:"join_bytes"` // Size of the JSON encoded arrivals
+}
+
+// AddJoinArrivalRequest is the output of ParentKey arriving at the join of
+// Key within a session. The first arrival creates the join with TenantID and
+// ExpiresAt.
+type AddJoinArrivalRequest struct {
+	TenantID   string
+	WorkflowID string
+	SessionID  string
+	Key        string
+	ParentKey  string
+	Value      map[string]map[string]interface{}
+	ExpiresAt  *time.Time // Kept until its run ends when nil
+}
+
+type JoinArrival struct {
+	ParentKey string                            `json:"parent_key"`
+	Value     map[string]map[string]interface{} `json:"value"`
+	ArrivedAt time.Time                         `json:"arrived_at"`
+}
+
+type JoinState struct {
+	Arrivals     []JoinArrival `json:"arrivals"`
+	Dispatched   bool          `json:"dispatched"`
+	DispatchedBy string        `json:"dispatched_by,omitempty"` // Parent key that claimed the join
 }
 
 type WorkflowStorageAdapter interface {
 	QueryWorkflowAction(ctx context.Context, tenantID, workflowID, key string) (*WorkflowAction, error)
 	QueryWorkflowActionDependencies(ctx context.Context, tenantID, workflowID, key, metaOutput string) ([]WorkflowAction, error)
 	AddAction(ctx context.Context, req *AddActionRequest) (*WorkflowAction, error)
+	// DeleteAction removes the action of key and the deps leading to and
+	// from it.
+	DeleteAction(ctx context.Context, tenantID, workflowID, key string) error
 	AddDep(ctx context.Context, tenantID, workflowID, key, metaOutput, key2 string) error
+	RemoveDep(ctx context.Context, tenantID, workflowID, key, metaOutput, key2 string) error
+	GetWorkflowActionDeps(ctx context.Context, tenantID, workflowID string) ([]WorkflowActionDep, error)
 	GetSessionContext(ctx context.Context, workflowID, sessionID, taskID string) (map[string]map[string]interface{}, error)
-	CreateSessionContext(ctx context.Context, workflowID, sessionID, taskID string, value map[string]map[string]interface{}) error
+	CreateSessionContext(ctx context.Context, sessionContext *SessionContext) error
 	DeleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) error
+	DeleteExpiredSessionContexts(ctx context.Context, now time.Time, limit int) (int64, error)
+	ListSessionContextUsage(ctx context.Context) ([]SessionContextUsage, error)
 	DisableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error
+	EnableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error
 	ListFlows(ctx context.Context, tenantID string, page, pageSize int) (*FlowListResponse, error)
 	GetWorkflowActions(ctx context.Context, tenantID, workflowID string) ([]WorkflowAction, error)
 	UpdateAction(ctx context.Context, req *UpdateActionRequest) (*WorkflowAction, error)
@@ -84,6 +221,42 @@ type WorkflowStorageAdapter interface {
 	GetFlow(ctx context.Context, tenantID, flowID string) (*Flow, error)
 	UpdateFlow(ctx context.Context, req *UpdateFlowRequest) (*Flow, error)
 	DeleteFlow(ctx context.Context, tenantID, flowID string) error
+	// SaveFlowGraph creates the flow of req, or replaces the settings,
+	// actions and deps of the existing flow and bumps its version once, in
+	// a single transaction. The status of an existing flow and the IDs of
+	// the actions it keeps are left as they are.
+	SaveFlowGraph(ctx context.Context, req *SaveFlowGraphRequest) (*Flow, error)
+	CreateRun(ctx context.Context, run *Run) error
+	GetRun(ctx context.Context, tenantID, workflowID, sessionID string) (*Run, error)
+	// GetRunStatus returns the status of a run without loading its steps.
+	GetRunStatus(ctx context.Context, workflowID, sessionID string) (RunStatus, error)
+	ListRuns(ctx context.Context, req *ListRunsRequest) (*RunListResponse, error)
+	UpdateRunStatus(ctx context.Context, workflowID, sessionID string, req *UpdateRunStatusRequest) (bool, error)
+	AddRunStep(ctx context.Context, step *RunStep) error
+	GetRunStep(ctx context.Context, workflowID, sessionID, taskID string) (*RunStep, error)
+	FinishRunStep(ctx context.Context, workflowID, sessionID, taskID string, req *FinishRunStepRequest) (bool, error)
+	UpdateRunStepStatus(ctx context.Context, workflowID, sessionID, taskID string, req *UpdateRunStepStatusRequest) (bool, error)
+	CountActiveRunSteps(ctx context.Context, workflowID, sessionID string) (int64, error)
+	AddJoinArrival(ctx context.Context, req *AddJoinArrivalRequest) (*JoinState, error)
+	// ClaimJoin marks the join of key as dispatched by parentKey. It reports
+	// false when another parent claimed it, but true again to the parent
+	// that claimed it, so a redelivered output can finish the dispatch.
+	ClaimJoin(ctx context.Context, workflowID, sessionID, key, parentKey string) (bool, error)
+	// DeleteSessionJoins deletes the joins of a session, once its run ended.
+	DeleteSessionJoins(ctx context.Context, workflowID, sessionID string) error
+	// DeleteExpiredJoins deletes up to limit joins expired at now whose run
+	// is not running anymore.
+	DeleteExpiredJoins(ctx context.Context, now time.Time, limit int) (int64, error)
+	ListExpiredRuns(ctx context.Context, now time.Time, limit int) ([]Run, error)
+	ListExpiredRunSteps(ctx context.Context, now time.Time, limit int) ([]RunStep, error)
+	SaveFlowSnapshot(ctx context.Context, snapshot *FlowSnapshot) error
+	GetFlowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error)
+	ScheduleRetry(ctx context.Context, retry *ScheduledRetry) error
+	// ClaimDueRetries leases up to limit retries due at now by moving them
+	// lease later, so a retry that is not deleted once dispatched is claimed
+	// again when its lease expires.
+	ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledRetry, error)
+	DeleteRetry(ctx context.Context, id string) error
 	Close(ctx context.Context) error
 }
 
@@ -100,3 +273,35 @@ type WorkerStorageAdapter interface {
 	GetAllConfigs(ctx context.Context, actionID string) ([]WorkerConfig, error)
 	Close(ctx context.Context) error
 }
+
+// mergeSessionContextUsage sums the usages of the same tenant, sorted by
+// tenant, for adapters that count session contexts and joins apart.
+func mergeSessionContextUsage(usages ...[]SessionContextUsage) []SessionContextUsage {
+
+	byTenant := map[string]*SessionContextUsage{}
+
+	for _, list := range usages {
+		for _, usage := range list {
+
+			merged, ok := byTenant[usage.TenantID]
+
+			if !ok {
+				merged = &SessionContextUsage{TenantID: usage.TenantID}
+				byTenant[usage.TenantID] = merged
+			}
+
+			merged.Contexts += usage.Contexts
+			merged.Bytes += usage.Bytes
+			merged.Joins += usage.Joins
+			merged.JoinBytes += usage.JoinBytes
+		}
+	}
+
+	merged := []SessionContextUsage{}
+
+	for _, tenantID := range slices.Sorted(maps.Keys(byTenant)) {
+		merged = append(merged, *byTenant[tenantID])
+	}
+
+	return merged
+}
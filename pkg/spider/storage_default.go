@@ -0,0 +1,161 @@
+package spider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type StorageKind string
+
+var (
+	StorageKindMongoDB  StorageKind = "mongodb"
+	StorageKindPostgres StorageKind = "postgres"
+	StorageKindSQLite   StorageKind = "sqlite"
+)
+
+func storageKind(ctx context.Context) (StorageKind, error) {
+
+	type Env struct {
+		Storage StorageKind `env:"SPIDER_STORAGE,default=mongodb"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		return "", err
+	}
+
+	return env.Storage, nil
+}
+
+// InitDefaultWorkflowStorageAdapter connects to the storage selected by
+// SPIDER_STORAGE, MongoDB when it is not set. Session contexts are kept in
+// NATS instead when SPIDER_SESSION_CONTEXT_STORAGE is nats.
+func InitDefaultWorkflowStorageAdapter(ctx context.Context) (WorkflowStorageAdapter, error) {
+
+	type Env struct {
+		SessionContextStorage string `env:"SPIDER_SESSION_CONTEXT_STORAGE"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := initWorkflowStorageAdapter(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch env.SessionContextStorage {
+	case "":
+		return storage, nil
+	case "nats":
+		sessionContextStorage, err := InitNATSSessionContextStorageAdapter(ctx, storage, InitNATSSessionContextStorageAdapterOpt{
+			BetaAutoSetupNATS: true,
+		})
+
+		if err != nil {
+			_ = storage.Close(ctx)
+			return nil, err
+		}
+
+		return sessionContextStorage, nil
+	}
+
+	_ = storage.Close(ctx)
+
+	return nil, fmt.Errorf("unknown SPIDER_SESSION_CONTEXT_STORAGE %q", env.SessionContextStorage)
+}
+
+func initWorkflowStorageAdapter(ctx context.Context) (WorkflowStorageAdapter, error) {
+
+	kind, err := storageKind(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case StorageKindMongoDB:
+		storage, err := InitMongodDBWorkflowStorageAdapter(ctx, InitMongodDBWorkflowStorageAdapterOpt{
+			BetaAutoSetupSchema: true,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	case StorageKindPostgres:
+		storage, err := InitPostgresWorkflowStorageAdapter(ctx, InitPostgresWorkflowStorageAdapterOpt{
+			BetaAutoSetupSchema: true,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	case StorageKindSQLite:
+		storage, err := InitSQLiteWorkflowStorageAdapter(ctx, InitSQLiteWorkflowStorageAdapterOpt{
+			BetaAutoSetupSchema: true,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}
+
+	return nil, fmt.Errorf("unknown SPIDER_STORAGE %q", kind)
+}
+
+// InitDefaultWorkerStorageAdapter connects to the storage selected by
+// SPIDER_STORAGE, MongoDB when it is not set.
+func InitDefaultWorkerStorageAdapter(ctx context.Context) (WorkerStorageAdapter, error) {
+
+	kind, err := storageKind(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case StorageKindMongoDB:
+		storage, err := InitMongodDBWorkerStorageAdapter(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	case StorageKindPostgres:
+		storage, err := InitPostgresWorkerStorageAdapter(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	case StorageKindSQLite:
+		storage, err := InitSQLiteWorkerStorageAdapter(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return storage, nil
+	}
+
+	return nil, fmt.Errorf("unknown SPIDER_STORAGE %q", kind)
+}
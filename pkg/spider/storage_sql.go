@@ -0,0 +1,249 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect holds what differs between the SQL databases the storage
+// adapters run on. Queries are written with ? placeholders and rebound for
+// the database.
+type sqlDialect struct {
+	name string
+	// placeholder returns the n-th (1-based) bind parameter
+	placeholder func(n int) string
+	// isUniqueViolation reports whether err is a unique constraint failure
+	isUniqueViolation func(err error) bool
+	// lockMigrations serializes the migrations of concurrent replicas
+	// within a transaction, empty when the database needs no lock
+	lockMigrations string
+	// timeValue encodes the time bind parameters, nil when the driver
+	// stores time.Time as is
+	timeValue  func(t time.Time) any
+	migrations fs.FS
+}
+
+// sqlConn is implemented by *sql.DB and *sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (d *sqlDialect) exec(ctx context.Context, conn sqlConn, query string, args ...any) (sql.Result, error) {
+	return conn.ExecContext(ctx, d.rebind(query), d.bind(args)...)
+}
+
+func (d *sqlDialect) query(ctx context.Context, conn sqlConn, query string, args ...any) (*sql.Rows, error) {
+	return conn.QueryContext(ctx, d.rebind(query), d.bind(args)...)
+}
+
+func (d *sqlDialect) queryRow(ctx context.Context, conn sqlConn, query string, args ...any) *sql.Row {
+	return conn.QueryRowContext(ctx, d.rebind(query), d.bind(args)...)
+}
+
+func (d *sqlDialect) bind(args []any) []any {
+
+	if d.timeValue == nil {
+		return args
+	}
+
+	bound := make([]any, len(args))
+
+	for i, arg := range args {
+
+		switch v := arg.(type) {
+		case time.Time:
+			bound[i] = d.timeValue(v)
+		case *time.Time:
+			if v != nil {
+				bound[i] = d.timeValue(*v)
+			}
+		default:
+			bound[i] = arg
+		}
+	}
+
+	return bound
+}
+
+func (d *sqlDialect) rebind(query string) string {
+
+	if d.placeholder == nil {
+		return query
+	}
+
+	var b strings.Builder
+
+	n := 0
+
+	for _, r := range query {
+
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// sqlError translates the errors of missing rows and unique constraints
+// into ErrNotFound and ErrAlreadyExists, keeping the driver error wrapped.
+func (d *sqlDialect) sqlError(err error) error {
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case err != nil && d.isUniqueViolation(err):
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	}
+
+	return err
+}
+
+// sqlIn returns the placeholders of an IN list of n values.
+func sqlIn(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func sqlArgs[T any](values []T) []any {
+
+	args := make([]any, 0, len(values))
+
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return args
+}
+
+// sqlJSON encodes a value stored in a JSON column. nil values are stored as
+// JSON null, so JSON columns are never NULL.
+func sqlJSON(value any) (string, error) {
+
+	b, err := json.Marshal(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func scanSQLJSON(b []byte, value any) error {
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(b, value)
+}
+
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+func withSQLTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateSQL applies the migrations of the dialect that were not applied
+// yet, in the order of their file names, each in its own transaction. File
+// names start with their version, such as 0001_init.sql.
+func migrateSQL(ctx context.Context, db *sql.DB, d *sqlDialect) error {
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(d.migrations, "*.sql")
+
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+
+		migration, err := fs.ReadFile(d.migrations, name)
+
+		if err != nil {
+			return err
+		}
+
+		err = withSQLTx(ctx, db, func(tx *sql.Tx) error {
+
+			if d.lockMigrations != "" {
+
+				_, err := tx.ExecContext(ctx, d.lockMigrations)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			var applied int
+
+			err := d.queryRow(ctx, tx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version).Scan(&applied)
+
+			if err != nil {
+				return err
+			}
+
+			if applied > 0 {
+				return nil
+			}
+
+			_, err = tx.ExecContext(ctx, string(migration))
+
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", name, err)
+			}
+
+			_, err = d.exec(ctx, tx, `INSERT INTO schema_migrations (version) VALUES (?)`, version)
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package spider
+
+import (
+	"context"
+	"maps"
+)
+
+// MemoryWorkerStorageAdapter reads the action configs of a
+// MemoryWorkflowStorageAdapter, as the MongoDB worker adapter reads the
+// collections of the workflow one.
+type MemoryWorkerStorageAdapter struct {
+	storage *MemoryWorkflowStorageAdapter
+}
+
+var _ WorkerStorageAdapter = &MemoryWorkerStorageAdapter{}
+
+func NewMemoryWorkerStorageAdapter(storage *MemoryWorkflowStorageAdapter) *MemoryWorkerStorageAdapter {
+	return &MemoryWorkerStorageAdapter{
+		storage: storage,
+	}
+}
+
+func (w *MemoryWorkerStorageAdapter) GetAllConfigs(ctx context.Context, actionID string) ([]WorkerConfig, error) {
+	w.storage.mu.Lock()
+	defer w.storage.mu.Unlock()
+
+	var confs []WorkerConfig
+
+	for _, wa := range w.storage.actions {
+
+		if wa.ActionID != actionID {
+			continue
+		}
+
+		confs = append(confs, WorkerConfig{
+			WorkflowActionID: wa.ID,
+			TenantID:         wa.TenantID,
+			WorkflowID:       wa.WorkflowID,
+			Key:              wa.Key,
+			Config:           maps.Clone(wa.Config),
+			Meta:             maps.Clone(wa.Meta),
+		})
+	}
+
+	return confs, nil
+}
+
+func (w *MemoryWorkerStorageAdapter) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+)
+
+type SQLWorkerStorageAdapter struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+var _ WorkerStorageAdapter = &SQLWorkerStorageAdapter{}
+
+func (w *SQLWorkerStorageAdapter) GetAllConfigs(ctx context.Context, actionID string) ([]WorkerConfig, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlWorkflowActionColumns+` FROM workflow_actions a WHERE a.action_id = ? ORDER BY a.id`,
+		actionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var confs []WorkerConfig
+
+	for rows.Next() {
+
+		workerAction, err := scanSQLWorkflowAction(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		confs = append(confs, WorkerConfig{
+			WorkflowActionID: workerAction.ID,
+			TenantID:         workerAction.TenantID,
+			WorkflowID:       workerAction.WorkflowID,
+			Key:              workerAction.Key,
+			Config:           workerAction.Config,
+			Meta:             workerAction.Meta,
+		})
+	}
+
+	return confs, rows.Err()
+}
+
+func (w *SQLWorkerStorageAdapter) Close(ctx context.Context) error {
+	return w.db.Close()
+}
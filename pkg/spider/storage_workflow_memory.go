@@ -0,0 +1,697 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryWorkflowStorageAdapter keeps the whole workflow state in process. It
+// behaves like MongodDBWorkflowStorageAdapter, unique keys included, and
+// hands out copies so callers never share state with the store.
+type MemoryWorkflowStorageAdapter struct {
+	mu              sync.Mutex
+	flows           map[string]*Flow
+	actions         []*WorkflowAction
+	deps            []memoryWorkflowActionDep
+	sessionContexts map[memorySessionKey]*memorySessionContext
+	runs            map[string]*Run
+	runSteps        map[string]*RunStep
+	runStepOrder    []string
+	joins           map[memorySessionKey]*memoryJoin
+	retries         []ScheduledRetry
+	snapshots       map[memorySnapshotKey]*FlowSnapshot
+}
+
+var _ WorkflowStorageAdapter = &MemoryWorkflowStorageAdapter{}
+
+func NewMemoryWorkflowStorageAdapter() *MemoryWorkflowStorageAdapter {
+	return &MemoryWorkflowStorageAdapter{
+		flows:           map[string]*Flow{},
+		sessionContexts: map[memorySessionKey]*memorySessionContext{},
+		runs:            map[string]*Run{},
+		runSteps:        map[string]*RunStep{},
+		joins:           map[memorySessionKey]*memoryJoin{},
+		snapshots:       map[memorySnapshotKey]*FlowSnapshot{},
+	}
+}
+
+type memoryWorkflowActionDep struct {
+	WorkflowID string
+	WorkflowActionDep
+}
+
+// memorySessionKey addresses a record of a session, the task ID for session
+// contexts and the action key for joins.
+type memorySessionKey struct {
+	WorkflowID string
+	SessionID  string
+	ID         string
+}
+
+// memorySessionContext is a stored session context with the size of its
+// value, as reported by ListSessionContextUsage.
+type memorySessionContext struct {
+	SessionContext
+	Size int64
+}
+
+// memoryJoin is a stored join with the tenant and expiry it was created with
+// and the size of its arrivals, as reported by ListSessionContextUsage.
+type memoryJoin struct {
+	JoinState
+	TenantID  string
+	ExpiresAt *time.Time
+	Size      int64
+}
+
+type memorySnapshotKey struct {
+	TenantID   string
+	WorkflowID string
+	Version    uint64
+}
+
+func (w *MemoryWorkflowStorageAdapter) AddAction(ctx context.Context, req *AddActionRequest) (*WorkflowAction, error) {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.findAction(req.TenantID, req.WorkflowID, req.Key) != nil {
+		return nil, ErrAlreadyExists
+	}
+
+	wa := WorkflowAction{
+		ID:         id.String(),
+		Key:        req.Key,
+		TenantID:   req.TenantID,
+		WorkflowID: req.WorkflowID,
+		ActionID:   req.ActionID,
+		Config:     req.Config,
+		Map:        req.Map,
+		Meta:       req.Meta,
+		Disabled:   false,
+		Join:       req.Join,
+		Retry:      req.Retry,
+		Timeout:    req.Timeout,
+	}
+
+	stored := cloneWorkflowAction(wa)
+
+	w.actions = append(w.actions, &stored)
+
+	w.incrementFlowVersion(req.TenantID, req.WorkflowID)
+
+	action := cloneWorkflowAction(wa)
+
+	return &action, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteAction(ctx context.Context, tenantID, workflowID, key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.findAction(tenantID, workflowID, key) == nil {
+		return ErrNotFound
+	}
+
+	w.actions = slices.DeleteFunc(w.actions, func(wa *WorkflowAction) bool {
+		return wa.TenantID == tenantID && wa.WorkflowID == workflowID && wa.Key == key
+	})
+
+	w.deps = slices.DeleteFunc(w.deps, func(dep memoryWorkflowActionDep) bool {
+		return dep.WorkflowID == workflowID && (dep.Key == key || dep.DepKey == key)
+	})
+
+	w.incrementFlowVersion(tenantID, workflowID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) AddDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dep := memoryWorkflowActionDep{
+		WorkflowID: workflowID,
+		WorkflowActionDep: WorkflowActionDep{
+			Key:        key,
+			MetaOutput: metaOutput,
+			DepKey:     depKey,
+		},
+	}
+
+	if slices.Contains(w.deps, dep) {
+		return ErrAlreadyExists
+	}
+
+	w.deps = append(w.deps, dep)
+
+	w.incrementFlowVersion(tenantID, workflowID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) RemoveDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dep := memoryWorkflowActionDep{
+		WorkflowID: workflowID,
+		WorkflowActionDep: WorkflowActionDep{
+			Key:        key,
+			MetaOutput: metaOutput,
+			DepKey:     depKey,
+		},
+	}
+
+	i := slices.Index(w.deps, dep)
+
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	w.deps = slices.Delete(w.deps, i, i+1)
+
+	w.incrementFlowVersion(tenantID, workflowID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) QueryWorkflowAction(ctx context.Context, tenantID, workflowID, key string) (*WorkflowAction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wa := w.findAction(tenantID, workflowID, key)
+
+	if wa == nil {
+		return nil, ErrNotFound
+	}
+
+	action := cloneWorkflowAction(*wa)
+
+	return &action, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) QueryWorkflowActionDependencies(ctx context.Context, tenantID, workflowID, key, metaOutput string) ([]WorkflowAction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var depActions []WorkflowAction
+
+	for _, dep := range w.deps {
+
+		if dep.WorkflowID != workflowID || dep.Key != key || dep.MetaOutput != metaOutput {
+			continue
+		}
+
+		depAction := w.findAction(tenantID, workflowID, dep.DepKey)
+
+		if depAction == nil {
+			continue
+		}
+
+		depActions = append(depActions, cloneWorkflowAction(*depAction))
+	}
+
+	return depActions, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetWorkflowActionDeps(ctx context.Context, tenantID, workflowID string) ([]WorkflowActionDep, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var deps []WorkflowActionDep
+
+	for _, dep := range w.deps {
+		if dep.WorkflowID == workflowID {
+			deps = append(deps, dep.WorkflowActionDep)
+		}
+	}
+
+	return deps, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetSessionContext(ctx context.Context, workflowID, sessionID, taskID string) (map[string]map[string]interface{}, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stored, ok := w.sessionContexts[memorySessionKey{workflowID, sessionID, taskID}]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return cloneJSON(stored.Value)
+}
+
+func (w *MemoryWorkflowStorageAdapter) CreateSessionContext(ctx context.Context, sessionContext *SessionContext) error {
+
+	valb, err := json.Marshal(sessionContext.Value)
+
+	if err != nil {
+		return err
+	}
+
+	value, err := cloneJSON(sessionContext.Value)
+
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := memorySessionKey{sessionContext.WorkflowID, sessionContext.SessionID, sessionContext.TaskID}
+
+	_, ok := w.sessionContexts[key]
+
+	if ok {
+		return ErrAlreadyExists
+	}
+
+	stored := memorySessionContext{
+		SessionContext: *sessionContext,
+		Size:           int64(len(valb)),
+	}
+
+	stored.Value = value
+	stored.ExpiresAt = clonePtr(sessionContext.ExpiresAt)
+
+	w.sessionContexts[key] = &stored
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.sessionContexts, memorySessionKey{workflowID, sessionID, taskID})
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteExpiredSessionContexts(ctx context.Context, now time.Time, limit int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var deleted int64
+
+	for key, stored := range w.sessionContexts {
+
+		if deleted >= int64(limit) {
+			break
+		}
+
+		if stored.ExpiresAt == nil || stored.ExpiresAt.After(now) {
+			continue
+		}
+
+		// the task of the context is still running, or waits for a retry
+		step, ok := w.runSteps[key.ID]
+
+		if ok && step.WorkflowID == key.WorkflowID && step.SessionID == key.SessionID && slices.Contains(activeRunStepStatuses, step.Status) {
+			continue
+		}
+
+		delete(w.sessionContexts, key)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ListSessionContextUsage(ctx context.Context) ([]SessionContextUsage, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	byTenant := map[string]*SessionContextUsage{}
+
+	for _, stored := range w.sessionContexts {
+
+		usage, ok := byTenant[stored.TenantID]
+
+		if !ok {
+			usage = &SessionContextUsage{TenantID: stored.TenantID}
+			byTenant[stored.TenantID] = usage
+		}
+
+		usage.Contexts++
+		usage.Bytes += stored.Size
+	}
+
+	for _, join := range w.joins {
+
+		usage, ok := byTenant[join.TenantID]
+
+		if !ok {
+			usage = &SessionContextUsage{TenantID: join.TenantID}
+			byTenant[join.TenantID] = usage
+		}
+
+		usage.Joins++
+		usage.JoinBytes += join.Size
+	}
+
+	usages := []SessionContextUsage{}
+
+	for _, tenantID := range slices.Sorted(maps.Keys(byTenant)) {
+		usages = append(usages, *byTenant[tenantID])
+	}
+
+	return usages, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DisableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wa := w.findAction(tenantID, workflowID, key)
+
+	if wa != nil {
+		wa.Disabled = true
+	}
+
+	w.incrementFlowVersion(tenantID, workflowID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) EnableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wa := w.findAction(tenantID, workflowID, key)
+
+	if wa != nil {
+		wa.Disabled = false
+	}
+
+	w.incrementFlowVersion(tenantID, workflowID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ListFlows(ctx context.Context, tenantID string, page, pageSize int) (*FlowListResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var flows []*Flow
+
+	for _, flow := range w.flows {
+		if flow.TenantID == tenantID {
+			flows = append(flows, flow)
+		}
+	}
+
+	slices.SortFunc(flows, func(a, b *Flow) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	total := int64(len(flows))
+
+	skip := min((page-1)*pageSize, len(flows))
+	end := min(skip+pageSize, len(flows))
+
+	var workflows []WorkflowInfo
+
+	for _, flow := range flows[skip:end] {
+		workflows = append(workflows, WorkflowInfo{
+			ID:          flow.ID,
+			TenantID:    flow.TenantID,
+			Name:        flow.Name,
+			TriggerType: flow.TriggerType,
+			Status:      flow.Status,
+			Version:     flow.Version,
+			Meta:        maps.Clone(flow.Meta),
+		})
+	}
+
+	return &FlowListResponse{
+		Flows:    workflows,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetWorkflowActions(ctx context.Context, tenantID, workflowID string) ([]WorkflowAction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var actions []WorkflowAction
+
+	for _, wa := range w.actions {
+		if wa.TenantID == tenantID && wa.WorkflowID == workflowID {
+			actions = append(actions, cloneWorkflowAction(*wa))
+		}
+	}
+
+	return actions, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) UpdateAction(ctx context.Context, req *UpdateActionRequest) (*WorkflowAction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wa := w.findAction(req.TenantID, req.WorkflowID, req.Key)
+
+	if wa == nil {
+		return nil, ErrNotFound
+	}
+
+	updated := cloneWorkflowAction(WorkflowAction{
+		ID:         wa.ID,
+		Key:        wa.Key,
+		TenantID:   wa.TenantID,
+		WorkflowID: wa.WorkflowID,
+		ActionID:   wa.ActionID,
+		Config:     req.Config,
+		Map:        req.Map,
+		Meta:       req.Meta,
+		Disabled:   wa.Disabled,
+		Join:       req.Join,
+		Retry:      req.Retry,
+		Timeout:    req.Timeout,
+	})
+
+	*wa = updated
+
+	w.incrementFlowVersion(req.TenantID, req.WorkflowID)
+
+	action := cloneWorkflowAction(updated)
+
+	return &action, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteFlow(ctx context.Context, tenantID, flowID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	flow, ok := w.flows[flowID]
+
+	if !ok || flow.TenantID != tenantID {
+		return ErrNotFound
+	}
+
+	delete(w.flows, flowID)
+
+	w.actions = slices.DeleteFunc(w.actions, func(wa *WorkflowAction) bool {
+		return wa.TenantID == tenantID && wa.WorkflowID == flowID
+	})
+
+	w.deps = slices.DeleteFunc(w.deps, func(dep memoryWorkflowActionDep) bool {
+		return dep.WorkflowID == flowID
+	})
+
+	maps.DeleteFunc(w.sessionContexts, func(key memorySessionKey, _ *memorySessionContext) bool {
+		return key.WorkflowID == flowID
+	})
+
+	maps.DeleteFunc(w.joins, func(key memorySessionKey, _ *memoryJoin) bool {
+		return key.WorkflowID == flowID
+	})
+
+	w.retries = slices.DeleteFunc(w.retries, func(retry ScheduledRetry) bool {
+		return retry.TenantID == tenantID && retry.WorkflowID == flowID
+	})
+
+	maps.DeleteFunc(w.snapshots, func(key memorySnapshotKey, _ *FlowSnapshot) bool {
+		return key.TenantID == tenantID && key.WorkflowID == flowID
+	})
+
+	maps.DeleteFunc(w.runs, func(_ string, run *Run) bool {
+		return run.TenantID == tenantID && run.WorkflowID == flowID
+	})
+
+	maps.DeleteFunc(w.runSteps, func(_ string, step *RunStep) bool {
+		return step.TenantID == tenantID && step.WorkflowID == flowID
+	})
+
+	w.runStepOrder = slices.DeleteFunc(w.runStepOrder, func(taskID string) bool {
+		_, ok := w.runSteps[taskID]
+		return !ok
+	})
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) CreateFlow(ctx context.Context, req *CreateFlowRequest) (*Flow, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.flows[req.ID]
+
+	if ok {
+		return nil, ErrAlreadyExists
+	}
+
+	flow := Flow{
+		ID:          req.ID,
+		Version:     1,
+		Name:        req.Name,
+		TenantID:    req.TenantID,
+		TriggerType: req.TriggerType,
+		Meta:        maps.Clone(req.Meta),
+		Status:      FlowStatusDraft,
+		Deadline:    req.Deadline,
+		Retention:   req.Retention,
+	}
+
+	w.flows[flow.ID] = &flow
+
+	return cloneFlow(&flow), nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetFlow(ctx context.Context, tenantID, flowID string) (*Flow, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	flow, ok := w.flows[flowID]
+
+	if !ok || flow.TenantID != tenantID {
+		return nil, ErrNotFound
+	}
+
+	return cloneFlow(flow), nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) UpdateFlow(ctx context.Context, req *UpdateFlowRequest) (*Flow, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	flow, ok := w.flows[req.FlowID]
+
+	if !ok || flow.TenantID != req.TenantID {
+		return nil, ErrNotFound
+	}
+
+	flow.Name = req.Name
+	flow.TriggerType = req.TriggerType
+	flow.Meta = maps.Clone(req.Meta)
+	flow.Status = req.Status
+	flow.Deadline = req.Deadline
+	flow.Retention = req.Retention
+
+	return cloneFlow(flow), nil
+}
+
+// findAction returns the stored action, the caller holding w.mu.
+func (w *MemoryWorkflowStorageAdapter) findAction(tenantID, workflowID, key string) *WorkflowAction {
+
+	for _, wa := range w.actions {
+		if wa.TenantID == tenantID && wa.WorkflowID == workflowID && wa.Key == key {
+			return wa
+		}
+	}
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) incrementFlowVersion(tenantID, workflowID string) {
+
+	flow, ok := w.flows[workflowID]
+
+	if ok && flow.TenantID == tenantID {
+		flow.Version++
+	}
+}
+
+func (w *MemoryWorkflowStorageAdapter) Close(ctx context.Context) error {
+	return nil
+}
+
+func cloneFlow(flow *Flow) *Flow {
+
+	clone := *flow
+	clone.Meta = maps.Clone(flow.Meta)
+
+	return &clone
+}
+
+func cloneWorkflowAction(wa WorkflowAction) WorkflowAction {
+
+	wa.Config = maps.Clone(wa.Config)
+	wa.Map = maps.Clone(wa.Map)
+	wa.Meta = maps.Clone(wa.Meta)
+
+	if wa.Join != nil {
+		join := *wa.Join
+		wa.Join = &join
+	}
+
+	if wa.Retry != nil {
+		retry := *wa.Retry
+		retry.RetryableErrors = slices.Clone(retry.RetryableErrors)
+		wa.Retry = &retry
+	}
+
+	return wa
+}
+
+// cloneJSON deep copies a value through JSON, which also gives it the types
+// a value read back from MongoDB and normalized by the adapter has.
+func cloneJSON[T any](value T) (T, error) {
+
+	var clone T
+
+	valb, err := json.Marshal(value)
+
+	if err != nil {
+		return clone, err
+	}
+
+	err = json.Unmarshal(valb, &clone)
+
+	if err != nil {
+		return clone, err
+	}
+
+	return clone, nil
+}
@@ -0,0 +1,128 @@
+package spider
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// SaveFlowGraph checks the whole graph before it changes anything, so a
+// rejected graph leaves the flow as it was.
+func (w *MemoryWorkflowStorageAdapter) SaveFlowGraph(ctx context.Context, req *SaveFlowGraphRequest) (*Flow, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current, exists := w.flows[req.Flow.ID]
+
+	// flow IDs are unique across tenants
+	if exists && current.TenantID != req.Flow.TenantID {
+		return nil, ErrAlreadyExists
+	}
+
+	keys := map[string]bool{}
+
+	for _, action := range req.Actions {
+
+		if keys[action.Key] {
+			return nil, ErrAlreadyExists
+		}
+
+		keys[action.Key] = true
+	}
+
+	var deps []memoryWorkflowActionDep
+
+	for _, dep := range req.Deps {
+
+		stored := memoryWorkflowActionDep{
+			WorkflowID:        req.Flow.ID,
+			WorkflowActionDep: dep,
+		}
+
+		if slices.Contains(deps, stored) {
+			return nil, ErrAlreadyExists
+		}
+
+		deps = append(deps, stored)
+	}
+
+	actionIDs := map[string]string{}
+
+	if exists {
+		for _, wa := range w.actions {
+			if wa.TenantID == req.Flow.TenantID && wa.WorkflowID == req.Flow.ID {
+				actionIDs[wa.Key] = wa.ID
+			}
+		}
+	}
+
+	var actions []*WorkflowAction
+
+	for _, action := range req.Actions {
+
+		id, ok := actionIDs[action.Key]
+
+		if !ok {
+
+			newID, err := uuid.NewV7()
+
+			if err != nil {
+				return nil, err
+			}
+
+			id = newID.String()
+		}
+
+		wa := cloneWorkflowAction(WorkflowAction{
+			ID:         id,
+			Key:        action.Key,
+			TenantID:   req.Flow.TenantID,
+			WorkflowID: req.Flow.ID,
+			ActionID:   action.ActionID,
+			Config:     action.Config,
+			Map:        action.Map,
+			Meta:       action.Meta,
+			Disabled:   false,
+			Join:       action.Join,
+			Retry:      action.Retry,
+			Timeout:    action.Timeout,
+		})
+
+		actions = append(actions, &wa)
+	}
+
+	flow := Flow{
+		ID:          req.Flow.ID,
+		Version:     1,
+		Name:        req.Flow.Name,
+		TenantID:    req.Flow.TenantID,
+		TriggerType: req.Flow.TriggerType,
+		Meta:        maps.Clone(req.Flow.Meta),
+		Status:      FlowStatusDraft,
+		Deadline:    req.Flow.Deadline,
+		Retention:   req.Flow.Retention,
+	}
+
+	if exists {
+		flow.Version = current.Version + 1
+		flow.Status = current.Status
+	}
+
+	w.flows[flow.ID] = &flow
+
+	w.actions = slices.DeleteFunc(w.actions, func(wa *WorkflowAction) bool {
+		return wa.TenantID == flow.TenantID && wa.WorkflowID == flow.ID
+	})
+
+	w.actions = append(w.actions, actions...)
+
+	w.deps = slices.DeleteFunc(w.deps, func(dep memoryWorkflowActionDep) bool {
+		return dep.WorkflowID == flow.ID
+	})
+
+	w.deps = append(w.deps, deps...)
+
+	return cloneFlow(&flow), nil
+}
@@ -0,0 +1,137 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+)
+
+func (w *MemoryWorkflowStorageAdapter) AddJoinArrival(ctx context.Context, req *AddJoinArrivalRequest) (*JoinState, error) {
+
+	valb, err := json.Marshal(req.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := cloneJSON(req.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	joinKey := memorySessionKey{req.WorkflowID, req.SessionID, req.Key}
+
+	join, ok := w.joins[joinKey]
+
+	if !ok {
+		join = &memoryJoin{
+			JoinState: JoinState{
+				Arrivals: []JoinArrival{},
+			},
+			TenantID:  req.TenantID,
+			ExpiresAt: clonePtr(req.ExpiresAt),
+		}
+
+		w.joins[joinKey] = join
+	}
+
+	// a parent only counts once, redelivered outputs must not fill the join
+	arrived := slices.ContainsFunc(join.Arrivals, func(arrival JoinArrival) bool {
+		return arrival.ParentKey == req.ParentKey
+	})
+
+	if !arrived {
+		join.Arrivals = append(join.Arrivals, JoinArrival{
+			ParentKey: req.ParentKey,
+			Value:     stored,
+			ArrivedAt: time.Now(),
+		})
+
+		join.Size += int64(len(valb))
+	}
+
+	state := JoinState{
+		Dispatched:   join.Dispatched,
+		DispatchedBy: join.DispatchedBy,
+	}
+
+	for _, arrival := range join.Arrivals {
+
+		value, err := cloneJSON(arrival.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		state.Arrivals = append(state.Arrivals, JoinArrival{
+			ParentKey: arrival.ParentKey,
+			Value:     value,
+			ArrivedAt: arrival.ArrivedAt,
+		})
+	}
+
+	return &state, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ClaimJoin(ctx context.Context, workflowID, sessionID, key, parentKey string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	join, ok := w.joins[memorySessionKey{workflowID, sessionID, key}]
+
+	if !ok || join.Dispatched && join.DispatchedBy != parentKey {
+		return false, nil
+	}
+
+	join.Dispatched = true
+	join.DispatchedBy = parentKey
+
+	return true, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteSessionJoins(ctx context.Context, workflowID, sessionID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	maps.DeleteFunc(w.joins, func(key memorySessionKey, _ *memoryJoin) bool {
+		return key.WorkflowID == workflowID && key.SessionID == sessionID
+	})
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteExpiredJoins(ctx context.Context, now time.Time, limit int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var deleted int64
+
+	for key, join := range w.joins {
+
+		if deleted >= int64(limit) {
+			break
+		}
+
+		if join.ExpiresAt == nil || join.ExpiresAt.After(now) {
+			continue
+		}
+
+		// the run may still dispatch the join
+		run, ok := w.runs[key.SessionID]
+
+		if ok && run.WorkflowID == key.WorkflowID && run.Status == RunStatusRunning {
+			continue
+		}
+
+		delete(w.joins, key)
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,66 @@
+package spider
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (w *MemoryWorkflowStorageAdapter) ScheduleRetry(ctx context.Context, retry *ScheduledRetry) error {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	retry.ID = id.String()
+
+	w.retries = append(w.retries, *retry)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledRetry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var due []int
+
+	for i, retry := range w.retries {
+		if !retry.DueAt.After(now) {
+			due = append(due, i)
+		}
+	}
+
+	slices.SortStableFunc(due, func(a, b int) int {
+		return w.retries[a].DueAt.Compare(w.retries[b].DueAt)
+	})
+
+	due = due[:min(limit, len(due))]
+
+	retries := make([]ScheduledRetry, 0, len(due))
+
+	for _, i := range due {
+		retries = append(retries, w.retries[i])
+		w.retries[i].DueAt = now.Add(lease)
+	}
+
+	return retries, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) DeleteRetry(ctx context.Context, id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.retries = slices.DeleteFunc(w.retries, func(retry ScheduledRetry) bool {
+		return retry.ID == id
+	})
+
+	return nil
+}
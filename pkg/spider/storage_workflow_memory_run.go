@@ -0,0 +1,393 @@
+package spider
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (w *MemoryWorkflowStorageAdapter) CreateRun(ctx context.Context, run *Run) error {
+
+	stored, err := cloneRun(run)
+
+	if err != nil {
+		return err
+	}
+
+	stored.Steps = nil
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.runs[run.SessionID]
+
+	if ok {
+		return ErrAlreadyExists
+	}
+
+	w.runs[run.SessionID] = stored
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetRun(ctx context.Context, tenantID, workflowID, sessionID string) (*Run, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stored, ok := w.runs[sessionID]
+
+	if !ok || stored.TenantID != tenantID || stored.WorkflowID != workflowID {
+		return nil, ErrNotFound
+	}
+
+	run, err := cloneRun(stored)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, taskID := range w.runStepOrder {
+
+		step := w.runSteps[taskID]
+
+		if step.WorkflowID != workflowID || step.SessionID != sessionID {
+			continue
+		}
+
+		clone, err := cloneRunStep(step)
+
+		if err != nil {
+			return nil, err
+		}
+
+		run.Steps = append(run.Steps, *clone)
+	}
+
+	return run, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetRunStatus(ctx context.Context, workflowID, sessionID string) (RunStatus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	run, ok := w.runs[sessionID]
+
+	if !ok || run.WorkflowID != workflowID {
+		return "", ErrNotFound
+	}
+
+	return run.Status, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ListRuns(ctx context.Context, req *ListRunsRequest) (*RunListResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var matched []*Run
+
+	for _, run := range w.runs {
+
+		if run.TenantID != req.TenantID || run.WorkflowID != req.WorkflowID {
+			continue
+		}
+
+		if req.Status != "" && run.Status != req.Status {
+			continue
+		}
+
+		if req.From != nil && run.StartedAt.Before(*req.From) {
+			continue
+		}
+
+		if req.To != nil && !run.StartedAt.Before(*req.To) {
+			continue
+		}
+
+		matched = append(matched, run)
+	}
+
+	slices.SortFunc(matched, func(a, b *Run) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+
+	total := int64(len(matched))
+
+	skip := min((req.Page-1)*req.PageSize, len(matched))
+	end := min(skip+req.PageSize, len(matched))
+
+	runs := []Run{}
+
+	for _, stored := range matched[skip:end] {
+
+		run, err := cloneRun(stored)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, *run)
+	}
+
+	return &RunListResponse{
+		Runs:     runs,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) UpdateRunStatus(ctx context.Context, workflowID, sessionID string, req *UpdateRunStatusRequest) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	run, ok := w.runs[sessionID]
+
+	if !ok || run.WorkflowID != workflowID || !slices.Contains(req.From, run.Status) {
+		return false, nil
+	}
+
+	run.Status = req.To
+
+	if req.Error != "" {
+		run.Error = req.Error
+	}
+
+	if req.EndedAt != nil {
+		run.EndedAt = clonePtr(req.EndedAt)
+	}
+
+	if req.DeadlineAt != nil {
+		run.DeadlineAt = clonePtr(req.DeadlineAt)
+	}
+
+	if req.FlowVersion > 0 {
+		run.FlowVersion = req.FlowVersion
+	}
+
+	return true, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) AddRunStep(ctx context.Context, step *RunStep) error {
+
+	stored, err := cloneRunStep(step)
+
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.runSteps[step.TaskID]
+
+	if ok {
+		return ErrAlreadyExists
+	}
+
+	w.runSteps[step.TaskID] = stored
+	w.runStepOrder = append(w.runStepOrder, step.TaskID)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetRunStep(ctx context.Context, workflowID, sessionID, taskID string) (*RunStep, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	step, ok := w.runSteps[taskID]
+
+	if !ok || step.WorkflowID != workflowID || step.SessionID != sessionID {
+		return nil, ErrNotFound
+	}
+
+	return cloneRunStep(step)
+}
+
+func (w *MemoryWorkflowStorageAdapter) FinishRunStep(ctx context.Context, workflowID, sessionID, taskID string, req *FinishRunStepRequest) (bool, error) {
+
+	output, err := cloneJSON(req.Output)
+
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	step, ok := w.runSteps[taskID]
+
+	if !ok || step.WorkflowID != workflowID || step.SessionID != sessionID || !slices.Contains(activeRunStepStatuses, step.Status) {
+		return false, nil
+	}
+
+	endedAt := req.EndedAt
+
+	step.Status = req.Status
+	step.MetaOutput = req.MetaOutput
+	step.Output = output
+	step.Error = req.Error
+	step.EndedAt = &endedAt
+
+	return true, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) UpdateRunStepStatus(ctx context.Context, workflowID, sessionID, taskID string, req *UpdateRunStepStatusRequest) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	step, ok := w.runSteps[taskID]
+
+	if !ok || step.WorkflowID != workflowID || step.SessionID != sessionID || !slices.Contains(req.From, step.Status) {
+		return false, nil
+	}
+
+	step.Status = req.To
+
+	if req.Attempt > 0 {
+		step.Attempt = req.Attempt
+	}
+
+	if req.Error != "" {
+		step.Error = req.Error
+	}
+
+	if req.DeadlineAt != nil {
+		step.DeadlineAt = clonePtr(req.DeadlineAt)
+	}
+
+	return true, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) CountActiveRunSteps(ctx context.Context, workflowID, sessionID string) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var count int64
+
+	for _, step := range w.runSteps {
+		if step.WorkflowID == workflowID && step.SessionID == sessionID && slices.Contains(activeRunStepStatuses, step.Status) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) ListExpiredRuns(ctx context.Context, now time.Time, limit int) ([]Run, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var expired []*Run
+
+	for _, run := range w.runs {
+		if run.Status == RunStatusRunning && run.DeadlineAt != nil && !run.DeadlineAt.After(now) {
+			expired = append(expired, run)
+		}
+	}
+
+	slices.SortFunc(expired, func(a, b *Run) int {
+		return a.DeadlineAt.Compare(*b.DeadlineAt)
+	})
+
+	var runs []Run
+
+	for _, stored := range expired[:min(limit, len(expired))] {
+
+		run, err := cloneRun(stored)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, *run)
+	}
+
+	return runs, nil
+}
+
+// ListExpiredRunSteps returns running steps whose attempt outlived its
+// timeout, like the MongoDB adapter.
+func (w *MemoryWorkflowStorageAdapter) ListExpiredRunSteps(ctx context.Context, now time.Time, limit int) ([]RunStep, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var expired []*RunStep
+
+	for _, step := range w.runSteps {
+		if step.Status == RunStepStatusRunning && step.DeadlineAt != nil && !step.DeadlineAt.After(now) {
+			expired = append(expired, step)
+		}
+	}
+
+	slices.SortFunc(expired, func(a, b *RunStep) int {
+		return a.DeadlineAt.Compare(*b.DeadlineAt)
+	})
+
+	var steps []RunStep
+
+	for _, stored := range expired[:min(limit, len(expired))] {
+
+		step, err := cloneRunStep(stored)
+
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, *step)
+	}
+
+	return steps, nil
+}
+
+func cloneRun(run *Run) (*Run, error) {
+
+	clone := *run
+
+	payload, err := cloneJSON(run.TriggerPayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clone.TriggerPayload = payload
+	clone.EndedAt = clonePtr(run.EndedAt)
+	clone.DeadlineAt = clonePtr(run.DeadlineAt)
+	clone.Steps = nil
+
+	return &clone, nil
+}
+
+func cloneRunStep(step *RunStep) (*RunStep, error) {
+
+	clone := *step
+
+	input, err := cloneJSON(step.Input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cloneJSON(step.Output)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clone.Input = input
+	clone.Output = output
+	clone.EndedAt = clonePtr(step.EndedAt)
+	clone.DeadlineAt = clonePtr(step.DeadlineAt)
+
+	return &clone, nil
+}
+
+func clonePtr[T any](v *T) *T {
+
+	if v == nil {
+		return nil
+	}
+
+	clone := *v
+
+	return &clone
+}
@@ -0,0 +1,51 @@
+package spider
+
+import (
+	"context"
+	"slices"
+)
+
+// SaveFlowSnapshot stores the snapshot of a flow version, keeping the
+// existing one when the version is already stored.
+func (w *MemoryWorkflowStorageAdapter) SaveFlowSnapshot(ctx context.Context, snapshot *FlowSnapshot) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := memorySnapshotKey{snapshot.TenantID, snapshot.WorkflowID, snapshot.Version}
+
+	_, ok := w.snapshots[key]
+
+	if ok {
+		return nil
+	}
+
+	w.snapshots[key] = cloneFlowSnapshot(snapshot)
+
+	return nil
+}
+
+func (w *MemoryWorkflowStorageAdapter) GetFlowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	snapshot, ok := w.snapshots[memorySnapshotKey{tenantID, workflowID, version}]
+
+	if !ok {
+		return nil, ErrFlowSnapshotNotFound
+	}
+
+	return cloneFlowSnapshot(snapshot), nil
+}
+
+func cloneFlowSnapshot(snapshot *FlowSnapshot) *FlowSnapshot {
+
+	clone := *snapshot
+	clone.Actions = nil
+	clone.Deps = slices.Clone(snapshot.Deps)
+
+	for _, action := range snapshot.Actions {
+		clone.Actions = append(clone.Actions, cloneWorkflowAction(action))
+	}
+
+	return &clone
+}
@@ -0,0 +1,14 @@
+package spider_test
+
+import (
+	"testing"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+)
+
+func TestMemoryWorkflowStorageAdapter(t *testing.T) {
+	spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+		return spider.NewMemoryWorkflowStorageAdapter()
+	})
+}
@@ -3,6 +3,9 @@ package spider
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sethvargo/go-envconfig"
@@ -18,6 +21,11 @@ type MongodDBWorkflowStorageAdapter struct {
 	workflowActionCollection         *mongo.Collection
 	workflowActionDepCollection      *mongo.Collection
 	workflowSessionContextCollection *mongo.Collection
+	workflowRunCollection            *mongo.Collection
+	workflowRunStepCollection        *mongo.Collection
+	workflowSessionJoinCollection    *mongo.Collection
+	workflowScheduledRetryCollection *mongo.Collection
+	workflowFlowSnapshotCollection   *mongo.Collection
 }
 
 type InitMongodDBWorkflowStorageAdapterOpt struct {
@@ -78,6 +86,30 @@ func InitMongodDBWorkflowStorageAdapter(ctx context.Context, opt InitMongodDBWor
 			// return nil, err
 		}
 
+		err = db.CreateCollection(ctx, "workflow_runs")
+
+		if err != nil {
+			// return nil, err
+		}
+
+		err = db.CreateCollection(ctx, "workflow_run_steps")
+
+		if err != nil {
+			// return nil, err
+		}
+
+		err = db.CreateCollection(ctx, "workflow_session_joins")
+
+		if err != nil {
+			// return nil, err
+		}
+
+		err = db.CreateCollection(ctx, "workflow_scheduled_retries")
+
+		if err != nil {
+			// return nil, err
+		}
+
 		_, err = db.Collection("workflow_actions").Indexes().CreateOne(ctx, mongo.IndexModel{
 			Keys: bson.D{
 				{Key: "key", Value: -1},
@@ -117,6 +149,108 @@ func InitMongodDBWorkflowStorageAdapter(ctx context.Context, opt InitMongodDBWor
 		if err != nil {
 			// return nil, err
 		}
+
+		_, err = db.Collection("workflow_session_contexts").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "expires_at", Value: 1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_runs").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: -1},
+				{Key: "workflow_id", Value: -1},
+				{Key: "started_at", Value: -1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_run_steps").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "workflow_id", Value: -1},
+				{Key: "session_id", Value: -1},
+				{Key: "status", Value: -1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_runs").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "status", Value: -1},
+				{Key: "deadline_at", Value: 1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_run_steps").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "status", Value: -1},
+				{Key: "deadline_at", Value: 1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_session_joins").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "session_id", Value: -1},
+				{Key: "key", Value: -1},
+				{Key: "workflow_id", Value: -1},
+			},
+			Options: options.Index().SetUnique(true),
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_session_joins").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "expires_at", Value: 1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_scheduled_retries").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "due_at", Value: 1},
+			},
+		})
+
+		if err != nil {
+			// return nil, err
+		}
+
+		_, err = db.Collection("workflow_flow_snapshots").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "tenant_id", Value: -1},
+				{Key: "workflow_id", Value: -1},
+				{Key: "version", Value: -1},
+			},
+			Options: options.Index().SetUnique(true),
+		})
+
+		if err != nil {
+			// return nil, err
+		}
 	}
 
 	a := NewMongodDBWorkflowStorageAdapter(client, db)
@@ -131,11 +265,39 @@ func NewMongodDBWorkflowStorageAdapter(client *mongo.Client, db *mongo.Database)
 		workflowActionCollection:         db.Collection("workflow_actions"),
 		workflowActionDepCollection:      db.Collection("workflow_action_deps"),
 		workflowSessionContextCollection: db.Collection("workflow_session_contexts"),
+		workflowRunCollection:            db.Collection("workflow_runs"),
+		workflowRunStepCollection:        db.Collection("workflow_run_steps"),
+		workflowSessionJoinCollection:    db.Collection("workflow_session_joins"),
+		workflowScheduledRetryCollection: db.Collection("workflow_scheduled_retries"),
+		workflowFlowSnapshotCollection:   db.Collection("workflow_flow_snapshots"),
 	}
 }
 
+// AddAction writes the action and bumps the flow version in one
+// transaction, as every graph write below, so a snapshot of the flow never
+// reads a graph under the version of the previous one.
 func (w *MongodDBWorkflowStorageAdapter) AddAction(ctx context.Context, req *AddActionRequest) (*WorkflowAction, error) {
 
+	var action *WorkflowAction
+
+	err := w.inTransaction(ctx, func(ctx context.Context) error {
+
+		var err error
+
+		action, err = w.addAction(ctx, req)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return action, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) addAction(ctx context.Context, req *AddActionRequest) (*WorkflowAction, error) {
+
 	id, err := uuid.NewV7()
 
 	if err != nil {
@@ -152,12 +314,15 @@ func (w *MongodDBWorkflowStorageAdapter) AddAction(ctx context.Context, req *Add
 		Map:        req.Map,
 		Meta:       req.Meta,
 		Disabled:   false,
+		Join:       req.Join,
+		Retry:      req.Retry,
+		Timeout:    req.Timeout,
 	}
 
 	_, err = w.workflowActionCollection.InsertOne(ctx, wa)
 
 	if err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 
 	// Increment flow version when action is added
@@ -176,9 +341,61 @@ func (w *MongodDBWorkflowStorageAdapter) AddAction(ctx context.Context, req *Add
 		Map:        wa.Map,
 		Meta:       wa.Meta,
 		Disabled:   wa.Disabled,
+		Join:       wa.Join,
+		Retry:      wa.Retry,
+		Timeout:    wa.Timeout,
 	}, nil
 }
 
+func (w *MongodDBWorkflowStorageAdapter) DeleteAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return w.inTransaction(ctx, func(ctx context.Context) error {
+		return w.deleteAction(ctx, tenantID, workflowID, key)
+	})
+}
+
+func (w *MongodDBWorkflowStorageAdapter) deleteAction(ctx context.Context, tenantID, workflowID, key string) error {
+
+	result, err := w.workflowActionCollection.DeleteOne(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "key", Value: key},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	_, err = w.workflowActionDepCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "key", Value: key}},
+				bson.D{{Key: "dep_key", Value: key}},
+			}},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = w.incrementFlowVersion(ctx, tenantID, workflowID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (w *MongodDBWorkflowStorageAdapter) AddDep(
 	ctx context.Context,
 	tenantID,
@@ -186,6 +403,19 @@ func (w *MongodDBWorkflowStorageAdapter) AddDep(
 	key,
 	metaOutput,
 	depKey string,
+) error {
+	return w.inTransaction(ctx, func(ctx context.Context) error {
+		return w.addDep(ctx, tenantID, workflowID, key, metaOutput, depKey)
+	})
+}
+
+func (w *MongodDBWorkflowStorageAdapter) addDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
 ) error {
 	id, err := uuid.NewV7()
 
@@ -203,6 +433,61 @@ func (w *MongodDBWorkflowStorageAdapter) AddDep(
 
 	_, err = w.workflowActionDepCollection.InsertOne(ctx, dep)
 
+	if err != nil {
+		return mongoError(err)
+	}
+
+	err = w.incrementFlowVersion(ctx, tenantID, workflowID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) RemoveDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+	return w.inTransaction(ctx, func(ctx context.Context) error {
+		return w.removeDep(ctx, tenantID, workflowID, key, metaOutput, depKey)
+	})
+}
+
+func (w *MongodDBWorkflowStorageAdapter) removeDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+
+	result, err := w.workflowActionDepCollection.DeleteOne(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "key", Value: key},
+			{Key: "meta_output", Value: metaOutput},
+			{Key: "dep_key", Value: depKey},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	err = w.incrementFlowVersion(ctx, tenantID, workflowID)
+
 	if err != nil {
 		return err
 	}
@@ -221,7 +506,7 @@ func (w *MongodDBWorkflowStorageAdapter) QueryWorkflowAction(ctx context.Context
 		},
 	)
 
-	err := result.Err()
+	err := mongoError(result.Err())
 
 	if err != nil {
 		return nil, err
@@ -245,6 +530,9 @@ func (w *MongodDBWorkflowStorageAdapter) QueryWorkflowAction(ctx context.Context
 		Map:        wa.Map,
 		Meta:       wa.Meta,
 		Disabled:   wa.Disabled,
+		Join:       wa.Join,
+		Retry:      wa.Retry,
+		Timeout:    wa.Timeout,
 	}, nil
 }
 
@@ -293,6 +581,44 @@ func (w *MongodDBWorkflowStorageAdapter) QueryWorkflowActionDependencies(ctx con
 	return depActions, nil
 }
 
+func (w *MongodDBWorkflowStorageAdapter) GetWorkflowActionDeps(ctx context.Context, tenantID, workflowID string) ([]WorkflowActionDep, error) {
+
+	cur, err := w.workflowActionDepCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+		},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	var deps []WorkflowActionDep
+
+	for cur.Next(ctx) {
+
+		var dep MDWorkflowActionDep
+
+		err := cur.Decode(&dep)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deps = append(deps, WorkflowActionDep{
+			Key:        dep.Key,
+			MetaOutput: dep.MetaOutput,
+			DepKey:     dep.DepKey,
+		})
+	}
+
+	return deps, nil
+}
+
 func (w *MongodDBWorkflowStorageAdapter) GetSessionContext(ctx context.Context, workflowID, sessionID, taskID string) (map[string]map[string]interface{}, error) {
 	result := w.workflowSessionContextCollection.FindOne(
 		ctx,
@@ -303,7 +629,7 @@ func (w *MongodDBWorkflowStorageAdapter) GetSessionContext(ctx context.Context,
 		},
 	)
 
-	err := result.Err()
+	err := mongoError(result.Err())
 
 	if err != nil {
 		return nil, err
@@ -332,48 +658,226 @@ func (w *MongodDBWorkflowStorageAdapter) GetSessionContext(ctx context.Context,
 	return sessCtx.Value, nil
 }
 
-func (w *MongodDBWorkflowStorageAdapter) CreateSessionContext(ctx context.Context, workflowID, sessionID, taskID string, value map[string]map[string]interface{}) error {
+func (w *MongodDBWorkflowStorageAdapter) CreateSessionContext(ctx context.Context, sessionContext *SessionContext) error {
 	id, err := uuid.NewV7()
 
 	if err != nil {
 		return err
 	}
 
+	valb, err := json.Marshal(sessionContext.Value)
+
+	if err != nil {
+		return err
+	}
+
 	newSess := MDWorkflowSessionContext{
 		ID:         id.String(),
-		WorkflowID: workflowID,
-		SessionID:  sessionID,
-		TaskID:     taskID,
-		Value:      value,
+		TenantID:   sessionContext.TenantID,
+		WorkflowID: sessionContext.WorkflowID,
+		SessionID:  sessionContext.SessionID,
+		TaskID:     sessionContext.TaskID,
+		Value:      sessionContext.Value,
+		Size:       int64(len(valb)),
+		CreatedAt:  sessionContext.CreatedAt,
+		ExpiresAt:  sessionContext.ExpiresAt,
 	}
 
 	_, err = w.workflowSessionContextCollection.InsertOne(ctx, newSess)
 
 	if err != nil {
-		return err
+		return mongoError(err)
 	}
 
 	return nil
 }
 
 func (w *MongodDBWorkflowStorageAdapter) DeleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) error {
-	// _, err := w.workflowSessionContextCollection.DeleteOne(
-	// 	ctx,
-	// 	bson.D{
-	// 		{Key: "workflow_id", Value: workflowID},
-	// 		{Key: "session_id", Value: sessionID},
-	// 		{Key: "task_id", Value: taskID},
-	// 	},
-	// )
-	//
-	// if err != nil {
-	// 	return err
-	// }
+	_, err := w.workflowSessionContextCollection.DeleteOne(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+			{Key: "task_id", Value: taskID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// DeleteExpiredSessionContexts keeps the contexts of the steps still running
+// or waiting for a retry, whatever their expiry.
+func (w *MongodDBWorkflowStorageAdapter) DeleteExpiredSessionContexts(ctx context.Context, now time.Time, limit int) (int64, error) {
+
+	cur, err := w.workflowSessionContextCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetProjection(bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "workflow_id", Value: 1},
+				{Key: "session_id", Value: 1},
+				{Key: "task_id", Value: 1},
+			}).
+			SetLimit(int64(limit)),
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer cur.Close(ctx)
+
+	var sessCtxs []MDWorkflowSessionContext
+
+	for cur.Next(ctx) {
+
+		var sessCtx MDWorkflowSessionContext
+
+		err := cur.Decode(&sessCtx)
+
+		if err != nil {
+			return 0, err
+		}
+
+		sessCtxs = append(sessCtxs, sessCtx)
+	}
+
+	if len(sessCtxs) == 0 {
+		return 0, nil
+	}
+
+	taskIDs := make([]string, 0, len(sessCtxs))
+
+	for _, sessCtx := range sessCtxs {
+		taskIDs = append(taskIDs, sessCtx.TaskID)
+	}
+
+	stepCur, err := w.workflowRunStepCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: taskIDs}}},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: activeRunStepStatuses}}},
+		},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer stepCur.Close(ctx)
+
+	active := map[runKey]map[string]bool{}
+
+	for stepCur.Next(ctx) {
+
+		var mdStep MDRunStep
+
+		err := stepCur.Decode(&mdStep)
+
+		if err != nil {
+			return 0, err
+		}
+
+		key := runKey{mdStep.WorkflowID, mdStep.SessionID}
+
+		if active[key] == nil {
+			active[key] = map[string]bool{}
+		}
+
+		active[key][mdStep.ID] = true
+	}
+
+	var ids []string
+
+	for _, sessCtx := range sessCtxs {
+
+		if active[runKey{sessCtx.WorkflowID, sessCtx.SessionID}][sessCtx.TaskID] {
+			continue
+		}
+
+		ids = append(ids, sessCtx.ID)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := w.workflowSessionContextCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+		},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) ListSessionContextUsage(ctx context.Context) ([]SessionContextUsage, error) {
+
+	cur, err := w.workflowSessionContextCollection.Aggregate(
+		ctx,
+		mongo.Pipeline{
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$tenant_id"},
+				{Key: "contexts", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "bytes", Value: bson.D{{Key: "$sum", Value: "$size"}}},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	usages := []SessionContextUsage{}
+
+	for cur.Next(ctx) {
+
+		var usage MDSessionContextUsage
+
+		err := cur.Decode(&usage)
+
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, SessionContextUsage{
+			TenantID: usage.TenantID,
+			Contexts: usage.Contexts,
+			Bytes:    usage.Bytes,
+		})
+	}
+
+	joinUsages, err := w.listJoinUsage(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSessionContextUsage(usages, joinUsages), nil
+}
+
 func (w *MongodDBWorkflowStorageAdapter) DisableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return w.inTransaction(ctx, func(ctx context.Context) error {
+		return w.disableWorkflowAction(ctx, tenantID, workflowID, key)
+	})
+}
+
+func (w *MongodDBWorkflowStorageAdapter) disableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
 
 	_, err := w.workflowActionCollection.UpdateOne(
 		ctx,
@@ -405,6 +909,44 @@ func (w *MongodDBWorkflowStorageAdapter) DisableWorkflowAction(ctx context.Conte
 	return nil
 }
 
+func (w *MongodDBWorkflowStorageAdapter) EnableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return w.inTransaction(ctx, func(ctx context.Context) error {
+		return w.enableWorkflowAction(ctx, tenantID, workflowID, key)
+	})
+}
+
+func (w *MongodDBWorkflowStorageAdapter) enableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+
+	_, err := w.workflowActionCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "key", Value: key},
+		},
+		bson.D{
+			{
+				Key: "$set",
+				Value: bson.D{
+					{Key: "disabled", Value: false},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	err = w.incrementFlowVersion(ctx, tenantID, workflowID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (w *MongodDBWorkflowStorageAdapter) ListFlows(ctx context.Context, tenantID string, page, pageSize int) (*FlowListResponse, error) {
 
 	skip := (page - 1) * pageSize
@@ -495,6 +1037,9 @@ func (w *MongodDBWorkflowStorageAdapter) GetWorkflowActions(ctx context.Context,
 			Map:        wa.Map,
 			Meta:       wa.Meta,
 			Disabled:   wa.Disabled,
+			Join:       wa.Join,
+			Retry:      wa.Retry,
+			Timeout:    wa.Timeout,
 		}
 
 		actions = append(actions, action)
@@ -505,11 +1050,34 @@ func (w *MongodDBWorkflowStorageAdapter) GetWorkflowActions(ctx context.Context,
 
 func (w *MongodDBWorkflowStorageAdapter) UpdateAction(ctx context.Context, req *UpdateActionRequest) (*WorkflowAction, error) {
 
+	var action *WorkflowAction
+
+	err := w.inTransaction(ctx, func(ctx context.Context) error {
+
+		var err error
+
+		action, err = w.updateAction(ctx, req)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return action, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) updateAction(ctx context.Context, req *UpdateActionRequest) (*WorkflowAction, error) {
+
 	update := bson.D{
 		{Key: "$set", Value: bson.D{
 			{Key: "config", Value: req.Config},
 			{Key: "map", Value: req.Map},
 			{Key: "meta", Value: req.Meta},
+			{Key: "join", Value: req.Join},
+			{Key: "retry", Value: req.Retry},
+			{Key: "timeout", Value: req.Timeout},
 		}},
 	}
 
@@ -524,7 +1092,7 @@ func (w *MongodDBWorkflowStorageAdapter) UpdateAction(ctx context.Context, req *
 		options.FindOneAndUpdate().SetReturnDocument(options.After),
 	)
 
-	err := result.Err()
+	err := mongoError(result.Err())
 
 	if err != nil {
 		return nil, err
@@ -554,12 +1122,30 @@ func (w *MongodDBWorkflowStorageAdapter) UpdateAction(ctx context.Context, req *
 		Map:        wa.Map,
 		Meta:       wa.Meta,
 		Disabled:   wa.Disabled,
+		Join:       wa.Join,
+		Retry:      wa.Retry,
+		Timeout:    wa.Timeout,
 	}, nil
 }
 
 func (w *MongodDBWorkflowStorageAdapter) DeleteFlow(ctx context.Context, tenantID, flowID string) error {
 
-	_, err := w.workflowCollection.DeleteOne(
+	// the documents keyed by workflow_id alone must not be deleted for a
+	// flow of another tenant
+	err := w.workflowCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: flowID},
+			{Key: "tenant_id", Value: tenantID},
+		},
+		options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	).Err()
+
+	if err != nil {
+		return mongoError(err)
+	}
+
+	_, err = w.workflowCollection.DeleteOne(
 		ctx,
 		bson.D{
 			{Key: "_id", Value: flowID},
@@ -605,6 +1191,65 @@ func (w *MongodDBWorkflowStorageAdapter) DeleteFlow(ctx context.Context, tenantI
 		return err
 	}
 
+	_, err = w.workflowSessionJoinCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: flowID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.workflowScheduledRetryCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: flowID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.workflowFlowSnapshotCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: flowID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.workflowRunCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: flowID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.workflowRunStepCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: flowID},
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -618,12 +1263,14 @@ func (w *MongodDBWorkflowStorageAdapter) CreateFlow(ctx context.Context, req *Cr
 		TriggerType: req.TriggerType,
 		Meta:        req.Meta,
 		Status:      FlowStatusDraft,
+		Deadline:    req.Deadline,
+		Retention:   req.Retention,
 	}
 
 	_, err := w.workflowCollection.InsertOne(ctx, flow)
 
 	if err != nil {
-		return nil, err
+		return nil, mongoError(err)
 	}
 
 	return &Flow{
@@ -634,6 +1281,8 @@ func (w *MongodDBWorkflowStorageAdapter) CreateFlow(ctx context.Context, req *Cr
 		TriggerType: flow.TriggerType,
 		Meta:        flow.Meta,
 		Status:      flow.Status,
+		Deadline:    flow.Deadline,
+		Retention:   flow.Retention,
 	}, nil
 }
 
@@ -647,7 +1296,7 @@ func (w *MongodDBWorkflowStorageAdapter) GetFlow(ctx context.Context, tenantID,
 		},
 	)
 
-	err := result.Err()
+	err := mongoError(result.Err())
 
 	if err != nil {
 		return nil, err
@@ -669,6 +1318,8 @@ func (w *MongodDBWorkflowStorageAdapter) GetFlow(ctx context.Context, tenantID,
 		TriggerType: flow.TriggerType,
 		Meta:        flow.Meta,
 		Status:      flow.Status,
+		Deadline:    flow.Deadline,
+		Retention:   flow.Retention,
 	}, nil
 }
 
@@ -679,6 +1330,8 @@ func (w *MongodDBWorkflowStorageAdapter) UpdateFlow(ctx context.Context, req *Up
 			{Key: "trigger_type", Value: req.TriggerType},
 			{Key: "meta", Value: req.Meta},
 			{Key: "status", Value: req.Status},
+			{Key: "deadline", Value: req.Deadline},
+			{Key: "retention", Value: req.Retention},
 		}},
 	}
 
@@ -698,6 +1351,25 @@ func (w *MongodDBWorkflowStorageAdapter) UpdateFlow(ctx context.Context, req *Up
 	return w.GetFlow(ctx, req.TenantID, req.FlowID)
 }
 
+// inTransaction runs fn in a multi-document transaction, which needs
+// MongoDB to run as a replica set.
+func (w *MongodDBWorkflowStorageAdapter) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	session, err := w.client.StartSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+
+	return err
+}
+
 func (w *MongodDBWorkflowStorageAdapter) incrementFlowVersion(ctx context.Context, tenantID, workflowID string) error {
 	_, err := w.workflowCollection.UpdateOne(
 		ctx,
@@ -714,6 +1386,20 @@ func (w *MongodDBWorkflowStorageAdapter) incrementFlowVersion(ctx context.Contex
 	return err
 }
 
+// mongoError translates the errors of missing documents and duplicate keys
+// into ErrNotFound and ErrAlreadyExists, keeping the driver error wrapped.
+func mongoError(err error) error {
+
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	}
+
+	return err
+}
+
 func (w *MongodDBWorkflowStorageAdapter) Close(ctx context.Context) error {
 	return w.client.Disconnect(ctx)
 }
@@ -726,6 +1412,8 @@ type MDFlow struct {
 	TriggerType FlowTriggerType   `bson:"trigger_type"`
 	Meta        map[string]string `bson:"meta,omitempty"`
 	Status      FlowStatus        `bson:"status"`
+	Deadline    Duration          `bson:"deadline,omitempty"`
+	Retention   Duration          `bson:"retention,omitempty"`
 }
 
 type MDWorkflowAction struct {
@@ -738,6 +1426,9 @@ type MDWorkflowAction struct {
 	Map        map[string]Mapper `bson:"map"`
 	Meta       map[string]string `bson:"meta,omitempty"`
 	Disabled   bool              `bson:"disabled"`
+	Join       *JoinPolicy       `bson:"join,omitempty"`
+	Retry      *RetryPolicy      `bson:"retry,omitempty"`
+	Timeout    Duration          `bson:"timeout,omitempty"`
 }
 
 type MDWorkflowActionDep struct {
@@ -750,8 +1441,18 @@ type MDWorkflowActionDep struct {
 
 type MDWorkflowSessionContext struct {
 	ID         string                            `bson:"_id"`
+	TenantID   string                            `bson:"tenant_id"`
 	WorkflowID string                            `bson:"workflow_id"` // Composite unique index
 	SessionID  string                            `bson:"session_id"`  // Composite unique index
 	TaskID     string                            `bson:"task_id"`     // Composite unique index
 	Value      map[string]map[string]interface{} `bson:"value"`
+	Size       int64                             `bson:"size"`
+	CreatedAt  time.Time                         `bson:"created_at"`
+	ExpiresAt  *time.Time                        `bson:"expires_at,omitempty"`
+}
+
+type MDSessionContextUsage struct {
+	TenantID string `bson:"_id"`
+	Contexts int64  `bson:"contexts"`
+	Bytes    int64  `bson:"bytes"`
 }
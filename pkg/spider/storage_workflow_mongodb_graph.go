@@ -0,0 +1,223 @@
+package spider
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// SaveFlowGraph writes the flow and its graph in a multi-document
+// transaction, which needs MongoDB to run as a replica set.
+func (w *MongodDBWorkflowStorageAdapter) SaveFlowGraph(ctx context.Context, req *SaveFlowGraphRequest) (*Flow, error) {
+
+	session, err := w.client.StartSession()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		return w.saveFlowGraph(ctx, req)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Flow), nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) saveFlowGraph(ctx context.Context, req *SaveFlowGraphRequest) (*Flow, error) {
+
+	var current MDFlow
+
+	err := w.workflowCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: req.Flow.ID},
+		},
+	).Decode(&current)
+
+	exists := true
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		exists = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	// flow IDs are unique across tenants
+	if exists && current.TenantID != req.Flow.TenantID {
+		return nil, ErrAlreadyExists
+	}
+
+	flow := MDFlow{
+		ID:          req.Flow.ID,
+		Version:     1,
+		Name:        req.Flow.Name,
+		TenantID:    req.Flow.TenantID,
+		TriggerType: req.Flow.TriggerType,
+		Meta:        req.Flow.Meta,
+		Status:      FlowStatusDraft,
+		Deadline:    req.Flow.Deadline,
+		Retention:   req.Flow.Retention,
+	}
+
+	if exists {
+		flow.Version = current.Version + 1
+		flow.Status = current.Status
+
+		_, err = w.workflowCollection.ReplaceOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: flow.ID},
+			},
+			flow,
+		)
+	} else {
+		_, err = w.workflowCollection.InsertOne(ctx, flow)
+	}
+
+	if err != nil {
+		return nil, mongoError(err)
+	}
+
+	actionIDs := map[string]string{}
+
+	if exists {
+
+		cur, err := w.workflowActionCollection.Find(
+			ctx,
+			bson.D{
+				{Key: "tenant_id", Value: flow.TenantID},
+				{Key: "workflow_id", Value: flow.ID},
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var actions []MDWorkflowAction
+
+		err = cur.All(ctx, &actions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, wa := range actions {
+			actionIDs[wa.Key] = wa.ID
+		}
+
+		_, err = w.workflowActionCollection.DeleteMany(
+			ctx,
+			bson.D{
+				{Key: "tenant_id", Value: flow.TenantID},
+				{Key: "workflow_id", Value: flow.ID},
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = w.workflowActionDepCollection.DeleteMany(
+			ctx,
+			bson.D{
+				{Key: "workflow_id", Value: flow.ID},
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var actions []interface{}
+
+	for _, action := range req.Actions {
+
+		id, ok := actionIDs[action.Key]
+
+		if !ok {
+
+			newID, err := uuid.NewV7()
+
+			if err != nil {
+				return nil, err
+			}
+
+			id = newID.String()
+		}
+
+		actions = append(actions, MDWorkflowAction{
+			ID:         id,
+			Key:        action.Key,
+			TenantID:   flow.TenantID,
+			WorkflowID: flow.ID,
+			ActionID:   action.ActionID,
+			Config:     action.Config,
+			Map:        action.Map,
+			Meta:       action.Meta,
+			Disabled:   false,
+			Join:       action.Join,
+			Retry:      action.Retry,
+			Timeout:    action.Timeout,
+		})
+	}
+
+	if len(actions) > 0 {
+
+		_, err = w.workflowActionCollection.InsertMany(ctx, actions)
+
+		if err != nil {
+			return nil, mongoError(err)
+		}
+	}
+
+	var deps []interface{}
+
+	for _, dep := range req.Deps {
+
+		id, err := uuid.NewV7()
+
+		if err != nil {
+			return nil, err
+		}
+
+		deps = append(deps, MDWorkflowActionDep{
+			ID:         id.String(),
+			WorkflowID: flow.ID,
+			Key:        dep.Key,
+			MetaOutput: dep.MetaOutput,
+			DepKey:     dep.DepKey,
+		})
+	}
+
+	if len(deps) > 0 {
+
+		_, err = w.workflowActionDepCollection.InsertMany(ctx, deps)
+
+		if err != nil {
+			return nil, mongoError(err)
+		}
+	}
+
+	return &Flow{
+		ID:          flow.ID,
+		Version:     flow.Version,
+		Name:        flow.Name,
+		TenantID:    flow.TenantID,
+		TriggerType: flow.TriggerType,
+		Meta:        flow.Meta,
+		Status:      flow.Status,
+		Deadline:    flow.Deadline,
+		Retention:   flow.Retention,
+	}, nil
+}
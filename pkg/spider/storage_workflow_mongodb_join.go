@@ -0,0 +1,332 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func (w *MongodDBWorkflowStorageAdapter) AddJoinArrival(ctx context.Context, req *AddJoinArrivalRequest) (*JoinState, error) {
+
+	valb, err := json.Marshal(req.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{
+		{Key: "workflow_id", Value: req.WorkflowID},
+		{Key: "session_id", Value: req.SessionID},
+		{Key: "key", Value: req.Key},
+	}
+
+	_, err = w.workflowSessionJoinCollection.UpdateOne(
+		ctx,
+		filter,
+		bson.D{
+			{Key: "$setOnInsert", Value: bson.D{
+				{Key: "tenant_id", Value: req.TenantID},
+				{Key: "arrivals", Value: bson.A{}},
+				{Key: "dispatched", Value: false},
+				{Key: "size", Value: int64(0)},
+				{Key: "expires_at", Value: req.ExpiresAt},
+			}},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a parent only counts once, redelivered outputs must not fill the join
+	_, err = w.workflowSessionJoinCollection.UpdateOne(
+		ctx,
+		append(filter, bson.E{Key: "arrivals.parent_key", Value: bson.D{{Key: "$ne", Value: req.ParentKey}}}),
+		bson.D{
+			{Key: "$push", Value: bson.D{
+				{Key: "arrivals", Value: MDJoinArrival{
+					ParentKey: req.ParentKey,
+					Value:     req.Value,
+					ArrivedAt: time.Now(),
+				}},
+			}},
+			{Key: "$inc", Value: bson.D{
+				{Key: "size", Value: int64(len(valb))},
+			}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := w.workflowSessionJoinCollection.FindOne(ctx, filter)
+
+	err = result.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var join MDWorkflowSessionJoin
+
+	err = result.Decode(&join)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := JoinState{
+		Dispatched:   join.Dispatched,
+		DispatchedBy: join.DispatchedBy,
+	}
+
+	for _, arrival := range join.Arrivals {
+
+		valb, err := json.Marshal(arrival.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var value map[string]map[string]interface{}
+
+		err = json.Unmarshal(valb, &value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		state.Arrivals = append(state.Arrivals, JoinArrival{
+			ParentKey: arrival.ParentKey,
+			Value:     value,
+			ArrivedAt: arrival.ArrivedAt,
+		})
+	}
+
+	return &state, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) ClaimJoin(ctx context.Context, workflowID, sessionID, key, parentKey string) (bool, error) {
+
+	result, err := w.workflowSessionJoinCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+			{Key: "key", Value: key},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "dispatched", Value: false}},
+				bson.D{{Key: "dispatched_by", Value: parentKey}},
+			}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "dispatched", Value: true},
+				{Key: "dispatched_by", Value: parentKey},
+			}},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	// a claim repeated by its parent matches without modifying the join
+	return result.MatchedCount > 0, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) DeleteSessionJoins(ctx context.Context, workflowID, sessionID string) error {
+
+	_, err := w.workflowSessionJoinCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+		},
+	)
+
+	return err
+}
+
+func (w *MongodDBWorkflowStorageAdapter) DeleteExpiredJoins(ctx context.Context, now time.Time, limit int) (int64, error) {
+
+	cur, err := w.workflowSessionJoinCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetProjection(bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "workflow_id", Value: 1},
+				{Key: "session_id", Value: 1},
+			}).
+			SetLimit(int64(limit)),
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer cur.Close(ctx)
+
+	var joins []MDWorkflowSessionJoin
+
+	for cur.Next(ctx) {
+
+		var join MDWorkflowSessionJoin
+
+		err := cur.Decode(&join)
+
+		if err != nil {
+			return 0, err
+		}
+
+		joins = append(joins, join)
+	}
+
+	if len(joins) == 0 {
+		return 0, nil
+	}
+
+	sessionIDs := make([]string, 0, len(joins))
+
+	for _, join := range joins {
+		sessionIDs = append(sessionIDs, join.SessionID)
+	}
+
+	runCur, err := w.workflowRunCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: sessionIDs}}},
+			{Key: "status", Value: RunStatusRunning},
+		},
+		options.Find().SetProjection(bson.D{
+			{Key: "_id", Value: 1},
+			{Key: "workflow_id", Value: 1},
+		}),
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer runCur.Close(ctx)
+
+	running := map[runKey]bool{}
+
+	for runCur.Next(ctx) {
+
+		var mdRun MDRun
+
+		err := runCur.Decode(&mdRun)
+
+		if err != nil {
+			return 0, err
+		}
+
+		running[runKey{mdRun.WorkflowID, mdRun.ID}] = true
+	}
+
+	// the run may still dispatch the join
+	var ids []bson.ObjectID
+
+	for _, join := range joins {
+
+		if running[runKey{join.WorkflowID, join.SessionID}] {
+			continue
+		}
+
+		ids = append(ids, join.ID)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := w.workflowSessionJoinCollection.DeleteMany(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+		},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// listJoinUsage returns the joins and the size of their arrivals by tenant.
+func (w *MongodDBWorkflowStorageAdapter) listJoinUsage(ctx context.Context) ([]SessionContextUsage, error) {
+
+	cur, err := w.workflowSessionJoinCollection.Aggregate(
+		ctx,
+		mongo.Pipeline{
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$tenant_id"},
+				{Key: "joins", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "bytes", Value: bson.D{{Key: "$sum", Value: "$size"}}},
+			}}},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	var usages []SessionContextUsage
+
+	for cur.Next(ctx) {
+
+		var usage MDJoinUsage
+
+		err := cur.Decode(&usage)
+
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, SessionContextUsage{
+			TenantID:  usage.TenantID,
+			Joins:     usage.Joins,
+			JoinBytes: usage.Bytes,
+		})
+	}
+
+	return usages, nil
+}
+
+type MDWorkflowSessionJoin struct {
+	ID           bson.ObjectID   `bson:"_id,omitempty"`
+	TenantID     string          `bson:"tenant_id"`
+	WorkflowID   string          `bson:"workflow_id"` // Composite unique index
+	SessionID    string          `bson:"session_id"`  // Composite unique index
+	Key          string          `bson:"key"`         // Composite unique index
+	Arrivals     []MDJoinArrival `bson:"arrivals"`
+	Dispatched   bool            `bson:"dispatched"`
+	DispatchedBy string          `bson:"dispatched_by,omitempty"`
+	Size         int64           `bson:"size"`
+	ExpiresAt    *time.Time      `bson:"expires_at,omitempty"`
+}
+
+type MDJoinUsage struct {
+	TenantID string `bson:"_id"`
+	Joins    int64  `bson:"joins"`
+	Bytes    int64  `bson:"bytes"`
+}
+
+type MDJoinArrival struct {
+	ParentKey string                            `bson:"parent_key"`
+	Value     map[string]map[string]interface{} `bson:"value"`
+	ArrivedAt time.Time                         `bson:"arrived_at"`
+}
@@ -0,0 +1,150 @@
+package spider
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func (w *MongodDBWorkflowStorageAdapter) ScheduleRetry(ctx context.Context, retry *ScheduledRetry) error {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return err
+	}
+
+	mdRetry := MDScheduledRetry{
+		ID:          id.String(),
+		TenantID:    retry.TenantID,
+		WorkflowID:  retry.WorkflowID,
+		SessionID:   retry.SessionID,
+		TaskID:      retry.TaskID,
+		Key:         retry.Key,
+		ActionID:    retry.ActionID,
+		Values:      retry.Values,
+		Attempt:     retry.Attempt,
+		FlowVersion: retry.FlowVersion,
+		Timeout:     retry.Timeout,
+		DueAt:       retry.DueAt,
+	}
+
+	_, err = w.workflowScheduledRetryCollection.InsertOne(ctx, mdRetry)
+
+	if err != nil {
+		return err
+	}
+
+	retry.ID = mdRetry.ID
+
+	return nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledRetry, error) {
+
+	cur, err := w.workflowScheduledRetryCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "due_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "due_at", Value: 1}}).
+			SetLimit(int64(limit)),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	var candidates []MDScheduledRetry
+
+	for cur.Next(ctx) {
+
+		var mdRetry MDScheduledRetry
+
+		err := cur.Decode(&mdRetry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, mdRetry)
+	}
+
+	var retries []ScheduledRetry
+
+	for _, mdRetry := range candidates {
+
+		// another workflow replica may claim the same retry, whoever
+		// moves it owns its lease
+		result, err := w.workflowScheduledRetryCollection.UpdateOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: mdRetry.ID},
+				{Key: "due_at", Value: bson.D{{Key: "$lte", Value: now}}},
+			},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "due_at", Value: now.Add(lease)},
+				}},
+			},
+		)
+
+		if err != nil {
+			return retries, err
+		}
+
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		retries = append(retries, ScheduledRetry{
+			ID:          mdRetry.ID,
+			TenantID:    mdRetry.TenantID,
+			WorkflowID:  mdRetry.WorkflowID,
+			SessionID:   mdRetry.SessionID,
+			TaskID:      mdRetry.TaskID,
+			Key:         mdRetry.Key,
+			ActionID:    mdRetry.ActionID,
+			Values:      mdRetry.Values,
+			Attempt:     mdRetry.Attempt,
+			FlowVersion: mdRetry.FlowVersion,
+			Timeout:     mdRetry.Timeout,
+			DueAt:       mdRetry.DueAt,
+		})
+	}
+
+	return retries, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) DeleteRetry(ctx context.Context, id string) error {
+
+	_, err := w.workflowScheduledRetryCollection.DeleteOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: id},
+		},
+	)
+
+	return err
+}
+
+type MDScheduledRetry struct {
+	ID          string    `bson:"_id"`
+	TenantID    string    `bson:"tenant_id"`
+	WorkflowID  string    `bson:"workflow_id"`
+	SessionID   string    `bson:"session_id"`
+	TaskID      string    `bson:"task_id"`
+	Key         string    `bson:"key"`
+	ActionID    string    `bson:"action_id"`
+	Values      string    `bson:"values"`
+	Attempt     int       `bson:"attempt"`
+	FlowVersion uint64    `bson:"flow_version"`
+	Timeout     Duration  `bson:"timeout,omitempty"`
+	DueAt       time.Time `bson:"due_at"`
+}
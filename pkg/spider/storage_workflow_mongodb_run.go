@@ -0,0 +1,518 @@
+package spider
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func (w *MongodDBWorkflowStorageAdapter) CreateRun(ctx context.Context, run *Run) error {
+
+	mdRun := MDRun{
+		ID:                run.SessionID,
+		TenantID:          run.TenantID,
+		WorkflowID:        run.WorkflowID,
+		FlowVersion:       run.FlowVersion,
+		Status:            run.Status,
+		TriggerKey:        run.TriggerKey,
+		TriggerMetaOutput: run.TriggerMetaOutput,
+		TriggerPayload:    run.TriggerPayload,
+		Error:             run.Error,
+		StartedAt:         run.StartedAt,
+		EndedAt:           run.EndedAt,
+		DeadlineAt:        run.DeadlineAt,
+	}
+
+	_, err := w.workflowRunCollection.InsertOne(ctx, mdRun)
+
+	if err != nil {
+		return mongoError(err)
+	}
+
+	return nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) GetRun(ctx context.Context, tenantID, workflowID, sessionID string) (*Run, error) {
+
+	result := w.workflowRunCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: workflowID},
+		},
+	)
+
+	err := mongoError(result.Err())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var mdRun MDRun
+
+	err = result.Decode(&mdRun)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := w.workflowRunStepCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+		},
+		// task IDs derive from their parent, they do not sort by time
+		options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	run := mdRun.ToRun()
+
+	for cur.Next(ctx) {
+
+		var mdStep MDRunStep
+
+		err := cur.Decode(&mdStep)
+
+		if err != nil {
+			return nil, err
+		}
+
+		run.Steps = append(run.Steps, mdStep.ToRunStep())
+	}
+
+	return &run, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) GetRunStatus(ctx context.Context, workflowID, sessionID string) (RunStatus, error) {
+
+	result := w.workflowRunCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "workflow_id", Value: workflowID},
+		},
+		options.FindOne().SetProjection(bson.D{{Key: "status", Value: 1}}),
+	)
+
+	err := mongoError(result.Err())
+
+	if err != nil {
+		return "", err
+	}
+
+	var mdRun MDRun
+
+	err = result.Decode(&mdRun)
+
+	if err != nil {
+		return "", err
+	}
+
+	return mdRun.Status, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) ListRuns(ctx context.Context, req *ListRunsRequest) (*RunListResponse, error) {
+
+	skip := (req.Page - 1) * req.PageSize
+
+	filter := bson.D{
+		{Key: "tenant_id", Value: req.TenantID},
+		{Key: "workflow_id", Value: req.WorkflowID},
+	}
+
+	if req.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: req.Status})
+	}
+
+	if req.From != nil || req.To != nil {
+		startedAt := bson.D{}
+
+		if req.From != nil {
+			startedAt = append(startedAt, bson.E{Key: "$gte", Value: *req.From})
+		}
+
+		if req.To != nil {
+			startedAt = append(startedAt, bson.E{Key: "$lt", Value: *req.To})
+		}
+
+		filter = append(filter, bson.E{Key: "started_at", Value: startedAt})
+	}
+
+	total, err := w.workflowRunCollection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().
+		SetSkip(int64(skip)).
+		SetLimit(int64(req.PageSize)).
+		SetSort(bson.D{{Key: "started_at", Value: -1}})
+
+	cur, err := w.workflowRunCollection.Find(ctx, filter, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	runs := []Run{}
+
+	for cur.Next(ctx) {
+
+		var mdRun MDRun
+
+		err := cur.Decode(&mdRun)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, mdRun.ToRun())
+	}
+
+	return &RunListResponse{
+		Runs:     runs,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) UpdateRunStatus(ctx context.Context, workflowID, sessionID string, req *UpdateRunStatusRequest) (bool, error) {
+
+	set := bson.D{
+		{Key: "status", Value: req.To},
+	}
+
+	if req.Error != "" {
+		set = append(set, bson.E{Key: "error", Value: req.Error})
+	}
+
+	if req.EndedAt != nil {
+		set = append(set, bson.E{Key: "ended_at", Value: req.EndedAt})
+	}
+
+	if req.DeadlineAt != nil {
+		set = append(set, bson.E{Key: "deadline_at", Value: req.DeadlineAt})
+	}
+
+	if req.FlowVersion > 0 {
+		set = append(set, bson.E{Key: "flow_version", Value: req.FlowVersion})
+	}
+
+	result, err := w.workflowRunCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: sessionID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: req.From}}},
+		},
+		bson.D{
+			{Key: "$set", Value: set},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) AddRunStep(ctx context.Context, step *RunStep) error {
+
+	mdStep := MDRunStep{
+		ID:          step.TaskID,
+		SessionID:   step.SessionID,
+		TenantID:    step.TenantID,
+		WorkflowID:  step.WorkflowID,
+		Key:         step.Key,
+		ActionID:    step.ActionID,
+		Status:      step.Status,
+		Input:       step.Input,
+		Output:      step.Output,
+		MetaOutput:  step.MetaOutput,
+		Error:       step.Error,
+		Attempt:     step.Attempt,
+		FlowVersion: step.FlowVersion,
+		StartedAt:   step.StartedAt,
+		EndedAt:     step.EndedAt,
+		DeadlineAt:  step.DeadlineAt,
+	}
+
+	_, err := w.workflowRunStepCollection.InsertOne(ctx, mdStep)
+
+	if err != nil {
+		return mongoError(err)
+	}
+
+	return nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) GetRunStep(ctx context.Context, workflowID, sessionID, taskID string) (*RunStep, error) {
+
+	result := w.workflowRunStepCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: taskID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+		},
+	)
+
+	err := mongoError(result.Err())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var mdStep MDRunStep
+
+	err = result.Decode(&mdStep)
+
+	if err != nil {
+		return nil, err
+	}
+
+	step := mdStep.ToRunStep()
+
+	return &step, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) FinishRunStep(ctx context.Context, workflowID, sessionID, taskID string, req *FinishRunStepRequest) (bool, error) {
+
+	result, err := w.workflowRunStepCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: taskID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: activeRunStepStatuses}}},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: req.Status},
+				{Key: "meta_output", Value: req.MetaOutput},
+				{Key: "output", Value: req.Output},
+				{Key: "error", Value: req.Error},
+				{Key: "ended_at", Value: req.EndedAt},
+			}},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) UpdateRunStepStatus(ctx context.Context, workflowID, sessionID, taskID string, req *UpdateRunStepStatusRequest) (bool, error) {
+
+	set := bson.D{
+		{Key: "status", Value: req.To},
+	}
+
+	if req.Attempt > 0 {
+		set = append(set, bson.E{Key: "attempt", Value: req.Attempt})
+	}
+
+	if req.Error != "" {
+		set = append(set, bson.E{Key: "error", Value: req.Error})
+	}
+
+	if req.DeadlineAt != nil {
+		set = append(set, bson.E{Key: "deadline_at", Value: req.DeadlineAt})
+	}
+
+	result, err := w.workflowRunStepCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: taskID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: req.From}}},
+		},
+		bson.D{
+			{Key: "$set", Value: set},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) CountActiveRunSteps(ctx context.Context, workflowID, sessionID string) (int64, error) {
+	return w.workflowRunStepCollection.CountDocuments(
+		ctx,
+		bson.D{
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "session_id", Value: sessionID},
+			{Key: "status", Value: bson.D{{Key: "$in", Value: activeRunStepStatuses}}},
+		},
+	)
+}
+
+func (w *MongodDBWorkflowStorageAdapter) ListExpiredRuns(ctx context.Context, now time.Time, limit int) ([]Run, error) {
+
+	cur, err := w.workflowRunCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "status", Value: RunStatusRunning},
+			{Key: "deadline_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "deadline_at", Value: 1}}).
+			SetLimit(int64(limit)),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	var runs []Run
+
+	for cur.Next(ctx) {
+
+		var mdRun MDRun
+
+		err := cur.Decode(&mdRun)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, mdRun.ToRun())
+	}
+
+	return runs, nil
+}
+
+// ListExpiredRunSteps returns running steps whose attempt outlived its
+// timeout. Steps waiting for a retry are not running an attempt, so they
+// never expire.
+func (w *MongodDBWorkflowStorageAdapter) ListExpiredRunSteps(ctx context.Context, now time.Time, limit int) ([]RunStep, error) {
+
+	cur, err := w.workflowRunStepCollection.Find(
+		ctx,
+		bson.D{
+			{Key: "status", Value: RunStepStatusRunning},
+			{Key: "deadline_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "deadline_at", Value: 1}}).
+			SetLimit(int64(limit)),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	var steps []RunStep
+
+	for cur.Next(ctx) {
+
+		var mdStep MDRunStep
+
+		err := cur.Decode(&mdStep)
+
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, mdStep.ToRunStep())
+	}
+
+	return steps, nil
+}
+
+type MDRun struct {
+	ID                string                 `bson:"_id"` // Session ID
+	TenantID          string                 `bson:"tenant_id"`
+	WorkflowID        string                 `bson:"workflow_id"`
+	FlowVersion       uint64                 `bson:"flow_version,omitempty"`
+	Status            RunStatus              `bson:"status"`
+	TriggerKey        string                 `bson:"trigger_key"`
+	TriggerMetaOutput string                 `bson:"trigger_meta_output"`
+	TriggerPayload    map[string]interface{} `bson:"trigger_payload"`
+	Error             string                 `bson:"error,omitempty"`
+	StartedAt         time.Time              `bson:"started_at"`
+	EndedAt           *time.Time             `bson:"ended_at,omitempty"`
+	DeadlineAt        *time.Time             `bson:"deadline_at,omitempty"`
+}
+
+func (r *MDRun) ToRun() Run {
+	return Run{
+		SessionID:         r.ID,
+		TenantID:          r.TenantID,
+		WorkflowID:        r.WorkflowID,
+		FlowVersion:       r.FlowVersion,
+		Status:            r.Status,
+		TriggerKey:        r.TriggerKey,
+		TriggerMetaOutput: r.TriggerMetaOutput,
+		TriggerPayload:    r.TriggerPayload,
+		Error:             r.Error,
+		StartedAt:         r.StartedAt,
+		EndedAt:           r.EndedAt,
+		DeadlineAt:        r.DeadlineAt,
+	}
+}
+
+type MDRunStep struct {
+	ID          string                 `bson:"_id"` // Task ID
+	SessionID   string                 `bson:"session_id"`
+	TenantID    string                 `bson:"tenant_id"`
+	WorkflowID  string                 `bson:"workflow_id"`
+	Key         string                 `bson:"key"`
+	ActionID    string                 `bson:"action_id"`
+	Status      RunStepStatus          `bson:"status"`
+	Input       map[string]interface{} `bson:"input"`
+	Output      map[string]interface{} `bson:"output,omitempty"`
+	MetaOutput  string                 `bson:"meta_output,omitempty"`
+	Error       string                 `bson:"error,omitempty"`
+	Attempt     int                    `bson:"attempt"`
+	FlowVersion uint64                 `bson:"flow_version,omitempty"`
+	StartedAt   time.Time              `bson:"started_at"`
+	EndedAt     *time.Time             `bson:"ended_at,omitempty"`
+	DeadlineAt  *time.Time             `bson:"deadline_at,omitempty"`
+}
+
+func (s *MDRunStep) ToRunStep() RunStep {
+	return RunStep{
+		TaskID:      s.ID,
+		SessionID:   s.SessionID,
+		TenantID:    s.TenantID,
+		WorkflowID:  s.WorkflowID,
+		Key:         s.Key,
+		ActionID:    s.ActionID,
+		Status:      s.Status,
+		Input:       s.Input,
+		Output:      s.Output,
+		MetaOutput:  s.MetaOutput,
+		Error:       s.Error,
+		Attempt:     s.Attempt,
+		FlowVersion: s.FlowVersion,
+		StartedAt:   s.StartedAt,
+		EndedAt:     s.EndedAt,
+		DeadlineAt:  s.DeadlineAt,
+	}
+}
@@ -0,0 +1,156 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// SaveFlowSnapshot stores the snapshot of a flow version. Snapshots never
+// change, so when the version is already stored the existing one is kept.
+func (w *MongodDBWorkflowStorageAdapter) SaveFlowSnapshot(ctx context.Context, snapshot *FlowSnapshot) error {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return err
+	}
+
+	actions := make([]MDWorkflowAction, 0, len(snapshot.Actions))
+
+	for _, action := range snapshot.Actions {
+		actions = append(actions, MDWorkflowAction{
+			ID:         action.ID,
+			Key:        action.Key,
+			TenantID:   action.TenantID,
+			WorkflowID: action.WorkflowID,
+			ActionID:   action.ActionID,
+			Config:     action.Config,
+			Map:        action.Map,
+			Meta:       action.Meta,
+			Disabled:   action.Disabled,
+			Join:       action.Join,
+			Retry:      action.Retry,
+			Timeout:    action.Timeout,
+		})
+	}
+
+	deps := make([]MDFlowSnapshotDep, 0, len(snapshot.Deps))
+
+	for _, dep := range snapshot.Deps {
+		deps = append(deps, MDFlowSnapshotDep{
+			Key:        dep.Key,
+			MetaOutput: dep.MetaOutput,
+			DepKey:     dep.DepKey,
+		})
+	}
+
+	_, err = w.workflowFlowSnapshotCollection.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: snapshot.TenantID},
+			{Key: "workflow_id", Value: snapshot.WorkflowID},
+			{Key: "version", Value: snapshot.Version},
+		},
+		bson.D{
+			{Key: "$setOnInsert", Value: bson.D{
+				{Key: "_id", Value: id.String()},
+				{Key: "actions", Value: actions},
+				{Key: "deps", Value: deps},
+				{Key: "created_at", Value: snapshot.CreatedAt},
+			}},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *MongodDBWorkflowStorageAdapter) GetFlowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error) {
+
+	result := w.workflowFlowSnapshotCollection.FindOne(
+		ctx,
+		bson.D{
+			{Key: "tenant_id", Value: tenantID},
+			{Key: "workflow_id", Value: workflowID},
+			{Key: "version", Value: version},
+		},
+	)
+
+	err := result.Err()
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrFlowSnapshotNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var mdSnapshot MDFlowSnapshot
+
+	err = result.Decode(&mdSnapshot)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := FlowSnapshot{
+		TenantID:   mdSnapshot.TenantID,
+		WorkflowID: mdSnapshot.WorkflowID,
+		Version:    mdSnapshot.Version,
+		CreatedAt:  mdSnapshot.CreatedAt,
+	}
+
+	for _, wa := range mdSnapshot.Actions {
+		snapshot.Actions = append(snapshot.Actions, WorkflowAction{
+			ID:         wa.ID,
+			Key:        wa.Key,
+			TenantID:   wa.TenantID,
+			WorkflowID: wa.WorkflowID,
+			ActionID:   wa.ActionID,
+			Config:     wa.Config,
+			Map:        wa.Map,
+			Meta:       wa.Meta,
+			Disabled:   wa.Disabled,
+			Join:       wa.Join,
+			Retry:      wa.Retry,
+			Timeout:    wa.Timeout,
+		})
+	}
+
+	for _, dep := range mdSnapshot.Deps {
+		snapshot.Deps = append(snapshot.Deps, WorkflowActionDep{
+			Key:        dep.Key,
+			MetaOutput: dep.MetaOutput,
+			DepKey:     dep.DepKey,
+		})
+	}
+
+	return &snapshot, nil
+}
+
+type MDFlowSnapshot struct {
+	ID         string              `bson:"_id"`
+	TenantID   string              `bson:"tenant_id"`   // Composite unique index
+	WorkflowID string              `bson:"workflow_id"` // Composite unique index
+	Version    uint64              `bson:"version"`     // Composite unique index
+	Actions    []MDWorkflowAction  `bson:"actions"`
+	Deps       []MDFlowSnapshotDep `bson:"deps"`
+	CreatedAt  time.Time           `bson:"created_at"`
+}
+
+type MDFlowSnapshotDep struct {
+	Key        string `bson:"key"`
+	MetaOutput string `bson:"meta_output"`
+	DepKey     string `bson:"dep_key"`
+}
@@ -0,0 +1,65 @@
+package spider_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// TestMongoDBWorkflowStorageAdapter runs against SPIDER_TEST_MONGODB_URI,
+// which must be a replica set as the adapter uses transactions. Each
+// subtest gets a database of its own, dropped once it ends.
+func TestMongoDBWorkflowStorageAdapter(t *testing.T) {
+
+	uri := os.Getenv("SPIDER_TEST_MONGODB_URI")
+
+	if uri == "" {
+		t.Skip("SPIDER_TEST_MONGODB_URI is not set")
+	}
+
+	t.Setenv("MONGODB_URI", uri)
+
+	spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+
+		ctx := context.Background()
+
+		name := fmt.Sprintf("spider_test_%d", time.Now().UnixNano())
+
+		t.Setenv("MONGODB_DB_NAME", name)
+
+		t.Cleanup(func() {
+
+			client, err := mongo.Connect(options.Client().ApplyURI(uri))
+
+			if err != nil {
+				t.Errorf("mongo connect: %v", err)
+				return
+			}
+
+			defer client.Disconnect(ctx)
+
+			err = client.Database(name).Drop(ctx)
+
+			if err != nil {
+				t.Errorf("drop %s: %v", name, err)
+			}
+		})
+
+		storage, err := spider.InitMongodDBWorkflowStorageAdapter(ctx, spider.InitMongodDBWorkflowStorageAdapterOpt{
+			BetaAutoSetupSchema: true,
+		})
+
+		if err != nil {
+			t.Fatalf("InitMongodDBWorkflowStorageAdapter: %v", err)
+		}
+
+		return storage
+	})
+}
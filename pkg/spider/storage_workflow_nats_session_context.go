@@ -0,0 +1,621 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/targc/xnats-go"
+)
+
+// NATSSessionContextStorageAdapter keeps session contexts in a JetStream
+// KeyValue bucket and delegates everything else to the wrapped storage.
+// Contexts larger than the object threshold go to an Object Store bucket,
+// the KeyValue entry then only names the object. A context past the
+// retention of its flow reads as missing unless its step is still active,
+// and is removed by the retention sweep. The buckets have no TTL of their
+// own, it would drop the contexts of steps still running.
+type NATSSessionContextStorageAdapter struct {
+	WorkflowStorageAdapter
+	nc              *xnats.XNats
+	kv              jetstream.KeyValue
+	objects         jetstream.ObjectStore
+	objectThreshold int
+}
+
+var _ WorkflowStorageAdapter = &NATSSessionContextStorageAdapter{}
+
+type InitNATSSessionContextStorageAdapterOpt struct {
+	BetaAutoSetupNATS bool
+	// ObjectThreshold overrides NATS_SESSION_CONTEXT_OBJECT_THRESHOLD, the
+	// size in bytes above which a context is stored in the Object Store.
+	// Contexts all stay in the KeyValue bucket when both are 0.
+	ObjectThreshold int
+}
+
+func InitNATSSessionContextStorageAdapter(ctx context.Context, storage WorkflowStorageAdapter, opt InitNATSSessionContextStorageAdapterOpt) (*NATSSessionContextStorageAdapter, error) {
+	type Env struct {
+		NATSHost                          string `env:"NATS_HOST,required"`
+		NATSPort                          int    `env:"NATS_PORT,required"`
+		NATSUser                          string `env:"NATS_USER,required"`
+		NATSPassword                      string `env:"NATS_PASSWORD,required"`
+		NATSStreamPrefix                  string `env:"NATS_STREAM_PREFIX,required"`
+		NATSSessionContextObjectThreshold int    `env:"NATS_SESSION_CONTEXT_OBJECT_THRESHOLD,default=0"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nc, err := xnats.Connect(xnats.ConnectOpt{
+		Host:     env.NATSHost,
+		Port:     env.NATSPort,
+		User:     env.NATSUser,
+		Password: env.NATSPassword,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectThreshold := env.NATSSessionContextObjectThreshold
+
+	if opt.ObjectThreshold > 0 {
+		objectThreshold = opt.ObjectThreshold
+	}
+
+	bucket := buildSessionContextBucket(env.NATSStreamPrefix)
+
+	if opt.BetaAutoSetupNATS {
+
+		err = betaCreateSessionContextBuckets(ctx, nc.JS(), bucket, objectThreshold > 0)
+
+		if err != nil {
+			// return nil, err
+		}
+	}
+
+	kv, err := nc.JS().KeyValue(ctx, bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var objects jetstream.ObjectStore
+
+	if objectThreshold > 0 {
+		objects, err = nc.JS().ObjectStore(ctx, bucket)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a := NewNATSSessionContextStorageAdapter(storage, kv, objects, objectThreshold)
+	a.nc = nc
+
+	return a, nil
+}
+
+// NewNATSSessionContextStorageAdapter stores the session contexts of
+// storage in kv. objects may be nil to keep every context in kv.
+func NewNATSSessionContextStorageAdapter(storage WorkflowStorageAdapter, kv jetstream.KeyValue, objects jetstream.ObjectStore, objectThreshold int) *NATSSessionContextStorageAdapter {
+	return &NATSSessionContextStorageAdapter{
+		WorkflowStorageAdapter: storage,
+		kv:                     kv,
+		objects:                objects,
+		objectThreshold:        objectThreshold,
+	}
+}
+
+// natsSessionContext is the KeyValue entry of a session context, holding
+// either the context or the name of the object storing it.
+type natsSessionContext struct {
+	TenantID  string          `json:"tenant_id,omitempty"`
+	Size      int64           `json:"size,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Object    string          `json:"object,omitempty"`
+}
+
+func (w *NATSSessionContextStorageAdapter) GetSessionContext(ctx context.Context, workflowID, sessionID, taskID string) (map[string]map[string]interface{}, error) {
+
+	entry, err := w.kv.Get(ctx, buildSessionContextKey(workflowID, sessionID, taskID))
+
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var stored natsSessionContext
+
+	err = json.Unmarshal(entry.Value(), &stored)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.ExpiresAt != nil && !stored.ExpiresAt.After(time.Now()) {
+
+		active, err := w.stepActive(ctx, workflowID, sessionID, taskID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			return nil, ErrNotFound
+		}
+	}
+
+	valb := []byte(stored.Value)
+
+	if stored.Object != "" {
+
+		if w.objects == nil {
+			return nil, fmt.Errorf("session context stored in object %s, but no object store is configured", stored.Object)
+		}
+
+		valb, err = w.objects.GetBytes(ctx, stored.Object)
+
+		if errors.Is(err, jetstream.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var value map[string]map[string]interface{}
+
+	err = json.Unmarshal(valb, &value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (w *NATSSessionContextStorageAdapter) CreateSessionContext(ctx context.Context, sessionContext *SessionContext) error {
+
+	key := buildSessionContextKey(sessionContext.WorkflowID, sessionContext.SessionID, sessionContext.TaskID)
+
+	valb, err := json.Marshal(sessionContext.Value)
+
+	if err != nil {
+		return err
+	}
+
+	stored := natsSessionContext{
+		TenantID:  sessionContext.TenantID,
+		Size:      int64(len(valb)),
+		ExpiresAt: sessionContext.ExpiresAt,
+		Value:     valb,
+	}
+
+	if w.objects != nil && len(valb) > w.objectThreshold {
+
+		id, err := uuid.NewV7()
+
+		if err != nil {
+			return err
+		}
+
+		// writers racing for the same task each write their own object, so
+		// the loser cannot overwrite the context of the winner
+		stored = natsSessionContext{
+			TenantID:  sessionContext.TenantID,
+			Size:      int64(len(valb)),
+			ExpiresAt: sessionContext.ExpiresAt,
+			Object:    fmt.Sprintf("%s.%s", key, id.String()),
+		}
+
+		_, err = w.objects.PutBytes(ctx, stored.Object, valb)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	entryb, err := json.Marshal(stored)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.kv.Create(ctx, key, entryb)
+
+	if err == nil {
+		return nil
+	}
+
+	if stored.Object != "" {
+
+		derr := w.objects.Delete(ctx, stored.Object)
+
+		if derr != nil {
+			slog.Error("Delete session context object failed", slog.Any("error", derr.Error()))
+		}
+	}
+
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	}
+
+	return err
+}
+
+func (w *NATSSessionContextStorageAdapter) DeleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) error {
+
+	key := buildSessionContextKey(workflowID, sessionID, taskID)
+
+	entry, err := w.kv.Get(ctx, key)
+
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var stored natsSessionContext
+
+	err = json.Unmarshal(entry.Value(), &stored)
+
+	if err != nil {
+		return err
+	}
+
+	if stored.Object != "" && w.objects != nil {
+
+		err = w.objects.Delete(ctx, stored.Object)
+
+		if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	// purge rather than delete, so the bucket keeps no marker per task
+	err = w.kv.Purge(ctx, key)
+
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteFlow deletes the flow from the wrapped storage, then purges its
+// session contexts and their objects by key prefix.
+func (w *NATSSessionContextStorageAdapter) DeleteFlow(ctx context.Context, tenantID, flowID string) error {
+
+	err := w.WorkflowStorageAdapter.DeleteFlow(ctx, tenantID, flowID)
+
+	if err != nil {
+		return err
+	}
+
+	prefix := flowID + "."
+
+	lister, err := w.kv.ListKeysFiltered(ctx, prefix+">")
+
+	if err != nil && !errors.Is(err, jetstream.ErrNoKeysFound) {
+		return err
+	}
+
+	var keys []string
+
+	if lister != nil {
+
+		defer lister.Stop()
+
+		for key := range lister.Keys() {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+
+		err := w.kv.Purge(ctx, key)
+
+		if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	if w.objects == nil {
+		return nil
+	}
+
+	// objects are named after the key of their context, those a failed
+	// write left behind included
+	infos, err := w.objects.List(ctx)
+
+	if errors.Is(err, jetstream.ErrNoObjectsFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+
+		if !strings.HasPrefix(info.Name, prefix) {
+			continue
+		}
+
+		err := w.objects.Delete(ctx, info.Name)
+
+		if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stepActive reports whether the step of taskID is still running or waits
+// for a retry, its context is then kept past the retention of its flow.
+func (w *NATSSessionContextStorageAdapter) stepActive(ctx context.Context, workflowID, sessionID, taskID string) (bool, error) {
+
+	step, err := w.WorkflowStorageAdapter.GetRunStep(ctx, workflowID, sessionID, taskID)
+
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(activeRunStepStatuses, step.Status), nil
+}
+
+// DeleteExpiredSessionContexts reads every entry of the bucket to find the
+// expired ones, KeyValue has no index on the expiry.
+func (w *NATSSessionContextStorageAdapter) DeleteExpiredSessionContexts(ctx context.Context, now time.Time, limit int) (int64, error) {
+
+	lister, err := w.kv.ListKeys(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer lister.Stop()
+
+	var keys []string
+
+	for key := range lister.Keys() {
+		keys = append(keys, key)
+	}
+
+	var deleted int64
+
+	for _, key := range keys {
+
+		if deleted >= int64(limit) {
+			break
+		}
+
+		entry, err := w.kv.Get(ctx, key)
+
+		// deleted since it was listed
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return deleted, err
+		}
+
+		var stored natsSessionContext
+
+		err = json.Unmarshal(entry.Value(), &stored)
+
+		if err != nil {
+			return deleted, err
+		}
+
+		if stored.ExpiresAt == nil || stored.ExpiresAt.After(now) {
+			continue
+		}
+
+		workflowID, sessionID, taskID, ok := parseSessionContextKey(key)
+
+		if !ok {
+			continue
+		}
+
+		active, err := w.stepActive(ctx, workflowID, sessionID, taskID)
+
+		if err != nil {
+			return deleted, err
+		}
+
+		if active {
+			continue
+		}
+
+		if stored.Object != "" && w.objects != nil {
+
+			err = w.objects.Delete(ctx, stored.Object)
+
+			if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+				return deleted, err
+			}
+		}
+
+		// only purge the revision that was read, the task may have written
+		// a new context since
+		err = w.kv.Purge(ctx, key, jetstream.LastRevision(entry.Revision()))
+
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// ListSessionContextUsage reads every entry of the bucket, it is meant for
+// occasional admin use.
+func (w *NATSSessionContextStorageAdapter) ListSessionContextUsage(ctx context.Context) ([]SessionContextUsage, error) {
+
+	lister, err := w.kv.ListKeys(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer lister.Stop()
+
+	byTenant := map[string]*SessionContextUsage{}
+
+	for key := range lister.Keys() {
+
+		entry, err := w.kv.Get(ctx, key)
+
+		// expired or deleted since it was listed
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var stored natsSessionContext
+
+		err = json.Unmarshal(entry.Value(), &stored)
+
+		if err != nil {
+			return nil, err
+		}
+
+		usage, ok := byTenant[stored.TenantID]
+
+		if !ok {
+			usage = &SessionContextUsage{TenantID: stored.TenantID}
+			byTenant[stored.TenantID] = usage
+		}
+
+		usage.Contexts++
+		usage.Bytes += stored.Size
+	}
+
+	var usages []SessionContextUsage
+
+	for _, usage := range byTenant {
+		usages = append(usages, *usage)
+	}
+
+	// the joins stay in the wrapped storage
+	wrapped, err := w.WorkflowStorageAdapter.ListSessionContextUsage(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var joinUsages []SessionContextUsage
+
+	for _, usage := range wrapped {
+
+		if usage.Joins == 0 {
+			continue
+		}
+
+		joinUsages = append(joinUsages, SessionContextUsage{
+			TenantID:  usage.TenantID,
+			Joins:     usage.Joins,
+			JoinBytes: usage.JoinBytes,
+		})
+	}
+
+	return mergeSessionContextUsage(usages, joinUsages), nil
+}
+
+func (w *NATSSessionContextStorageAdapter) Close(ctx context.Context) error {
+
+	if w.nc != nil {
+		w.nc.Close()
+	}
+
+	return w.WorkflowStorageAdapter.Close(ctx)
+}
+
+func buildSessionContextBucket(prefix string) string {
+	return fmt.Sprintf("%s-session-contexts", prefix)
+}
+
+func buildSessionContextKey(workflowID, sessionID, taskID string) string {
+	return fmt.Sprintf("%s.%s.%s", workflowID, sessionID, taskID)
+}
+
+func parseSessionContextKey(key string) (workflowID, sessionID, taskID string, ok bool) {
+
+	parts := strings.SplitN(key, ".", 3)
+
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], parts[2], true
+}
+
+func betaCreateSessionContextBuckets(ctx context.Context, js jetstream.JetStream, bucket string, objects bool) error {
+
+	_, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:   bucket,
+		Storage:  jetstream.FileStorage,
+		Replicas: 1,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("nats key value bucket created", slog.String("bucket", bucket))
+
+	if !objects {
+		return nil
+	}
+
+	_, err = js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:   bucket,
+		Storage:  jetstream.FileStorage,
+		Replicas: 1,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("nats object store created", slog.String("bucket", bucket))
+
+	return nil
+}
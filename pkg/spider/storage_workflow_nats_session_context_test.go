@@ -0,0 +1,51 @@
+package spider_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+)
+
+func TestNATSSessionContextStorageAdapter(t *testing.T) {
+
+	port := startNATSServer(t)
+
+	for _, tt := range []struct {
+		name            string
+		objectThreshold int
+	}{
+		{name: "KeyValue"},
+		// every context of the suite is larger, so all go to the Object Store
+		{name: "ObjectStore", objectThreshold: 8},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+
+			spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+
+				t.Setenv("NATS_HOST", natsTestHost)
+				t.Setenv("NATS_PORT", strconv.Itoa(port))
+				t.Setenv("NATS_USER", natsTestUser)
+				t.Setenv("NATS_PASSWORD", natsTestPassword)
+				t.Setenv("NATS_STREAM_PREFIX", natsTestPrefix())
+
+				storage, err := spider.InitNATSSessionContextStorageAdapter(context.Background(), spider.NewMemoryWorkflowStorageAdapter(), spider.InitNATSSessionContextStorageAdapterOpt{
+					BetaAutoSetupNATS: true,
+					ObjectThreshold:   tt.objectThreshold,
+				})
+
+				if err != nil {
+					t.Fatalf("InitNATSSessionContextStorageAdapter: %v", err)
+				}
+
+				t.Cleanup(func() {
+					_ = storage.Close(context.Background())
+				})
+
+				return storage
+			})
+		})
+	}
+}
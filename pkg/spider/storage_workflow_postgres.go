@@ -0,0 +1,119 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/sethvargo/go-envconfig"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+var postgresDialect = func() *sqlDialect {
+
+	migrations, err := fs.Sub(postgresMigrations, "migrations/postgres")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &sqlDialect{
+		name: "postgres",
+		placeholder: func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		},
+		isUniqueViolation: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) && pgErr.Code == "23505"
+		},
+		// an arbitrary key shared by every replica running the migrations
+		lockMigrations: `SELECT pg_advisory_xact_lock(7244301)`,
+		migrations:     migrations,
+	}
+}()
+
+func openPostgres(ctx context.Context) (*sql.DB, error) {
+
+	type Env struct {
+		PostgresURI string `env:"POSTGRES_URI,required"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("pgx", env.PostgresURI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.PingContext(ctx)
+
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type InitPostgresWorkflowStorageAdapterOpt struct {
+	BetaAutoSetupSchema bool
+}
+
+func InitPostgresWorkflowStorageAdapter(ctx context.Context, opt InitPostgresWorkflowStorageAdapterOpt) (*SQLWorkflowStorageAdapter, error) {
+
+	db, err := openPostgres(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.BetaAutoSetupSchema {
+		err = migrateSQL(ctx, db, postgresDialect)
+
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	return NewPostgresWorkflowStorageAdapter(db), nil
+}
+
+func NewPostgresWorkflowStorageAdapter(db *sql.DB) *SQLWorkflowStorageAdapter {
+	return &SQLWorkflowStorageAdapter{
+		db:      db,
+		dialect: postgresDialect,
+	}
+}
+
+func InitPostgresWorkerStorageAdapter(ctx context.Context) (*SQLWorkerStorageAdapter, error) {
+
+	db, err := openPostgres(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPostgresWorkerStorageAdapter(db), nil
+}
+
+func NewPostgresWorkerStorageAdapter(db *sql.DB) *SQLWorkerStorageAdapter {
+	return &SQLWorkerStorageAdapter{
+		db:      db,
+		dialect: postgresDialect,
+	}
+}
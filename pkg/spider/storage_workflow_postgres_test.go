@@ -0,0 +1,84 @@
+package spider_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+)
+
+// TestPostgresWorkflowStorageAdapter runs against SPIDER_TEST_POSTGRES_DSN.
+// Each subtest migrates a schema of its own, dropped once it ends.
+func TestPostgresWorkflowStorageAdapter(t *testing.T) {
+
+	dsn := os.Getenv("SPIDER_TEST_POSTGRES_DSN")
+
+	if dsn == "" {
+		t.Skip("SPIDER_TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	db, err := sql.Open("pgx", dsn)
+
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+
+		schema := fmt.Sprintf("spider_test_%d", time.Now().UnixNano())
+
+		_, err := db.ExecContext(ctx, "CREATE SCHEMA "+schema)
+
+		if err != nil {
+			t.Fatalf("create schema %s: %v", schema, err)
+		}
+
+		t.Cleanup(func() {
+
+			_, err := db.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE")
+
+			if err != nil {
+				t.Errorf("drop schema %s: %v", schema, err)
+			}
+		})
+
+		t.Setenv("POSTGRES_URI", withSearchPath(dsn, schema))
+
+		storage, err := spider.InitPostgresWorkflowStorageAdapter(ctx, spider.InitPostgresWorkflowStorageAdapterOpt{
+			BetaAutoSetupSchema: true,
+		})
+
+		if err != nil {
+			t.Fatalf("InitPostgresWorkflowStorageAdapter: %v", err)
+		}
+
+		return storage
+	})
+}
+
+// withSearchPath sets the search_path of dsn, either a URL or key=value
+// pairs.
+func withSearchPath(dsn, schema string) string {
+
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+
+	return dsn + "?search_path=" + schema
+}
@@ -0,0 +1,918 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SQLWorkflowStorageAdapter stores the workflow state in a SQL database. It
+// behaves like MongodDBWorkflowStorageAdapter, and writes touching several
+// rows, such as an action and the version of its flow, run in a
+// transaction.
+type SQLWorkflowStorageAdapter struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+var _ WorkflowStorageAdapter = &SQLWorkflowStorageAdapter{}
+
+const sqlWorkflowActionColumns = `a.id, a.key, a.tenant_id, a.workflow_id, a.action_id, a.config, a.map, a.meta, a.disabled, a.join_policy, a.retry_policy, a.timeout`
+
+func scanSQLWorkflowAction(row sqlScanner) (*WorkflowAction, error) {
+
+	var (
+		wa          WorkflowAction
+		config      []byte
+		mapping     []byte
+		meta        []byte
+		joinPolicy  []byte
+		retryPolicy []byte
+	)
+
+	err := row.Scan(
+		&wa.ID,
+		&wa.Key,
+		&wa.TenantID,
+		&wa.WorkflowID,
+		&wa.ActionID,
+		&config,
+		&mapping,
+		&meta,
+		&wa.Disabled,
+		&joinPolicy,
+		&retryPolicy,
+		(*int64)(&wa.Timeout),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, column := range []struct {
+		b     []byte
+		value any
+	}{
+		{config, &wa.Config},
+		{mapping, &wa.Map},
+		{meta, &wa.Meta},
+		{joinPolicy, &wa.Join},
+		{retryPolicy, &wa.Retry},
+	} {
+		err = scanSQLJSON(column.b, column.value)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &wa, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) AddAction(ctx context.Context, req *AddActionRequest) (*WorkflowAction, error) {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return nil, err
+	}
+
+	wa := WorkflowAction{
+		ID:         id.String(),
+		Key:        req.Key,
+		TenantID:   req.TenantID,
+		WorkflowID: req.WorkflowID,
+		ActionID:   req.ActionID,
+		Config:     req.Config,
+		Map:        req.Map,
+		Meta:       req.Meta,
+		Disabled:   false,
+		Join:       req.Join,
+		Retry:      req.Retry,
+		Timeout:    req.Timeout,
+	}
+
+	args, err := sqlWorkflowActionArgs(&wa)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`INSERT INTO workflow_actions (id, key, tenant_id, workflow_id, action_id, config, map, meta, disabled, join_policy, retry_policy, timeout) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			args...,
+		)
+
+		if err != nil {
+			return w.dialect.sqlError(err)
+		}
+
+		return w.incrementFlowVersion(ctx, tx, req.TenantID, req.WorkflowID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &wa, nil
+}
+
+func sqlWorkflowActionArgs(wa *WorkflowAction) ([]any, error) {
+
+	args := []any{wa.ID, wa.Key, wa.TenantID, wa.WorkflowID, wa.ActionID}
+
+	for _, value := range []any{wa.Config, wa.Map, wa.Meta} {
+
+		column, err := sqlJSON(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, column)
+	}
+
+	args = append(args, wa.Disabled)
+
+	for _, value := range []any{wa.Join, wa.Retry} {
+
+		column, err := sqlJSON(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, column)
+	}
+
+	return append(args, int64(wa.Timeout)), nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		result, err := w.dialect.exec(
+			ctx,
+			tx,
+			`DELETE FROM workflow_actions WHERE tenant_id = ? AND workflow_id = ? AND key = ?`,
+			tenantID,
+			workflowID,
+			key,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return ErrNotFound
+		}
+
+		_, err = w.dialect.exec(
+			ctx,
+			tx,
+			`DELETE FROM workflow_action_deps WHERE workflow_id = ? AND (key = ? OR dep_key = ?)`,
+			workflowID,
+			key,
+			key,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		return w.incrementFlowVersion(ctx, tx, tenantID, workflowID)
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) AddDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return err
+	}
+
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`INSERT INTO workflow_action_deps (id, workflow_id, key, meta_output, dep_key) VALUES (?, ?, ?, ?, ?)`,
+			id.String(),
+			workflowID,
+			key,
+			metaOutput,
+			depKey,
+		)
+
+		if err != nil {
+			return w.dialect.sqlError(err)
+		}
+
+		return w.incrementFlowVersion(ctx, tx, tenantID, workflowID)
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) RemoveDep(
+	ctx context.Context,
+	tenantID,
+	workflowID,
+	key,
+	metaOutput,
+	depKey string,
+) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		result, err := w.dialect.exec(
+			ctx,
+			tx,
+			`DELETE FROM workflow_action_deps WHERE workflow_id = ? AND key = ? AND meta_output = ? AND dep_key = ?`,
+			workflowID,
+			key,
+			metaOutput,
+			depKey,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return ErrNotFound
+		}
+
+		return w.incrementFlowVersion(ctx, tx, tenantID, workflowID)
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) QueryWorkflowAction(ctx context.Context, tenantID, workflowID, key string) (*WorkflowAction, error) {
+
+	row := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT `+sqlWorkflowActionColumns+` FROM workflow_actions a WHERE a.tenant_id = ? AND a.workflow_id = ? AND a.key = ?`,
+		tenantID,
+		workflowID,
+		key,
+	)
+
+	wa, err := scanSQLWorkflowAction(row)
+
+	if err != nil {
+		return nil, w.dialect.sqlError(err)
+	}
+
+	return wa, nil
+}
+
+// QueryWorkflowActionDependencies skips dependencies on actions that do not
+// exist, as the MongoDB adapter does.
+func (w *SQLWorkflowStorageAdapter) QueryWorkflowActionDependencies(ctx context.Context, tenantID, workflowID, key, metaOutput string) ([]WorkflowAction, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlWorkflowActionColumns+` FROM workflow_action_deps d JOIN workflow_actions a ON a.workflow_id = d.workflow_id AND a.key = d.dep_key AND a.tenant_id = ? WHERE d.workflow_id = ? AND d.key = ? AND d.meta_output = ? ORDER BY d.id`,
+		tenantID,
+		workflowID,
+		key,
+		metaOutput,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var depActions []WorkflowAction
+
+	for rows.Next() {
+
+		wa, err := scanSQLWorkflowAction(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		depActions = append(depActions, *wa)
+	}
+
+	return depActions, rows.Err()
+}
+
+func (w *SQLWorkflowStorageAdapter) GetWorkflowActionDeps(ctx context.Context, tenantID, workflowID string) ([]WorkflowActionDep, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT key, meta_output, dep_key FROM workflow_action_deps WHERE workflow_id = ? ORDER BY id`,
+		workflowID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deps []WorkflowActionDep
+
+	for rows.Next() {
+
+		var dep WorkflowActionDep
+
+		err := rows.Scan(&dep.Key, &dep.MetaOutput, &dep.DepKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deps = append(deps, dep)
+	}
+
+	return deps, rows.Err()
+}
+
+func (w *SQLWorkflowStorageAdapter) GetSessionContext(ctx context.Context, workflowID, sessionID, taskID string) (map[string]map[string]interface{}, error) {
+
+	var b []byte
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT value FROM workflow_session_contexts WHERE workflow_id = ? AND session_id = ? AND task_id = ?`,
+		workflowID,
+		sessionID,
+		taskID,
+	).Scan(&b)
+
+	if err != nil {
+		return nil, w.dialect.sqlError(err)
+	}
+
+	var value map[string]map[string]interface{}
+
+	err = scanSQLJSON(b, &value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) CreateSessionContext(ctx context.Context, sessionContext *SessionContext) error {
+
+	column, err := sqlJSON(sessionContext.Value)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`INSERT INTO workflow_session_contexts (workflow_id, session_id, task_id, value, tenant_id, size, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionContext.WorkflowID,
+		sessionContext.SessionID,
+		sessionContext.TaskID,
+		column,
+		sessionContext.TenantID,
+		len(column),
+		sessionContext.CreatedAt,
+		sessionContext.ExpiresAt,
+	)
+
+	if err != nil {
+		return w.dialect.sqlError(err)
+	}
+
+	return nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) error {
+
+	_, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`DELETE FROM workflow_session_contexts WHERE workflow_id = ? AND session_id = ? AND task_id = ?`,
+		workflowID,
+		sessionID,
+		taskID,
+	)
+
+	return err
+}
+
+// DeleteExpiredSessionContexts keeps the contexts of the steps still running
+// or waiting for a retry, whatever their expiry.
+func (w *SQLWorkflowStorageAdapter) DeleteExpiredSessionContexts(ctx context.Context, now time.Time, limit int) (int64, error) {
+
+	args := []any{now}
+	args = append(args, sqlArgs(activeRunStepStatuses)...)
+	args = append(args, limit)
+
+	result, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`DELETE FROM workflow_session_contexts WHERE (workflow_id, session_id, task_id) IN (SELECT c.workflow_id, c.session_id, c.task_id FROM workflow_session_contexts c WHERE c.expires_at <= ? AND NOT EXISTS (SELECT 1 FROM workflow_run_steps s WHERE s.task_id = c.task_id AND s.workflow_id = c.workflow_id AND s.session_id = c.session_id AND s.status IN `+sqlIn(len(activeRunStepStatuses))+`) LIMIT ?)`,
+		args...,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (w *SQLWorkflowStorageAdapter) ListSessionContextUsage(ctx context.Context) ([]SessionContextUsage, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT tenant_id, COUNT(*), COALESCE(SUM(size), 0) FROM workflow_session_contexts GROUP BY tenant_id ORDER BY tenant_id`,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	usages := []SessionContextUsage{}
+
+	for rows.Next() {
+
+		var usage SessionContextUsage
+
+		err := rows.Scan(&usage.TenantID, &usage.Contexts, &usage.Bytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, usage)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	joinRows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT j.tenant_id, COUNT(*), COALESCE(SUM(a.size), 0) FROM workflow_session_joins j LEFT JOIN (SELECT workflow_id, session_id, key, SUM(size) AS size FROM workflow_session_join_arrivals GROUP BY workflow_id, session_id, key) a ON a.workflow_id = j.workflow_id AND a.session_id = j.session_id AND a.key = j.key GROUP BY j.tenant_id`,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer joinRows.Close()
+
+	var joinUsages []SessionContextUsage
+
+	for joinRows.Next() {
+
+		var usage SessionContextUsage
+
+		err := joinRows.Scan(&usage.TenantID, &usage.Joins, &usage.JoinBytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		joinUsages = append(joinUsages, usage)
+	}
+
+	err = joinRows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSessionContextUsage(usages, joinUsages), nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DisableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`UPDATE workflow_actions SET disabled = ? WHERE tenant_id = ? AND workflow_id = ? AND key = ?`,
+			true,
+			tenantID,
+			workflowID,
+			key,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		return w.incrementFlowVersion(ctx, tx, tenantID, workflowID)
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) EnableWorkflowAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`UPDATE workflow_actions SET disabled = ? WHERE tenant_id = ? AND workflow_id = ? AND key = ?`,
+			false,
+			tenantID,
+			workflowID,
+			key,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		return w.incrementFlowVersion(ctx, tx, tenantID, workflowID)
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) ListFlows(ctx context.Context, tenantID string, page, pageSize int) (*FlowListResponse, error) {
+
+	skip := (page - 1) * pageSize
+
+	var total int64
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT COUNT(*) FROM workflows WHERE tenant_id = ?`,
+		tenantID,
+	).Scan(&total)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlFlowColumns+` FROM workflows WHERE tenant_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`,
+		tenantID,
+		pageSize,
+		skip,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var workflows []WorkflowInfo
+
+	for rows.Next() {
+
+		flow, err := scanSQLFlow(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		workflows = append(workflows, WorkflowInfo{
+			ID:          flow.ID,
+			TenantID:    flow.TenantID,
+			Name:        flow.Name,
+			TriggerType: flow.TriggerType,
+			Status:      flow.Status,
+			Version:     flow.Version,
+			Meta:        flow.Meta,
+		})
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlowListResponse{
+		Flows:    workflows,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetWorkflowActions(ctx context.Context, tenantID, workflowID string) ([]WorkflowAction, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlWorkflowActionColumns+` FROM workflow_actions a WHERE a.tenant_id = ? AND a.workflow_id = ? ORDER BY a.id`,
+		tenantID,
+		workflowID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var actions []WorkflowAction
+
+	for rows.Next() {
+
+		wa, err := scanSQLWorkflowAction(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		actions = append(actions, *wa)
+	}
+
+	return actions, rows.Err()
+}
+
+func (w *SQLWorkflowStorageAdapter) UpdateAction(ctx context.Context, req *UpdateActionRequest) (*WorkflowAction, error) {
+
+	var columns []any
+
+	for _, value := range []any{req.Config, req.Map, req.Meta, req.Join, req.Retry} {
+
+		column, err := sqlJSON(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, column)
+	}
+
+	var wa *WorkflowAction
+
+	err := withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		result, err := w.dialect.exec(
+			ctx,
+			tx,
+			`UPDATE workflow_actions SET config = ?, map = ?, meta = ?, join_policy = ?, retry_policy = ?, timeout = ? WHERE tenant_id = ? AND workflow_id = ? AND key = ?`,
+			append(columns, int64(req.Timeout), req.TenantID, req.WorkflowID, req.Key)...,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if updated == 0 {
+			return ErrNotFound
+		}
+
+		wa, err = scanSQLWorkflowAction(w.dialect.queryRow(
+			ctx,
+			tx,
+			`SELECT `+sqlWorkflowActionColumns+` FROM workflow_actions a WHERE a.tenant_id = ? AND a.workflow_id = ? AND a.key = ?`,
+			req.TenantID,
+			req.WorkflowID,
+			req.Key,
+		))
+
+		if err != nil {
+			return err
+		}
+
+		return w.incrementFlowVersion(ctx, tx, req.TenantID, req.WorkflowID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wa, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteFlow(ctx context.Context, tenantID, flowID string) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		// the rows keyed by workflow_id alone must not be deleted for a flow
+		// of another tenant
+		result, err := w.dialect.exec(ctx, tx, `DELETE FROM workflows WHERE id = ? AND tenant_id = ?`, flowID, tenantID)
+
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return ErrNotFound
+		}
+
+		for _, query := range []struct {
+			query string
+			args  []any
+		}{
+			{`DELETE FROM workflow_actions WHERE tenant_id = ? AND workflow_id = ?`, []any{tenantID, flowID}},
+			{`DELETE FROM workflow_action_deps WHERE workflow_id = ?`, []any{flowID}},
+			{`DELETE FROM workflow_session_contexts WHERE workflow_id = ?`, []any{flowID}},
+			{`DELETE FROM workflow_session_joins WHERE workflow_id = ?`, []any{flowID}},
+			{`DELETE FROM workflow_session_join_arrivals WHERE workflow_id = ?`, []any{flowID}},
+			{`DELETE FROM workflow_scheduled_retries WHERE tenant_id = ? AND workflow_id = ?`, []any{tenantID, flowID}},
+			{`DELETE FROM workflow_flow_snapshots WHERE tenant_id = ? AND workflow_id = ?`, []any{tenantID, flowID}},
+			{`DELETE FROM workflow_runs WHERE tenant_id = ? AND workflow_id = ?`, []any{tenantID, flowID}},
+			{`DELETE FROM workflow_run_steps WHERE tenant_id = ? AND workflow_id = ?`, []any{tenantID, flowID}},
+		} {
+			_, err := w.dialect.exec(ctx, tx, query.query, query.args...)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+const sqlFlowColumns = `id, tenant_id, name, trigger_type, meta, status, version, deadline, retention`
+
+func scanSQLFlow(row sqlScanner) (*Flow, error) {
+
+	var (
+		flow Flow
+		meta []byte
+	)
+
+	err := row.Scan(
+		&flow.ID,
+		&flow.TenantID,
+		&flow.Name,
+		&flow.TriggerType,
+		&meta,
+		&flow.Status,
+		&flow.Version,
+		(*int64)(&flow.Deadline),
+		(*int64)(&flow.Retention),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(meta, &flow.Meta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &flow, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) CreateFlow(ctx context.Context, req *CreateFlowRequest) (*Flow, error) {
+
+	flow := Flow{
+		ID:          req.ID,
+		Version:     1,
+		Name:        req.Name,
+		TenantID:    req.TenantID,
+		TriggerType: req.TriggerType,
+		Meta:        req.Meta,
+		Status:      FlowStatusDraft,
+		Deadline:    req.Deadline,
+		Retention:   req.Retention,
+	}
+
+	meta, err := sqlJSON(flow.Meta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`INSERT INTO workflows (`+sqlFlowColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			flow.ID,
+			flow.TenantID,
+			flow.Name,
+			flow.TriggerType,
+			meta,
+			flow.Status,
+			flow.Version,
+			int64(flow.Deadline),
+			int64(flow.Retention),
+		)
+
+		return w.dialect.sqlError(err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &flow, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetFlow(ctx context.Context, tenantID, flowID string) (*Flow, error) {
+
+	row := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT `+sqlFlowColumns+` FROM workflows WHERE id = ? AND tenant_id = ?`,
+		flowID,
+		tenantID,
+	)
+
+	flow, err := scanSQLFlow(row)
+
+	if err != nil {
+		return nil, w.dialect.sqlError(err)
+	}
+
+	return flow, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) UpdateFlow(ctx context.Context, req *UpdateFlowRequest) (*Flow, error) {
+
+	meta, err := sqlJSON(req.Meta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`UPDATE workflows SET name = ?, trigger_type = ?, meta = ?, status = ?, deadline = ?, retention = ? WHERE id = ? AND tenant_id = ?`,
+		req.Name,
+		req.TriggerType,
+		meta,
+		req.Status,
+		int64(req.Deadline),
+		int64(req.Retention),
+		req.FlowID,
+		req.TenantID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w.GetFlow(ctx, req.TenantID, req.FlowID)
+}
+
+func (w *SQLWorkflowStorageAdapter) incrementFlowVersion(ctx context.Context, tx *sql.Tx, tenantID, workflowID string) error {
+	_, err := w.dialect.exec(
+		ctx,
+		tx,
+		`UPDATE workflows SET version = version + 1 WHERE id = ? AND tenant_id = ?`,
+		workflowID,
+		tenantID,
+	)
+	return err
+}
+
+func (w *SQLWorkflowStorageAdapter) Close(ctx context.Context) error {
+	return w.db.Close()
+}
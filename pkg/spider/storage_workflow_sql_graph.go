@@ -0,0 +1,231 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+func (w *SQLWorkflowStorageAdapter) SaveFlowGraph(ctx context.Context, req *SaveFlowGraphRequest) (*Flow, error) {
+
+	meta, err := sqlJSON(req.Flow.Meta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var flow *Flow
+
+	err = withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		current, err := scanSQLFlow(w.dialect.queryRow(
+			ctx,
+			tx,
+			`SELECT `+sqlFlowColumns+` FROM workflows WHERE id = ?`,
+			req.Flow.ID,
+		))
+
+		exists := true
+
+		if errors.Is(err, sql.ErrNoRows) {
+			exists = false
+		} else if err != nil {
+			return err
+		}
+
+		// flow IDs are unique across tenants
+		if exists && current.TenantID != req.Flow.TenantID {
+			return ErrAlreadyExists
+		}
+
+		flow = &Flow{
+			ID:          req.Flow.ID,
+			Version:     1,
+			Name:        req.Flow.Name,
+			TenantID:    req.Flow.TenantID,
+			TriggerType: req.Flow.TriggerType,
+			Meta:        req.Flow.Meta,
+			Status:      FlowStatusDraft,
+			Deadline:    req.Flow.Deadline,
+			Retention:   req.Flow.Retention,
+		}
+
+		actionIDs := map[string]string{}
+
+		if exists {
+
+			flow.Version = current.Version + 1
+			flow.Status = current.Status
+
+			_, err = w.dialect.exec(
+				ctx,
+				tx,
+				`UPDATE workflows SET name = ?, trigger_type = ?, meta = ?, version = ?, deadline = ?, retention = ? WHERE id = ?`,
+				flow.Name,
+				flow.TriggerType,
+				meta,
+				flow.Version,
+				int64(flow.Deadline),
+				int64(flow.Retention),
+				flow.ID,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			actionIDs, err = w.actionIDs(ctx, tx, flow.TenantID, flow.ID)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.dialect.exec(ctx, tx, `DELETE FROM workflow_actions WHERE tenant_id = ? AND workflow_id = ?`, flow.TenantID, flow.ID)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.dialect.exec(ctx, tx, `DELETE FROM workflow_action_deps WHERE workflow_id = ?`, flow.ID)
+
+			if err != nil {
+				return err
+			}
+		} else {
+
+			_, err = w.dialect.exec(
+				ctx,
+				tx,
+				`INSERT INTO workflows (`+sqlFlowColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				flow.ID,
+				flow.TenantID,
+				flow.Name,
+				flow.TriggerType,
+				meta,
+				flow.Status,
+				flow.Version,
+				int64(flow.Deadline),
+				int64(flow.Retention),
+			)
+
+			if err != nil {
+				return w.dialect.sqlError(err)
+			}
+		}
+
+		for _, action := range req.Actions {
+
+			id, ok := actionIDs[action.Key]
+
+			if !ok {
+
+				newID, err := uuid.NewV7()
+
+				if err != nil {
+					return err
+				}
+
+				id = newID.String()
+			}
+
+			args, err := sqlWorkflowActionArgs(&WorkflowAction{
+				ID:         id,
+				Key:        action.Key,
+				TenantID:   flow.TenantID,
+				WorkflowID: flow.ID,
+				ActionID:   action.ActionID,
+				Config:     action.Config,
+				Map:        action.Map,
+				Meta:       action.Meta,
+				Disabled:   false,
+				Join:       action.Join,
+				Retry:      action.Retry,
+				Timeout:    action.Timeout,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.dialect.exec(
+				ctx,
+				tx,
+				`INSERT INTO workflow_actions (id, key, tenant_id, workflow_id, action_id, config, map, meta, disabled, join_policy, retry_policy, timeout) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				args...,
+			)
+
+			if err != nil {
+				return w.dialect.sqlError(err)
+			}
+		}
+
+		for _, dep := range req.Deps {
+
+			id, err := uuid.NewV7()
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.dialect.exec(
+				ctx,
+				tx,
+				`INSERT INTO workflow_action_deps (id, workflow_id, key, meta_output, dep_key) VALUES (?, ?, ?, ?, ?)`,
+				id.String(),
+				flow.ID,
+				dep.Key,
+				dep.MetaOutput,
+				dep.DepKey,
+			)
+
+			if err != nil {
+				return w.dialect.sqlError(err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return flow, nil
+}
+
+// actionIDs returns the IDs of the actions of a flow by key.
+func (w *SQLWorkflowStorageAdapter) actionIDs(ctx context.Context, tx *sql.Tx, tenantID, workflowID string) (map[string]string, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		tx,
+		`SELECT key, id FROM workflow_actions WHERE tenant_id = ? AND workflow_id = ?`,
+		tenantID,
+		workflowID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := map[string]string{}
+
+	for rows.Next() {
+
+		var key, id string
+
+		err := rows.Scan(&key, &id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids[key] = id
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,263 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (w *SQLWorkflowStorageAdapter) AddJoinArrival(ctx context.Context, req *AddJoinArrivalRequest) (*JoinState, error) {
+
+	column, err := sqlJSON(req.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var state JoinState
+
+	err = withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`INSERT INTO workflow_session_joins (workflow_id, session_id, key, tenant_id, dispatched, expires_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+			req.WorkflowID,
+			req.SessionID,
+			req.Key,
+			req.TenantID,
+			false,
+			req.ExpiresAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		// a parent only counts once, redelivered outputs must not fill the join
+		_, err = w.dialect.exec(
+			ctx,
+			tx,
+			`INSERT INTO workflow_session_join_arrivals (workflow_id, session_id, key, parent_key, value, size, arrived_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+			req.WorkflowID,
+			req.SessionID,
+			req.Key,
+			req.ParentKey,
+			column,
+			len(column),
+			time.Now(),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		err = w.dialect.queryRow(
+			ctx,
+			tx,
+			`SELECT dispatched, dispatched_by FROM workflow_session_joins WHERE workflow_id = ? AND session_id = ? AND key = ?`,
+			req.WorkflowID,
+			req.SessionID,
+			req.Key,
+		).Scan(&state.Dispatched, &state.DispatchedBy)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := w.dialect.query(
+			ctx,
+			tx,
+			`SELECT parent_key, value, arrived_at FROM workflow_session_join_arrivals WHERE workflow_id = ? AND session_id = ? AND key = ? ORDER BY seq`,
+			req.WorkflowID,
+			req.SessionID,
+			req.Key,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+
+			var (
+				arrival JoinArrival
+				b       []byte
+			)
+
+			err := rows.Scan(&arrival.ParentKey, &b, &arrival.ArrivedAt)
+
+			if err != nil {
+				return err
+			}
+
+			err = scanSQLJSON(b, &arrival.Value)
+
+			if err != nil {
+				return err
+			}
+
+			state.Arrivals = append(state.Arrivals, arrival)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) ClaimJoin(ctx context.Context, workflowID, sessionID, key, parentKey string) (bool, error) {
+
+	result, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`UPDATE workflow_session_joins SET dispatched = ?, dispatched_by = ? WHERE workflow_id = ? AND session_id = ? AND key = ? AND (dispatched = ? OR dispatched_by = ?)`,
+		true,
+		parentKey,
+		workflowID,
+		sessionID,
+		key,
+		false,
+		parentKey,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteSessionJoins(ctx context.Context, workflowID, sessionID string) error {
+	return withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		_, err := w.dialect.exec(
+			ctx,
+			tx,
+			`DELETE FROM workflow_session_join_arrivals WHERE workflow_id = ? AND session_id = ?`,
+			workflowID,
+			sessionID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = w.dialect.exec(
+			ctx,
+			tx,
+			`DELETE FROM workflow_session_joins WHERE workflow_id = ? AND session_id = ?`,
+			workflowID,
+			sessionID,
+		)
+
+		return err
+	})
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteExpiredJoins(ctx context.Context, now time.Time, limit int) (int64, error) {
+
+	// the run may still dispatch the join
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT j.workflow_id, j.session_id, j.key FROM workflow_session_joins j WHERE j.expires_at <= ? AND NOT EXISTS (SELECT 1 FROM workflow_runs r WHERE r.session_id = j.session_id AND r.workflow_id = j.workflow_id AND r.status = ?) LIMIT ?`,
+		now,
+		RunStatusRunning,
+		limit,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var keys []sqlJoinKey
+
+	for rows.Next() {
+
+		var key sqlJoinKey
+
+		err := rows.Scan(&key.WorkflowID, &key.SessionID, &key.Key)
+
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	err = rows.Err()
+
+	rows.Close()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+
+	err = withSQLTx(ctx, w.db, func(tx *sql.Tx) error {
+
+		deleted = 0
+
+		for _, key := range keys {
+
+			_, err := w.dialect.exec(
+				ctx,
+				tx,
+				`DELETE FROM workflow_session_join_arrivals WHERE workflow_id = ? AND session_id = ? AND key = ?`,
+				key.WorkflowID,
+				key.SessionID,
+				key.Key,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			result, err := w.dialect.exec(
+				ctx,
+				tx,
+				`DELETE FROM workflow_session_joins WHERE workflow_id = ? AND session_id = ? AND key = ?`,
+				key.WorkflowID,
+				key.SessionID,
+				key.Key,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			n, err := result.RowsAffected()
+
+			if err != nil {
+				return err
+			}
+
+			deleted += n
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+type sqlJoinKey struct {
+	WorkflowID string
+	SessionID  string
+	Key        string
+}
@@ -0,0 +1,145 @@
+package spider
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (w *SQLWorkflowStorageAdapter) ScheduleRetry(ctx context.Context, retry *ScheduledRetry) error {
+
+	id, err := uuid.NewV7()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`INSERT INTO workflow_scheduled_retries (id, tenant_id, workflow_id, session_id, task_id, key, action_id, input_values, attempt, flow_version, timeout, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(),
+		retry.TenantID,
+		retry.WorkflowID,
+		retry.SessionID,
+		retry.TaskID,
+		retry.Key,
+		retry.ActionID,
+		retry.Values,
+		retry.Attempt,
+		retry.FlowVersion,
+		int64(retry.Timeout),
+		retry.DueAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	retry.ID = id.String()
+
+	return nil
+}
+
+func (w *SQLWorkflowStorageAdapter) ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledRetry, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT id, tenant_id, workflow_id, session_id, task_id, key, action_id, input_values, attempt, flow_version, timeout, due_at FROM workflow_scheduled_retries WHERE due_at <= ? ORDER BY due_at LIMIT ?`,
+		now,
+		limit,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []ScheduledRetry
+
+	for rows.Next() {
+
+		var retry ScheduledRetry
+
+		err := rows.Scan(
+			&retry.ID,
+			&retry.TenantID,
+			&retry.WorkflowID,
+			&retry.SessionID,
+			&retry.TaskID,
+			&retry.Key,
+			&retry.ActionID,
+			&retry.Values,
+			&retry.Attempt,
+			&retry.FlowVersion,
+			(*int64)(&retry.Timeout),
+			&retry.DueAt,
+		)
+
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		candidates = append(candidates, retry)
+	}
+
+	err = rows.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var retries []ScheduledRetry
+
+	for _, retry := range candidates {
+
+		// another workflow replica may claim the same retry, whoever
+		// moves it owns its lease
+		result, err := w.dialect.exec(
+			ctx,
+			w.db,
+			`UPDATE workflow_scheduled_retries SET due_at = ? WHERE id = ? AND due_at <= ?`,
+			now.Add(lease),
+			retry.ID,
+			now,
+		)
+
+		if err != nil {
+			return retries, err
+		}
+
+		claimed, err := result.RowsAffected()
+
+		if err != nil {
+			return retries, err
+		}
+
+		if claimed == 0 {
+			continue
+		}
+
+		retries = append(retries, retry)
+	}
+
+	return retries, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) DeleteRetry(ctx context.Context, id string) error {
+
+	_, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`DELETE FROM workflow_scheduled_retries WHERE id = ?`,
+		id,
+	)
+
+	return err
+}
@@ -0,0 +1,555 @@
+package spider
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const sqlRunColumns = `session_id, tenant_id, workflow_id, flow_version, status, trigger_key, trigger_meta_output, trigger_payload, error, started_at, ended_at, deadline_at`
+
+func scanSQLRun(row sqlScanner) (*Run, error) {
+
+	var (
+		run            Run
+		triggerPayload []byte
+	)
+
+	err := row.Scan(
+		&run.SessionID,
+		&run.TenantID,
+		&run.WorkflowID,
+		&run.FlowVersion,
+		&run.Status,
+		&run.TriggerKey,
+		&run.TriggerMetaOutput,
+		&triggerPayload,
+		&run.Error,
+		&run.StartedAt,
+		&run.EndedAt,
+		&run.DeadlineAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(triggerPayload, &run.TriggerPayload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+const sqlRunStepColumns = `task_id, session_id, tenant_id, workflow_id, key, action_id, status, input, output, meta_output, error, attempt, flow_version, started_at, ended_at, deadline_at`
+
+func scanSQLRunStep(row sqlScanner) (*RunStep, error) {
+
+	var (
+		step   RunStep
+		input  []byte
+		output []byte
+	)
+
+	err := row.Scan(
+		&step.TaskID,
+		&step.SessionID,
+		&step.TenantID,
+		&step.WorkflowID,
+		&step.Key,
+		&step.ActionID,
+		&step.Status,
+		&input,
+		&output,
+		&step.MetaOutput,
+		&step.Error,
+		&step.Attempt,
+		&step.FlowVersion,
+		&step.StartedAt,
+		&step.EndedAt,
+		&step.DeadlineAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(input, &step.Input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(output, &step.Output)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &step, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) CreateRun(ctx context.Context, run *Run) error {
+
+	triggerPayload, err := sqlJSON(run.TriggerPayload)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`INSERT INTO workflow_runs (`+sqlRunColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.SessionID,
+		run.TenantID,
+		run.WorkflowID,
+		run.FlowVersion,
+		run.Status,
+		run.TriggerKey,
+		run.TriggerMetaOutput,
+		triggerPayload,
+		run.Error,
+		run.StartedAt,
+		run.EndedAt,
+		run.DeadlineAt,
+	)
+
+	if err != nil {
+		return w.dialect.sqlError(err)
+	}
+
+	return nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetRun(ctx context.Context, tenantID, workflowID, sessionID string) (*Run, error) {
+
+	row := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunColumns+` FROM workflow_runs WHERE session_id = ? AND tenant_id = ? AND workflow_id = ?`,
+		sessionID,
+		tenantID,
+		workflowID,
+	)
+
+	run, err := scanSQLRun(row)
+
+	if err != nil {
+		return nil, w.dialect.sqlError(err)
+	}
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunStepColumns+` FROM workflow_run_steps WHERE workflow_id = ? AND session_id = ? ORDER BY started_at, task_id`,
+		workflowID,
+		sessionID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		step, err := scanSQLRunStep(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		run.Steps = append(run.Steps, *step)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetRunStatus(ctx context.Context, workflowID, sessionID string) (RunStatus, error) {
+
+	var status RunStatus
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT status FROM workflow_runs WHERE session_id = ? AND workflow_id = ?`,
+		sessionID,
+		workflowID,
+	).Scan(&status)
+
+	if err != nil {
+		return "", w.dialect.sqlError(err)
+	}
+
+	return status, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) ListRuns(ctx context.Context, req *ListRunsRequest) (*RunListResponse, error) {
+
+	skip := (req.Page - 1) * req.PageSize
+
+	where := []string{"tenant_id = ?", "workflow_id = ?"}
+	args := []any{req.TenantID, req.WorkflowID}
+
+	if req.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, req.Status)
+	}
+
+	if req.From != nil {
+		where = append(where, "started_at >= ?")
+		args = append(args, *req.From)
+	}
+
+	if req.To != nil {
+		where = append(where, "started_at < ?")
+		args = append(args, *req.To)
+	}
+
+	filter := strings.Join(where, " AND ")
+
+	var total int64
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT COUNT(*) FROM workflow_runs WHERE `+filter,
+		args...,
+	).Scan(&total)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunColumns+` FROM workflow_runs WHERE `+filter+` ORDER BY started_at DESC LIMIT ? OFFSET ?`,
+		append(args, req.PageSize, skip)...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	runs := []Run{}
+
+	for rows.Next() {
+
+		run, err := scanSQLRun(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, *run)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunListResponse{
+		Runs:     runs,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) UpdateRunStatus(ctx context.Context, workflowID, sessionID string, req *UpdateRunStatusRequest) (bool, error) {
+
+	if len(req.From) == 0 {
+		return false, nil
+	}
+
+	set := []string{"status = ?"}
+	args := []any{req.To}
+
+	if req.Error != "" {
+		set = append(set, "error = ?")
+		args = append(args, req.Error)
+	}
+
+	if req.EndedAt != nil {
+		set = append(set, "ended_at = ?")
+		args = append(args, *req.EndedAt)
+	}
+
+	if req.DeadlineAt != nil {
+		set = append(set, "deadline_at = ?")
+		args = append(args, *req.DeadlineAt)
+	}
+
+	if req.FlowVersion > 0 {
+		set = append(set, "flow_version = ?")
+		args = append(args, req.FlowVersion)
+	}
+
+	args = append(args, sessionID, workflowID)
+	args = append(args, sqlArgs(req.From)...)
+
+	result, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`UPDATE workflow_runs SET `+strings.Join(set, ", ")+` WHERE session_id = ? AND workflow_id = ? AND status IN `+sqlIn(len(req.From)),
+		args...,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) AddRunStep(ctx context.Context, step *RunStep) error {
+
+	input, err := sqlJSON(step.Input)
+
+	if err != nil {
+		return err
+	}
+
+	output, err := sqlJSON(step.Output)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`INSERT INTO workflow_run_steps (`+sqlRunStepColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		step.TaskID,
+		step.SessionID,
+		step.TenantID,
+		step.WorkflowID,
+		step.Key,
+		step.ActionID,
+		step.Status,
+		input,
+		output,
+		step.MetaOutput,
+		step.Error,
+		step.Attempt,
+		step.FlowVersion,
+		step.StartedAt,
+		step.EndedAt,
+		step.DeadlineAt,
+	)
+
+	if err != nil {
+		return w.dialect.sqlError(err)
+	}
+
+	return nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetRunStep(ctx context.Context, workflowID, sessionID, taskID string) (*RunStep, error) {
+
+	row := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunStepColumns+` FROM workflow_run_steps WHERE task_id = ? AND workflow_id = ? AND session_id = ?`,
+		taskID,
+		workflowID,
+		sessionID,
+	)
+
+	step, err := scanSQLRunStep(row)
+
+	if err != nil {
+		return nil, w.dialect.sqlError(err)
+	}
+
+	return step, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) FinishRunStep(ctx context.Context, workflowID, sessionID, taskID string, req *FinishRunStepRequest) (bool, error) {
+
+	output, err := sqlJSON(req.Output)
+
+	if err != nil {
+		return false, err
+	}
+
+	args := []any{req.Status, req.MetaOutput, output, req.Error, req.EndedAt, taskID, workflowID, sessionID}
+	args = append(args, sqlArgs(activeRunStepStatuses)...)
+
+	result, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`UPDATE workflow_run_steps SET status = ?, meta_output = ?, output = ?, error = ?, ended_at = ? WHERE task_id = ? AND workflow_id = ? AND session_id = ? AND status IN `+sqlIn(len(activeRunStepStatuses)),
+		args...,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) UpdateRunStepStatus(ctx context.Context, workflowID, sessionID, taskID string, req *UpdateRunStepStatusRequest) (bool, error) {
+
+	if len(req.From) == 0 {
+		return false, nil
+	}
+
+	set := []string{"status = ?"}
+	args := []any{req.To}
+
+	if req.Attempt > 0 {
+		set = append(set, "attempt = ?")
+		args = append(args, req.Attempt)
+	}
+
+	if req.Error != "" {
+		set = append(set, "error = ?")
+		args = append(args, req.Error)
+	}
+
+	if req.DeadlineAt != nil {
+		set = append(set, "deadline_at = ?")
+		args = append(args, *req.DeadlineAt)
+	}
+
+	args = append(args, taskID, workflowID, sessionID)
+	args = append(args, sqlArgs(req.From)...)
+
+	result, err := w.dialect.exec(
+		ctx,
+		w.db,
+		`UPDATE workflow_run_steps SET `+strings.Join(set, ", ")+` WHERE task_id = ? AND workflow_id = ? AND session_id = ? AND status IN `+sqlIn(len(req.From)),
+		args...,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return updated > 0, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) CountActiveRunSteps(ctx context.Context, workflowID, sessionID string) (int64, error) {
+
+	var count int64
+
+	args := []any{workflowID, sessionID}
+	args = append(args, sqlArgs(activeRunStepStatuses)...)
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT COUNT(*) FROM workflow_run_steps WHERE workflow_id = ? AND session_id = ? AND status IN `+sqlIn(len(activeRunStepStatuses)),
+		args...,
+	).Scan(&count)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (w *SQLWorkflowStorageAdapter) ListExpiredRuns(ctx context.Context, now time.Time, limit int) ([]Run, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunColumns+` FROM workflow_runs WHERE status = ? AND deadline_at <= ? ORDER BY deadline_at LIMIT ?`,
+		RunStatusRunning,
+		now,
+		limit,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var runs []Run
+
+	for rows.Next() {
+
+		run, err := scanSQLRun(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, *run)
+	}
+
+	return runs, rows.Err()
+}
+
+// ListExpiredRunSteps returns running steps whose attempt outlived its
+// timeout. Steps waiting for a retry are not running an attempt, so they
+// never expire.
+func (w *SQLWorkflowStorageAdapter) ListExpiredRunSteps(ctx context.Context, now time.Time, limit int) ([]RunStep, error) {
+
+	rows, err := w.dialect.query(
+		ctx,
+		w.db,
+		`SELECT `+sqlRunStepColumns+` FROM workflow_run_steps WHERE status = ? AND deadline_at <= ? ORDER BY deadline_at LIMIT ?`,
+		RunStepStatusRunning,
+		now,
+		limit,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var steps []RunStep
+
+	for rows.Next() {
+
+		step, err := scanSQLRunStep(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, *step)
+	}
+
+	return steps, rows.Err()
+}
@@ -0,0 +1,89 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SaveFlowSnapshot stores the snapshot of a flow version. Snapshots never
+// change, so when the version is already stored the existing one is kept.
+func (w *SQLWorkflowStorageAdapter) SaveFlowSnapshot(ctx context.Context, snapshot *FlowSnapshot) error {
+
+	actions, err := sqlJSON(snapshot.Actions)
+
+	if err != nil {
+		return err
+	}
+
+	deps, err := sqlJSON(snapshot.Deps)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.dialect.exec(
+		ctx,
+		w.db,
+		`INSERT INTO workflow_flow_snapshots (tenant_id, workflow_id, version, actions, deps, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		snapshot.TenantID,
+		snapshot.WorkflowID,
+		snapshot.Version,
+		actions,
+		deps,
+		snapshot.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *SQLWorkflowStorageAdapter) GetFlowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error) {
+
+	var (
+		snapshot FlowSnapshot
+		actions  []byte
+		deps     []byte
+	)
+
+	err := w.dialect.queryRow(
+		ctx,
+		w.db,
+		`SELECT tenant_id, workflow_id, version, actions, deps, created_at FROM workflow_flow_snapshots WHERE tenant_id = ? AND workflow_id = ? AND version = ?`,
+		tenantID,
+		workflowID,
+		version,
+	).Scan(
+		&snapshot.TenantID,
+		&snapshot.WorkflowID,
+		&snapshot.Version,
+		&actions,
+		&deps,
+		&snapshot.CreatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFlowSnapshotNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(actions, &snapshot.Actions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanSQLJSON(deps, &snapshot.Deps)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,145 @@
+package spider
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteTimeFormat has a fixed width, so SQLite compares and sorts the
+// stored times as strings in time order. The driver reads it back as a UTC
+// time.Time from DATETIME columns.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000Z"
+
+var sqliteDialect = func() *sqlDialect {
+
+	migrations, err := fs.Sub(sqliteMigrations, "migrations/sqlite")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &sqlDialect{
+		name: "sqlite",
+		isUniqueViolation: func(err error) bool {
+			var sqliteErr *sqlite.Error
+
+			if !errors.As(err, &sqliteErr) {
+				return false
+			}
+
+			code := sqliteErr.Code()
+
+			return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+		},
+		timeValue: func(t time.Time) any {
+			return t.UTC().Format(sqliteTimeFormat)
+		},
+		migrations: migrations,
+	}
+}()
+
+// OpenSQLite opens the SQLite database at path, ":memory:" for a database
+// that lives as long as the returned handle.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, and an in-memory database is private to
+	// its connection
+	db.SetMaxOpenConns(1)
+
+	err = db.PingContext(ctx)
+
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func openSQLiteFromEnv(ctx context.Context) (*sql.DB, error) {
+
+	type Env struct {
+		SQLitePath string `env:"SQLITE_PATH,default=spider.db"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenSQLite(ctx, env.SQLitePath)
+}
+
+type InitSQLiteWorkflowStorageAdapterOpt struct {
+	BetaAutoSetupSchema bool
+}
+
+func InitSQLiteWorkflowStorageAdapter(ctx context.Context, opt InitSQLiteWorkflowStorageAdapterOpt) (*SQLWorkflowStorageAdapter, error) {
+
+	db, err := openSQLiteFromEnv(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.BetaAutoSetupSchema {
+		err = MigrateSQLite(ctx, db)
+
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	return NewSQLiteWorkflowStorageAdapter(db), nil
+}
+
+// MigrateSQLite creates or upgrades the schema of the SQLite storage.
+func MigrateSQLite(ctx context.Context, db *sql.DB) error {
+	return migrateSQL(ctx, db, sqliteDialect)
+}
+
+func NewSQLiteWorkflowStorageAdapter(db *sql.DB) *SQLWorkflowStorageAdapter {
+	return &SQLWorkflowStorageAdapter{
+		db:      db,
+		dialect: sqliteDialect,
+	}
+}
+
+func InitSQLiteWorkerStorageAdapter(ctx context.Context) (*SQLWorkerStorageAdapter, error) {
+
+	db, err := openSQLiteFromEnv(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLiteWorkerStorageAdapter(db), nil
+}
+
+func NewSQLiteWorkerStorageAdapter(db *sql.DB) *SQLWorkerStorageAdapter {
+	return &SQLWorkerStorageAdapter{
+		db:      db,
+		dialect: sqliteDialect,
+	}
+}
@@ -0,0 +1,32 @@
+package spider_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/spidertest"
+)
+
+func TestSQLiteWorkflowStorageAdapter(t *testing.T) {
+	spidertest.RunStorageConformance(t, func(t *testing.T) spider.WorkflowStorageAdapter {
+
+		ctx := context.Background()
+
+		db, err := spider.OpenSQLite(ctx, filepath.Join(t.TempDir(), "spider.db"))
+
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+
+		err = spider.MigrateSQLite(ctx, db)
+
+		if err != nil {
+			_ = db.Close()
+			t.Fatalf("MigrateSQLite: %v", err)
+		}
+
+		return spider.NewSQLiteWorkflowStorageAdapter(db)
+	})
+}
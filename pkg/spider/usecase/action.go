@@ -2,14 +2,121 @@ package usecase
 
 import (
 	"context"
+	"slices"
 
 	"github.com/targc/spider-go/pkg/spider"
 )
 
+// AddAction adds an action to a flow once its action ID, mappers and
+// policies are valid.
+func (u *Usecase) AddAction(ctx context.Context, req *spider.AddActionRequest) (*spider.WorkflowAction, error) {
+	_, err := u.storage.GetFlow(ctx, req.TenantID, req.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+
+	if req.Key == "" {
+		verr.add("key", "key is required")
+	}
+
+	u.validateAction(verr, "", WorkflowActionInput{
+		Key:      req.Key,
+		ActionID: req.ActionID,
+		Mapper:   req.Map,
+		Join:     req.Join,
+		Retry:    req.Retry,
+		Timeout:  req.Timeout,
+	})
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	return u.storage.AddAction(ctx, req)
+}
+
+// DeleteAction deletes an action and its peers. The action of an active
+// flow is only deleted if the graph left is valid.
+func (u *Usecase) DeleteAction(ctx context.Context, tenantID, workflowID, key string) error {
+	err := u.validateActiveFlowEdit(ctx, tenantID, workflowID, func(actions []WorkflowActionInput, peers []PeerInput) ([]WorkflowActionInput, []PeerInput) {
+		actions = slices.DeleteFunc(actions, func(action WorkflowActionInput) bool {
+			return action.Key == key
+		})
+
+		peers = slices.DeleteFunc(peers, func(peer PeerInput) bool {
+			return peer.ParentKey == key || peer.ChildKey == key
+		})
+
+		return actions, peers
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.storage.DeleteAction(ctx, tenantID, workflowID, key)
+}
+
+func (u *Usecase) EnableAction(ctx context.Context, tenantID, workflowID, key string) error {
+	return u.storage.EnableWorkflowAction(ctx, tenantID, workflowID, key)
+}
+
 func (u *Usecase) DisableAction(ctx context.Context, tenantID, workflowID, key string) error {
 	return u.storage.DisableWorkflowAction(ctx, tenantID, workflowID, key)
 }
 
+// UpdateAction updates an action of a flow once its action ID and new
+// mappers and policies are valid.
 func (u *Usecase) UpdateAction(ctx context.Context, req *spider.UpdateActionRequest) (*spider.WorkflowAction, error) {
+	action, err := u.storage.QueryWorkflowAction(ctx, req.TenantID, req.WorkflowID, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+
+	u.validateAction(verr, "", WorkflowActionInput{
+		Key:      action.Key,
+		ActionID: action.ActionID,
+		Mapper:   req.Map,
+		Join:     req.Join,
+		Retry:    req.Retry,
+		Timeout:  req.Timeout,
+	})
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
 	return u.storage.UpdateAction(ctx, req)
 }
+
+func (u *Usecase) AddPeer(ctx context.Context, tenantID, workflowID string, peer PeerInput) error {
+	_, err := u.storage.GetFlow(ctx, tenantID, workflowID)
+	if err != nil {
+		return err
+	}
+
+	err = u.validateNewPeer(ctx, tenantID, workflowID, peer)
+	if err != nil {
+		return err
+	}
+
+	return u.storage.AddDep(ctx, tenantID, workflowID, peer.ParentKey, peer.MetaOutput, peer.ChildKey)
+}
+
+// RemovePeer removes a peer. The peer of an active flow is only removed if
+// the graph left is valid.
+func (u *Usecase) RemovePeer(ctx context.Context, tenantID, workflowID string, peer PeerInput) error {
+	err := u.validateActiveFlowEdit(ctx, tenantID, workflowID, func(actions []WorkflowActionInput, peers []PeerInput) ([]WorkflowActionInput, []PeerInput) {
+		return actions, slices.DeleteFunc(peers, func(p PeerInput) bool {
+			return p == peer
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.storage.RemoveDep(ctx, tenantID, workflowID, peer.ParentKey, peer.MetaOutput, peer.ChildKey)
+}
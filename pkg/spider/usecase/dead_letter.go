@@ -0,0 +1,23 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+func (u *Usecase) ListDeadLetters(ctx context.Context, req *spider.ListDeadLettersRequest) (*spider.DeadLetterListResponse, error) {
+	return u.messenger.ListDeadLetters(ctx, req)
+}
+
+func (u *Usecase) GetDeadLetter(ctx context.Context, tenantID, id string) (*spider.DeadLetter, error) {
+	return u.messenger.GetDeadLetter(ctx, tenantID, id)
+}
+
+func (u *Usecase) ReplayDeadLetter(ctx context.Context, tenantID, id string) error {
+	return u.messenger.ReplayDeadLetter(ctx, tenantID, id)
+}
+
+func (u *Usecase) DiscardDeadLetter(ctx context.Context, tenantID, id string) error {
+	return u.messenger.DiscardDeadLetter(ctx, tenantID, id)
+}
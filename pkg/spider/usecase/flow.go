@@ -12,6 +12,8 @@ type CreateFlowRequest struct {
 	Name        string                 `json:"name"`
 	TriggerType spider.FlowTriggerType `json:"trigger_type"`
 	Meta        map[string]string      `json:"meta,omitempty"`
+	Deadline    spider.Duration        `json:"deadline,omitempty"`
+	Retention   spider.Duration        `json:"retention,omitempty"`
 	Actions     []WorkflowActionInput  `json:"actions"`
 	Peers       []PeerInput            `json:"peers"`
 }
@@ -19,9 +21,12 @@ type CreateFlowRequest struct {
 type WorkflowActionInput struct {
 	Key      string                   `json:"key"`
 	ActionID string                   `json:"action_id"`
-	Config   map[string]string        `json:"config"`
-	Mapper   map[string]spider.Mapper `json:"mapper"`
+	Config   map[string]string        `json:"config,omitempty"`
+	Mapper   map[string]spider.Mapper `json:"mapper,omitempty"`
 	Meta     map[string]string        `json:"meta,omitempty"`
+	Join     *spider.JoinPolicy       `json:"join,omitempty"`
+	Retry    *spider.RetryPolicy      `json:"retry,omitempty"`
+	Timeout  spider.Duration          `json:"timeout,omitempty"`
 }
 
 type PeerInput struct {
@@ -37,6 +42,8 @@ type UpdateFlowRequest struct {
 	TriggerType spider.FlowTriggerType `json:"trigger_type"`
 	Meta        map[string]string      `json:"meta,omitempty"`
 	Status      spider.FlowStatus      `json:"status"`
+	Deadline    spider.Duration        `json:"deadline,omitempty"`
+	Retention   spider.Duration        `json:"retention,omitempty"`
 }
 
 type FlowResponse struct {
@@ -45,62 +52,88 @@ type FlowResponse struct {
 }
 
 func (u *Usecase) CreateFlow(ctx context.Context, req *CreateFlowRequest) (*FlowResponse, error) {
-	id, err := uuid.NewV7()
+	err := u.validateFlow(req)
 	if err != nil {
 		return nil, err
 	}
 
-	flow, err := u.storage.CreateFlow(ctx, &spider.CreateFlowRequest{
-		ID:          id.String(),
-		TenantID:    req.TenantID,
-		Name:        req.Name,
-		TriggerType: req.TriggerType,
-		Meta:        req.Meta,
-	})
-
+	id, err := uuid.NewV7()
 	if err != nil {
 		return nil, err
 	}
 
-	workflowID := flow.ID
+	flow, err := u.storage.SaveFlowGraph(ctx, buildFlowGraph(id.String(), req))
+	if err != nil {
+		return nil, err
+	}
 
-	for _, action := range req.Actions {
-		_, err = u.storage.AddAction(ctx, &spider.AddActionRequest{
-			TenantID:   req.TenantID,
-			WorkflowID: workflowID,
-			Key:        action.Key,
-			ActionID:   action.ActionID,
-			Config:     action.Config,
-			Map:        action.Mapper,
-			Meta:       action.Meta,
-		})
+	return &FlowResponse{
+		FlowID:   flow.ID,
+		FlowName: flow.Name,
+	}, nil
+}
 
-		if err != nil {
-			return nil, err
-		}
+// ReplaceFlowGraph replaces the settings, actions and peers of an existing
+// flow at once. Sessions already running keep the graph they started on.
+func (u *Usecase) ReplaceFlowGraph(ctx context.Context, flowID string, req *CreateFlowRequest) (*FlowResponse, error) {
+	_, err := u.storage.GetFlow(ctx, req.TenantID, flowID)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, peer := range req.Peers {
-		err = u.storage.AddDep(
-			ctx,
-			req.TenantID,
-			workflowID,
-			peer.ParentKey,
-			peer.MetaOutput,
-			peer.ChildKey,
-		)
+	err = u.validateFlow(req)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	flow, err := u.storage.SaveFlowGraph(ctx, buildFlowGraph(flowID, req))
+	if err != nil {
+		return nil, err
 	}
 
 	return &FlowResponse{
-		FlowID:   workflowID,
+		FlowID:   flow.ID,
 		FlowName: flow.Name,
 	}, nil
 }
 
+func buildFlowGraph(flowID string, req *CreateFlowRequest) *spider.SaveFlowGraphRequest {
+	graph := &spider.SaveFlowGraphRequest{
+		Flow: spider.CreateFlowRequest{
+			ID:          flowID,
+			TenantID:    req.TenantID,
+			Name:        req.Name,
+			TriggerType: req.TriggerType,
+			Meta:        req.Meta,
+			Deadline:    req.Deadline,
+			Retention:   req.Retention,
+		},
+	}
+
+	for _, action := range req.Actions {
+		graph.Actions = append(graph.Actions, spider.AddActionRequest{
+			Key:      action.Key,
+			ActionID: action.ActionID,
+			Config:   action.Config,
+			Map:      action.Mapper,
+			Meta:     action.Meta,
+			Join:     action.Join,
+			Retry:    action.Retry,
+			Timeout:  action.Timeout,
+		})
+	}
+
+	for _, peer := range req.Peers {
+		graph.Deps = append(graph.Deps, spider.WorkflowActionDep{
+			Key:        peer.ParentKey,
+			MetaOutput: peer.MetaOutput,
+			DepKey:     peer.ChildKey,
+		})
+	}
+
+	return graph
+}
+
 func (u *Usecase) ListFlows(ctx context.Context, tenantID string, page, pageSize int) (*spider.FlowListResponse, error) {
 	return u.storage.ListFlows(ctx, tenantID, page, pageSize)
 }
@@ -109,6 +142,8 @@ type FlowDetailResponse struct {
 	FlowID   string                  `json:"flow_id"`
 	FlowName string                  `json:"flow_name"`
 	TenantID string                  `json:"tenant_id"`
+	Status   spider.FlowStatus       `json:"status"`
+	Version  uint64                  `json:"version"`
 	Actions  []spider.WorkflowAction `json:"actions"`
 }
 
@@ -127,20 +162,68 @@ func (u *Usecase) GetFlow(ctx context.Context, tenantID, flowID string) (*FlowDe
 		FlowID:   flowID,
 		FlowName: flow.Name,
 		TenantID: tenantID,
+		Status:   flow.Status,
+		Version:  flow.Version,
 		Actions:  actions,
 	}, nil
 }
 
 func (u *Usecase) UpdateFlow(ctx context.Context, req *UpdateFlowRequest) (*spider.Flow, error) {
+	current, err := u.storage.GetFlow(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	validateFlowSettings(verr, req.Deadline, req.Retention)
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	status := req.Status
+	if status == "" {
+		status = current.Status
+	}
+
+	// a flow only starts running triggers once its graph is sound
+	if status == spider.FlowStatusActive && current.Status != spider.FlowStatusActive {
+		err = u.validateStoredFlowGraph(ctx, req.TenantID, req.FlowID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	storageReq := &spider.UpdateFlowRequest{
 		TenantID:    req.TenantID,
 		FlowID:      req.FlowID,
 		Name:        req.Name,
 		TriggerType: req.TriggerType,
 		Meta:        req.Meta,
-		Status:      req.Status,
+		Status:      status,
+		Deadline:    req.Deadline,
+		Retention:   req.Retention,
+	}
+
+	flow, err := u.storage.UpdateFlow(ctx, storageReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// runs held while the flow was paused follow the flow once it is
+	// activated or archived. This is done on every save rather than only on
+	// a status change, so saving the flow again finishes a release that
+	// failed; the engine takes a run released twice as a redelivery.
+	switch flow.Status {
+	case spider.FlowStatusActive:
+		err = u.releaseHeldRuns(ctx, flow.TenantID, flow.ID)
+	case spider.FlowStatusArchived:
+		err = u.rejectHeldRuns(ctx, flow.TenantID, flow.ID)
 	}
-	return u.storage.UpdateFlow(ctx, storageReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return flow, nil
 }
 
 func (u *Usecase) DeleteFlow(ctx context.Context, tenantID, flowID string) error {
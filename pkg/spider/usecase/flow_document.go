@@ -0,0 +1,204 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"sigs.k8s.io/yaml"
+)
+
+// FlowDocumentAPIVersion is the version of the flow document format.
+const FlowDocumentAPIVersion = "spider/v1"
+
+// FlowDocument describes a flow and its graph in a file meant to be kept in
+// git, as YAML or JSON. Importing a document creates the flow of ID, or
+// replaces the settings and graph of that flow.
+type FlowDocument struct {
+	APIVersion  string                 `json:"api_version" example:"spider/v1"`
+	ID          string                 `json:"id" example:"order-created"`
+	Name        string                 `json:"name" example:"My Workflow"`
+	TriggerType spider.FlowTriggerType `json:"trigger_type" example:"event"`
+	Meta        map[string]string      `json:"meta,omitempty"`
+	Deadline    spider.Duration        `json:"deadline,omitempty" swaggertype:"string" example:"1h"`
+	Retention   spider.Duration        `json:"retention,omitempty" swaggertype:"string" example:"72h"`
+	Actions     []WorkflowActionInput  `json:"actions"`
+	Peers       []PeerInput            `json:"peers,omitempty"`
+}
+
+// ParseFlowDocument reads a flow document from YAML or JSON. Unknown fields
+// are rejected, so a misspelled one does not go unnoticed.
+func ParseFlowDocument(data []byte) (*FlowDocument, error) {
+	var doc FlowDocument
+
+	err := yaml.UnmarshalStrict(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// MarshalFlowDocumentYAML writes a flow document as YAML.
+func MarshalFlowDocumentYAML(doc *FlowDocument) ([]byte, error) {
+	return yaml.Marshal(doc)
+}
+
+// CreateFlowRequest returns the request creating the flow of the document
+// for a tenant.
+func (d *FlowDocument) CreateFlowRequest(tenantID string) *CreateFlowRequest {
+	return &CreateFlowRequest{
+		TenantID:    tenantID,
+		Name:        d.Name,
+		TriggerType: d.TriggerType,
+		Meta:        d.Meta,
+		Deadline:    d.Deadline,
+		Retention:   d.Retention,
+		Actions:     d.Actions,
+		Peers:       d.Peers,
+	}
+}
+
+// ExportFlow describes a flow and its graph as a document.
+func (u *Usecase) ExportFlow(ctx context.Context, tenantID, flowID string) (*FlowDocument, error) {
+	flow, err := u.storage.GetFlow(ctx, tenantID, flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := u.storage.GetWorkflowActions(ctx, tenantID, flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := u.storage.GetWorkflowActionDeps(ctx, tenantID, flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &FlowDocument{
+		APIVersion:  FlowDocumentAPIVersion,
+		ID:          flow.ID,
+		Name:        flow.Name,
+		TriggerType: flow.TriggerType,
+		Meta:        flow.Meta,
+		Deadline:    flow.Deadline,
+		Retention:   flow.Retention,
+		Actions:     []WorkflowActionInput{},
+	}
+
+	for _, action := range actions {
+		doc.Actions = append(doc.Actions, WorkflowActionInput{
+			Key:      action.Key,
+			ActionID: action.ActionID,
+			Config:   action.Config,
+			Mapper:   action.Map,
+			Meta:     action.Meta,
+			Join:     action.Join,
+			Retry:    action.Retry,
+			Timeout:  action.Timeout,
+		})
+	}
+
+	for _, dep := range deps {
+		doc.Peers = append(doc.Peers, PeerInput{
+			ParentKey:  dep.Key,
+			MetaOutput: dep.MetaOutput,
+			ChildKey:   dep.DepKey,
+		})
+	}
+
+	return doc, nil
+}
+
+// ImportFlow creates or replaces the flow of a document. Importing the
+// document a flow already matches leaves it untouched, so importing the
+// same document twice bumps the flow version once.
+func (u *Usecase) ImportFlow(ctx context.Context, tenantID string, doc *FlowDocument) (*spider.Flow, error) {
+	verr := &ValidationError{}
+
+	if doc.APIVersion != FlowDocumentAPIVersion {
+		verr.add("api_version", "unsupported api_version %q, want %q", doc.APIVersion, FlowDocumentAPIVersion)
+	}
+
+	if doc.ID == "" {
+		verr.add("id", "id is required")
+	}
+
+	if doc.Name == "" {
+		verr.add("name", "name is required")
+	}
+
+	validateFlowSettings(verr, doc.Deadline, doc.Retention)
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	err := u.validateFlowGraph(doc.Actions, doc.Peers)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := u.ExportFlow(ctx, tenantID, doc.ID)
+	if err != nil && !errors.Is(err, spider.ErrNotFound) {
+		return nil, err
+	}
+
+	if current != nil {
+		same, err := sameFlowDocuments(current, doc)
+		if err != nil {
+			return nil, err
+		}
+
+		if same {
+			return u.storage.GetFlow(ctx, tenantID, doc.ID)
+		}
+	}
+
+	return u.storage.SaveFlowGraph(ctx, buildFlowGraph(doc.ID, doc.CreateFlowRequest(tenantID)))
+}
+
+// sameFlowDocuments reports whether two documents describe the same flow,
+// not telling empty maps and lists from missing ones.
+func sameFlowDocuments(a, b *FlowDocument) (bool, error) {
+	ja, err := json.Marshal(normalizeFlowDocument(a))
+	if err != nil {
+		return false, err
+	}
+
+	jb, err := json.Marshal(normalizeFlowDocument(b))
+	if err != nil {
+		return false, err
+	}
+
+	return string(ja) == string(jb), nil
+}
+
+func normalizeFlowDocument(doc *FlowDocument) FlowDocument {
+	normalized := *doc
+	normalized.Meta = nilIfEmpty(doc.Meta)
+	normalized.Actions = nil
+	normalized.Peers = nil
+
+	for _, action := range doc.Actions {
+		action.Config = nilIfEmpty(action.Config)
+		action.Meta = nilIfEmpty(action.Meta)
+		action.Mapper = nilIfEmpty(action.Mapper)
+
+		normalized.Actions = append(normalized.Actions, action)
+	}
+
+	normalized.Peers = append(normalized.Peers, doc.Peers...)
+
+	return normalized
+}
+
+func nilIfEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if len(m) == 0 {
+		return nil
+	}
+
+	return m
+}
@@ -0,0 +1,465 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+func TestCreateFlowValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		deadline  spider.Duration
+		retention spider.Duration
+		actions   []usecase.WorkflowActionInput
+		peers     []usecase.PeerInput
+		fields    []string
+	}{
+		{
+			name: "valid",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "b", ActionID: "echo", Mapper: map[string]spider.Mapper{
+					"value": {Mode: spider.MapperModeExpression, Value: `a.output.value + "!"`},
+				}},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+			},
+		},
+		{
+			name:   "no action",
+			fields: []string{"actions"},
+		},
+		{
+			name: "duplicate key",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "a", ActionID: "echo"},
+			},
+			fields: []string{"actions[1].key"},
+		},
+		{
+			name: "unknown action id",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "missing"},
+			},
+			fields: []string{"actions[0].action_id"},
+		},
+		{
+			name: "invalid expression",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo", Mapper: map[string]spider.Mapper{
+					"value": {Mode: spider.MapperModeExpression, Value: "a.output +"},
+				}},
+			},
+			fields: []string{"actions[0].mapper.value.value"},
+		},
+		{
+			name: "unknown peer key",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+			},
+			fields: []string{"peers[0].child_key"},
+		},
+		{
+			name: "cycle",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "b", ActionID: "echo"},
+				{Key: "c", ActionID: "echo"},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+				{ParentKey: "b", MetaOutput: "success", ChildKey: "c"},
+				{ParentKey: "c", MetaOutput: "success", ChildKey: "b"},
+			},
+			fields: []string{"actions[1].key"},
+		},
+		{
+			name: "unknown join mode",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "b", ActionID: "echo", Join: &spider.JoinPolicy{Mode: "most"}},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+			},
+			fields: []string{"actions[1].join.mode"},
+		},
+		{
+			name: "join count above parents",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "b", ActionID: "echo"},
+				{Key: "c", ActionID: "echo", Join: &spider.JoinPolicy{Mode: spider.JoinModeAny, Count: 3}},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "c"},
+				{ParentKey: "b", MetaOutput: "success", ChildKey: "c"},
+			},
+			fields: []string{"actions[2].join.count"},
+		},
+		{
+			name: "join without count",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo"},
+				{Key: "b", ActionID: "echo", Join: &spider.JoinPolicy{Mode: spider.JoinModeAny}},
+			},
+			peers: []usecase.PeerInput{
+				{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+			},
+			fields: []string{"actions[1].join.count"},
+		},
+		{
+			name:      "negative durations",
+			deadline:  spider.Duration(-time.Hour),
+			retention: spider.Duration(-time.Hour),
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo", Timeout: spider.Duration(-time.Second)},
+			},
+			fields: []string{"deadline", "retention", "actions[0].timeout"},
+		},
+		{
+			name: "negative retry",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo", Retry: &spider.RetryPolicy{
+					MaxAttempts:  -1,
+					InitialDelay: spider.Duration(-time.Second),
+					Multiplier:   -2,
+					MaxDelay:     spider.Duration(-time.Minute),
+				}},
+			},
+			fields: []string{
+				"actions[0].retry.max_attempts",
+				"actions[0].retry.initial_delay",
+				"actions[0].retry.multiplier",
+				"actions[0].retry.max_delay",
+			},
+		},
+		{
+			name: "retry max delay below initial delay",
+			actions: []usecase.WorkflowActionInput{
+				{Key: "a", ActionID: "echo", Retry: &spider.RetryPolicy{
+					MaxAttempts:  3,
+					InitialDelay: spider.Duration(time.Minute),
+					MaxDelay:     spider.Duration(time.Second),
+				}},
+			},
+			fields: []string{"actions[0].retry.max_delay"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUsecase(t)
+
+			flow, err := u.CreateFlow(context.Background(), &usecase.CreateFlowRequest{
+				TenantID:    testTenantID,
+				Name:        "flow",
+				TriggerType: spider.FlowTriggerTypeEvent,
+				Deadline:    tt.deadline,
+				Retention:   tt.retention,
+				Actions:     tt.actions,
+				Peers:       tt.peers,
+			})
+
+			if len(tt.fields) > 0 {
+				requireFields(t, err, tt.fields...)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreateFlow: %v", err)
+			}
+
+			got, err := u.storage.GetFlow(context.Background(), testTenantID, flow.FlowID)
+			if err != nil {
+				t.Fatalf("GetFlow: %v", err)
+			}
+
+			if got.Status != spider.FlowStatusDraft {
+				t.Errorf("status %s, want %s", got.Status, spider.FlowStatusDraft)
+			}
+		})
+	}
+}
+
+func TestReplaceFlowGraph(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	_, err := u.ReplaceFlowGraph(ctx, "missing", &usecase.CreateFlowRequest{
+		TenantID: testTenantID,
+		Name:     "flow",
+		Actions:  []usecase.WorkflowActionInput{{Key: "a", ActionID: "echo"}},
+	})
+	if !errors.Is(err, spider.ErrNotFound) {
+		t.Fatalf("ReplaceFlowGraph of a missing flow: %v, want %v", err, spider.ErrNotFound)
+	}
+
+	// a cycle no entry action leads to keeps the current graph
+	_, err = u.ReplaceFlowGraph(ctx, flowID, &usecase.CreateFlowRequest{
+		TenantID: testTenantID,
+		Name:     "flow",
+		Actions: []usecase.WorkflowActionInput{
+			{Key: "a", ActionID: "echo"},
+			{Key: "b", ActionID: "echo"},
+			{Key: "c", ActionID: "echo"},
+		},
+		Peers: []usecase.PeerInput{
+			{ParentKey: "b", MetaOutput: "success", ChildKey: "c"},
+			{ParentKey: "c", MetaOutput: "success", ChildKey: "b"},
+		},
+	})
+	requireFields(t, err, "actions[1].key", "actions[1].key", "actions[2].key")
+
+	flow, err := u.GetFlow(ctx, testTenantID, flowID)
+	if err != nil {
+		t.Fatalf("GetFlow: %v", err)
+	}
+
+	if len(flow.Actions) != 2 {
+		t.Fatalf("%d actions after an invalid replace, want 2", len(flow.Actions))
+	}
+
+	_, err = u.ReplaceFlowGraph(ctx, flowID, &usecase.CreateFlowRequest{
+		TenantID: testTenantID,
+		Name:     "replaced",
+		Actions: []usecase.WorkflowActionInput{
+			{Key: "a", ActionID: "echo"},
+			{Key: "b", ActionID: "echo"},
+			{Key: "c", ActionID: "echo"},
+		},
+		Peers: []usecase.PeerInput{
+			{ParentKey: "a", MetaOutput: "success", ChildKey: "b"},
+			{ParentKey: "a", MetaOutput: "success", ChildKey: "c"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceFlowGraph: %v", err)
+	}
+
+	flow, err = u.GetFlow(ctx, testTenantID, flowID)
+	if err != nil {
+		t.Fatalf("GetFlow: %v", err)
+	}
+
+	if flow.FlowName != "replaced" || len(flow.Actions) != 3 {
+		t.Fatalf("flow %s with %d actions, want replaced with 3", flow.FlowName, len(flow.Actions))
+	}
+}
+
+func TestUpdateFlowActivation(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	// an action of an unknown action ID, added around the usecase
+	_, err := u.storage.AddAction(ctx, &spider.AddActionRequest{
+		TenantID:   testTenantID,
+		WorkflowID: flowID,
+		Key:        "orphan",
+		ActionID:   "missing",
+	})
+	if err != nil {
+		t.Fatalf("AddAction: %v", err)
+	}
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	requireFields(t, err, "actions[2].action_id")
+
+	flow, err := u.storage.GetFlow(ctx, testTenantID, flowID)
+	if err != nil {
+		t.Fatalf("GetFlow: %v", err)
+	}
+
+	if flow.Status != spider.FlowStatusDraft {
+		t.Fatalf("status %s, want %s", flow.Status, spider.FlowStatusDraft)
+	}
+
+	_, err = u.ReplaceFlowGraph(ctx, flowID, &usecase.CreateFlowRequest{
+		TenantID:    testTenantID,
+		Name:        "flow",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Actions: []usecase.WorkflowActionInput{
+			{Key: "start", ActionID: "route"},
+			{Key: "echo", ActionID: "echo"},
+		},
+		Peers: []usecase.PeerInput{
+			{ParentKey: "start", MetaOutput: "success", ChildKey: "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceFlowGraph: %v", err)
+	}
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+}
+
+// createHeldRuns records runs triggered while the flow was paused, oldest
+// first.
+func (u *testUsecase) createHeldRuns(t *testing.T, flowID string, n int) []string {
+	t.Helper()
+
+	var sessionIDs []string
+
+	startedAt := time.Now().Add(-time.Hour)
+
+	for i := range n {
+		sessionID := flowID + "-held-" + string(rune('a'+i))
+
+		err := u.storage.CreateRun(context.Background(), &spider.Run{
+			SessionID:         sessionID,
+			TenantID:          testTenantID,
+			WorkflowID:        flowID,
+			Status:            spider.RunStatusHeld,
+			TriggerKey:        "start",
+			TriggerMetaOutput: "success",
+			TriggerPayload:    map[string]interface{}{"index": float64(i)},
+			StartedAt:         startedAt.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+
+	return sessionIDs
+}
+
+func TestUpdateFlowReleasesHeldRuns(t *testing.T) {
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	err := u.setFlowStatus(t, flowID, spider.FlowStatusPaused)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	sessionIDs := u.createHeldRuns(t, flowID, 3)
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	if len(u.messenger.triggers) != len(sessionIDs) {
+		t.Fatalf("%d triggers sent, want %d", len(u.messenger.triggers), len(sessionIDs))
+	}
+
+	// held runs are resumed oldest first, with their own trigger
+	for i, trigger := range u.messenger.triggers {
+		if trigger.SessionID != sessionIDs[i] {
+			t.Errorf("trigger %d of session %s, want %s", i, trigger.SessionID, sessionIDs[i])
+		}
+
+		if trigger.Key != "start" || trigger.MetaOutput != "success" {
+			t.Errorf("trigger %d from %s/%s, want start/success", i, trigger.Key, trigger.MetaOutput)
+		}
+	}
+
+	// an update keeping the status releases the runs still held again
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	if len(u.messenger.triggers) != 2*len(sessionIDs) {
+		t.Fatalf("%d triggers sent, want %d", len(u.messenger.triggers), 2*len(sessionIDs))
+	}
+}
+
+func TestUpdateFlowRetriesRelease(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	err := u.setFlowStatus(t, flowID, spider.FlowStatusPaused)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	sessionIDs := u.createHeldRuns(t, flowID, 2)
+
+	errDown := errors.New("messenger down")
+	u.messenger.triggerErr = errDown
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if !errors.Is(err, errDown) {
+		t.Fatalf("UpdateFlow error %v, want %v", err, errDown)
+	}
+
+	// the status is saved even though the release failed
+	flow, err := u.storage.GetFlow(ctx, testTenantID, flowID)
+	if err != nil {
+		t.Fatalf("GetFlow: %v", err)
+	}
+
+	if flow.Status != spider.FlowStatusActive {
+		t.Fatalf("flow %s, want %s", flow.Status, spider.FlowStatusActive)
+	}
+
+	u.messenger.triggerErr = nil
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	if len(u.messenger.triggers) != len(sessionIDs) {
+		t.Fatalf("%d triggers sent, want %d", len(u.messenger.triggers), len(sessionIDs))
+	}
+
+	for i, trigger := range u.messenger.triggers {
+		if trigger.SessionID != sessionIDs[i] {
+			t.Errorf("trigger %d of session %s, want %s", i, trigger.SessionID, sessionIDs[i])
+		}
+	}
+}
+
+func TestUpdateFlowRejectsHeldRuns(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	err := u.setFlowStatus(t, flowID, spider.FlowStatusPaused)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	sessionIDs := u.createHeldRuns(t, flowID, 2)
+
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusArchived)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	if len(u.messenger.triggers) != 0 {
+		t.Fatalf("%d triggers sent, want none", len(u.messenger.triggers))
+	}
+
+	for _, sessionID := range sessionIDs {
+		run, err := u.GetRun(ctx, testTenantID, flowID, sessionID)
+		if err != nil {
+			t.Fatalf("GetRun: %v", err)
+		}
+
+		if run.Status != spider.RunStatusRejected || run.EndedAt == nil {
+			t.Errorf("run %s %s, want ended %s", sessionID, run.Status, spider.RunStatusRejected)
+		}
+	}
+}
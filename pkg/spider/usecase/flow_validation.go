@@ -0,0 +1,494 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/file"
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// FieldError is a problem of one field of a flow, such as
+// "actions[1].key" or "peers[0].child_key".
+type FieldError struct {
+	Field   string `json:"field" example:"peers[0].child_key"`
+	Message string `json:"message" example:"unknown action key \"a9\""`
+}
+
+// ValidationError lists every problem found in a flow graph.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", field.Field, field.Message)
+	}
+
+	return fmt.Sprintf("invalid flow: %s", strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// validateFlow checks the settings of a flow to create or replace along with
+// its graph, returning a *ValidationError listing every problem, or nil.
+func (u *Usecase) validateFlow(req *CreateFlowRequest) error {
+	verr := &ValidationError{}
+
+	validateFlowSettings(verr, req.Deadline, req.Retention)
+
+	err := u.validateFlowGraph(req.Actions, req.Peers)
+
+	var graphErr *ValidationError
+	switch {
+	case errors.As(err, &graphErr):
+		verr.Fields = append(verr.Fields, graphErr.Fields...)
+	case err != nil:
+		return err
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// validateFlowSettings checks the deadline and retention of a flow, where
+// zero means none, adding their problems to verr.
+func validateFlowSettings(verr *ValidationError, deadline, retention spider.Duration) {
+	if deadline < 0 {
+		verr.add("deadline", "deadline cannot be negative")
+	}
+
+	if retention < 0 {
+		verr.add("retention", "retention cannot be negative")
+	}
+}
+
+// validateFlowGraph checks that the actions and peers form a graph the
+// workflow can run: unique keys, known action IDs, mappers that compile,
+// peers between existing actions, joins their parents can satisfy, no
+// cycles, and every action reachable from an entry action, an action no peer
+// leads to, which triggers start.
+// It returns a *ValidationError listing every problem, or nil.
+func (u *Usecase) validateFlowGraph(actions []WorkflowActionInput, peers []PeerInput) error {
+	verr := &ValidationError{}
+
+	if len(actions) == 0 {
+		verr.add("actions", "at least one action is required")
+	}
+
+	indexes := map[string]int{}
+
+	for i, action := range actions {
+		field := fmt.Sprintf("actions[%d].", i)
+
+		switch _, ok := indexes[action.Key]; {
+		case action.Key == "":
+			verr.add(field+"key", "key is required")
+		case ok:
+			verr.add(field+"key", "duplicate key %q", action.Key)
+		default:
+			indexes[action.Key] = i
+		}
+
+		u.validateAction(verr, field, action)
+	}
+
+	children := map[string][]string{}
+	parents := map[string]map[string]bool{}
+	hasParent := map[string]bool{}
+	seenPeers := map[PeerInput]bool{}
+
+	for i, peer := range peers {
+		field := fmt.Sprintf("peers[%d]", i)
+		valid := true
+
+		if _, ok := indexes[peer.ParentKey]; !ok {
+			verr.add(field+".parent_key", "unknown action key %q", peer.ParentKey)
+			valid = false
+		}
+
+		if _, ok := indexes[peer.ChildKey]; !ok {
+			verr.add(field+".child_key", "unknown action key %q", peer.ChildKey)
+			valid = false
+		}
+
+		if peer.MetaOutput == "" {
+			verr.add(field+".meta_output", "meta_output is required")
+			valid = false
+		}
+
+		if valid && peer.ParentKey == peer.ChildKey {
+			verr.add(field, "action %q cannot follow itself", peer.ParentKey)
+			valid = false
+		}
+
+		if valid && seenPeers[peer] {
+			verr.add(field, "duplicate peer")
+			valid = false
+		}
+
+		if !valid {
+			continue
+		}
+
+		seenPeers[peer] = true
+		children[peer.ParentKey] = append(children[peer.ParentKey], peer.ChildKey)
+		hasParent[peer.ChildKey] = true
+
+		if parents[peer.ChildKey] == nil {
+			parents[peer.ChildKey] = map[string]bool{}
+		}
+		parents[peer.ChildKey][peer.ParentKey] = true
+	}
+
+	// the mode and count of a join are checked with its action
+	for i, action := range actions {
+		join := action.Join
+		if join == nil || join.Mode != spider.JoinModeAny || join.Count <= len(parents[action.Key]) {
+			continue
+		}
+
+		verr.add(fmt.Sprintf("actions[%d].join.count", i), "count must be between 1 and %d, the parents of %q", len(parents[action.Key]), action.Key)
+	}
+
+	// the actions with a unique key, in order
+	var keys []string
+
+	for i, action := range actions {
+		if action.Key != "" && indexes[action.Key] == i {
+			keys = append(keys, action.Key)
+		}
+	}
+
+	var entries []string
+
+	for _, key := range keys {
+		if !hasParent[key] {
+			entries = append(entries, key)
+		}
+	}
+
+	if len(keys) > 0 && len(entries) == 0 {
+		verr.add("peers", "no entry action, every action follows another one")
+	}
+
+	for _, cycle := range findCycles(keys, children) {
+		verr.add(fmt.Sprintf("actions[%d].key", indexes[cycle[0]]), "cycle %s", strings.Join(cycle, " -> "))
+	}
+
+	reached := map[string]bool{}
+	queue := entries
+
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+
+		if reached[key] {
+			continue
+		}
+
+		reached[key] = true
+		queue = append(queue, children[key]...)
+	}
+
+	for _, key := range keys {
+		if reached[key] || len(entries) == 0 {
+			continue
+		}
+
+		verr.add(fmt.Sprintf("actions[%d].key", indexes[key]), "action %q cannot be reached from an entry action", key)
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// validateAction checks the action ID, the mappers, the timeout, the retry
+// policy and the join of an action, adding its problems to verr under the
+// field prefix. The join count is checked against the parents of the action
+// with the graph.
+func (u *Usecase) validateAction(verr *ValidationError, prefix string, action WorkflowActionInput) {
+	switch {
+	case action.ActionID == "":
+		verr.add(prefix+"action_id", "action_id is required")
+	case len(u.actionIDs) > 0 && !u.actionIDs[action.ActionID]:
+		verr.add(prefix+"action_id", "unknown action_id %q", action.ActionID)
+	}
+
+	if action.Timeout < 0 {
+		verr.add(prefix+"timeout", "timeout cannot be negative")
+	}
+
+	if action.Retry != nil {
+		validateRetry(verr, prefix+"retry.", action.Retry)
+	}
+
+	if action.Join != nil {
+		validateJoin(verr, prefix+"join.", action.Join)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(action.Mapper)) {
+		mapper := action.Mapper[name]
+		field := fmt.Sprintf("%smapper.%s", prefix, name)
+
+		// the workflow evaluates every mode but fixed as an expression
+		switch mapper.Mode {
+		case spider.MapperModeFixed:
+			continue
+		case "", spider.MapperModeKey, spider.MapperModeExpression:
+		default:
+			verr.add(field+".mode", "unknown mode %q", mapper.Mode)
+			continue
+		}
+
+		if mapper.Value == "" {
+			continue
+		}
+
+		_, err := expr.Compile(mapper.Value)
+		if err != nil {
+			verr.add(field+".value", "invalid expression: %s", expressionError(err))
+		}
+	}
+}
+
+// validateRetry checks a retry policy, adding its problems to verr under
+// the field prefix.
+func validateRetry(verr *ValidationError, prefix string, retry *spider.RetryPolicy) {
+	if retry.MaxAttempts < 0 {
+		verr.add(prefix+"max_attempts", "max_attempts cannot be negative")
+	}
+
+	if retry.InitialDelay < 0 {
+		verr.add(prefix+"initial_delay", "initial_delay cannot be negative")
+	}
+
+	if retry.Multiplier < 0 {
+		verr.add(prefix+"multiplier", "multiplier cannot be negative")
+	}
+
+	// a zero max_delay leaves the backoff unbounded
+	switch {
+	case retry.MaxDelay < 0:
+		verr.add(prefix+"max_delay", "max_delay cannot be negative")
+	case retry.MaxDelay > 0 && retry.MaxDelay < retry.InitialDelay:
+		verr.add(prefix+"max_delay", "max_delay cannot be less than initial_delay")
+	}
+}
+
+// validateJoin checks the mode of a join and that a join on some of the
+// parents waits for at least one, adding its problems to verr under the
+// field prefix.
+func validateJoin(verr *ValidationError, prefix string, join *spider.JoinPolicy) {
+	switch join.Mode {
+	case "", spider.JoinModeAll, spider.JoinModeFirst:
+	case spider.JoinModeAny:
+		if join.Count < 1 {
+			verr.add(prefix+"count", "count must be at least 1")
+		}
+	default:
+		verr.add(prefix+"mode", "unknown mode %q", join.Mode)
+	}
+}
+
+// validateStoredFlowGraph validates the graph a flow has in storage.
+func (u *Usecase) validateStoredFlowGraph(ctx context.Context, tenantID, flowID string) error {
+	actions, peers, err := u.storedFlowGraph(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	return u.validateFlowGraph(actions, peers)
+}
+
+// validateActiveFlowEdit validates the graph an active flow would have once
+// edit changed its stored graph, so the flow keeps a graph it can run. The
+// graph of a flow that is not active is only checked on activation.
+func (u *Usecase) validateActiveFlowEdit(ctx context.Context, tenantID, flowID string, edit func(actions []WorkflowActionInput, peers []PeerInput) ([]WorkflowActionInput, []PeerInput)) error {
+	flow, err := u.storage.GetFlow(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	if flow.Status != spider.FlowStatusActive {
+		return nil
+	}
+
+	actions, peers, err := u.storedFlowGraph(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	return u.validateFlowGraph(edit(actions, peers))
+}
+
+// storedFlowGraph reads the graph a flow has in storage.
+func (u *Usecase) storedFlowGraph(ctx context.Context, tenantID, flowID string) ([]WorkflowActionInput, []PeerInput, error) {
+	actions, err := u.storage.GetWorkflowActions(ctx, tenantID, flowID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deps, err := u.storage.GetWorkflowActionDeps(ctx, tenantID, flowID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inputs := make([]WorkflowActionInput, len(actions))
+	for i, action := range actions {
+		inputs[i] = WorkflowActionInput{
+			Key:      action.Key,
+			ActionID: action.ActionID,
+			Mapper:   action.Map,
+			Join:     action.Join,
+			Retry:    action.Retry,
+			Timeout:  action.Timeout,
+		}
+	}
+
+	peers := make([]PeerInput, len(deps))
+	for i, dep := range deps {
+		peers[i] = PeerInput{
+			ParentKey:  dep.Key,
+			MetaOutput: dep.MetaOutput,
+			ChildKey:   dep.DepKey,
+		}
+	}
+
+	return inputs, peers, nil
+}
+
+// validateNewPeer checks that peer links two actions of the stored graph of
+// a flow without closing a cycle.
+func (u *Usecase) validateNewPeer(ctx context.Context, tenantID, flowID string, peer PeerInput) error {
+	actions, err := u.storage.GetWorkflowActions(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	deps, err := u.storage.GetWorkflowActionDeps(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	verr := &ValidationError{}
+
+	keys := make([]string, len(actions))
+	known := map[string]bool{}
+
+	for i, action := range actions {
+		keys[i] = action.Key
+		known[action.Key] = true
+	}
+
+	if !known[peer.ParentKey] {
+		verr.add("parent_key", "unknown action key %q", peer.ParentKey)
+	}
+
+	if !known[peer.ChildKey] {
+		verr.add("child_key", "unknown action key %q", peer.ChildKey)
+	}
+
+	if peer.MetaOutput == "" {
+		verr.add("meta_output", "meta_output is required")
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	if peer.ParentKey == peer.ChildKey {
+		verr.add("child_key", "action %q cannot follow itself", peer.ParentKey)
+		return verr
+	}
+
+	children := map[string][]string{
+		peer.ParentKey: {peer.ChildKey},
+	}
+
+	for _, dep := range deps {
+		children[dep.Key] = append(children[dep.Key], dep.DepKey)
+	}
+
+	for _, cycle := range findCycles(keys, children) {
+		verr.add("child_key", "cycle %s", strings.Join(cycle, " -> "))
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	return nil
+}
+
+// findCycles returns the cycles found walking the peers from each key in
+// turn, each listed from its first action back to it.
+func findCycles(keys []string, children map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[string]int{}
+	var path []string
+	var cycles [][]string
+
+	var visit func(key string)
+	visit = func(key string) {
+		state[key] = visiting
+		path = append(path, key)
+
+		for _, child := range children[key] {
+			switch state[child] {
+			case unvisited:
+				visit(child)
+			case visiting:
+				for i, k := range path {
+					if k == child {
+						cycle := append([]string{}, path[i:]...)
+						cycles = append(cycles, append(cycle, child))
+						break
+					}
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[key] = visited
+	}
+
+	for _, key := range keys {
+		if state[key] == unvisited {
+			visit(key)
+		}
+	}
+
+	return cycles
+}
+
+func expressionError(err error) string {
+	var fileErr *file.Error
+	if errors.As(err, &fileErr) {
+		return fmt.Sprintf("%s (%d:%d)", fileErr.Message, fileErr.Line, fileErr.Column)
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,389 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// defaultTriggerMetaOutput is the meta output of a manual trigger from an
+// entry action that no peer follows yet.
+const defaultTriggerMetaOutput = "triggered"
+
+// runWaitInterval is how often WaitRun checks whether the run ended.
+const runWaitInterval = 200 * time.Millisecond
+
+// ErrRunEnded is returned when cancelling a run that already ended.
+var ErrRunEnded = errors.New("run already ended")
+
+// TriggerRunRequest starts a run of a flow from the API, as a trigger
+// worker would. Key defaults to the entry action of the flow and MetaOutput
+// to the meta output its peers follow, when there is only one of each.
+type TriggerRunRequest struct {
+	TenantID   string                 `json:"tenant_id"`
+	FlowID     string                 `json:"flow_id"`
+	Key        string                 `json:"key,omitempty"`
+	MetaOutput string                 `json:"meta_output,omitempty"`
+	Payload    map[string]interface{} `json:"payload"`
+}
+
+// TriggerRunResponse is a run started from the API. Status, Error and
+// Context are only set once it was waited for.
+type TriggerRunResponse struct {
+	SessionID string           `json:"session_id" example:"0190c2a4-7b9e-7c1a-9f4e-2d3b5a6c7d8e"`
+	Status    spider.RunStatus `json:"status,omitempty" example:"succeeded"`
+	Error     string           `json:"error,omitempty"`
+	// Context holds the output of the trigger and of every action that
+	// succeeded, by key, as the mappers of the run saw them.
+	Context map[string]map[string]interface{} `json:"context,omitempty"`
+}
+
+func (u *Usecase) ListRuns(ctx context.Context, req *spider.ListRunsRequest) (*spider.RunListResponse, error) {
+	return u.storage.ListRuns(ctx, req)
+}
+
+func (u *Usecase) GetRun(ctx context.Context, tenantID, flowID, sessionID string) (*spider.Run, error) {
+	return u.storage.GetRun(ctx, tenantID, flowID, sessionID)
+}
+
+// TriggerRun sends a trigger message for the entry action of a flow and
+// returns the session ID of the run it starts.
+func (u *Usecase) TriggerRun(ctx context.Context, req *TriggerRunRequest) (*TriggerRunResponse, error) {
+	flow, err := u.storage.GetFlow(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the workflow ignores the triggers of draft flows
+	if flow.Status == spider.FlowStatusDraft {
+		verr := &ValidationError{}
+		verr.add("status", "flow is draft, activate it to start runs")
+		return nil, verr
+	}
+
+	actions, err := u.storage.GetWorkflowActions(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := u.storage.GetWorkflowActionDeps(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	action, metaOutput, err := resolveTriggerEntry(actions, deps, req.Key, req.MetaOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := req.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	values, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionUUID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.messenger.SendTriggerMessage(ctx, spider.TriggerMessage{
+		TenantID:     req.TenantID,
+		WorkflowID:   req.FlowID,
+		Key:          action.Key,
+		ActionID:     action.ActionID,
+		MetaOutput:   metaOutput,
+		Values:       string(values),
+		NewSessionID: sessionUUID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TriggerRunResponse{
+		SessionID: sessionUUID.String(),
+	}, nil
+}
+
+// resolveTriggerEntry returns the entry action a manual trigger starts
+// from, and the meta output it leaves it with.
+func resolveTriggerEntry(actions []spider.WorkflowAction, deps []spider.WorkflowActionDep, key, metaOutput string) (*spider.WorkflowAction, string, error) {
+	verr := &ValidationError{}
+
+	hasParent := map[string]bool{}
+	for _, dep := range deps {
+		hasParent[dep.DepKey] = true
+	}
+
+	var entries []string
+	for _, action := range actions {
+		if !hasParent[action.Key] {
+			entries = append(entries, action.Key)
+		}
+	}
+
+	if key == "" {
+		if len(entries) != 1 {
+			verr.add("key", "the flow has %d entry actions, choose one of %s", len(entries), strings.Join(entries, ", "))
+			return nil, "", verr
+		}
+
+		key = entries[0]
+	}
+
+	i := slices.IndexFunc(actions, func(action spider.WorkflowAction) bool {
+		return action.Key == key
+	})
+
+	switch {
+	case i < 0:
+		verr.add("key", "unknown action key %q", key)
+	case hasParent[key]:
+		verr.add("key", "action %q is not an entry action, choose one of %s", key, strings.Join(entries, ", "))
+	case actions[i].Disabled:
+		verr.add("key", "action %q is disabled", key)
+	}
+
+	if len(verr.Fields) > 0 {
+		return nil, "", verr
+	}
+
+	if metaOutput == "" {
+		var metaOutputs []string
+
+		for _, dep := range deps {
+			if dep.Key == key && !slices.Contains(metaOutputs, dep.MetaOutput) {
+				metaOutputs = append(metaOutputs, dep.MetaOutput)
+			}
+		}
+
+		switch len(metaOutputs) {
+		case 0:
+			metaOutput = defaultTriggerMetaOutput
+		case 1:
+			metaOutput = metaOutputs[0]
+		default:
+			verr.add("meta_output", "action %q is followed on %s, choose one", key, strings.Join(metaOutputs, ", "))
+			return nil, "", verr
+		}
+	}
+
+	return &actions[i], metaOutput, nil
+}
+
+// WaitRun waits until a run ends and returns its final context. When ctx
+// is done first, the run is returned as it stands.
+func (u *Usecase) WaitRun(ctx context.Context, tenantID, flowID, sessionID string) (*TriggerRunResponse, error) {
+	ticker := time.NewTicker(runWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		// the run is only recorded once the workflow received its trigger
+		run, err := u.storage.GetRun(ctx, tenantID, flowID, sessionID)
+		if err != nil && !errors.Is(err, spider.ErrNotFound) {
+			return nil, err
+		}
+
+		if run != nil && run.EndedAt != nil {
+			return buildTriggerRunResponse(run), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if run == nil {
+				return nil, fmt.Errorf("run %s not started: %w", sessionID, ctx.Err())
+			}
+
+			return buildTriggerRunResponse(run), nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func buildTriggerRunResponse(run *spider.Run) *TriggerRunResponse {
+	output := map[string]interface{}{
+		"output": run.TriggerPayload,
+	}
+
+	contextVal := map[string]map[string]interface{}{
+		run.TriggerKey: output,
+		"$trigger":     output,
+	}
+
+	// steps are in start order, so the last output of a key wins
+	for _, step := range run.Steps {
+		if step.Status == spider.RunStepStatusSucceeded {
+			contextVal[step.Key] = map[string]interface{}{
+				"output": step.Output,
+			}
+		}
+	}
+
+	return &TriggerRunResponse{
+		SessionID: run.SessionID,
+		Status:    run.Status,
+		Error:     run.Error,
+		Context:   contextVal,
+	}
+}
+
+// CancelRun ends a running or held run as cancelled. Its active steps are
+// finished too, so their outputs are ignored and nothing follows them, and
+// the workers still processing its inputs are told to stop.
+func (u *Usecase) CancelRun(ctx context.Context, tenantID, flowID, sessionID string) (*spider.Run, error) {
+	// the run is looked up by tenant first, UpdateRunStatus is not
+	run, err := u.storage.GetRun(ctx, tenantID, flowID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	cause := spider.ErrRunCancelled.Error()
+	endedAt := time.Now()
+
+	cancelled, err := u.storage.UpdateRunStatus(ctx, flowID, sessionID, &spider.UpdateRunStatusRequest{
+		From:    []spider.RunStatus{spider.RunStatusRunning, spider.RunStatusHeld},
+		To:      spider.RunStatusCancelled,
+		Error:   cause,
+		EndedAt: &endedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !cancelled {
+		return nil, fmt.Errorf("%w: %s", ErrRunEnded, run.Status)
+	}
+
+	// the steps dispatched before the run was cancelled
+	run, err = u.storage.GetRun(ctx, tenantID, flowID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range run.Steps {
+		finished, err := u.storage.FinishRunStep(ctx, flowID, sessionID, step.TaskID, &spider.FinishRunStepRequest{
+			Status:  spider.RunStepStatusCancelled,
+			Error:   cause,
+			EndedAt: endedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !finished {
+			continue
+		}
+
+		err = u.storage.DeleteSessionContext(ctx, flowID, sessionID, step.TaskID)
+		if err != nil && !errors.Is(err, spider.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	err = u.storage.DeleteSessionJoins(ctx, flowID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.messenger.SendCancelMessage(ctx, spider.CancelMessage{
+		TenantID:   tenantID,
+		WorkflowID: flowID,
+		SessionID:  sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u.storage.GetRun(ctx, tenantID, flowID, sessionID)
+}
+
+// releaseHeldRuns sends the triggers of the runs held while the flow was
+// paused again, oldest first. The workflow resumes each held run instead of
+// starting a new one.
+func (u *Usecase) releaseHeldRuns(ctx context.Context, tenantID, flowID string) error {
+	runs, err := u.listHeldRuns(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	slices.Reverse(runs)
+
+	for _, run := range runs {
+		values, err := json.Marshal(run.TriggerPayload)
+		if err != nil {
+			return err
+		}
+
+		err = u.messenger.SendTriggerMessage(ctx, spider.TriggerMessage{
+			TenantID:   run.TenantID,
+			WorkflowID: run.WorkflowID,
+			Key:        run.TriggerKey,
+			MetaOutput: run.TriggerMetaOutput,
+			Values:     string(values),
+			SessionID:  run.SessionID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *Usecase) rejectHeldRuns(ctx context.Context, tenantID, flowID string) error {
+	runs, err := u.listHeldRuns(ctx, tenantID, flowID)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		endedAt := time.Now()
+
+		_, err := u.storage.UpdateRunStatus(ctx, flowID, run.SessionID, &spider.UpdateRunStatusRequest{
+			From:    []spider.RunStatus{spider.RunStatusHeld},
+			To:      spider.RunStatusRejected,
+			Error:   "flow is archived",
+			EndedAt: &endedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listHeldRuns returns every held run of a flow, newest first.
+func (u *Usecase) listHeldRuns(ctx context.Context, tenantID, flowID string) ([]spider.Run, error) {
+	var runs []spider.Run
+
+	for page := 1; ; page++ {
+		result, err := u.storage.ListRuns(ctx, &spider.ListRunsRequest{
+			TenantID:   tenantID,
+			WorkflowID: flowID,
+			Status:     spider.RunStatusHeld,
+			Page:       page,
+			PageSize:   100,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, result.Runs...)
+
+		if len(result.Runs) < result.PageSize || int64(len(runs)) >= result.Total {
+			return runs, nil
+		}
+	}
+}
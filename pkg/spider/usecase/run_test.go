@@ -0,0 +1,149 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+func TestCancelRun(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+	sessionID := "session"
+	startedAt := time.Now()
+
+	err := u.storage.CreateRun(ctx, &spider.Run{
+		SessionID:  sessionID,
+		TenantID:   testTenantID,
+		WorkflowID: flowID,
+		Status:     spider.RunStatusRunning,
+		TriggerKey: "start",
+		StartedAt:  startedAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	steps := map[string]spider.RunStepStatus{
+		"done":    spider.RunStepStatusSucceeded,
+		"running": spider.RunStepStatusRunning,
+	}
+
+	for taskID, status := range steps {
+		err := u.storage.AddRunStep(ctx, &spider.RunStep{
+			TaskID:     taskID,
+			SessionID:  sessionID,
+			TenantID:   testTenantID,
+			WorkflowID: flowID,
+			Key:        "echo",
+			ActionID:   "echo",
+			Status:     status,
+			Attempt:    1,
+			StartedAt:  startedAt,
+		})
+		if err != nil {
+			t.Fatalf("AddRunStep: %v", err)
+		}
+
+		err = u.storage.CreateSessionContext(ctx, &spider.SessionContext{
+			TenantID:   testTenantID,
+			WorkflowID: flowID,
+			SessionID:  sessionID,
+			TaskID:     taskID,
+			Value: map[string]map[string]interface{}{
+				"$trigger": {"output": map[string]interface{}{}},
+			},
+			CreatedAt: startedAt,
+		})
+		if err != nil {
+			t.Fatalf("CreateSessionContext: %v", err)
+		}
+	}
+
+	_, err = u.CancelRun(ctx, "other", flowID, sessionID)
+	if !errors.Is(err, spider.ErrNotFound) {
+		t.Fatalf("CancelRun of another tenant: %v, want %v", err, spider.ErrNotFound)
+	}
+
+	run, err := u.CancelRun(ctx, testTenantID, flowID, sessionID)
+	if err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+
+	if run.Status != spider.RunStatusCancelled || run.EndedAt == nil {
+		t.Fatalf("run %s, want ended %s", run.Status, spider.RunStatusCancelled)
+	}
+
+	for _, step := range run.Steps {
+		want := spider.RunStepStatusSucceeded
+		if step.TaskID == "running" {
+			want = spider.RunStepStatusCancelled
+		}
+
+		if step.Status != want {
+			t.Errorf("step %s %s, want %s", step.TaskID, step.Status, want)
+		}
+	}
+
+	// only the context of the cancelled step is dropped, the other one is
+	// left to the end of its task
+	_, err = u.storage.GetSessionContext(ctx, flowID, sessionID, "running")
+	if !errors.Is(err, spider.ErrNotFound) {
+		t.Errorf("context of the cancelled step: %v, want %v", err, spider.ErrNotFound)
+	}
+
+	_, err = u.storage.GetSessionContext(ctx, flowID, sessionID, "done")
+	if err != nil {
+		t.Errorf("context of the finished step: %v", err)
+	}
+
+	if len(u.messenger.cancels) != 1 || u.messenger.cancels[0].SessionID != sessionID {
+		t.Fatalf("cancel messages %v, want one for %s", u.messenger.cancels, sessionID)
+	}
+
+	_, err = u.CancelRun(ctx, testTenantID, flowID, sessionID)
+	if !errors.Is(err, usecase.ErrRunEnded) {
+		t.Fatalf("CancelRun of a cancelled run: %v, want %v", err, usecase.ErrRunEnded)
+	}
+
+	if len(u.messenger.cancels) != 1 {
+		t.Fatalf("%d cancel messages, want 1", len(u.messenger.cancels))
+	}
+}
+
+func TestCancelHeldRun(t *testing.T) {
+	ctx := context.Background()
+	u := newTestUsecase(t)
+	flowID := u.createFlow(t)
+
+	err := u.setFlowStatus(t, flowID, spider.FlowStatusPaused)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	sessionIDs := u.createHeldRuns(t, flowID, 2)
+
+	run, err := u.CancelRun(ctx, testTenantID, flowID, sessionIDs[0])
+	if err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+
+	if run.Status != spider.RunStatusCancelled {
+		t.Fatalf("run %s, want %s", run.Status, spider.RunStatusCancelled)
+	}
+
+	// the cancelled run is not resumed with the flow
+	err = u.setFlowStatus(t, flowID, spider.FlowStatusActive)
+	if err != nil {
+		t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	if len(u.messenger.triggers) != 1 || u.messenger.triggers[0].SessionID != sessionIDs[1] {
+		t.Fatalf("triggers %v, want one for %s", u.messenger.triggers, sessionIDs[1])
+	}
+}
@@ -0,0 +1,11 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+func (u *Usecase) ListSessionContextUsage(ctx context.Context) ([]spider.SessionContextUsage, error) {
+	return u.storage.ListSessionContextUsage(ctx)
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/targc/spider-go/pkg/spider"
+)
+
+// SimulateFlowRequest walks a flow from a trigger with stubbed action
+// outputs. Key and MetaOutput default as in TriggerRunRequest.
+type SimulateFlowRequest struct {
+	TenantID   string                            `json:"tenant_id"`
+	FlowID     string                            `json:"flow_id"`
+	Key        string                            `json:"key,omitempty"`
+	MetaOutput string                            `json:"meta_output,omitempty"`
+	Payload    map[string]interface{}            `json:"payload"`
+	Outputs    map[string]spider.SimulatedOutput `json:"outputs"`
+}
+
+// SimulateFlow walks the current graph of a flow as a run would, without
+// sending anything to the workers nor recording a run. Draft flows can be
+// simulated too.
+func (u *Usecase) SimulateFlow(ctx context.Context, req *SimulateFlowRequest) (*spider.Simulation, error) {
+	flow, err := u.storage.GetFlow(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := u.storage.GetWorkflowActions(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := u.storage.GetWorkflowActionDeps(ctx, req.TenantID, req.FlowID)
+	if err != nil {
+		return nil, err
+	}
+
+	action, metaOutput, err := resolveTriggerEntry(actions, deps, req.Key, req.MetaOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	for _, key := range slices.Sorted(maps.Keys(req.Outputs)) {
+		known := slices.ContainsFunc(actions, func(action spider.WorkflowAction) bool {
+			return action.Key == key
+		})
+		if !known {
+			verr.add("outputs."+key, "unknown action key %q", key)
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	snapshot := &spider.FlowSnapshot{
+		TenantID:   req.TenantID,
+		WorkflowID: req.FlowID,
+		Version:    flow.Version,
+		Actions:    actions,
+		Deps:       deps,
+	}
+
+	return spider.Simulate(snapshot, &spider.SimulateRequest{
+		TriggerKey:        action.Key,
+		TriggerMetaOutput: metaOutput,
+		Payload:           req.Payload,
+		Outputs:           req.Outputs,
+	})
+}
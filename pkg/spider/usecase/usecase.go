@@ -1,15 +1,46 @@
 package usecase
 
 import (
+	"context"
+
+	"github.com/sethvargo/go-envconfig"
 	"github.com/targc/spider-go/pkg/spider"
 )
 
 type Usecase struct {
-	storage spider.WorkflowStorageAdapter
+	storage   spider.WorkflowStorageAdapter
+	messenger spider.WorkflowMessengerAdapter
+	actionIDs map[string]bool
+}
+
+// InitUsecase reads the action IDs flows may use from SPIDER_ACTION_IDS, a
+// comma separated list. Flows may use any action ID when it is empty.
+func InitUsecase(ctx context.Context, storage spider.WorkflowStorageAdapter, messenger spider.WorkflowMessengerAdapter) (*Usecase, error) {
+	type Env struct {
+		ActionIDs []string `env:"SPIDER_ACTION_IDS"`
+	}
+
+	var env Env
+
+	err := envconfig.Process(ctx, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUsecase(storage, messenger, env.ActionIDs...), nil
 }
 
-func NewUsecase(storage spider.WorkflowStorageAdapter) *Usecase {
+// NewUsecase returns a usecase whose flows may only use actionIDs, or any
+// action ID when none is given.
+func NewUsecase(storage spider.WorkflowStorageAdapter, messenger spider.WorkflowMessengerAdapter, actionIDs ...string) *Usecase {
+	known := map[string]bool{}
+	for _, actionID := range actionIDs {
+		known[actionID] = true
+	}
+
 	return &Usecase{
-		storage: storage,
+		storage:   storage,
+		messenger: messenger,
+		actionIDs: known,
 	}
 }
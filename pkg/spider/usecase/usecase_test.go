@@ -0,0 +1,128 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+const testTenantID = "tenant"
+
+// recordingMessenger is the memory messenger, keeping the trigger and
+// cancel messages the usecase sends. Triggers fail with triggerErr when it
+// is set.
+type recordingMessenger struct {
+	spider.WorkflowMessengerAdapter
+	mu         sync.Mutex
+	triggers   []spider.TriggerMessage
+	cancels    []spider.CancelMessage
+	triggerErr error
+}
+
+func (m *recordingMessenger) SendTriggerMessage(ctx context.Context, message spider.TriggerMessage) error {
+	m.mu.Lock()
+	if m.triggerErr != nil {
+		m.mu.Unlock()
+		return m.triggerErr
+	}
+	m.triggers = append(m.triggers, message)
+	m.mu.Unlock()
+
+	return m.WorkflowMessengerAdapter.SendTriggerMessage(ctx, message)
+}
+
+func (m *recordingMessenger) SendCancelMessage(ctx context.Context, message spider.CancelMessage) error {
+	m.mu.Lock()
+	m.cancels = append(m.cancels, message)
+	m.mu.Unlock()
+
+	return m.WorkflowMessengerAdapter.SendCancelMessage(ctx, message)
+}
+
+type testUsecase struct {
+	*usecase.Usecase
+	storage   *spider.MemoryWorkflowStorageAdapter
+	messenger *recordingMessenger
+}
+
+func newTestUsecase(t *testing.T) *testUsecase {
+	t.Helper()
+
+	storage := spider.NewMemoryWorkflowStorageAdapter()
+
+	messenger := &recordingMessenger{
+		WorkflowMessengerAdapter: spider.NewMemoryWorkflowMessengerAdapter(spider.NewMemoryBroker(spider.MemoryBrokerOpt{})),
+	}
+
+	t.Cleanup(func() {
+		_ = messenger.Close(context.Background())
+	})
+
+	return &testUsecase{
+		Usecase:   usecase.NewUsecase(storage, messenger, "echo", "route"),
+		storage:   storage,
+		messenger: messenger,
+	}
+}
+
+// createFlow creates a flow of two actions, start then echo.
+func (u *testUsecase) createFlow(t *testing.T) string {
+	t.Helper()
+
+	flow, err := u.CreateFlow(context.Background(), &usecase.CreateFlowRequest{
+		TenantID:    testTenantID,
+		Name:        "flow",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Actions: []usecase.WorkflowActionInput{
+			{Key: "start", ActionID: "route"},
+			{Key: "echo", ActionID: "echo"},
+		},
+		Peers: []usecase.PeerInput{
+			{ParentKey: "start", MetaOutput: "success", ChildKey: "echo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateFlow: %v", err)
+	}
+
+	return flow.FlowID
+}
+
+func (u *testUsecase) setFlowStatus(t *testing.T, flowID string, status spider.FlowStatus) error {
+	t.Helper()
+
+	_, err := u.UpdateFlow(context.Background(), &usecase.UpdateFlowRequest{
+		TenantID:    testTenantID,
+		FlowID:      flowID,
+		Name:        "flow",
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Status:      status,
+	})
+
+	return err
+}
+
+// requireFields fails unless err is a *usecase.ValidationError listing
+// exactly fields.
+func requireFields(t *testing.T, err error, fields ...string) {
+	t.Helper()
+
+	var verr *usecase.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %v, want a validation error", err)
+	}
+
+	var got []string
+	for _, field := range verr.Fields {
+		got = append(got, field.Field)
+	}
+
+	if !slices.Equal(got, fields) {
+		t.Fatalf("fields %v, want %v: %v", got, fields, err)
+	}
+}
@@ -11,6 +11,18 @@ type Worker struct {
 	actionID  string
 }
 
+func InitWorker(
+	messenger WorkerMessengerAdapter,
+	storage WorkerStorageAdapter,
+	actionID string,
+) *Worker {
+	return &Worker{
+		messenger,
+		storage,
+		actionID,
+	}
+}
+
 func InitDefaultWorker(
 	ctx context.Context,
 	actionID string,
@@ -23,7 +35,7 @@ func InitDefaultWorker(
 		return nil, err
 	}
 
-	storage, err := InitMongodDBWorkerStorageAdapter(ctx)
+	storage, err := InitDefaultWorkerStorageAdapter(ctx)
 
 	if err != nil {
 		return nil, err
@@ -54,9 +66,29 @@ func (w *Worker) Run(ctx context.Context, h func(c InputMessageContext, m InputM
 
 			err := h(c, m)
 
+			if err != nil && runCancelled(c.Context) {
+				slog.Info(
+					"handler stopped, run cancelled",
+					slog.String("session_id", m.SessionID),
+					slog.String("task_id", m.TaskID),
+				)
+
+				return nil
+			}
+
 			if err != nil {
 				slog.Error("failed to process handler", slog.String("error", err.Error()))
-				return err
+
+				// the workflow owns the retry policy, so the failure is
+				// reported instead of being redelivered to this handler
+				serr := w.messenger.SendOutputMessage(c.Context, m.ToFailedOutputMessage(err))
+
+				if serr != nil {
+					slog.Error("failed to report handler error", slog.String("error", serr.Error()))
+					return err
+				}
+
+				return nil
 			}
 
 			return nil
@@ -3,8 +3,12 @@ package spider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/expr-lang/expr"
 	"github.com/google/uuid"
@@ -12,8 +16,10 @@ import (
 )
 
 type Workflow struct {
-	messenger WorkflowMessengerAdapter
-	storage   WorkflowStorageAdapter
+	messenger  WorkflowMessengerAdapter
+	storage    WorkflowStorageAdapter
+	snapshots  *flowSnapshotCache
+	retentions *flowRetentionCache
 }
 
 func InitWorkflow(
@@ -23,6 +29,8 @@ func InitWorkflow(
 	return &Workflow{
 		messenger,
 		storage,
+		newFlowSnapshotCache(),
+		newFlowRetentionCache(),
 	}
 }
 
@@ -37,9 +45,7 @@ func InitDefaultWorkflow(
 		return nil, err
 	}
 
-	storage, err := InitMongodDBWorkflowStorageAdapter(ctx, InitMongodDBWorkflowStorageAdapterOpt{
-		BetaAutoSetupSchema: true,
-	})
+	storage, err := InitDefaultWorkflowStorageAdapter(ctx)
 
 	if err != nil {
 		return nil, err
@@ -48,6 +54,8 @@ func InitDefaultWorkflow(
 	return &Workflow{
 		messenger,
 		storage,
+		newFlowSnapshotCache(),
+		newFlowRetentionCache(),
 	}, nil
 }
 
@@ -71,6 +79,10 @@ func (w *Workflow) Run(ctx context.Context) error {
 		return w.listenOutputMessages(ctx)
 	})
 
+	eg.Go(func() error {
+		return w.runScheduler(ctx)
+	})
+
 	err := eg.Wait()
 
 	if err != nil {
@@ -84,16 +96,22 @@ func (w *Workflow) listenTriggerMessages(ctx context.Context) error {
 
 	err := w.messenger.ListenTriggerMessages(ctx, func(c TriggerMessageContext, m TriggerMessage) error {
 
-		workflowAction, err := w.storage.QueryWorkflowAction(c.Context, m.TenantID, m.WorkflowID, m.Key)
+		flow, err := w.storage.GetFlow(c.Context, m.TenantID, m.WorkflowID)
 
 		if err != nil {
-			slog.Error(
-				"QueryWorkflowAction failed",
-				slog.Any("error", err.Error()),
-				slog.Any("workflow_id", m.WorkflowID),
-				slog.Any("key", m.Key),
-			)
+			slog.Error("GetFlow failed", slog.Any("error", err.Error()))
+			return err
+		}
+
+		snapshot, err := w.currentFlowSnapshot(ctx, flow)
 
+		if err != nil {
+			return err
+		}
+
+		workflowAction, err := snapshotAction(snapshot, m.Key)
+
+		if err != nil {
 			return err
 		}
 
@@ -110,13 +128,15 @@ func (w *Workflow) listenTriggerMessages(ctx context.Context) error {
 			return err
 		}
 
-		sessionUUID, err := uuid.NewV7()
+		sessionID, started, err := w.startRun(ctx, flow, snapshot, m, wvalues)
 
 		if err != nil {
 			return err
 		}
 
-		sessionID := sessionUUID.String()
+		if !started {
+			return nil
+		}
 
 		nextContextVal := map[string]map[string]interface{}{}
 
@@ -126,101 +146,163 @@ func (w *Workflow) listenTriggerMessages(ctx context.Context) error {
 
 		nextContextVal["$trigger"] = nextContextVal[m.Key]
 
-		deps, err := w.storage.QueryWorkflowActionDependencies(c.Context, m.TenantID, m.WorkflowID, m.Key, m.MetaOutput)
+		deps := snapshot.Dependencies(m.Key, m.MetaOutput)
+
+		err = w.dispatch(ctx, snapshot, sessionID, "", m.Key, nextContextVal, deps)
+
+		// a failing mapper fails again on every redelivery
+		if ErrorClassOf(err) == ErrorClassPermanent {
+			w.failRun(ctx, m.WorkflowID, sessionID, err)
+			return nil
+		}
 
 		if err != nil {
-			slog.Error("QueryWorkflowActionDependencies failed", slog.Any("error", err.Error()))
+
+			// a trigger without a session starts another run when redelivered
+			if m.SessionID == "" && m.NewSessionID == "" {
+				w.failRun(ctx, m.WorkflowID, sessionID, err)
+			}
+
 			return err
 		}
 
-		eg := errgroup.Group{}
+		w.completeRunIfIdle(ctx, m.WorkflowID, sessionID)
 
-		eg.SetLimit(10)
+		return nil
+	})
 
-		for _, dep := range deps {
-			eg.Go(func() error {
+	return err
+}
 
-				nextTaskUUID, err := uuid.NewV7()
+// startRun records the run of a trigger according to the status of its
+// flow and reports whether the run should proceed. Triggers of paused flows
+// are held, and a held run is resumed when its trigger is sent again with
+// its session ID once the flow is active.
+func (w *Workflow) startRun(ctx context.Context, flow *Flow, snapshot *FlowSnapshot, m TriggerMessage, wvalues map[string]interface{}) (string, bool, error) {
 
-				if err != nil {
-					return err
-				}
+	now := time.Now()
+
+	var deadlineAt *time.Time
 
-				nextTaskID := nextTaskUUID.String()
+	if flow.Deadline > 0 {
+		t := now.Add(time.Duration(flow.Deadline))
+		deadlineAt = &t
+	}
 
-				err = w.storage.CreateSessionContext(ctx, m.WorkflowID, sessionID, nextTaskID, nextContextVal)
+	if m.SessionID != "" {
 
-				if err != nil {
-					slog.Error("CreateSessionContext failed", slog.Any("error", err.Error()))
-					return err
-				}
+		// the flow may have been paused again since the release
+		if flow.Status != FlowStatusActive {
+			return "", false, nil
+		}
 
-				nextInput, err := ex(nextContextVal, dep.Map)
+		released, err := w.storage.UpdateRunStatus(ctx, m.WorkflowID, m.SessionID, &UpdateRunStatusRequest{
+			From:        []RunStatus{RunStatusHeld},
+			To:          RunStatusRunning,
+			DeadlineAt:  deadlineAt,
+			FlowVersion: snapshot.Version,
+		})
 
-				if err != nil {
-					slog.Error("marshal next input failed", slog.Any("error", err.Error()))
-					return err
-				}
+		if err != nil {
+			slog.Error("UpdateRunStatus failed", slog.Any("error", err.Error()))
+			return "", false, err
+		}
 
-				nextInputb, err := json.Marshal(nextInput)
+		if !released {
+			return w.resumeRun(ctx, m.WorkflowID, m.SessionID)
+		}
 
-				if err != nil {
-					slog.Error("marshal next input failed", slog.Any("error", err.Error()))
-					return err
-				}
+		return m.SessionID, true, nil
+	}
 
-				err = w.messenger.SendInputMessage(ctx, InputMessage{
-					SessionID:  sessionID,
-					TaskID:     nextTaskID,
-					TenantID:   dep.TenantID,
-					WorkflowID: dep.WorkflowID,
-					// TODO
-					// WorkflowActionID: dep.ID,
-					Key:      dep.Key,
-					ActionID: dep.ActionID,
-					Values:   string(nextInputb),
-				})
+	if flow.Status == FlowStatusDraft {
+		slog.Info(
+			"trigger ignored, flow is draft",
+			slog.String("workflow_id", m.WorkflowID),
+			slog.String("key", m.Key),
+		)
 
-				if err != nil {
-					slog.Error("sent input message failed", slog.Any("error", err.Error()))
-					return err
-				}
+		return "", false, nil
+	}
 
-				return nil
-			})
-		}
+	sessionID := m.NewSessionID
 
-		err = eg.Wait()
+	if sessionID == "" {
+		sessionUUID, err := uuid.NewV7()
 
 		if err != nil {
-			return err
+			return "", false, err
 		}
 
-		return nil
-	})
+		sessionID = sessionUUID.String()
+	}
 
-	return err
+	run := Run{
+		SessionID:         sessionID,
+		TenantID:          m.TenantID,
+		WorkflowID:        m.WorkflowID,
+		FlowVersion:       snapshot.Version,
+		Status:            RunStatusRunning,
+		TriggerKey:        m.Key,
+		TriggerMetaOutput: m.MetaOutput,
+		TriggerPayload:    wvalues,
+		StartedAt:         now,
+		DeadlineAt:        deadlineAt,
+	}
+
+	switch flow.Status {
+	case FlowStatusActive:
+	case FlowStatusPaused:
+		run.Status = RunStatusHeld
+		run.DeadlineAt = nil
+	default:
+		run.Status = RunStatusRejected
+		run.Error = fmt.Sprintf("flow is %s", flow.Status)
+		run.DeadlineAt = nil
+		run.EndedAt = &now
+	}
+
+	err := w.storage.CreateRun(ctx, &run)
+
+	if errors.Is(err, ErrAlreadyExists) {
+		return w.resumeRun(ctx, m.WorkflowID, sessionID)
+	}
+
+	if err != nil {
+		slog.Error("CreateRun failed", slog.Any("error", err.Error()))
+		return "", false, err
+	}
+
+	return sessionID, run.Status == RunStatusRunning, nil
+}
+
+// resumeRun reports whether the run of a redelivered trigger, already
+// started, is still running, so its dispatch is replayed.
+func (w *Workflow) resumeRun(ctx context.Context, workflowID, sessionID string) (string, bool, error) {
+
+	running, err := w.runRunning(ctx, workflowID, sessionID)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return sessionID, running, nil
 }
 
 func (w *Workflow) listenOutputMessages(ctx context.Context) error {
 
 	err := w.messenger.ListenOutputMessages(ctx, func(c OutputMessageContext, m OutputMessage) error {
 
-		workflowAction, err := w.storage.QueryWorkflowAction(c.Context, m.TenantID, m.WorkflowID, m.Key)
+		snapshot, err := w.flowSnapshot(c.Context, m.TenantID, m.WorkflowID, m.FlowVersion)
 
 		if err != nil {
-			slog.Error(
-				"QueryWorkflowAction failed",
-				slog.Any("error", err.Error()),
-				slog.Any("workflow_id", m.WorkflowID),
-				slog.Any("key", m.Key),
-			)
-
 			return err
 		}
 
-		if workflowAction.Disabled {
-			return nil
+		workflowAction, err := snapshotAction(snapshot, m.Key)
+
+		if err != nil {
+			return err
 		}
 
 		wvalues := map[string]interface{}{}
@@ -232,8 +314,50 @@ func (w *Workflow) listenOutputMessages(ctx context.Context) error {
 			return err
 		}
 
+		if m.Error != "" {
+			return w.handleStepFailure(ctx, m, workflowAction)
+		}
+
+		step, err := w.storage.GetRunStep(ctx, m.WorkflowID, m.SessionID, m.TaskID)
+
+		if err != nil {
+			slog.Error("GetRunStep failed", slog.Any("error", err.Error()))
+			return err
+		}
+
+		if !slices.Contains(activeRunStepStatuses, step.Status) {
+			slog.Warn(
+				"step is not running, output ignored",
+				slog.String("session_id", m.SessionID),
+				slog.String("task_id", m.TaskID),
+			)
+
+			return nil
+		}
+
+		running, err := w.runRunning(ctx, m.WorkflowID, m.SessionID)
+
+		if err != nil {
+			return err
+		}
+
+		// the run ended meanwhile, its steps are not followed anymore
+		if !running {
+			return w.finishRunStep(ctx, m, wvalues)
+		}
+
+		if workflowAction.Disabled {
+			return w.finishRunStep(ctx, m, wvalues)
+		}
+
 		wcontext, err := w.storage.GetSessionContext(ctx, m.WorkflowID, m.SessionID, m.TaskID)
 
+		if errors.Is(err, ErrNotFound) {
+			slog.Error("GetSessionContext failed", slog.Any("error", err.Error()))
+			w.failRun(ctx, m.WorkflowID, m.SessionID, err)
+			return PermanentError(err)
+		}
+
 		if err != nil {
 			slog.Error("GetSessionContext failed", slog.Any("error", err.Error()))
 			return err
@@ -244,87 +368,388 @@ func (w *Workflow) listenOutputMessages(ctx context.Context) error {
 			"output": wvalues,
 		}
 
-		deps, err := w.storage.QueryWorkflowActionDependencies(c.Context, m.TenantID, m.WorkflowID, m.Key, m.MetaOutput)
+		deps := snapshot.Dependencies(m.Key, m.MetaOutput)
 
-		if err != nil {
-			slog.Error("QueryWorkflowActionDependencies failed", slog.Any("error", err.Error()))
+		// the children are recorded before the step finishes, so the run
+		// is never seen idle in between, and the step stays running until
+		// they all are, so a redelivered output replays the dispatch
+		err = w.dispatch(ctx, snapshot, m.SessionID, m.TaskID, m.Key, nextContextVal, deps)
+
+		if err != nil && ErrorClassOf(err) != ErrorClassPermanent {
 			return err
 		}
 
-		err = w.storage.DeleteSessionContext(ctx, m.WorkflowID, m.SessionID, m.TaskID)
-
+		// a failing mapper fails again on every redelivery
 		if err != nil {
-			slog.Error("DeleteSessionContext failed", slog.Any("error", err.Error()))
-			return err
+			w.failRun(ctx, m.WorkflowID, m.SessionID, err)
 		}
 
-		eg := errgroup.Group{}
+		return w.finishRunStep(ctx, m, wvalues)
+	})
 
-		eg.SetLimit(10)
+	return err
+}
 
-		for _, dep := range deps {
-			eg.Go(func() error {
+// finishRunStep records the output of a step whose children, if any, were
+// dispatched, and completes the run once it was its last active step.
+func (w *Workflow) finishRunStep(ctx context.Context, m OutputMessage, wvalues map[string]interface{}) error {
 
-				nextTaskUUID, err := uuid.NewV7()
+	finished, err := w.storage.FinishRunStep(ctx, m.WorkflowID, m.SessionID, m.TaskID, &FinishRunStepRequest{
+		Status:     RunStepStatusSucceeded,
+		MetaOutput: m.MetaOutput,
+		Output:     wvalues,
+		EndedAt:    time.Now(),
+	})
 
-				if err != nil {
-					return err
-				}
+	if err != nil {
+		slog.Error("FinishRunStep failed", slog.Any("error", err.Error()))
+		return err
+	}
 
-				nextTaskID := nextTaskUUID.String()
+	if !finished {
+		return nil
+	}
 
-				err = w.storage.CreateSessionContext(ctx, m.WorkflowID, m.SessionID, nextTaskID, nextContextVal)
+	// the children carry their own context from here on
+	w.deleteSessionContext(ctx, m.WorkflowID, m.SessionID, m.TaskID)
 
-				if err != nil {
-					slog.Error("CreateSessionContext failed", slog.Any("error", err.Error()))
-					return err
-				}
+	w.completeRunIfIdle(ctx, m.WorkflowID, m.SessionID)
 
-				nextInput, err := ex(nextContextVal, dep.Map)
+	return nil
+}
 
-				if err != nil {
-					slog.Error("ex failed", slog.Any("error", err.Error()))
-					return err
-				}
+// dispatch sends the next input message to every dependency of parentKey,
+// recording a run step and a session context for each new task. Task IDs
+// derive from parentTaskID, so dispatching again after a failure records
+// the same tasks and sends the inputs of the ones still running again. A
+// mapper that fails returns a permanent error.
+func (w *Workflow) dispatch(ctx context.Context, snapshot *FlowSnapshot, sessionID, parentTaskID, parentKey string, contextVal map[string]map[string]interface{}, deps []WorkflowAction) error {
+
+	eg := errgroup.Group{}
+
+	eg.SetLimit(10)
+
+	for _, dep := range deps {
+		eg.Go(func() error {
+
+			taskContextVal := contextVal
+
+			nextTaskID := childTaskID(sessionID, parentTaskID, dep.Key)
 
-				nextInputb, err := json.Marshal(nextInput)
+			if dep.Join != nil {
+				joined, ok, err := w.join(ctx, sessionID, parentKey, dep, contextVal, snapshot.Deps)
 
 				if err != nil {
-					slog.Error("marshal next input failed", slog.Any("error", err.Error()))
+					slog.Error("join failed", slog.Any("error", err.Error()))
 					return err
 				}
 
-				err = w.messenger.SendInputMessage(ctx, InputMessage{
-					SessionID:  m.SessionID,
-					TaskID:     nextTaskID,
-					TenantID:   dep.TenantID,
-					WorkflowID: dep.WorkflowID,
-					// TODO
-					// WorkflowActionID: dep.ID,
-					Key:      dep.Key,
-					ActionID: dep.ActionID,
-					Values:   string(nextInputb),
-				})
+				if !ok {
+					return nil
+				}
+
+				taskContextVal = joined
+
+				// a join is dispatched once per session, whatever parent
+				// completes it
+				nextTaskID = childTaskID(sessionID, "", dep.Key)
+			}
+
+			step := RunStep{
+				TaskID:      nextTaskID,
+				SessionID:   sessionID,
+				TenantID:    dep.TenantID,
+				WorkflowID:  dep.WorkflowID,
+				Key:         dep.Key,
+				ActionID:    dep.ActionID,
+				Status:      RunStepStatusRunning,
+				Attempt:     1,
+				FlowVersion: snapshot.Version,
+				StartedAt:   time.Now(),
+				DeadlineAt:  stepDeadline(dep.Timeout),
+			}
+
+			nextInput, err := ex(taskContextVal, dep.Map)
+
+			if err != nil {
+				slog.Error("ex failed", slog.Any("error", err.Error()))
+
+				endedAt := time.Now()
+
+				step.Status = RunStepStatusFailed
+				step.Error = err.Error()
+				step.EndedAt = &endedAt
+
+				_ = w.storage.AddRunStep(ctx, &step)
+
+				return PermanentError(err)
+			}
+
+			step.Input = nextInput
+
+			running, err := w.runRunning(ctx, dep.WorkflowID, sessionID)
+
+			if err != nil {
+				return err
+			}
+
+			// the run ended while its steps were being dispatched
+			if !running {
+				return nil
+			}
+
+			err = w.storage.AddRunStep(ctx, &step)
+
+			if err != nil && !errors.Is(err, ErrAlreadyExists) {
+				slog.Error("AddRunStep failed", slog.Any("error", err.Error()))
+				return err
+			}
+
+			// a replayed dispatch finds the task it recorded, and sends its
+			// input again unless the task moved on since
+			if err != nil {
+
+				recorded, err := w.storage.GetRunStep(ctx, dep.WorkflowID, sessionID, nextTaskID)
 
 				if err != nil {
-					slog.Error("sent input message failed", slog.Any("error", err.Error()))
+					slog.Error("GetRunStep failed", slog.Any("error", err.Error()))
 					return err
 				}
 
-				return nil
+				if recorded.Status != RunStepStatusRunning {
+					return nil
+				}
+
+				step = *recorded
+			}
+
+			nextInputb, err := json.Marshal(step.Input)
+
+			if err != nil {
+				slog.Error("marshal next input failed", slog.Any("error", err.Error()))
+				return err
+			}
+
+			expiresAt, err := w.sessionContextExpiry(ctx, dep.TenantID, dep.WorkflowID, step.StartedAt)
+
+			if err != nil {
+				return err
+			}
+
+			err = w.storage.CreateSessionContext(ctx, &SessionContext{
+				TenantID:   dep.TenantID,
+				WorkflowID: dep.WorkflowID,
+				SessionID:  sessionID,
+				TaskID:     nextTaskID,
+				Value:      taskContextVal,
+				CreatedAt:  step.StartedAt,
+				ExpiresAt:  expiresAt,
 			})
+
+			if err != nil && !errors.Is(err, ErrAlreadyExists) {
+				slog.Error("CreateSessionContext failed", slog.Any("error", err.Error()))
+				return err
+			}
+
+			err = w.messenger.SendInputMessage(ctx, InputMessage{
+				SessionID:  sessionID,
+				TaskID:     nextTaskID,
+				TenantID:   dep.TenantID,
+				WorkflowID: dep.WorkflowID,
+				// TODO
+				// WorkflowActionID: dep.ID,
+				Key:         dep.Key,
+				ActionID:    dep.ActionID,
+				Values:      string(nextInputb),
+				Attempt:     step.Attempt,
+				FlowVersion: step.FlowVersion,
+			})
+
+			if err != nil {
+				slog.Error("sent input message failed", slog.Any("error", err.Error()))
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
+
+// childTaskID derives the task ID of the child key of parentTaskID within a
+// session. The children of the trigger derive from the session alone.
+func childTaskID(sessionID, parentTaskID, key string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(sessionID+"/"+parentTaskID+"/"+key)).String()
+}
+
+// join records the arrival of parentKey at the joining action dep. It
+// returns the context merged from every arrived branch once enough distinct
+// parents arrived, and false while the join is still waiting or was already
+// dispatched by another parent.
+func (w *Workflow) join(
+	ctx context.Context,
+	sessionID,
+	parentKey string,
+	dep WorkflowAction,
+	contextVal map[string]map[string]interface{},
+	edges []WorkflowActionDep,
+) (map[string]map[string]interface{}, bool, error) {
+
+	parents := map[string]struct{}{}
+
+	for _, edge := range edges {
+		if edge.DepKey == dep.Key {
+			parents[edge.Key] = struct{}{}
 		}
+	}
 
-		err = eg.Wait()
+	expiresAt, err := w.sessionContextExpiry(ctx, dep.TenantID, dep.WorkflowID, time.Now())
 
-		if err != nil {
-			return err
+	if err != nil {
+		return nil, false, err
+	}
+
+	state, err := w.storage.AddJoinArrival(ctx, &AddJoinArrivalRequest{
+		TenantID:   dep.TenantID,
+		WorkflowID: dep.WorkflowID,
+		SessionID:  sessionID,
+		Key:        dep.Key,
+		ParentKey:  parentKey,
+		Value:      contextVal,
+		ExpiresAt:  expiresAt,
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(state.Arrivals) < dep.Join.Threshold(len(parents)) {
+		return nil, false, nil
+	}
+
+	// the parent that claimed the join claims it again when its output is
+	// redelivered, to finish the dispatch
+	if state.Dispatched && state.DispatchedBy != parentKey {
+		return nil, false, nil
+	}
+
+	claimed, err := w.storage.ClaimJoin(ctx, dep.WorkflowID, sessionID, dep.Key, parentKey)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !claimed {
+		return nil, false, nil
+	}
+
+	joined := map[string]map[string]interface{}{}
+
+	for _, arrival := range state.Arrivals {
+		for k, v := range arrival.Value {
+			joined[k] = v
 		}
+	}
 
+	return joined, true, nil
+}
+
+// snapshotAction returns the action of key in snapshot. A message naming an
+// action its flow version does not have can never be processed.
+func snapshotAction(snapshot *FlowSnapshot, key string) (*WorkflowAction, error) {
+
+	action, ok := snapshot.Action(key)
+
+	if !ok {
+		err := fmt.Errorf("action %s not found in flow %s version %d", key, snapshot.WorkflowID, snapshot.Version)
+		slog.Error(err.Error())
+		return nil, PermanentError(err)
+	}
+
+	return action, nil
+}
+
+// stepDeadline returns when an attempt started now times out, or nil when
+// the action has no timeout.
+func stepDeadline(timeout Duration) *time.Time {
+
+	if timeout <= 0 {
 		return nil
+	}
+
+	deadlineAt := time.Now().Add(time.Duration(timeout))
+
+	return &deadlineAt
+}
+
+// runRunning reports whether a run is still running, so the steps of an
+// ended run are not followed anymore.
+func (w *Workflow) runRunning(ctx context.Context, workflowID, sessionID string) (bool, error) {
+
+	status, err := w.storage.GetRunStatus(ctx, workflowID, sessionID)
+
+	if err != nil {
+		slog.Error("GetRunStatus failed", slog.Any("error", err.Error()))
+		return false, err
+	}
+
+	return status == RunStatusRunning, nil
+}
+
+// completeRunIfIdle marks the run as succeeded once no step is running
+// anymore. It must be called after the step that ended is finished, its
+// children being recorded before.
+func (w *Workflow) completeRunIfIdle(ctx context.Context, workflowID, sessionID string) {
+
+	active, err := w.storage.CountActiveRunSteps(ctx, workflowID, sessionID)
+
+	if err != nil {
+		slog.Error("CountActiveRunSteps failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	if active > 0 {
+		return
+	}
+
+	endedAt := time.Now()
+
+	ok, err := w.storage.UpdateRunStatus(ctx, workflowID, sessionID, &UpdateRunStatusRequest{
+		From:    []RunStatus{RunStatusRunning},
+		To:      RunStatusSucceeded,
+		EndedAt: &endedAt,
 	})
 
-	return err
+	if err != nil {
+		slog.Error("UpdateRunStatus failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	if ok {
+		w.deleteSessionJoins(ctx, workflowID, sessionID)
+	}
+}
+
+func (w *Workflow) failRun(ctx context.Context, workflowID, sessionID string, cause error) {
+
+	endedAt := time.Now()
+
+	ok, err := w.storage.UpdateRunStatus(ctx, workflowID, sessionID, &UpdateRunStatusRequest{
+		From:    []RunStatus{RunStatusRunning},
+		To:      RunStatusFailed,
+		Error:   cause.Error(),
+		EndedAt: &endedAt,
+	})
+
+	if err != nil {
+		slog.Error("UpdateRunStatus failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	if ok {
+		w.deleteSessionJoins(ctx, workflowID, sessionID)
+	}
 }
 
 func (w *Workflow) Close(ctx context.Context) error {
@@ -346,6 +771,9 @@ func (w *Workflow) Close(ctx context.Context) error {
 
 func ex(env map[string]map[string]interface{}, mapping map[string]Mapper) (map[string]interface{}, error) {
 
+	// copy the env so concurrent dispatches never share the builtin entry
+	env = maps.Clone(env)
+
 	if env == nil {
 		env = map[string]map[string]interface{}{}
 	}
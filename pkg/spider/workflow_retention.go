@@ -0,0 +1,144 @@
+package spider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	flowRetentionCacheTTL   = time.Minute
+	maxCachedFlowRetentions = 1024
+)
+
+// flowRetentionCache keeps the retention of flows for a short while, so
+// dispatching a task does not read its flow every time. A retention edit
+// reaches new session contexts within flowRetentionCacheTTL.
+type flowRetentionCache struct {
+	mu         sync.Mutex
+	retentions map[string]cachedFlowRetention
+}
+
+type cachedFlowRetention struct {
+	retention Duration
+	cachedAt  time.Time
+}
+
+func newFlowRetentionCache() *flowRetentionCache {
+	return &flowRetentionCache{
+		retentions: map[string]cachedFlowRetention{},
+	}
+}
+
+func (c *flowRetentionCache) get(tenantID, workflowID string, now time.Time) (Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.retentions[flowRetentionCacheKey(tenantID, workflowID)]
+
+	if !ok || now.Sub(cached.cachedAt) > flowRetentionCacheTTL {
+		return 0, false
+	}
+
+	return cached.retention, true
+}
+
+func (c *flowRetentionCache) put(tenantID, workflowID string, retention Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.retentions) >= maxCachedFlowRetentions {
+		clear(c.retentions)
+	}
+
+	c.retentions[flowRetentionCacheKey(tenantID, workflowID)] = cachedFlowRetention{
+		retention: retention,
+		cachedAt:  now,
+	}
+}
+
+func flowRetentionCacheKey(tenantID, workflowID string) string {
+	return fmt.Sprintf("%s/%s", tenantID, workflowID)
+}
+
+// sessionContextExpiry returns when a session context of the flow written
+// at now expires, nil when the flow keeps contexts until their task is
+// done.
+func (w *Workflow) sessionContextExpiry(ctx context.Context, tenantID, workflowID string, now time.Time) (*time.Time, error) {
+
+	retention, ok := w.retentions.get(tenantID, workflowID, now)
+
+	if !ok {
+
+		flow, err := w.storage.GetFlow(ctx, tenantID, workflowID)
+
+		if err != nil {
+			slog.Error("GetFlow failed", slog.Any("error", err.Error()))
+			return nil, err
+		}
+
+		retention = flow.Retention
+
+		w.retentions.put(tenantID, workflowID, retention, now)
+	}
+
+	if retention <= 0 {
+		return nil, nil
+	}
+
+	expiresAt := now.Add(time.Duration(retention))
+
+	return &expiresAt, nil
+}
+
+// deleteSessionContext drops the context of a task once nothing reads it
+// anymore. A context left behind is removed by its retention.
+func (w *Workflow) deleteSessionContext(ctx context.Context, workflowID, sessionID, taskID string) {
+
+	err := w.storage.DeleteSessionContext(ctx, workflowID, sessionID, taskID)
+
+	if err != nil {
+		slog.Error("DeleteSessionContext failed", slog.Any("error", err.Error()))
+	}
+}
+
+// deleteSessionJoins drops the joins of a run once it ended, dispatched or
+// not, as nothing arrives at them anymore. Joins left behind are removed by
+// their retention.
+func (w *Workflow) deleteSessionJoins(ctx context.Context, workflowID, sessionID string) {
+
+	err := w.storage.DeleteSessionJoins(ctx, workflowID, sessionID)
+
+	if err != nil {
+		slog.Error("DeleteSessionJoins failed", slog.Any("error", err.Error()))
+	}
+}
+
+// expireSessionContexts deletes the session contexts and the joins that
+// outlived the retention of their flow.
+func (w *Workflow) expireSessionContexts(ctx context.Context) {
+
+	now := time.Now()
+
+	deleted, err := w.storage.DeleteExpiredSessionContexts(ctx, now, 1000)
+
+	if err != nil {
+		slog.Error("DeleteExpiredSessionContexts failed", slog.Any("error", err.Error()))
+	}
+
+	if deleted > 0 {
+		slog.Info("expired session contexts deleted", slog.Int64("count", deleted))
+	}
+
+	deleted, err = w.storage.DeleteExpiredJoins(ctx, now, 1000)
+
+	if err != nil {
+		slog.Error("DeleteExpiredJoins failed", slog.Any("error", err.Error()))
+	}
+
+	if deleted > 0 {
+		slog.Info("expired joins deleted", slog.Int64("count", deleted))
+	}
+}
@@ -0,0 +1,289 @@
+package spider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	schedulerInterval = time.Second
+	// retryLease is how long a claimed retry waits before it is claimed
+	// again, when the scheduler fails to dispatch or delete it.
+	retryLease = 30 * time.Second
+)
+
+// handleStepFailure either schedules another attempt of a failed step or,
+// once its retry policy is exhausted, fails the step and the run.
+func (w *Workflow) handleStepFailure(ctx context.Context, m OutputMessage, action *WorkflowAction) error {
+
+	attempt := max(m.Attempt, 1)
+
+	if action.Retry != nil && action.Retry.ShouldRetry(attempt, m.ErrorClass) {
+
+		step, err := w.storage.GetRunStep(ctx, m.WorkflowID, m.SessionID, m.TaskID)
+
+		if err != nil {
+			slog.Error("GetRunStep failed", slog.Any("error", err.Error()))
+			return err
+		}
+
+		// a late failure of an attempt that was already retried
+		if step.Attempt > attempt {
+			return nil
+		}
+
+		values, err := json.Marshal(step.Input)
+
+		if err != nil {
+			return err
+		}
+
+		// the step is claimed before its retry is scheduled, so a
+		// redelivered failure of the same attempt does not schedule another
+		claimed, err := w.storage.UpdateRunStepStatus(ctx, m.WorkflowID, m.SessionID, m.TaskID, &UpdateRunStepStatusRequest{
+			From:    []RunStepStatus{RunStepStatusRunning},
+			To:      RunStepStatusRetrying,
+			Attempt: attempt,
+			Error:   m.Error,
+		})
+
+		if err != nil {
+			slog.Error("UpdateRunStepStatus failed", slog.Any("error", err.Error()))
+			return err
+		}
+
+		if !claimed {
+			return nil
+		}
+
+		delay := action.Retry.Delay(attempt)
+
+		err = w.storage.ScheduleRetry(ctx, &ScheduledRetry{
+			TenantID:    m.TenantID,
+			WorkflowID:  m.WorkflowID,
+			SessionID:   m.SessionID,
+			TaskID:      m.TaskID,
+			Key:         step.Key,
+			ActionID:    step.ActionID,
+			Values:      string(values),
+			Attempt:     attempt + 1,
+			FlowVersion: m.FlowVersion,
+			Timeout:     action.Timeout,
+			DueAt:       time.Now().Add(delay),
+		})
+
+		if err != nil {
+			slog.Error("ScheduleRetry failed", slog.Any("error", err.Error()))
+
+			// released, the step is claimed again by the redelivered failure
+			_, uerr := w.storage.UpdateRunStepStatus(ctx, m.WorkflowID, m.SessionID, m.TaskID, &UpdateRunStepStatusRequest{
+				From: []RunStepStatus{RunStepStatusRetrying},
+				To:   RunStepStatusRunning,
+			})
+
+			if uerr != nil {
+				slog.Error("UpdateRunStepStatus failed", slog.Any("error", uerr.Error()))
+			}
+
+			return err
+		}
+
+		slog.Info(
+			"step retry scheduled",
+			slog.String("session_id", m.SessionID),
+			slog.String("task_id", m.TaskID),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+		)
+
+		return nil
+	}
+
+	finished, err := w.storage.FinishRunStep(ctx, m.WorkflowID, m.SessionID, m.TaskID, &FinishRunStepRequest{
+		Status:  RunStepStatusFailed,
+		Error:   m.Error,
+		EndedAt: time.Now(),
+	})
+
+	if err != nil {
+		slog.Error("FinishRunStep failed", slog.Any("error", err.Error()))
+		return err
+	}
+
+	if !finished {
+		return nil
+	}
+
+	w.deleteSessionContext(ctx, m.WorkflowID, m.SessionID, m.TaskID)
+
+	w.failRun(ctx, m.WorkflowID, m.SessionID, fmt.Errorf("step %s failed after %d attempt(s): %s", m.Key, attempt, m.Error))
+
+	return nil
+}
+
+func (w *Workflow) runScheduler(ctx context.Context) error {
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.dispatchDueRetries(ctx)
+			w.expireRunSteps(ctx)
+			w.expireRuns(ctx)
+			w.expireSessionContexts(ctx)
+		}
+	}
+}
+
+func (w *Workflow) dispatchDueRetries(ctx context.Context) {
+
+	retries, err := w.storage.ClaimDueRetries(ctx, time.Now(), retryLease, 100)
+
+	if err != nil {
+		slog.Error("ClaimDueRetries failed", slog.Any("error", err.Error()))
+	}
+
+	for _, retry := range retries {
+
+		running, err := w.runRunning(ctx, retry.WorkflowID, retry.SessionID)
+
+		// the retry is claimed again once its lease expires
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		// the run ended, or is gone, while the step waited for its retry
+		if !running {
+			w.cancelRetry(ctx, retry)
+			continue
+		}
+
+		dispatch, err := w.claimRetryStep(ctx, retry)
+
+		if err != nil {
+			continue
+		}
+
+		// the step was finished meanwhile, e.g. by a late output
+		if !dispatch {
+			w.deleteRetry(ctx, retry)
+			continue
+		}
+
+		err = w.messenger.SendInputMessage(ctx, InputMessage{
+			SessionID:   retry.SessionID,
+			TaskID:      retry.TaskID,
+			TenantID:    retry.TenantID,
+			WorkflowID:  retry.WorkflowID,
+			Key:         retry.Key,
+			ActionID:    retry.ActionID,
+			Values:      retry.Values,
+			Attempt:     retry.Attempt,
+			FlowVersion: retry.FlowVersion,
+		})
+
+		if err != nil {
+			slog.Error("sent input message failed", slog.Any("error", err.Error()))
+
+			// back to retrying until the lease expires, a step left running
+			// is claimed again by claimRetryStep
+			_, err := w.storage.UpdateRunStepStatus(ctx, retry.WorkflowID, retry.SessionID, retry.TaskID, &UpdateRunStepStatusRequest{
+				From:    []RunStepStatus{RunStepStatusRunning},
+				To:      RunStepStatusRetrying,
+				Attempt: retry.Attempt - 1,
+			})
+
+			if err != nil {
+				slog.Error("UpdateRunStepStatus failed", slog.Any("error", err.Error()))
+			}
+
+			continue
+		}
+
+		w.deleteRetry(ctx, retry)
+
+		slog.Info(
+			"step retried",
+			slog.String("session_id", retry.SessionID),
+			slog.String("task_id", retry.TaskID),
+			slog.Int("attempt", retry.Attempt),
+		)
+	}
+}
+
+// claimRetryStep moves the step of retry to running at the retried attempt.
+// It also reports true for a step an earlier lease of the retry claimed but
+// did not dispatch, which is still running at that attempt. A retry whose
+// input was sent but not deleted is sent twice, as a redelivery would be.
+func (w *Workflow) claimRetryStep(ctx context.Context, retry ScheduledRetry) (bool, error) {
+
+	claimed, err := w.storage.UpdateRunStepStatus(ctx, retry.WorkflowID, retry.SessionID, retry.TaskID, &UpdateRunStepStatusRequest{
+		From:       []RunStepStatus{RunStepStatusRetrying},
+		To:         RunStepStatusRunning,
+		Attempt:    retry.Attempt,
+		DeadlineAt: stepDeadline(retry.Timeout),
+	})
+
+	if err != nil {
+		slog.Error("UpdateRunStepStatus failed", slog.Any("error", err.Error()))
+		return false, err
+	}
+
+	if claimed {
+		return true, nil
+	}
+
+	step, err := w.storage.GetRunStep(ctx, retry.WorkflowID, retry.SessionID, retry.TaskID)
+
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		slog.Error("GetRunStep failed", slog.Any("error", err.Error()))
+		return false, err
+	}
+
+	return step.Status == RunStepStatusRunning && step.Attempt == retry.Attempt, nil
+}
+
+// cancelRetry cancels the step of a retry whose run ended and drops the
+// retry.
+func (w *Workflow) cancelRetry(ctx context.Context, retry ScheduledRetry) {
+
+	finished, err := w.storage.FinishRunStep(ctx, retry.WorkflowID, retry.SessionID, retry.TaskID, &FinishRunStepRequest{
+		Status:  RunStepStatusCancelled,
+		Error:   "run ended before the retry",
+		EndedAt: time.Now(),
+	})
+
+	if err != nil {
+		slog.Error("FinishRunStep failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	if finished {
+		w.deleteSessionContext(ctx, retry.WorkflowID, retry.SessionID, retry.TaskID)
+	}
+
+	w.deleteRetry(ctx, retry)
+}
+
+// deleteRetry drops a retry that needs no dispatch anymore. A retry that
+// could not be deleted is claimed again, and dropped then.
+func (w *Workflow) deleteRetry(ctx context.Context, retry ScheduledRetry) {
+
+	err := w.storage.DeleteRetry(ctx, retry.ID)
+
+	if err != nil {
+		slog.Error("DeleteRetry failed", slog.Any("error", err.Error()))
+	}
+}
@@ -0,0 +1,155 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const maxCachedFlowSnapshots = 1024
+
+// flowSnapshotCache keeps snapshots in memory. Snapshots never change, so
+// entries are only dropped to bound the cache.
+type flowSnapshotCache struct {
+	mu        sync.Mutex
+	snapshots map[string]*FlowSnapshot
+}
+
+func newFlowSnapshotCache() *flowSnapshotCache {
+	return &flowSnapshotCache{
+		snapshots: map[string]*FlowSnapshot{},
+	}
+}
+
+func (c *flowSnapshotCache) get(tenantID, workflowID string, version uint64) (*FlowSnapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot, ok := c.snapshots[flowSnapshotCacheKey(tenantID, workflowID, version)]
+
+	return snapshot, ok
+}
+
+func (c *flowSnapshotCache) put(snapshot *FlowSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.snapshots) >= maxCachedFlowSnapshots {
+		clear(c.snapshots)
+	}
+
+	c.snapshots[flowSnapshotCacheKey(snapshot.TenantID, snapshot.WorkflowID, snapshot.Version)] = snapshot
+}
+
+func flowSnapshotCacheKey(tenantID, workflowID string, version uint64) string {
+	return fmt.Sprintf("%s/%s/%d", tenantID, workflowID, version)
+}
+
+// flowSnapshot returns the graph a session pinned to version runs on.
+// Sessions started before versions were pinned carry version 0 and keep
+// following the current graph.
+func (w *Workflow) flowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error) {
+
+	if version == 0 {
+		return w.readFlowSnapshot(ctx, tenantID, workflowID, 0)
+	}
+
+	snapshot, ok := w.snapshots.get(tenantID, workflowID, version)
+
+	if ok {
+		return snapshot, nil
+	}
+
+	snapshot, err := w.storage.GetFlowSnapshot(ctx, tenantID, workflowID, version)
+
+	if err != nil {
+		slog.Error("GetFlowSnapshot failed", slog.Any("error", err.Error()))
+		return nil, err
+	}
+
+	w.snapshots.put(snapshot)
+
+	return snapshot, nil
+}
+
+// currentFlowSnapshot returns the snapshot of the current version of flow,
+// taking it first if no session started on that version yet.
+func (w *Workflow) currentFlowSnapshot(ctx context.Context, flow *Flow) (*FlowSnapshot, error) {
+
+	snapshot, err := w.flowSnapshot(ctx, flow.TenantID, flow.ID, flow.Version)
+
+	if err == nil {
+		return snapshot, nil
+	}
+
+	if !errors.Is(err, ErrFlowSnapshotNotFound) {
+		return nil, err
+	}
+
+	version := flow.Version
+
+	for range 3 {
+
+		snapshot, err = w.readFlowSnapshot(ctx, flow.TenantID, flow.ID, version)
+
+		if err != nil {
+			return nil, err
+		}
+
+		latest, err := w.storage.GetFlow(ctx, flow.TenantID, flow.ID)
+
+		if err != nil {
+			slog.Error("GetFlow failed", slog.Any("error", err.Error()))
+			return nil, err
+		}
+
+		// an edit landed while the graph was read, so it may mix versions
+		if latest.Version != version {
+			version = latest.Version
+			continue
+		}
+
+		err = w.storage.SaveFlowSnapshot(ctx, snapshot)
+
+		if err != nil {
+			slog.Error("SaveFlowSnapshot failed", slog.Any("error", err.Error()))
+			return nil, err
+		}
+
+		// another replica may have saved this version first, its snapshot
+		// is the one every session of the version runs on
+		return w.flowSnapshot(ctx, flow.TenantID, flow.ID, version)
+	}
+
+	return nil, fmt.Errorf("flow %s changed while taking its snapshot", flow.ID)
+}
+
+// readFlowSnapshot reads the current graph of a flow from storage.
+func (w *Workflow) readFlowSnapshot(ctx context.Context, tenantID, workflowID string, version uint64) (*FlowSnapshot, error) {
+
+	actions, err := w.storage.GetWorkflowActions(ctx, tenantID, workflowID)
+
+	if err != nil {
+		slog.Error("GetWorkflowActions failed", slog.Any("error", err.Error()))
+		return nil, err
+	}
+
+	deps, err := w.storage.GetWorkflowActionDeps(ctx, tenantID, workflowID)
+
+	if err != nil {
+		slog.Error("GetWorkflowActionDeps failed", slog.Any("error", err.Error()))
+		return nil, err
+	}
+
+	return &FlowSnapshot{
+		TenantID:   tenantID,
+		WorkflowID: workflowID,
+		Version:    version,
+		Actions:    actions,
+		Deps:       deps,
+		CreatedAt:  time.Now(),
+	}, nil
+}
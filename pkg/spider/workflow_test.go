@@ -0,0 +1,609 @@
+package spider_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/targc/spider-go/pkg/spider"
+	"github.com/targc/spider-go/pkg/spider/usecase"
+)
+
+const workflowTestTenantID = "tenant"
+
+// workflowEngine runs a workflow and its workers on the memory broker and
+// the memory storage.
+type workflowEngine struct {
+	t         *testing.T
+	ctx       context.Context
+	cancel    context.CancelFunc
+	broker    *spider.MemoryBroker
+	storage   *spider.MemoryWorkflowStorageAdapter
+	messenger *spider.MemoryWorkflowMessengerAdapter
+	usecase   *usecase.Usecase
+	workflow  *spider.Workflow
+}
+
+// workflowEngineOpt wraps the adapters the workflow runs on, e.g. to fail
+// some of their calls.
+type workflowEngineOpt struct {
+	storage   func(spider.WorkflowStorageAdapter) spider.WorkflowStorageAdapter
+	messenger func(spider.WorkflowMessengerAdapter) spider.WorkflowMessengerAdapter
+}
+
+func newWorkflowEngine(t *testing.T) *workflowEngine {
+	t.Helper()
+
+	return newWorkflowEngineOpt(t, workflowEngineOpt{})
+}
+
+func newWorkflowEngineOpt(t *testing.T, opt workflowEngineOpt) *workflowEngine {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	broker := spider.NewMemoryBroker(spider.MemoryBrokerOpt{
+		NakDelay: 10 * time.Millisecond,
+	})
+
+	storage := spider.NewMemoryWorkflowStorageAdapter()
+
+	messenger := spider.NewMemoryWorkflowMessengerAdapter(broker)
+
+	var (
+		workflowStorage   spider.WorkflowStorageAdapter   = storage
+		workflowMessenger spider.WorkflowMessengerAdapter = messenger
+	)
+
+	if opt.storage != nil {
+		workflowStorage = opt.storage(storage)
+	}
+
+	if opt.messenger != nil {
+		workflowMessenger = opt.messenger(messenger)
+	}
+
+	e := &workflowEngine{
+		t:         t,
+		ctx:       ctx,
+		cancel:    cancel,
+		broker:    broker,
+		storage:   storage,
+		messenger: messenger,
+		usecase:   usecase.NewUsecase(storage, messenger),
+		workflow:  spider.InitWorkflow(workflowMessenger, workflowStorage),
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := e.workflow.Run(ctx)
+
+		if err != nil {
+			t.Errorf("workflow: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return e
+}
+
+// work runs a worker of actionID, whose handler gets the input values.
+func (e *workflowEngine) work(actionID string, h func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error) {
+	e.t.Helper()
+
+	worker := spider.InitWorker(
+		spider.NewMemoryWorkerMessengerAdapter(e.broker, actionID),
+		spider.NewMemoryWorkerStorageAdapter(e.storage),
+		actionID,
+	)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := worker.Run(e.ctx, func(c spider.InputMessageContext, m spider.InputMessage) error {
+
+			input := map[string]interface{}{}
+
+			err := json.Unmarshal([]byte(m.Values), &input)
+
+			if err != nil {
+				return err
+			}
+
+			return h(c, m, input)
+		})
+
+		if err != nil {
+			e.t.Errorf("worker %s: %v", actionID, err)
+		}
+	}()
+
+	e.t.Cleanup(func() {
+		e.cancel()
+		<-done
+	})
+}
+
+// echo runs a worker of actionID that outputs its input down success.
+func (e *workflowEngine) echo(actionID string) {
+	e.work(actionID, func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error {
+		return sendOutput(c, "success", input)
+	})
+}
+
+// createFlow creates an active flow of actions and peers.
+func (e *workflowEngine) createFlow(name string, actions []usecase.WorkflowActionInput, peers []usecase.PeerInput) string {
+	e.t.Helper()
+
+	flow, err := e.usecase.CreateFlow(e.ctx, &usecase.CreateFlowRequest{
+		TenantID:    workflowTestTenantID,
+		Name:        name,
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Actions:     actions,
+		Peers:       peers,
+	})
+
+	if err != nil {
+		e.t.Fatalf("CreateFlow: %v", err)
+	}
+
+	_, err = e.usecase.UpdateFlow(e.ctx, &usecase.UpdateFlowRequest{
+		TenantID:    workflowTestTenantID,
+		FlowID:      flow.FlowID,
+		Name:        name,
+		TriggerType: spider.FlowTriggerTypeEvent,
+		Status:      spider.FlowStatusActive,
+	})
+
+	if err != nil {
+		e.t.Fatalf("UpdateFlow: %v", err)
+	}
+
+	return flow.FlowID
+}
+
+// trigger starts a run of flowID from its start action and returns the
+// session of the run.
+func (e *workflowEngine) trigger(flowID string, payload map[string]interface{}) string {
+	e.t.Helper()
+
+	values, err := json.Marshal(payload)
+
+	if err != nil {
+		e.t.Fatalf("Marshal: %v", err)
+	}
+
+	err = e.messenger.SendTriggerMessage(e.ctx, spider.TriggerMessage{
+		TenantID:   workflowTestTenantID,
+		WorkflowID: flowID,
+		Key:        "start",
+		ActionID:   "start",
+		MetaOutput: "success",
+		Values:     string(values),
+	})
+
+	if err != nil {
+		e.t.Fatalf("SendTriggerMessage: %v", err)
+	}
+
+	var sessionID string
+
+	waitFor(e.t, "the run", func() bool {
+
+		runs, err := e.storage.ListRuns(e.ctx, &spider.ListRunsRequest{
+			TenantID:   workflowTestTenantID,
+			WorkflowID: flowID,
+			Page:       1,
+			PageSize:   10,
+		})
+
+		if err != nil {
+			e.t.Fatalf("ListRuns: %v", err)
+		}
+
+		if len(runs.Runs) == 0 {
+			return false
+		}
+
+		sessionID = runs.Runs[0].SessionID
+
+		return true
+	})
+
+	return sessionID
+}
+
+// waitRun waits until the run of sessionID is no longer running.
+func (e *workflowEngine) waitRun(flowID, sessionID string) *spider.Run {
+	e.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for {
+
+		run, err := e.storage.GetRun(e.ctx, workflowTestTenantID, flowID, sessionID)
+
+		if err != nil && !errors.Is(err, spider.ErrNotFound) {
+			e.t.Fatalf("GetRun: %v", err)
+		}
+
+		if run != nil && run.Status != spider.RunStatusRunning {
+			return run
+		}
+
+		if time.Now().After(deadline) {
+			e.t.Fatalf("run %s still running: %#v", sessionID, run)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sendOutput(c spider.InputMessageContext, metaOutput string, values map[string]interface{}) error {
+
+	b, err := json.Marshal(values)
+
+	if err != nil {
+		return err
+	}
+
+	return c.SendOutput(metaOutput, string(b))
+}
+
+func expression(value string) spider.Mapper {
+	return spider.Mapper{
+		Mode:  spider.MapperModeExpression,
+		Value: value,
+	}
+}
+
+func runSteps(run *spider.Run) map[string]spider.RunStep {
+
+	steps := map[string]spider.RunStep{}
+
+	for _, step := range run.Steps {
+		steps[step.Key] = step
+	}
+
+	return steps
+}
+
+func stepKeys(steps map[string]spider.RunStep) []string {
+
+	keys := []string{}
+
+	for key := range steps {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestWorkflowRun(t *testing.T) {
+
+	e := newWorkflowEngine(t)
+
+	e.work("route", func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error {
+		return sendOutput(c, input["side"].(string), input)
+	})
+
+	e.work("flaky", func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error {
+
+		if m.Attempt == 1 {
+			return spider.TransientError(errors.New("flaky"))
+		}
+
+		return sendOutput(c, "success", map[string]interface{}{
+			"attempt": m.Attempt,
+		})
+	})
+
+	e.echo("echo")
+
+	flowID := e.createFlow(
+		"branches",
+		[]usecase.WorkflowActionInput{
+			{Key: "start", ActionID: "start"},
+			{
+				Key:      "route",
+				ActionID: "route",
+				Mapper: map[string]spider.Mapper{
+					"side":  expression("start.output.side"),
+					"value": expression("start.output.value"),
+				},
+			},
+			{
+				Key:      "left",
+				ActionID: "echo",
+				Mapper: map[string]spider.Mapper{
+					"value": expression(`route.output.value + "-left"`),
+				},
+			},
+			{
+				Key:      "right",
+				ActionID: "echo",
+				Mapper: map[string]spider.Mapper{
+					"value": expression(`route.output.value + "-right"`),
+				},
+			},
+			{
+				Key:      "flaky",
+				ActionID: "flaky",
+				Retry: &spider.RetryPolicy{
+					MaxAttempts:  3,
+					InitialDelay: spider.Duration(10 * time.Millisecond),
+				},
+			},
+			{
+				Key:      "join",
+				ActionID: "echo",
+				Mapper: map[string]spider.Mapper{
+					"left":    expression("left.output.value"),
+					"attempt": expression("flaky.output.attempt"),
+				},
+				Join: &spider.JoinPolicy{
+					Mode: spider.JoinModeAll,
+				},
+			},
+		},
+		[]usecase.PeerInput{
+			{ParentKey: "start", MetaOutput: "success", ChildKey: "route"},
+			{ParentKey: "route", MetaOutput: "left", ChildKey: "left"},
+			{ParentKey: "route", MetaOutput: "left", ChildKey: "flaky"},
+			{ParentKey: "route", MetaOutput: "right", ChildKey: "right"},
+			{ParentKey: "left", MetaOutput: "success", ChildKey: "join"},
+			{ParentKey: "flaky", MetaOutput: "success", ChildKey: "join"},
+		},
+	)
+
+	sessionID := e.trigger(flowID, map[string]interface{}{
+		"side":  "left",
+		"value": "hi",
+	})
+
+	run := e.waitRun(flowID, sessionID)
+
+	if run.Status != spider.RunStatusSucceeded {
+		t.Fatalf("run status %s, want %s: %s", run.Status, spider.RunStatusSucceeded, run.Error)
+	}
+
+	steps := runSteps(run)
+
+	// the right branch is not taken and the join runs once
+	if !reflect.DeepEqual(stepKeys(steps), []string{"flaky", "join", "left", "route"}) {
+		t.Fatalf("steps %v", stepKeys(steps))
+	}
+
+	for key, step := range steps {
+		if step.Status != spider.RunStepStatusSucceeded {
+			t.Errorf("step %s status %s, want %s", key, step.Status, spider.RunStepStatusSucceeded)
+		}
+	}
+
+	if steps["flaky"].Attempt != 2 {
+		t.Errorf("flaky attempt %d, want 2", steps["flaky"].Attempt)
+	}
+
+	wantInput := map[string]interface{}{
+		"left":    "hi-left",
+		"attempt": float64(2),
+	}
+
+	if !reflect.DeepEqual(steps["join"].Input, wantInput) {
+		t.Errorf("join input %#v, want %#v", steps["join"].Input, wantInput)
+	}
+
+	waitFor(t, "the join deleted once the run ended", func() bool {
+
+		usages, err := e.storage.ListSessionContextUsage(e.ctx)
+
+		if err != nil {
+			t.Fatalf("ListSessionContextUsage: %v", err)
+		}
+
+		for _, usage := range usages {
+			if usage.Joins > 0 {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// failingRetryStorage leases retries for a millisecond and fails the
+// revert of the first retried step whose input could not be sent.
+type failingRetryStorage struct {
+	spider.WorkflowStorageAdapter
+	reverts atomic.Int32
+}
+
+func (s *failingRetryStorage) ClaimDueRetries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]spider.ScheduledRetry, error) {
+	return s.WorkflowStorageAdapter.ClaimDueRetries(ctx, now, time.Millisecond, limit)
+}
+
+func (s *failingRetryStorage) UpdateRunStepStatus(ctx context.Context, workflowID, sessionID, taskID string, req *spider.UpdateRunStepStatusRequest) (bool, error) {
+
+	// the claim of a failed step records its error, the revert does not
+	if req.To == spider.RunStepStatusRetrying && req.Error == "" && s.reverts.Add(1) == 1 {
+		return false, errors.New("storage down")
+	}
+
+	return s.WorkflowStorageAdapter.UpdateRunStepStatus(ctx, workflowID, sessionID, taskID, req)
+}
+
+// failingRetryMessenger fails to send the first retried input.
+type failingRetryMessenger struct {
+	spider.WorkflowMessengerAdapter
+	sends atomic.Int32
+}
+
+func (m *failingRetryMessenger) SendInputMessage(ctx context.Context, message spider.InputMessage) error {
+
+	if message.Attempt > 1 && m.sends.Add(1) == 1 {
+		return errors.New("broker down")
+	}
+
+	return m.WorkflowMessengerAdapter.SendInputMessage(ctx, message)
+}
+
+func TestWorkflowRetryDispatchFailure(t *testing.T) {
+
+	storage := &failingRetryStorage{}
+	messenger := &failingRetryMessenger{}
+
+	e := newWorkflowEngineOpt(t, workflowEngineOpt{
+		storage: func(s spider.WorkflowStorageAdapter) spider.WorkflowStorageAdapter {
+			storage.WorkflowStorageAdapter = s
+			return storage
+		},
+		messenger: func(m spider.WorkflowMessengerAdapter) spider.WorkflowMessengerAdapter {
+			messenger.WorkflowMessengerAdapter = m
+			return messenger
+		},
+	})
+
+	e.work("flaky", func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error {
+
+		if m.Attempt == 1 {
+			return spider.TransientError(errors.New("flaky"))
+		}
+
+		return sendOutput(c, "success", map[string]interface{}{
+			"attempt": m.Attempt,
+		})
+	})
+
+	flowID := e.createFlow(
+		"retry",
+		[]usecase.WorkflowActionInput{
+			{Key: "start", ActionID: "start"},
+			{
+				Key:      "flaky",
+				ActionID: "flaky",
+				Retry: &spider.RetryPolicy{
+					MaxAttempts:  3,
+					InitialDelay: spider.Duration(10 * time.Millisecond),
+				},
+			},
+		},
+		[]usecase.PeerInput{
+			{ParentKey: "start", MetaOutput: "success", ChildKey: "flaky"},
+		},
+	)
+
+	sessionID := e.trigger(flowID, map[string]interface{}{})
+
+	run := e.waitRun(flowID, sessionID)
+
+	if run.Status != spider.RunStatusSucceeded {
+		t.Fatalf("run status %s, want %s: %s", run.Status, spider.RunStatusSucceeded, run.Error)
+	}
+
+	// the step left running by the failed revert is sent again once the
+	// lease of its retry expires
+	if messenger.sends.Load() < 2 || storage.reverts.Load() < 1 {
+		t.Fatalf("%d retried sends and %d reverts, want a failed send and a failed revert", messenger.sends.Load(), storage.reverts.Load())
+	}
+
+	if steps := runSteps(run); steps["flaky"].Attempt != 2 {
+		t.Errorf("flaky attempt %d, want 2", steps["flaky"].Attempt)
+	}
+}
+
+func TestWorkflowCancelRun(t *testing.T) {
+
+	e := newWorkflowEngine(t)
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+
+	e.work("slow", func(c spider.InputMessageContext, m spider.InputMessage, input map[string]interface{}) error {
+
+		close(started)
+
+		<-c.Context.Done()
+
+		err := context.Cause(c.Context)
+
+		stopped <- err
+
+		return err
+	})
+
+	e.echo("echo")
+
+	flowID := e.createFlow(
+		"cancel",
+		[]usecase.WorkflowActionInput{
+			{Key: "start", ActionID: "start"},
+			{Key: "first", ActionID: "echo"},
+			{Key: "slow", ActionID: "slow"},
+			{Key: "after", ActionID: "echo"},
+		},
+		[]usecase.PeerInput{
+			{ParentKey: "start", MetaOutput: "success", ChildKey: "first"},
+			{ParentKey: "first", MetaOutput: "success", ChildKey: "slow"},
+			{ParentKey: "slow", MetaOutput: "success", ChildKey: "after"},
+		},
+	)
+
+	sessionID := e.trigger(flowID, map[string]interface{}{})
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow step not started")
+	}
+
+	_, err := e.usecase.CancelRun(e.ctx, workflowTestTenantID, flowID, sessionID)
+
+	if err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, spider.ErrRunCancelled) {
+			t.Errorf("handler stopped with %v, want %v", err, spider.ErrRunCancelled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow handler not cancelled")
+	}
+
+	run := e.waitRun(flowID, sessionID)
+
+	if run.Status != spider.RunStatusCancelled {
+		t.Fatalf("run status %s, want %s", run.Status, spider.RunStatusCancelled)
+	}
+
+	steps := runSteps(run)
+
+	if !reflect.DeepEqual(stepKeys(steps), []string{"first", "slow"}) {
+		t.Fatalf("steps %v", stepKeys(steps))
+	}
+
+	if steps["first"].Status != spider.RunStepStatusSucceeded {
+		t.Errorf("first status %s, want %s", steps["first"].Status, spider.RunStepStatusSucceeded)
+	}
+
+	if steps["slow"].Status != spider.RunStepStatusCancelled {
+		t.Errorf("slow status %s, want %s", steps["slow"].Status, spider.RunStepStatusCancelled)
+	}
+}
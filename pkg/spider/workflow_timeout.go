@@ -0,0 +1,191 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// MetaOutputTimeout is the meta output a timed out step routes down. When
+// the action has no dependency on it, a timeout fails the run instead.
+const MetaOutputTimeout = "timeout"
+
+func (w *Workflow) expireRunSteps(ctx context.Context) {
+
+	steps, err := w.storage.ListExpiredRunSteps(ctx, time.Now(), 100)
+
+	if err != nil {
+		slog.Error("ListExpiredRunSteps failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	for _, step := range steps {
+
+		err := w.timeoutRunStep(ctx, step)
+
+		if err != nil {
+			w.failRun(ctx, step.WorkflowID, step.SessionID, err)
+		}
+	}
+}
+
+// timeoutRunStep finishes a step whose worker never answered in time and
+// either routes the session down the step's timeout meta output or fails
+// the run.
+func (w *Workflow) timeoutRunStep(ctx context.Context, step RunStep) error {
+
+	cause := fmt.Errorf("step %s timed out on attempt %d", step.Key, step.Attempt)
+
+	snapshot, err := w.flowSnapshot(ctx, step.TenantID, step.WorkflowID, step.FlowVersion)
+
+	if err != nil {
+		return err
+	}
+
+	workflowAction, err := snapshotAction(snapshot, step.Key)
+
+	if err != nil {
+		return err
+	}
+
+	var deps []WorkflowAction
+
+	if !workflowAction.Disabled {
+		deps = snapshot.Dependencies(step.Key, MetaOutputTimeout)
+	}
+
+	// the children are recorded before the step finishes, so the run is
+	// never seen idle in between
+	if len(deps) > 0 {
+
+		wcontext, err := w.storage.GetSessionContext(ctx, step.WorkflowID, step.SessionID, step.TaskID)
+
+		if err != nil {
+			slog.Error("GetSessionContext failed", slog.Any("error", err.Error()))
+			return err
+		}
+
+		nextContextVal := wcontext
+		nextContextVal[step.Key] = map[string]interface{}{
+			"output": map[string]interface{}{},
+			"error":  cause.Error(),
+		}
+
+		err = w.dispatch(ctx, snapshot, step.SessionID, step.TaskID, step.Key, nextContextVal, deps)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// a late output of the worker is ignored once the step is finished
+	finished, err := w.storage.FinishRunStep(ctx, step.WorkflowID, step.SessionID, step.TaskID, &FinishRunStepRequest{
+		Status:     RunStepStatusTimedOut,
+		MetaOutput: MetaOutputTimeout,
+		Output:     map[string]interface{}{},
+		Error:      cause.Error(),
+		EndedAt:    time.Now(),
+	})
+
+	if err != nil {
+		slog.Error("FinishRunStep failed", slog.Any("error", err.Error()))
+		return err
+	}
+
+	if !finished {
+		return nil
+	}
+
+	slog.Warn(
+		"step timed out",
+		slog.String("session_id", step.SessionID),
+		slog.String("task_id", step.TaskID),
+		slog.Int("attempt", step.Attempt),
+	)
+
+	w.deleteSessionContext(ctx, step.WorkflowID, step.SessionID, step.TaskID)
+
+	if !workflowAction.Disabled && len(deps) == 0 {
+		return cause
+	}
+
+	w.completeRunIfIdle(ctx, step.WorkflowID, step.SessionID)
+
+	return nil
+}
+
+func (w *Workflow) expireRuns(ctx context.Context) {
+
+	runs, err := w.storage.ListExpiredRuns(ctx, time.Now(), 100)
+
+	if err != nil {
+		slog.Error("ListExpiredRuns failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	for _, run := range runs {
+		w.timeoutRun(ctx, run)
+	}
+}
+
+// timeoutRun ends a run that outlived its flow deadline. Its active steps
+// are finished too, so late outputs and pending retries go nowhere.
+func (w *Workflow) timeoutRun(ctx context.Context, run Run) {
+
+	cause := errors.New("run exceeded the flow deadline")
+
+	endedAt := time.Now()
+
+	ok, err := w.storage.UpdateRunStatus(ctx, run.WorkflowID, run.SessionID, &UpdateRunStatusRequest{
+		From:    []RunStatus{RunStatusRunning},
+		To:      RunStatusTimedOut,
+		Error:   cause.Error(),
+		EndedAt: &endedAt,
+	})
+
+	if err != nil {
+		slog.Error("UpdateRunStatus failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	w.deleteSessionJoins(ctx, run.WorkflowID, run.SessionID)
+
+	slog.Warn(
+		"run timed out",
+		slog.String("workflow_id", run.WorkflowID),
+		slog.String("session_id", run.SessionID),
+	)
+
+	fullRun, err := w.storage.GetRun(ctx, run.TenantID, run.WorkflowID, run.SessionID)
+
+	if err != nil {
+		slog.Error("GetRun failed", slog.Any("error", err.Error()))
+		return
+	}
+
+	for _, step := range fullRun.Steps {
+
+		finished, err := w.storage.FinishRunStep(ctx, step.WorkflowID, step.SessionID, step.TaskID, &FinishRunStepRequest{
+			Status:  RunStepStatusTimedOut,
+			Error:   cause.Error(),
+			EndedAt: endedAt,
+		})
+
+		if err != nil {
+			slog.Error("FinishRunStep failed", slog.Any("error", err.Error()))
+			continue
+		}
+
+		if !finished {
+			continue
+		}
+
+		w.deleteSessionContext(ctx, step.WorkflowID, step.SessionID, step.TaskID)
+	}
+}